@@ -39,6 +39,10 @@ var (
 	errEventSignatureMismatch = errors.New("event signature mismatch")
 )
 
+// ErrUnknownEvent is returned by the generated log decoders for logs which don't
+// match any event of the contract.
+var ErrUnknownEvent = errors.New("unknown event signature")
+
 // SignerFn is a signer function callback when a contract requires a method to
 // sign the transaction before submission.
 type SignerFn func(common.Address, *types.Transaction) (*types.Transaction, error)
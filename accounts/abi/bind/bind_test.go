@@ -2039,6 +2039,95 @@ var bindTests = []struct {
 			}
 		`,
 	},
+	// Test that custom errors, the log decoder and the multicall builder are generated.
+	// The contract reverts every call with the Unauthorized error.
+	{
+		name:     "CustomErrors",
+		bytecode: []string{"0x6010600c60003960106000f36382b4290060e01b60005260046000fd"},
+		abi: []string{`[
+			{"inputs":[{"name":"who","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+			{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Deposit","type":"event"},
+			{"inputs":[{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}],"name":"InsufficientBalance","type":"error"},
+			{"inputs":[],"name":"Unauthorized","type":"error"}
+		]`},
+		imports: `
+			"errors"
+			"math/big"
+
+			"github.com/rethereum-blockchain/go-rethereum/accounts/abi/bind"
+			"github.com/rethereum-blockchain/go-rethereum/accounts/abi/bind/backends"
+			"github.com/rethereum-blockchain/go-rethereum/common"
+			"github.com/rethereum-blockchain/go-rethereum/core"
+			"github.com/rethereum-blockchain/go-rethereum/core/types"
+			"github.com/rethereum-blockchain/go-rethereum/crypto"
+			"github.com/rethereum-blockchain/go-rethereum/eth/ethconfig"
+		`,
+		tester: `
+			var (
+				key, _  = crypto.GenerateKey()
+				user, _ = bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+				sim     = backends.NewSimulatedBackend(core.GenesisAlloc{user.From: {Balance: big.NewInt(1000000000000000000)}}, ethconfig.Defaults.Miner.GasCeil)
+			)
+			defer sim.Close()
+
+			addr, _, contract, err := DeployCustomErrors(user, sim)
+			if err != nil {
+				t.Fatalf("Failed to deploy contract: %v", err)
+			}
+			sim.Commit()
+
+			// Reverted calls are converted into the custom error
+			_, err = contract.BalanceOf(nil, user.From)
+			if _, ok := UnpackCustomErrorsError(err).(*CustomErrorsUnauthorizedError); !ok {
+				t.Fatalf("Failed to unpack custom error: %v", err)
+			}
+			other := errors.New("other")
+			if err := UnpackCustomErrorsError(other); err != other {
+				t.Fatalf("Unrelated error changed: %v", err)
+			}
+			parsed, _ := CustomErrorsMetaData.GetAbi()
+			custom := parsed.Errors["InsufficientBalance"]
+			data, _ := custom.Inputs.Pack(big.NewInt(1), big.NewInt(2))
+			insufficient, err := UnpackCustomErrorsInsufficientBalanceError(append(custom.ID[:4:4], data...))
+			if err != nil {
+				t.Fatalf("Failed to unpack custom error: %v", err)
+			}
+			if insufficient.Available.Cmp(big.NewInt(1)) != 0 || insufficient.Required.Cmp(big.NewInt(2)) != 0 {
+				t.Fatalf("Custom error mismatch: %v", insufficient)
+			}
+			if _, err := UnpackCustomErrorsUnauthorizedError(append(custom.ID[:4:4], data...)); err == nil {
+				t.Fatalf("Unpacked mismatching custom error")
+			}
+
+			// Logs are decoded into the event they match
+			data, _ = parsed.Events["Deposit"].Inputs.NonIndexed().Pack(big.NewInt(3))
+			log := types.Log{Address: addr, Topics: []common.Hash{parsed.Events["Deposit"].ID, common.BytesToHash(user.From.Bytes())}, Data: data}
+			decoded, err := DecodeCustomErrorsLog(log)
+			if err != nil {
+				t.Fatalf("Failed to decode log: %v", err)
+			}
+			if deposit, ok := decoded.(*CustomErrorsDeposit); !ok || deposit.From != user.From || deposit.Value.Cmp(big.NewInt(3)) != 0 {
+				t.Fatalf("Decoded log mismatch: %v", decoded)
+			}
+			if _, err := DecodeCustomErrorsLog(types.Log{Topics: []common.Hash{{}}}); err != bind.ErrUnknownEvent {
+				t.Fatalf("Unknown log decoded: %v", err)
+			}
+
+			// Calls added to a multicall return their results once executed
+			batch := bind.NewMulticall()
+			multicall, err := NewCustomErrorsMulticall(addr, batch)
+			if err != nil {
+				t.Fatalf("Failed to create multicall binding: %v", err)
+			}
+			balance := multicall.BalanceOf(user.From)
+			if _, err := balance(); err != bind.ErrMulticallPending {
+				t.Fatalf("Result available before execution: %v", err)
+			}
+			if batch.Len() != 1 {
+				t.Fatalf("Call not added to batch")
+			}
+		`,
+	},
 }
 
 // Tests that packages generated by the binder can be successfully compiled and
@@ -2115,3 +2204,15 @@ func TestGolangBindings(t *testing.T) {
 		t.Fatalf("failed to run binding test: %v\n%s", err, out)
 	}
 }
+
+// Tests that an event colliding with the multicall binding is rejected.
+func TestBindMulticallCollision(t *testing.T) {
+	abi := `[{"inputs":[],"name":"get","outputs":[{"type":"uint256"}],"stateMutability":"view","type":"function"},{"anonymous":false,"inputs":[],"name":"Multicall","type":"event"}]`
+	if _, err := Bind([]string{"Test"}, []string{abi}, []string{""}, nil, "bindtest", LangGo, nil, nil); err == nil {
+		t.Fatal("colliding multicall event accepted")
+	}
+	aliases := map[string]string{"Multicall": "MulticallEvent"}
+	if _, err := Bind([]string{"Test"}, []string{abi}, []string{""}, nil, "bindtest", LangGo, nil, aliases); err != nil {
+		t.Fatalf("aliased multicall event rejected: %v", err)
+	}
+}
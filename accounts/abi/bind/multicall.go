@@ -0,0 +1,261 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rethereum-blockchain/go-rethereum"
+	"github.com/rethereum-blockchain/go-rethereum/accounts/abi"
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/common/hexutil"
+	"github.com/rethereum-blockchain/go-rethereum/rpc"
+)
+
+// Multicall3Address is the address of the Multicall3 contract, which is deployed
+// at the same address on most chains.
+var Multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// ErrMulticallPending is returned when unpacking the result of a call whose batch
+// has not been executed yet.
+var ErrMulticallPending = errors.New("multicall batch not executed")
+
+// multicall3MetaData contains the ABI of the aggregate3 method of Multicall3.
+var multicall3MetaData = &MetaData{
+	ABI: `[{"inputs":[{"components":[{"internalType":"address","name":"target","type":"address"},{"internalType":"bool","name":"allowFailure","type":"bool"},{"internalType":"bytes","name":"callData","type":"bytes"}],"internalType":"struct Multicall3.Call3[]","name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"internalType":"bool","name":"success","type":"bool"},{"internalType":"bytes","name":"returnData","type":"bytes"}],"internalType":"struct Multicall3.Result[]","name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`,
+}
+
+// multicall3Call is the Call3 struct of Multicall3.
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// multicall3Result is the Result struct of Multicall3.
+type multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// BatchCaller is the interface required to execute a multicall as a JSON-RPC
+// batch. It is implemented by rpc.Client.
+type BatchCaller interface {
+	BatchCallContext(ctx context.Context, b []rpc.BatchElem) error
+}
+
+// Multicall collects calls to view methods of any number of contracts, which are
+// then executed in a single request. Calls are added either through Add, or
+// through the typed multicall bindings generated by abigen.
+type Multicall struct {
+	calls []*MulticallResult
+}
+
+// MulticallResult is the result of a call added to a Multicall. It is available
+// once the batch has been executed.
+type MulticallResult struct {
+	contract *BoundContract
+	method   string
+	input    []byte
+
+	done   bool
+	output []byte
+	err    error
+}
+
+// NewMulticall creates an empty multicall batch.
+func NewMulticall() *Multicall {
+	return new(Multicall)
+}
+
+// Add adds a call of the given contract method to the batch. Only the address
+// and ABI of the contract are used, the backend it is bound to is ignored.
+func (m *Multicall) Add(contract *BoundContract, method string, params ...interface{}) *MulticallResult {
+	res := &MulticallResult{contract: contract, method: method}
+	res.input, res.err = contract.abi.Pack(method, params...)
+	if res.err != nil {
+		// The call can't be made, fail it right away.
+		res.done = true
+		return res
+	}
+	m.calls = append(m.calls, res)
+	return res
+}
+
+// Len returns the number of calls in the batch.
+func (m *Multicall) Len() int {
+	return len(m.calls)
+}
+
+// Execute runs all calls of the batch in a single eth_call of the aggregate3
+// method of the Multicall3 contract deployed at the given address. Calls which
+// revert don't fail the batch, their revert error is returned by the result
+// instead. The returned error is only non-nil if the batch couldn't be executed.
+func (m *Multicall) Execute(opts *CallOpts, caller ContractCaller, multicall common.Address) error {
+	if len(m.calls) == 0 {
+		return nil
+	}
+	parsed, err := multicall3MetaData.GetAbi()
+	if err != nil {
+		return err
+	}
+	calls := make([]multicall3Call, len(m.calls))
+	for i, call := range m.calls {
+		calls[i] = multicall3Call{Target: call.contract.address, AllowFailure: true, CallData: call.input}
+	}
+	contract := NewBoundContract(multicall, *parsed, caller, nil, nil)
+
+	var out []interface{}
+	if err := contract.Call(opts, &out, "aggregate3", calls); err != nil {
+		return err
+	}
+	results := *abi.ConvertType(out[0], new([]multicall3Result)).(*[]multicall3Result)
+	if len(results) != len(m.calls) {
+		return errors.New("multicall result count mismatch")
+	}
+	for i, call := range m.calls {
+		call.done = true
+		if results[i].Success {
+			call.output = results[i].ReturnData
+		} else {
+			call.err = newRevertError(results[i].ReturnData)
+		}
+	}
+	return nil
+}
+
+// ExecuteBatch runs all calls of the batch as a single JSON-RPC batch of eth_call
+// requests. Unlike Execute, it doesn't need the Multicall3 contract to be deployed.
+// The errors of the individual calls are returned by the results, the returned
+// error is only non-nil if the batch couldn't be sent.
+func (m *Multicall) ExecuteBatch(opts *CallOpts, client BatchCaller) error {
+	if len(m.calls) == 0 {
+		return nil
+	}
+	// Don't crash on a lazy user
+	if opts == nil {
+		opts = new(CallOpts)
+	}
+	block := "latest"
+	if opts.Pending {
+		block = "pending"
+	} else if opts.BlockNumber != nil {
+		block = hexutil.EncodeBig(opts.BlockNumber)
+	}
+	var (
+		reqs    = make([]rpc.BatchElem, len(m.calls))
+		outputs = make([]hexutil.Bytes, len(m.calls))
+	)
+	for i, call := range m.calls {
+		msg := ethereum.CallMsg{From: opts.From, To: &call.contract.address, Data: call.input}
+		reqs[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args:   []interface{}{toCallArg(msg), block},
+			Result: &outputs[i],
+		}
+	}
+	if err := client.BatchCallContext(ensureContext(opts.Context), reqs); err != nil {
+		return err
+	}
+	for i, call := range m.calls {
+		call.done = true
+		call.output, call.err = outputs[i], reqs[i].Error
+	}
+	return nil
+}
+
+// Unpack returns the output values of the call. It fails with ErrMulticallPending
+// if the batch has not been executed yet.
+func (r *MulticallResult) Unpack() ([]interface{}, error) {
+	if !r.done {
+		return nil, ErrMulticallPending
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	// Calls of accounts without code succeed, but don't return anything.
+	if len(r.output) == 0 && len(r.contract.abi.Methods[r.method].Outputs) > 0 {
+		return nil, ErrNoCode
+	}
+	return r.contract.abi.Unpack(r.method, r.output)
+}
+
+// Err returns the error of the call, or ErrMulticallPending if the batch has not
+// been executed yet.
+func (r *MulticallResult) Err() error {
+	if !r.done {
+		return ErrMulticallPending
+	}
+	return r.err
+}
+
+// revertError is the error of a reverted call, carrying the revert data like the
+// errors returned by the RPC client.
+type revertError struct {
+	reason string
+	data   []byte
+}
+
+func newRevertError(data []byte) *revertError {
+	reason, err := abi.UnpackRevert(data)
+	if err != nil {
+		reason = ""
+	}
+	return &revertError{reason: reason, data: data}
+}
+
+// Error implements error.
+func (e *revertError) Error() string {
+	if e.reason == "" {
+		return "execution reverted"
+	}
+	return "execution reverted: " + e.reason
+}
+
+// ErrorData returns the hex encoded revert data, implementing rpc.DataError.
+func (e *revertError) ErrorData() interface{} {
+	return hexutil.Encode(e.data)
+}
+
+// RevertData extracts the data of a reverted call from the error returned by the
+// backend, which can then be decoded with the Unpack*Error functions of the
+// generated bindings.
+func RevertData(err error) ([]byte, bool) {
+	var de rpc.DataError
+	if !errors.As(err, &de) {
+		return nil, false
+	}
+	switch data := de.ErrorData().(type) {
+	case string:
+		b, err := hexutil.Decode(data)
+		return b, err == nil
+	case []byte:
+		return data, true
+	case hexutil.Bytes:
+		return data, true
+	}
+	return nil, false
+}
+
+func toCallArg(msg ethereum.CallMsg) interface{} {
+	return map[string]interface{}{
+		"from": msg.From,
+		"to":   msg.To,
+		"data": hexutil.Bytes(msg.Data),
+	}
+}
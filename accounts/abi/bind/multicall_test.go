@@ -0,0 +1,224 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/rethereum-blockchain/go-rethereum"
+	"github.com/rethereum-blockchain/go-rethereum/accounts/abi"
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/common/hexutil"
+	"github.com/rethereum-blockchain/go-rethereum/rpc"
+)
+
+const multicallTestABI = `[
+	{"inputs":[{"name":"who","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+	{"inputs":[],"name":"Unauthorized","type":"error"}
+]`
+
+var (
+	unauthorizedData = common.FromHex("0x82b42900")
+	revertReasonData = common.FromHex("0x08c379a0000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000046e6f706500000000000000000000000000000000000000000000000000000000")
+)
+
+func newMulticallTestContract(t *testing.T, address common.Address) *BoundContract {
+	parsed, err := abi.JSON(strings.NewReader(multicallTestABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewBoundContract(address, parsed, nil, nil, nil)
+}
+
+// multicall3Caller emulates the aggregate3 method of Multicall3. Calls to accounts
+// in balances return the balance, all others revert with the configured data.
+type multicall3Caller struct {
+	balances map[common.Address]int64
+	reverts  map[common.Address][]byte
+	calls    int
+}
+
+func (c *multicall3Caller) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func (c *multicall3Caller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.calls++
+	parsed, _ := multicall3MetaData.GetAbi()
+	method := parsed.Methods["aggregate3"]
+	if *call.To != Multicall3Address || !bytes.Equal(call.Data[:4], method.ID) {
+		return nil, errors.New("not a multicall")
+	}
+	args, err := method.Inputs.Unpack(call.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	var (
+		calls   = *abi.ConvertType(args[0], new([]multicall3Call)).(*[]multicall3Call)
+		results = make([]multicall3Result, len(calls))
+	)
+	for i, call := range calls {
+		if balance, ok := c.balances[common.BytesToAddress(call.CallData[16:36])]; ok {
+			results[i].Success = true
+			results[i].ReturnData = common.LeftPadBytes(big.NewInt(balance).Bytes(), 32)
+		} else {
+			results[i].ReturnData = c.reverts[call.Target]
+		}
+	}
+	return method.Outputs.Pack(results)
+}
+
+// batchCaller emulates eth_call batches, reverting all calls to accounts
+// without balance.
+type batchCaller struct {
+	balances map[common.Address]int64
+	block    interface{}
+}
+
+type dataError struct {
+	data string
+}
+
+func (e *dataError) Error() string          { return "execution reverted" }
+func (e *dataError) ErrorData() interface{} { return e.data }
+
+func (c *batchCaller) BatchCallContext(ctx context.Context, reqs []rpc.BatchElem) error {
+	for i := range reqs {
+		req := &reqs[i]
+		if req.Method != "eth_call" {
+			return errors.New("unexpected method " + req.Method)
+		}
+		c.block = req.Args[1]
+		data := req.Args[0].(map[string]interface{})["data"].(hexutil.Bytes)
+		if balance, ok := c.balances[common.BytesToAddress(data[16:36])]; ok {
+			*req.Result.(*hexutil.Bytes) = common.LeftPadBytes(big.NewInt(balance).Bytes(), 32)
+		} else {
+			req.Error = &dataError{hexutil.Encode(unauthorizedData)}
+		}
+	}
+	return nil
+}
+
+func TestMulticallExecute(t *testing.T) {
+	var (
+		alice  = common.Address{0xa}
+		bob    = common.Address{0xb}
+		token  = newMulticallTestContract(t, common.Address{1})
+		locked = newMulticallTestContract(t, common.Address{2})
+		caller = &multicall3Caller{
+			balances: map[common.Address]int64{alice: 10, bob: 20},
+			reverts:  map[common.Address][]byte{locked.address: revertReasonData},
+		}
+		batch = NewMulticall()
+	)
+	aliceRes := batch.Add(token, "balanceOf", alice)
+	bobRes := batch.Add(token, "balanceOf", bob)
+	lockedRes := batch.Add(locked, "balanceOf", common.Address{0xc})
+	invalidRes := batch.Add(token, "balanceOf", "not an address")
+
+	if batch.Len() != 3 {
+		t.Fatalf("wrong number of calls in batch: %d", batch.Len())
+	}
+	if _, err := aliceRes.Unpack(); err != ErrMulticallPending {
+		t.Fatalf("wrong error before execution: %v", err)
+	}
+	if err := invalidRes.Err(); err == nil {
+		t.Fatal("no error for call with invalid arguments")
+	}
+	if err := batch.Execute(nil, caller, Multicall3Address); err != nil {
+		t.Fatal(err)
+	}
+	if caller.calls != 1 {
+		t.Fatalf("batch executed in %d calls", caller.calls)
+	}
+	for res, want := range map[*MulticallResult]int64{aliceRes: 10, bobRes: 20} {
+		out, err := res.Unpack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance := out[0].(*big.Int); balance.Int64() != want {
+			t.Errorf("wrong balance %v, want %d", balance, want)
+		}
+	}
+	err := lockedRes.Err()
+	if err == nil || err.Error() != "execution reverted: nope" {
+		t.Fatalf("wrong error for reverted call: %v", err)
+	}
+	if data, ok := RevertData(err); !ok || !bytes.Equal(data, revertReasonData) {
+		t.Fatalf("wrong revert data %x", data)
+	}
+}
+
+func TestMulticallExecuteBatch(t *testing.T) {
+	var (
+		alice  = common.Address{0xa}
+		token  = newMulticallTestContract(t, common.Address{1})
+		caller = &batchCaller{balances: map[common.Address]int64{alice: 10}}
+		batch  = NewMulticall()
+	)
+	aliceRes := batch.Add(token, "balanceOf", alice)
+	bobRes := batch.Add(token, "balanceOf", common.Address{0xb})
+
+	if err := batch.ExecuteBatch(&CallOpts{BlockNumber: big.NewInt(16)}, caller); err != nil {
+		t.Fatal(err)
+	}
+	if caller.block != "0x10" {
+		t.Errorf("wrong block argument %v", caller.block)
+	}
+	out, err := aliceRes.Unpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance := out[0].(*big.Int); balance.Int64() != 10 {
+		t.Errorf("wrong balance %v", balance)
+	}
+	if _, err := bobRes.Unpack(); err == nil {
+		t.Fatal("no error for reverted call")
+	}
+	data, ok := RevertData(bobRes.Err())
+	if !ok || !bytes.Equal(data, unauthorizedData) {
+		t.Fatalf("wrong revert data %x", data)
+	}
+	customErr := token.abi.Errors["Unauthorized"]
+	if _, err := customErr.Unpack(data); err != nil {
+		t.Fatalf("can't unpack custom error: %v", err)
+	}
+}
+
+func TestRevertData(t *testing.T) {
+	tests := []struct {
+		err  error
+		data []byte
+		ok   bool
+	}{
+		{err: errors.New("failed")},
+		{err: &dataError{"0x82b42900"}, data: unauthorizedData, ok: true},
+		{err: &dataError{"invalid"}},
+		{err: newRevertError(revertReasonData), data: revertReasonData, ok: true},
+	}
+	for i, test := range tests {
+		data, ok := RevertData(test.err)
+		if ok != test.ok || !bytes.Equal(data, test.data) {
+			t.Errorf("test %d: wrong revert data %x (%v), want %x (%v)", i, data, ok, test.data, test.ok)
+		}
+	}
+}
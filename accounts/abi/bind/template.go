@@ -38,6 +38,7 @@ type tmplContract struct {
 	Fallback    *tmplMethod            // Additional special fallback function
 	Receive     *tmplMethod            // Additional special receive function
 	Events      map[string]*tmplEvent  // Contract events accessors
+	Errors      map[string]*tmplError  // Contract custom errors
 	Libraries   map[string]string      // Same as tmplData, but filtered to only keep what the contract needs
 	Library     bool                   // Indicator whether the contract is a library
 }
@@ -57,6 +58,13 @@ type tmplEvent struct {
 	Normalized abi.Event // Normalized version of the parsed fields
 }
 
+// tmplError is a wrapper around an abi.Error that contains a few preprocessed
+// and cached data fields.
+type tmplError struct {
+	Original   abi.Error // Original error as parsed by the abi package
+	Normalized abi.Error // Normalized version of the parsed fields
+}
+
 // tmplField is a wrapper around a struct field with binding language
 // struct type definition and relative filed name.
 type tmplField struct {
@@ -90,6 +98,7 @@ import (
 	"math/big"
 	"strings"
 	"errors"
+	"fmt"
 
 	ethereum "github.com/rethereum-blockchain/go-rethereum"
 	"github.com/rethereum-blockchain/go-rethereum/accounts/abi"
@@ -102,6 +111,7 @@ import (
 // Reference imports to suppress errors if they are not otherwise used.
 var (
 	_ = errors.New
+	_ = fmt.Sprintf
 	_ = big.NewInt
 	_ = strings.NewReader
 	_ = ethereum.NotFound
@@ -424,6 +434,56 @@ var (
 		}
 	{{end}}
 
+	{{if .Calls}}
+		// {{.Type}}Multicall is an auto generated Go binding adding calls of an Ethereum
+		// contract to a multicall batch.
+		type {{.Type}}Multicall struct {
+		  contract *bind.BoundContract // Generic contract wrapper for packing and unpacking the calls
+		  batch    *bind.Multicall     // Batch to add the calls to
+		}
+
+		// New{{.Type}}Multicall creates a new instance of {{.Type}}, adding calls of the contract
+		// at the given address to the batch.
+		func New{{.Type}}Multicall(address common.Address, batch *bind.Multicall) (*{{.Type}}Multicall, error) {
+		  contract, err := bind{{.Type}}(address, nil, nil, nil)
+		  if err != nil {
+		    return nil, err
+		  }
+		  return &{{.Type}}Multicall{contract: contract, batch: batch}, nil
+		}
+	{{end}}
+
+	{{range .Calls}}
+		// {{.Normalized.Name}} adds a call of the contract method 0x{{printf "%x" .Original.ID}} to the batch.
+		// The returned function retrieves the results once the batch has been executed.
+		//
+		// Solidity: {{.Original.String}}
+		func (_{{$contract.Type}} *{{$contract.Type}}Multicall) {{.Normalized.Name}}({{range $i, $_ := .Normalized.Inputs}}{{if ne $i 0}},{{end}} {{.Name}} {{bindtype .Type $structs}} {{end}}) func() ({{if .Structured}}struct{ {{range .Normalized.Outputs}}{{.Name}} {{bindtype .Type $structs}};{{end}} },{{else}}{{range .Normalized.Outputs}}{{bindtype .Type $structs}},{{end}}{{end}} error) {
+			result := _{{$contract.Type}}.batch.Add(_{{$contract.Type}}.contract, "{{.Original.Name}}" {{range .Normalized.Inputs}}, {{.Name}}{{end}})
+			return func() ({{if .Structured}}struct{ {{range .Normalized.Outputs}}{{.Name}} {{bindtype .Type $structs}};{{end}} },{{else}}{{range .Normalized.Outputs}}{{bindtype .Type $structs}},{{end}}{{end}} error) {
+				{{if .Normalized.Outputs}}out{{else}}_{{end}}, err := result.Unpack()
+				{{if .Structured}}
+				outstruct := new(struct{ {{range .Normalized.Outputs}} {{.Name}} {{bindtype .Type $structs}}; {{end}} })
+				if err != nil {
+					return *outstruct, err
+				}
+				{{range $i, $t := .Normalized.Outputs}}
+				outstruct.{{.Name}} = *abi.ConvertType(out[{{$i}}], new({{bindtype .Type $structs}})).(*{{bindtype .Type $structs}}){{end}}
+
+				return *outstruct, err
+				{{else}}
+				if err != nil {
+					return {{range $i, $_ := .Normalized.Outputs}}*new({{bindtype .Type $structs}}), {{end}} err
+				}
+				{{range $i, $t := .Normalized.Outputs}}
+				out{{$i}} := *abi.ConvertType(out[{{$i}}], new({{bindtype .Type $structs}})).(*{{bindtype .Type $structs}}){{end}}
+
+				return {{range $i, $t := .Normalized.Outputs}}out{{$i}}, {{end}} err
+				{{end}}
+			}
+		}
+	{{end}}
+
 	{{range .Events}}
 		// {{$contract.Type}}{{.Normalized.Name}}Iterator is returned from Filter{{.Normalized.Name}} and is used to iterate over the raw logs and unpacked data for {{.Normalized.Name}} events raised by the {{$contract.Type}} contract.
 		type {{$contract.Type}}{{.Normalized.Name}}Iterator struct {
@@ -567,5 +627,81 @@ var (
 		}
 
  	{{end}}
+
+	{{if .Events}}
+		// Decode{{$contract.Type}}Log unpacks a log emitted by the {{$contract.Type}} contract into the
+		// binding of the event it matches. Logs of other events fail with bind.ErrUnknownEvent.
+		func Decode{{$contract.Type}}Log(log types.Log) (interface{}, error) {
+			parsed, err := {{$contract.Type}}MetaData.GetAbi()
+			if err != nil {
+				return nil, err
+			}
+			if len(log.Topics) == 0 {
+				return nil, bind.ErrUnknownEvent
+			}
+			contract := bind.NewBoundContract(log.Address, *parsed, nil, nil, nil)
+			switch log.Topics[0] {
+			{{range .Events}}
+			case parsed.Events["{{.Original.Name}}"].ID:
+				event := new({{$contract.Type}}{{.Normalized.Name}})
+				if err := contract.UnpackLog(event, "{{.Original.Name}}", log); err != nil {
+					return nil, err
+				}
+				event.Raw = log
+				return event, nil
+			{{end}}
+			}
+			return nil, bind.ErrUnknownEvent
+		}
+	{{end}}
+
+	{{range .Errors}}
+		// {{$contract.Type}}{{.Normalized.Name}}Error represents a {{.Normalized.Name}} error raised by the {{$contract.Type}} contract.
+		type {{$contract.Type}}{{.Normalized.Name}}Error struct { {{range .Normalized.Inputs}}
+			{{capitalise .Name}} {{bindtype .Type $structs}}; {{end}}
+		}
+
+		// Error implements the error interface.
+		func (e *{{$contract.Type}}{{.Normalized.Name}}Error) Error() string {
+			{{if .Normalized.Inputs}}return fmt.Sprintf("{{.Original.Name}}({{range $i, $_ := .Normalized.Inputs}}{{if ne $i 0}}, {{end}}{{.Name}}: %v{{end}})"{{range .Normalized.Inputs}}, e.{{capitalise .Name}}{{end}}){{else}}return "{{.Original.Name}}()"{{end}}
+		}
+
+		// Unpack{{$contract.Type}}{{.Normalized.Name}}Error unpacks the revert data of the custom error 0x{{printf "%x" (slice .Original.ID.Bytes 0 4)}}.
+		//
+		// Solidity: {{.Original.String}}
+		func Unpack{{$contract.Type}}{{.Normalized.Name}}Error(data []byte) (*{{$contract.Type}}{{.Normalized.Name}}Error, error) {
+			parsed, err := {{$contract.Type}}MetaData.GetAbi()
+			if err != nil {
+				return nil, err
+			}
+			errABI := parsed.Errors["{{.Original.Name}}"]
+			{{if .Normalized.Inputs}}values, err := {{else}}_, err = {{end}}errABI.Unpack(data)
+			if err != nil {
+				return nil, err
+			}
+			out := new({{$contract.Type}}{{.Normalized.Name}}Error)
+			{{range $i, $t := .Normalized.Inputs}}
+			out.{{capitalise .Name}} = *abi.ConvertType(values.([]interface{})[{{$i}}], new({{bindtype .Type $structs}})).(*{{bindtype .Type $structs}}){{end}}
+
+			return out, nil
+		}
+	{{end}}
+
+	{{if .Errors}}
+		// Unpack{{$contract.Type}}Error converts the error of a failed call or transaction into the
+		// binding of the {{$contract.Type}} custom error it carries the revert data of. Other errors
+		// are returned unchanged.
+		func Unpack{{$contract.Type}}Error(err error) error {
+			data, ok := bind.RevertData(err)
+			if !ok {
+				return err
+			}
+			{{range .Errors}}
+			if custom, uerr := Unpack{{$contract.Type}}{{.Normalized.Name}}Error(data); uerr == nil {
+				return custom
+			}{{end}}
+			return err
+		}
+	{{end}}
 {{end}}
 `
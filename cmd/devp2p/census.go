@@ -0,0 +1,235 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/cmd/devp2p/internal/ethtest"
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/forkid"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+)
+
+// censusSet holds the status of all nodes reached by the census.
+type censusSet struct {
+	mu      sync.Mutex
+	window  time.Duration // nodes not reached within the window are left out of snapshots
+	entries map[enode.ID]*censusEntry
+}
+
+type censusEntry struct {
+	node   *enode.Node
+	status *ethtest.NodeStatus
+	seen   time.Time
+}
+
+func newCensusSet(window time.Duration) *censusSet {
+	return &censusSet{window: window, entries: make(map[enode.ID]*censusEntry)}
+}
+
+// add records the status reported by a node.
+func (s *censusSet) add(n *enode.Node, status *ethtest.NodeStatus, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[n.ID()] = &censusEntry{node: n, status: status, seen: now}
+}
+
+// censusSnapshot is the aggregated state of the network at some point in time.
+type censusSnapshot struct {
+	Time      time.Time      `json:"time"`
+	Nodes     int            `json:"nodes"`
+	Clients   map[string]int `json:"clients"`
+	Versions  map[string]int `json:"versions"`
+	Protocols map[string]int `json:"protocols"`
+	Networks  map[string]int `json:"networks"`
+	ForkIDs   map[string]int `json:"forkIDs"`
+	Heads     map[string]int `json:"heads"`
+	Peers     []censusNode   `json:"peers"`
+}
+
+// censusNode is the status of a single node in a snapshot.
+type censusNode struct {
+	Record     *enode.Node `json:"record"`
+	Name       string      `json:"name"`
+	Protocol   uint        `json:"protocol"`
+	NetworkID  uint64      `json:"networkID"`
+	Genesis    common.Hash `json:"genesis"`
+	ForkID     string      `json:"forkID"`
+	Head       common.Hash `json:"head"`
+	HeadNumber uint64      `json:"headNumber,omitempty"`
+	Seen       time.Time   `json:"seen"`
+}
+
+// snapshot aggregates the status of all nodes seen within the window.
+//
+// Heads are bucketed by their distance to the highest head reported on the same
+// network, nodes which didn't reveal their head number are counted as unknown.
+func (s *censusSet) snapshot(now time.Time) *censusSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := &censusSnapshot{
+		Time:      now,
+		Clients:   make(map[string]int),
+		Versions:  make(map[string]int),
+		Protocols: make(map[string]int),
+		Networks:  make(map[string]int),
+		ForkIDs:   make(map[string]int),
+		Heads:     make(map[string]int),
+	}
+	highest := make(map[common.Hash]uint64)
+	for id, e := range s.entries {
+		if now.Sub(e.seen) > s.window {
+			delete(s.entries, id)
+			continue
+		}
+		if e.status.HeadNumber > highest[e.status.Genesis] {
+			highest[e.status.Genesis] = e.status.HeadNumber
+		}
+	}
+	for _, e := range s.entries {
+		st := e.status
+		client, version := parseClientName(st.Name)
+		snap.Clients[client]++
+		snap.Versions[client+"/"+version]++
+		for _, cap := range st.Caps {
+			snap.Protocols[cap.String()]++
+		}
+		snap.Networks[networkString(st.NetworkID, st.Genesis)]++
+		snap.ForkIDs[forkIDString(st.ForkID)]++
+		snap.Heads[headBucket(st.HeadNumber, highest[st.Genesis])]++
+
+		snap.Peers = append(snap.Peers, censusNode{
+			Record:     e.node,
+			Name:       st.Name,
+			Protocol:   st.ProtocolVersion,
+			NetworkID:  st.NetworkID,
+			Genesis:    st.Genesis,
+			ForkID:     forkIDString(st.ForkID),
+			Head:       st.Head,
+			HeadNumber: st.HeadNumber,
+			Seen:       e.seen,
+		})
+	}
+	snap.Nodes = len(snap.Peers)
+	sort.Slice(snap.Peers, func(i, j int) bool {
+		return snap.Peers[i].Record.ID().String() < snap.Peers[j].Record.ID().String()
+	})
+	return snap
+}
+
+// parseClientName splits the devp2p client name into the client and its version,
+// e.g. "Geth/v1.11.6-stable-ea9e62ca/linux-amd64/go1.20.3" yields "Geth" and
+// "v1.11.6-stable-ea9e62ca". Custom node identities are skipped.
+func parseClientName(name string) (client, version string) {
+	parts := strings.Split(name, "/")
+	client = parts[0]
+	if client == "" {
+		client = "unknown"
+	}
+	for _, part := range parts[1:] {
+		if len(part) > 1 && (part[0] == 'v' || part[0] == 'V') && part[1] >= '0' && part[1] <= '9' {
+			return client, part
+		}
+	}
+	return client, "unknown"
+}
+
+func networkString(id uint64, genesis common.Hash) string {
+	return fmt.Sprintf("%d/%x", id, genesis[:4])
+}
+
+func forkIDString(id forkid.ID) string {
+	return fmt.Sprintf("%x/%d", id.Hash, id.Next)
+}
+
+func headBucket(head, highest uint64) string {
+	switch dist := highest - head; {
+	case head == 0:
+		return "unknown"
+	case dist == 0:
+		return "synced"
+	case dist < 16:
+		return "behind<16"
+	case dist < 1024:
+		return "behind<1024"
+	default:
+		return "behind>=1024"
+	}
+}
+
+// writeCensusJSON writes the snapshot to a time-stamped file in dir.
+func writeCensusJSON(dir string, snap *censusSnapshot) error {
+	data, err := json.MarshalIndent(snap, "", jsonIndent)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(dir, "census-"+snap.Time.UTC().Format("20060102-150405")+".json")
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// appendCensusCSV appends the aggregates of the snapshot to a CSV file, one row
+// per counted value. The file thus holds the time series of all snapshots.
+func appendCensusCSV(file string, snap *censusSnapshot) error {
+	fd, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	w := csv.NewWriter(fd)
+	if info, err := fd.Stat(); err == nil && info.Size() == 0 {
+		w.Write([]string{"time", "category", "key", "count"})
+	}
+	var (
+		ts   = snap.Time.UTC().Format(time.RFC3339)
+		rows = [][]string{{ts, "total", "nodes", strconv.Itoa(snap.Nodes)}}
+	)
+	for _, cat := range []struct {
+		name   string
+		counts map[string]int
+	}{
+		{"client", snap.Clients},
+		{"version", snap.Versions},
+		{"protocol", snap.Protocols},
+		{"network", snap.Networks},
+		{"forkid", snap.ForkIDs},
+		{"head", snap.Heads},
+	} {
+		keys := make([]string, 0, len(cat.counts))
+		for key := range cat.counts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			rows = append(rows, []string{ts, cat.name, key, strconv.Itoa(cat.counts[key])})
+		}
+	}
+	w.WriteAll(rows)
+	return w.Error()
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/cmd/devp2p/internal/ethtest"
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/forkid"
+	"github.com/rethereum-blockchain/go-rethereum/p2p"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enr"
+)
+
+func TestParseClientName(t *testing.T) {
+	tests := []struct {
+		name            string
+		client, version string
+	}{
+		{"Geth/v1.11.6-stable-ea9e62ca/linux-amd64/go1.20.3", "Geth", "v1.11.6-stable-ea9e62ca"},
+		{"Geth/mynode/v1.11.6-stable/linux-amd64/go1.20.3", "Geth", "v1.11.6-stable"},
+		{"erigon/v2.43.0-stable-db1a3b0b/linux-amd64/go1.20.2", "erigon", "v2.43.0-stable-db1a3b0b"},
+		{"Nethermind", "Nethermind", "unknown"},
+		{"", "unknown", "unknown"},
+	}
+	for _, test := range tests {
+		client, version := parseClientName(test.name)
+		if client != test.client || version != test.version {
+			t.Errorf("%q: got %q %q, want %q %q", test.name, client, version, test.client, test.version)
+		}
+	}
+}
+
+func TestCensusSnapshot(t *testing.T) {
+	var (
+		now     = time.Unix(1700000000, 0)
+		window  = time.Hour
+		set     = newCensusSet(window)
+		genesis = common.Hash{1}
+		fork    = forkid.ID{Hash: [4]byte{0xaa, 0xbb, 0xcc, 0xdd}, Next: 100}
+		eth68   = []p2p.Cap{{Name: "eth", Version: 68}, {Name: "snap", Version: 1}}
+	)
+	add := func(i byte, name string, head uint64, seen time.Time) {
+		n := enode.SignNull(new(enr.Record), enode.ID{i})
+		set.add(n, &ethtest.NodeStatus{
+			Name:            name,
+			Caps:            eth68,
+			ProtocolVersion: 68,
+			NetworkID:       1,
+			Genesis:         genesis,
+			ForkID:          fork,
+			HeadNumber:      head,
+		}, seen)
+	}
+	add(1, "Geth/v1.11.6-stable/linux-amd64/go1.20.3", 5000, now)
+	add(2, "Geth/v1.11.6-stable/linux-amd64/go1.20.3", 4990, now)
+	add(3, "erigon/v2.43.0-stable/linux-amd64/go1.20.2", 0, now)
+	add(4, "Geth/v1.10.0-stable/linux-amd64/go1.19", 100, now.Add(-2*window))
+
+	snap := set.snapshot(now)
+	if snap.Nodes != 3 {
+		t.Fatalf("wrong node count: got %d, want 3", snap.Nodes)
+	}
+	check := func(name string, have, want map[string]int) {
+		t.Helper()
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("wrong %s: got %v, want %v", name, have, want)
+		}
+	}
+	check("clients", snap.Clients, map[string]int{"Geth": 2, "erigon": 1})
+	check("versions", snap.Versions, map[string]int{"Geth/v1.11.6-stable": 2, "erigon/v2.43.0-stable": 1})
+	check("protocols", snap.Protocols, map[string]int{"eth/68": 3, "snap/1": 3})
+	check("networks", snap.Networks, map[string]int{"1/01000000": 3})
+	check("fork IDs", snap.ForkIDs, map[string]int{"aabbccdd/100": 3})
+	check("heads", snap.Heads, map[string]int{"synced": 1, "behind<16": 1, "unknown": 1})
+
+	// Check the output files.
+	dir := t.TempDir()
+	out := censusOutput(dir)
+	out(snap)
+	out(snap)
+
+	if _, err := os.Stat(filepath.Join(dir, "census-20231114-221320.json")); err != nil {
+		t.Fatal("snapshot not written:", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "census.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if lines[0] != "time,category,key,count" {
+		t.Fatalf("wrong CSV header: %q", lines[0])
+	}
+	if len(lines) != 1+2*12 {
+		t.Fatalf("wrong number of CSV lines: got %d, want %d", len(lines), 1+2*12)
+	}
+	if want := "2023-11-14T22:13:20Z,total,nodes,3"; lines[1] != want {
+		t.Fatalf("wrong first CSV row: got %q, want %q", lines[1], want)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/cmd/devp2p/internal/ethtest"
+	"github.com/rethereum-blockchain/go-rethereum/internal/flags"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	censusCommand = &cli.Command{
+		Name:      "census",
+		Usage:     "Collects client, protocol and fork statistics of the nodes found in the DHT",
+		ArgsUsage: "<output directory>",
+		Action:    census,
+		Flags: flags.Merge(discoveryNodeFlags, []cli.Flag{
+			crawlTimeoutFlag,
+			crawlParallelismFlag,
+			censusIntervalFlag,
+			censusWindowFlag,
+			censusNodesFlag,
+			censusV5Flag,
+		}),
+	}
+)
+
+var (
+	censusIntervalFlag = &cli.DurationFlag{
+		Name:  "interval",
+		Usage: "Time between snapshots. Nodes are queried again once the interval has passed.",
+		Value: 10 * time.Minute,
+	}
+	censusWindowFlag = &cli.DurationFlag{
+		Name:  "window",
+		Usage: "Only nodes reached within this time are counted in a snapshot.",
+		Value: time.Hour,
+	}
+	censusNodesFlag = &cli.StringFlag{
+		Name:  "nodes",
+		Usage: "Path of a nodes.json file with additional nodes to query",
+	}
+	censusV5Flag = &cli.BoolFlag{
+		Name:  "v5",
+		Usage: "Find nodes using discovery v5 instead of v4",
+	}
+)
+
+// censusDialTimeout is the time limit for querying the status of a single node.
+const censusDialTimeout = 10 * time.Second
+
+func census(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need output directory as argument")
+	}
+	dir := ctx.Args().First()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var iters []enode.Iterator
+	if ctx.Bool(censusV5Flag.Name) {
+		disc := startV5(ctx)
+		defer disc.Close()
+		iters = append(iters, disc.RandomNodes())
+	} else {
+		disc := startV4(ctx)
+		defer disc.Close()
+		iters = append(iters, disc.RandomNodes())
+	}
+	if ctx.IsSet(censusNodesFlag.Name) {
+		iters = append(iters, enode.IterNodes(loadNodesJSON(ctx.String(censusNodesFlag.Name)).nodes()))
+	}
+	mix := enode.NewFairMix(0)
+	for _, it := range iters {
+		mix.AddSource(it)
+	}
+	it := enode.Filter(mix, func(n *enode.Node) bool { return n.TCP() != 0 })
+
+	set := newCensusSet(ctx.Duration(censusWindowFlag.Name))
+	runCensus(it, set, censusOutput(dir), ctx.Duration(crawlTimeoutFlag.Name),
+		ctx.Duration(censusIntervalFlag.Name), ctx.Int(crawlParallelismFlag.Name))
+	return nil
+}
+
+// censusOutput returns a function which writes snapshots to the given directory.
+func censusOutput(dir string) func(*censusSnapshot) {
+	return func(snap *censusSnapshot) {
+		if err := writeCensusJSON(dir, snap); err != nil {
+			log.Error("Failed to write census snapshot", "err", err)
+		}
+		if err := appendCensusCSV(filepath.Join(dir, "census.csv"), snap); err != nil {
+			log.Error("Failed to write census time series", "err", err)
+		}
+	}
+}
+
+// runCensus queries the status of the nodes returned by the iterator, writing a
+// snapshot of the collected data every interval and once more when the timeout
+// expires.
+func runCensus(it enode.Iterator, set *censusSet, output func(*censusSnapshot), timeout, interval time.Duration, nthreads int) {
+	var (
+		nodes   = make(chan *enode.Node)
+		wg      sync.WaitGroup
+		queried uint64
+		failed  uint64
+
+		recentMu sync.Mutex
+		recent   = make(map[enode.ID]time.Time)
+	)
+	go func() {
+		defer close(nodes)
+		for it.Next() {
+			nodes <- it.Node()
+		}
+	}()
+	for i := 0; i < nthreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range nodes {
+				// Skip nodes that were already queried in this interval.
+				recentMu.Lock()
+				if last, ok := recent[n.ID()]; ok && time.Since(last) < interval {
+					recentMu.Unlock()
+					continue
+				}
+				recent[n.ID()] = time.Now()
+				recentMu.Unlock()
+
+				atomic.AddUint64(&queried, 1)
+				status, err := ethtest.QueryStatus(n, censusDialTimeout)
+				if err != nil {
+					atomic.AddUint64(&failed, 1)
+					log.Trace("Status query failed", "id", n.ID(), "err", err)
+					continue
+				}
+				set.add(n, status, time.Now())
+			}
+		}()
+	}
+
+	var (
+		timeoutTimer = time.NewTimer(timeout)
+		snapTicker   = time.NewTicker(interval)
+	)
+	defer timeoutTimer.Stop()
+	defer snapTicker.Stop()
+
+	snapshot := func() {
+		snap := set.snapshot(time.Now())
+		log.Info("Census snapshot", "nodes", snap.Nodes, "queried", atomic.LoadUint64(&queried), "failed", atomic.LoadUint64(&failed))
+		output(snap)
+	}
+	for {
+		select {
+		case <-snapTicker.C:
+			snapshot()
+		case <-timeoutTimer.C:
+			log.Info("Timeout, waiting for pending queries")
+			it.Close()
+			wg.Wait()
+			snapshot()
+			return
+		}
+	}
+}
@@ -37,6 +37,7 @@ var (
 			discv5CrawlCommand,
 			discv5TestCommand,
 			discv5ListenCommand,
+			discv5TopicSearchCommand,
 		},
 	}
 	discv5PingCommand = &cli.Command{
@@ -76,6 +77,13 @@ var (
 		Action: discv5Listen,
 		Flags:  discoveryNodeFlags,
 	}
+	discv5TopicSearchCommand = &cli.Command{
+		Name:      "topic-search",
+		Usage:     "Finds nodes advertised under a topic in the DHT",
+		ArgsUsage: "<topic>",
+		Action:    discv5TopicSearch,
+		Flags:     discoveryNodeFlags,
+	}
 )
 
 func discv5Ping(ctx *cli.Context) error {
@@ -133,6 +141,19 @@ func discv5Listen(ctx *cli.Context) error {
 	select {}
 }
 
+func discv5TopicSearch(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need topic as argument")
+	}
+	disc := startV5(ctx)
+	defer disc.Close()
+
+	for _, n := range disc.TopicSearch(ctx.Args().First()) {
+		fmt.Println(n)
+	}
+	return nil
+}
+
 // startV5 starts an ephemeral discovery v5 node.
 func startV5(ctx *cli.Context) *discover.UDPv5 {
 	ln, config := makeDiscoveryConfig(ctx)
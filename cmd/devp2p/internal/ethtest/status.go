@@ -0,0 +1,189 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/forkid"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/eth/protocols/eth"
+	"github.com/rethereum-blockchain/go-rethereum/p2p"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/rlpx"
+	"github.com/rethereum-blockchain/go-rethereum/rlp"
+)
+
+// NodeStatus is what a node reveals about itself during the devp2p and eth
+// protocol handshakes.
+type NodeStatus struct {
+	Name            string    // client name from the devp2p handshake
+	Caps            []p2p.Cap // all capabilities advertised by the node
+	ProtocolVersion uint      // negotiated eth protocol version
+	NetworkID       uint64
+	TD              *big.Int // total difficulty, nil if eth/69 was negotiated
+	Head            common.Hash
+	HeadNumber      uint64 // number of the head block, zero if it's unknown
+	Genesis         common.Hash
+	ForkID          forkid.ID
+}
+
+// QueryStatus connects to a node, performs the devp2p and eth handshakes and
+// returns the status reported by it. The whole exchange must complete within
+// the given timeout.
+//
+// Nodes speaking eth/69 include their head number in the status message. For
+// older versions, the head header is requested after echoing the status of the
+// remote node back to it. Failing to retrieve the head is not an error.
+func QueryStatus(dest *enode.Node, timeout time.Duration) (*NodeStatus, error) {
+	fd, err := net.DialTimeout("tcp", fmt.Sprintf("%v:%d", dest.IP(), dest.TCP()), timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := Conn{Conn: rlpx.NewConn(fd, dest.Pubkey())}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	conn.ourKey, _ = crypto.GenerateKey()
+	if _, err := conn.Handshake(conn.ourKey); err != nil {
+		return nil, err
+	}
+	conn.caps = []p2p.Cap{
+		{Name: "eth", Version: 66},
+		{Name: "eth", Version: 67},
+		{Name: "eth", Version: 68},
+		{Name: "eth", Version: 69},
+	}
+	conn.ourHighestProtoVersion = 69
+
+	// Exchange hello messages, keeping the remote one for its client name.
+	ourHello := &Hello{
+		Version: 5,
+		Caps:    conn.caps,
+		ID:      crypto.FromECDSAPub(&conn.ourKey.PublicKey)[1:],
+	}
+	if err := conn.Write(ourHello); err != nil {
+		return nil, fmt.Errorf("write to connection failed: %v", err)
+	}
+	var status *NodeStatus
+	switch msg := conn.Read().(type) {
+	case *Hello:
+		if msg.Version >= 5 {
+			conn.SetSnappy(true)
+		}
+		conn.negotiateEthProtocol(msg.Caps)
+		status = &NodeStatus{Name: msg.Name, Caps: msg.Caps, ProtocolVersion: conn.negotiatedProtoVersion}
+		if status.ProtocolVersion == 0 {
+			return status, fmt.Errorf("could not negotiate eth protocol (remote caps: %v)", msg.Caps)
+		}
+	case *Disconnect:
+		return nil, fmt.Errorf("disconnect received: %v", msg.Reason)
+	case *Error:
+		return nil, msg
+	default:
+		return nil, fmt.Errorf("bad handshake: %#v", msg)
+	}
+
+	// Read the status and mirror it back to keep the connection alive.
+	data, err := conn.readRaw((Status{}).Code())
+	if err != nil {
+		return status, err
+	}
+	if status.ProtocolVersion >= eth.ETH69 {
+		var msg eth.StatusPacket69
+		if err := rlp.DecodeBytes(data, &msg); err != nil {
+			return status, fmt.Errorf("could not rlp decode status: %v", err)
+		}
+		status.NetworkID, status.Genesis, status.ForkID = msg.NetworkID, msg.Genesis, msg.ForkID
+		status.Head, status.HeadNumber = msg.LatestBlockHash, msg.LatestBlock
+	} else {
+		var msg eth.StatusPacket
+		if err := rlp.DecodeBytes(data, &msg); err != nil {
+			return status, fmt.Errorf("could not rlp decode status: %v", err)
+		}
+		status.NetworkID, status.Genesis, status.ForkID = msg.NetworkID, msg.Genesis, msg.ForkID
+		status.Head, status.TD = msg.Head, msg.TD
+	}
+	if _, err := conn.Conn.Write(uint64((Status{}).Code()), data); err != nil {
+		return status, nil // the status is known, only the head number is missing
+	}
+	if status.HeadNumber == 0 && status.Head != status.Genesis {
+		status.HeadNumber = conn.headNumber(status.Head)
+	}
+	conn.Write(&Disconnect{Reason: p2p.DiscRequested})
+	return status, nil
+}
+
+// readRaw reads messages until one with the given code arrives, answering pings
+// and skipping all unrelated messages in the meantime.
+func (c *Conn) readRaw(code int) ([]byte, error) {
+	for {
+		have, data, _, err := c.Conn.Read()
+		if err != nil {
+			return nil, fmt.Errorf("could not read from connection: %v", err)
+		}
+		switch int(have) {
+		case code:
+			return data, nil
+		case (Ping{}).Code():
+			c.Write(&Pong{})
+		case (Disconnect{}).Code():
+			var msg Disconnect
+			if err := rlp.DecodeBytes(data, &msg); err != nil {
+				return nil, errors.New("disconnect received")
+			}
+			return nil, fmt.Errorf("disconnect received: %v", msg.Reason)
+		}
+	}
+}
+
+// headNumber requests the header of the given block and returns its number. If
+// the header can't be retrieved, zero is returned.
+func (c *Conn) headNumber(hash common.Hash) uint64 {
+	req := &GetBlockHeaders{
+		RequestId: 1,
+		GetBlockHeadersPacket: &eth.GetBlockHeadersPacket{
+			Origin: eth.HashOrNumber{Hash: hash},
+			Amount: 1,
+		},
+	}
+	if err := c.Write(req); err != nil {
+		return 0
+	}
+	for {
+		data, err := c.readRaw((BlockHeaders{}).Code())
+		if err != nil {
+			return 0
+		}
+		var resp eth.BlockHeadersPacket66
+		if err := rlp.DecodeBytes(data, &resp); err != nil {
+			return 0
+		}
+		if resp.RequestId != req.RequestId {
+			continue
+		}
+		if len(resp.BlockHeadersPacket) != 1 || resp.BlockHeadersPacket[0].Hash() != hash {
+			return 0
+		}
+		return resp.BlockHeadersPacket[0].Number.Uint64()
+	}
+}
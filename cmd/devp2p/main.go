@@ -47,6 +47,7 @@ func init() {
 	app.Commands = []*cli.Command{
 		enrdumpCommand,
 		keyCommand,
+		censusCommand,
 		discv4Command,
 		discv5Command,
 		dnsCommand,
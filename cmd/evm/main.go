@@ -40,6 +40,10 @@ var (
 		Name:  "cpuprofile",
 		Usage: "creates a CPU profile at the given path",
 	}
+	ProfileFlag = &cli.StringFlag{
+		Name:  "profile",
+		Usage: "write a gas profile of the execution in collapsed-stack (flamegraph) format to the given file",
+	}
 	StatDumpFlag = &cli.BoolFlag{
 		Name:  "statdump",
 		Usage: "displays stack and heap memory information",
@@ -204,6 +208,7 @@ func init() {
 		InputFileFlag,
 		MemProfileFlag,
 		CPUProfileFlag,
+		ProfileFlag,
 		StatDumpFlag,
 		GenesisFlag,
 		MachineFlag,
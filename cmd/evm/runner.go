@@ -19,6 +19,7 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
@@ -36,7 +37,9 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/core/state"
 	"github.com/rethereum-blockchain/go-rethereum/core/vm"
 	"github.com/rethereum-blockchain/go-rethereum/core/vm/runtime"
+	"github.com/rethereum-blockchain/go-rethereum/eth/tracers"
 	"github.com/rethereum-blockchain/go-rethereum/eth/tracers/logger"
+	_ "github.com/rethereum-blockchain/go-rethereum/eth/tracers/native"
 	"github.com/rethereum-blockchain/go-rethereum/internal/flags"
 	"github.com/rethereum-blockchain/go-rethereum/log"
 	"github.com/rethereum-blockchain/go-rethereum/params"
@@ -121,6 +124,7 @@ func runCmd(ctx *cli.Context) error {
 	var (
 		tracer        vm.EVMLogger
 		debugLogger   *logger.StructLogger
+		profiler      tracers.Tracer
 		statedb       *state.StateDB
 		chainConfig   *params.ChainConfig
 		sender        = common.BytesToAddress([]byte("sender"))
@@ -136,6 +140,16 @@ func runCmd(ctx *cli.Context) error {
 	} else {
 		debugLogger = logger.NewStructLogger(logconfig)
 	}
+	if ctx.String(ProfileFlag.Name) != "" {
+		if tracer != nil || ctx.Bool(BenchFlag.Name) {
+			return errors.New("--profile cannot be combined with --json, --debug or --bench")
+		}
+		var err error
+		if profiler, err = tracers.DefaultDirectory.New("gasProfiler", new(tracers.Context), json.RawMessage(`{"format": "collapsed"}`)); err != nil {
+			return err
+		}
+		tracer = profiler
+	}
 	if ctx.String(GenesisFlag.Name) != "" {
 		gen := readGenesis(ctx.String(GenesisFlag.Name))
 		genesisConfig = gen
@@ -295,6 +309,12 @@ func runCmd(ctx *cli.Context) error {
 		f.Close()
 	}
 
+	if profiler != nil {
+		if err := writeGasProfile(ctx.String(ProfileFlag.Name), profiler); err != nil {
+			return err
+		}
+	}
+
 	if ctx.Bool(DebugFlag.Name) {
 		if debugLogger != nil {
 			fmt.Fprintln(os.Stderr, "#### TRACE ####")
@@ -311,7 +331,7 @@ allocations:     %d
 allocated bytes: %d
 `, initialGas-leftOverGas, stats.time, stats.allocs, stats.bytesAllocated)
 	}
-	if tracer == nil {
+	if tracer == nil || tracer == profiler {
 		fmt.Printf("%#x\n", output)
 		if err != nil {
 			fmt.Printf(" error: %v\n", err)
@@ -320,3 +340,17 @@ allocated bytes: %d
 
 	return nil
 }
+
+// writeGasProfile writes the collapsed call stacks gathered by the gas profiler
+// into the given file, ready to be rendered by flamegraph tooling.
+func writeGasProfile(path string, profiler tracers.Tracer) error {
+	res, err := profiler.GetResult()
+	if err != nil {
+		return fmt.Errorf("could not create gas profile: %w", err)
+	}
+	var stacks string
+	if err := json.Unmarshal(res, &stacks); err != nil {
+		return fmt.Errorf("could not decode gas profile: %w", err)
+	}
+	return os.WriteFile(path, []byte(stacks), 0644)
+}
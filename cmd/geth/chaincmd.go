@@ -35,6 +35,7 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/core/types"
 	"github.com/rethereum-blockchain/go-rethereum/crypto"
 	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/internal/era"
 	"github.com/rethereum-blockchain/go-rethereum/internal/flags"
 	"github.com/rethereum-blockchain/go-rethereum/log"
 	"github.com/rethereum-blockchain/go-rethereum/metrics"
@@ -94,6 +95,8 @@ if one is set.  Otherwise it prints the genesis from the datadir.`,
 			utils.MetricsInfluxDBBucketFlag,
 			utils.MetricsInfluxDBOrganizationFlag,
 			utils.TxLookupLimitFlag,
+			utils.StateSchemeFlag,
+			utils.StateHistoryFlag,
 		}, utils.DatabasePathFlags),
 		Description: `
 The import command imports blocks from an RLP-encoded form. The form can be one file
@@ -117,6 +120,43 @@ Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing. If the file ends with .gz, the output will
 be gzipped.`,
+	}
+	importHistoryCommand = &cli.Command{
+		Action:    importHistory,
+		Name:      "import-history",
+		Usage:     "Import an Era1 archive of the block history",
+		ArgsUsage: "<dir>",
+		Flags: flags.Merge([]cli.Flag{
+			utils.TxLookupLimitFlag,
+		}, utils.DatabasePathFlags, utils.NetworkFlags),
+		Description: `
+The import-history command imports the headers, bodies and receipts of the
+Era1 archives found in the given directory, which must also contain the
+checksums.txt file written by export-history. The blocks are not executed,
+the state has to be synced afterwards.`,
+	}
+	exportHistoryCommand = &cli.Command{
+		Action:    exportHistory,
+		Name:      "export-history",
+		Usage:     "Export the block history into Era1 archives",
+		ArgsUsage: "<dir> <first> <last>",
+		Flags:     flags.Merge(utils.DatabasePathFlags, utils.NetworkFlags),
+		Description: `
+The export-history command writes the canonical blocks in the given range,
+along with their receipts and total difficulties, into Era1 archives of 8192
+blocks each. The first block must be a multiple of 8192.`,
+	}
+	verifyHistoryCommand = &cli.Command{
+		Action:    verifyHistory,
+		Name:      "verify-history",
+		Usage:     "Verify Era1 archives against the local chain",
+		ArgsUsage: "<dir>",
+		Flags:     flags.Merge(utils.DatabasePathFlags, utils.NetworkFlags),
+		Description: `
+The verify-history command checks the checksums and the internal consistency
+(block contents, total difficulties and accumulator roots) of the Era1 archives
+found in the given directory, and verifies the contained blocks against the
+local header chain.`,
 	}
 	importPreimagesCommand = &cli.Command{
 		Action:    importPreimages,
@@ -362,6 +402,73 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+// importHistory imports the block history from Era1 archives.
+func importHistory(ctx *cli.Context) error {
+	if ctx.Args().Len() != 1 {
+		utils.Fatalf("usage: %s", ctx.Command.ArgsUsage)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack, false)
+	defer db.Close()
+	defer chain.Stop()
+
+	start := time.Now()
+	if err := utils.ImportHistory(chain, ctx.Args().First(), utils.HistoryNetworkName(chain.Config())); err != nil {
+		utils.Fatalf("Import error: %v\n", err)
+	}
+	fmt.Printf("Import done in %v\n", time.Since(start))
+	return nil
+}
+
+// exportHistory exports the block history into Era1 archives.
+func exportHistory(ctx *cli.Context) error {
+	if ctx.Args().Len() != 3 {
+		utils.Fatalf("usage: %s", ctx.Command.ArgsUsage)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, _ := utils.MakeChain(ctx, stack, true)
+	start := time.Now()
+
+	var (
+		dir         = ctx.Args().Get(0)
+		first, ferr = strconv.ParseInt(ctx.Args().Get(1), 10, 64)
+		last, lerr  = strconv.ParseInt(ctx.Args().Get(2), 10, 64)
+	)
+	if ferr != nil || lerr != nil {
+		utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+	}
+	if first < 0 || last < 0 || first > last {
+		utils.Fatalf("Export error: invalid block range [%d, %d]\n", first, last)
+	}
+	if err := utils.ExportHistory(chain, dir, uint64(first), uint64(last), uint64(era.MaxEra1Size)); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
+// verifyHistory checks Era1 archives against the local chain.
+func verifyHistory(ctx *cli.Context) error {
+	if ctx.Args().Len() != 1 {
+		utils.Fatalf("usage: %s", ctx.Command.ArgsUsage)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, _ := utils.MakeChain(ctx, stack, true)
+	start := time.Now()
+
+	if err := utils.VerifyHistory(chain, ctx.Args().First(), utils.HistoryNetworkName(chain.Config())); err != nil {
+		utils.Fatalf("Verification error: %v\n", err)
+	}
+	fmt.Printf("Verification done in %v\n", time.Since(start))
+	return nil
+}
+
 // importPreimages imports preimage data from the specified file.
 func importPreimages(ctx *cli.Context) error {
 	if ctx.Args().Len() < 1 {
@@ -172,6 +172,11 @@ func makeFullNode(ctx *cli.Context) (*node.Node, ethapi.Backend) {
 		utils.RegisterGraphQLService(stack, backend, filterSystem, &cfg.Node)
 	}
 
+	// Relay connections to nodes behind NAT if requested.
+	if ctx.IsSet(utils.RelayListenFlag.Name) || ctx.IsSet(utils.RelayNodesFlag.Name) {
+		utils.RegisterRelayService(stack, utils.MakeRelayConfig(ctx))
+	}
+
 	// Add the Ethereum Stats daemon if requested.
 	if cfg.Ethstats.URL != "" {
 		utils.RegisterEthStatsService(stack, backend, cfg.Ethstats.URL)
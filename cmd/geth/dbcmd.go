@@ -18,10 +18,12 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
@@ -52,6 +54,23 @@ var (
 		Description: `
 Remove blockchain and state databases`,
 	}
+	freezerDictFlag = &cli.StringFlag{
+		Name:  "dict",
+		Usage: "Path of the zstd dictionary to compress the table with",
+	}
+	verifyWorkersFlag = &cli.IntFlag{
+		Name:  "workers",
+		Usage: "Number of parallel verification workers",
+		Value: runtime.NumCPU(),
+	}
+	verifyRepairFlag = &cli.BoolFlag{
+		Name:  "repair",
+		Usage: "Repair the recoverable inconsistencies",
+	}
+	verifyJSONFlag = &cli.BoolFlag{
+		Name:  "json",
+		Usage: "Print the verification report as JSON",
+	}
 	dbCommand = &cli.Command{
 		Name:      "db",
 		Usage:     "Low level database operations",
@@ -69,6 +88,9 @@ Remove blockchain and state databases`,
 			dbExportCmd,
 			dbMetadataCmd,
 			dbCheckStateContentCmd,
+			dbPruneHistoryCmd,
+			dbFreezerRecompressCmd,
+			dbVerifyCmd,
 		},
 	}
 	dbInspectCmd = &cli.Command{
@@ -164,6 +186,21 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		}, utils.NetworkFlags, utils.DatabasePathFlags),
 		Description: "This command displays information about the freezer index.",
 	}
+	dbFreezerRecompressCmd = &cli.Command{
+		Action:    freezerRecompress,
+		Name:      "freezer-recompress",
+		Usage:     "Convert a specific freezer table to a different compression codec",
+		ArgsUsage: "<freezer-type> <table-type> <codec>",
+		Flags: flags.Merge([]cli.Flag{
+			utils.SyncModeFlag,
+			freezerDictFlag,
+		}, utils.NetworkFlags, utils.DatabasePathFlags),
+		Description: `This command rewrites all the data files of the given freezer table compressed with
+the given codec ('snappy' or 'zstd'). A zstd dictionary, either trained with 'zstd --train' or
+raw content, can be supplied with --dict, removing any previous dictionary otherwise.
+The items appended later on are compressed with the same codec. Tables converted to zstd
+are not readable by older versions. The node must not be running. WARNING: the table may get corrupted if the conversion is aborted.`,
+	}
 	dbImportCmd = &cli.Command{
 		Action:    importLDBdata,
 		Name:      "import",
@@ -193,6 +230,38 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		}, utils.NetworkFlags, utils.DatabasePathFlags),
 		Description: "Shows metadata about the chain status.",
 	}
+	dbPruneHistoryCmd = &cli.Command{
+		Action:    pruneHistory,
+		Name:      "prune-history",
+		Usage:     "Expire the block bodies and receipts below a given block",
+		ArgsUsage: "<block (optional)>",
+		Flags: flags.Merge([]cli.Flag{
+			utils.SyncModeFlag,
+			utils.HistoryKeepFlag,
+		}, utils.NetworkFlags, utils.DatabasePathFlags),
+		Description: `This command deletes the block bodies and receipts below the given block from
+the ancient store, keeping the header chain intact. If no block is given, all but the
+most recent --history.keep blocks are expired. Only chain segments already moved to the
+ancient store can be expired, and the pruned history can't be served to the network or
+over RPC anymore.`,
+	}
+	dbVerifyCmd = &cli.Command{
+		Action: verifyDB,
+		Name:   "verify",
+		Usage:  "Cross-validate the chain data, freezer, transaction index, snapshot and state",
+		Flags: flags.Merge([]cli.Flag{
+			utils.SyncModeFlag,
+			verifyWorkersFlag,
+			verifyRepairFlag,
+			verifyJSONFlag,
+		}, utils.NetworkFlags, utils.DatabasePathFlags),
+		Description: `This command checks that the canonical hashes, headers, bodies, receipts and total
+difficulties agree across the key-value store and the freezer, that the transaction lookup
+entries point at real transactions, and that the snapshot generator marker and journal are
+consistent with the head state. With --repair, the recoverable inconsistencies are fixed:
+missing canonical mappings, stale mappings below the freezer, missing and dangling
+transaction lookups. The node must not be running.`,
+	}
 )
 
 func removeDB(ctx *cli.Context) error {
@@ -532,6 +601,89 @@ func dbDumpTrie(ctx *cli.Context) error {
 	return it.Err
 }
 
+func pruneHistory(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return fmt.Errorf("too many arguments given")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, false)
+	defer db.Close()
+
+	var target uint64
+	if ctx.NArg() == 1 {
+		number, err := strconv.ParseUint(ctx.Args().First(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid block number: %v", err)
+		}
+		target = number
+	} else {
+		keep := ctx.Uint64(utils.HistoryKeepFlag.Name)
+		if keep == 0 {
+			return fmt.Errorf("either a block number or --%s is required", utils.HistoryKeepFlag.Name)
+		}
+		head := rawdb.ReadHeadBlockHash(db)
+		number := rawdb.ReadHeaderNumber(db, head)
+		if number == nil {
+			return fmt.Errorf("failed to load head block")
+		}
+		if *number <= keep {
+			log.Info("Chain history shorter than the retention window", "head", *number, "keep", keep)
+			return nil
+		}
+		target = *number - keep
+	}
+	tail, err := rawdb.PruneChainHistory(db, target, nil)
+	if err != nil {
+		return err
+	}
+	log.Info("Chain history expired", "tail", tail)
+	return nil
+}
+
+func verifyDB(ctx *cli.Context) error {
+	if ctx.NArg() > 0 {
+		return fmt.Errorf("too many arguments given")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	repair := ctx.Bool(verifyRepairFlag.Name)
+	db := utils.MakeChainDatabase(ctx, stack, !repair)
+	defer db.Close()
+
+	report, err := utils.VerifyDatabase(db, ctx.Int(verifyWorkersFlag.Name), repair)
+	if err != nil {
+		return err
+	}
+	if ctx.Bool(verifyJSONFlag.Name) {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	} else {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Check", "Number", "Hash", "Detail", "Repaired"})
+		for _, issue := range report.Issues {
+			table.Append([]string{issue.Check, strconv.FormatUint(uint64(issue.Number), 10), issue.Hash.Hex(), issue.Detail, strconv.FormatBool(issue.Repaired)})
+		}
+		table.Render()
+	}
+	log.Info("Database verified", "blocks", report.Blocks, "txs", report.Transactions, "lookups", report.Lookups, "issues", len(report.Issues), "elapsed", report.Elapsed)
+	var unrepaired int
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			unrepaired++
+		}
+	}
+	if unrepaired > 0 {
+		return fmt.Errorf("found %d unrepaired inconsistencies", unrepaired)
+	}
+	return nil
+}
+
 func freezerInspect(ctx *cli.Context) error {
 	if ctx.NArg() < 4 {
 		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
@@ -556,6 +708,35 @@ func freezerInspect(ctx *cli.Context) error {
 	return rawdb.InspectFreezerTable(ancient, freezer, table, start, end)
 }
 
+func freezerRecompress(ctx *cli.Context) error {
+	if ctx.NArg() != 3 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	var (
+		freezer = ctx.Args().Get(0)
+		table   = ctx.Args().Get(1)
+		codec   = ctx.Args().Get(2)
+		dict    []byte
+	)
+	if path := ctx.String(freezerDictFlag.Name); path != "" {
+		var err error
+		if dict, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("failed to read dictionary: %v", err)
+		}
+	}
+	// Keep the node open to hold the datadir lock during the conversion
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	ancient := stack.ResolveAncient("chaindata", ctx.String(utils.AncientFlag.Name))
+	start := time.Now()
+	if err := rawdb.RecompressFreezerTable(ancient, freezer, table, codec, dict); err != nil {
+		return err
+	}
+	log.Info("Freezer table recompressed", "freezer", freezer, "table", table, "codec", codec, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
 func importLDBdata(ctx *cli.Context) error {
 	start := 0
 	switch ctx.NArg() {
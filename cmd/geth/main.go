@@ -91,6 +91,10 @@ var (
 		utils.GCModeFlag,
 		utils.SnapshotFlag,
 		utils.TxLookupLimitFlag,
+		utils.StateSchemeFlag,
+		utils.StateHistoryFlag,
+		utils.StateDiffsFlag,
+		utils.HistoryKeepFlag,
 		utils.LightServeFlag,
 		utils.LightIngressFlag,
 		utils.LightEgressFlag,
@@ -136,6 +140,12 @@ var (
 		utils.NodeKeyFileFlag,
 		utils.NodeKeyHexFlag,
 		utils.DNSDiscoveryFlag,
+		utils.DiscoveryTopicsFlag,
+		utils.RelayFlag,
+		utils.RelayListenFlag,
+		utils.RelayNodesFlag,
+		utils.EthServeLimitFlag,
+		utils.SnapServeLimitFlag,
 		utils.DeveloperFlag,
 		utils.DeveloperPeriodFlag,
 		utils.DeveloperGasLimitFlag,
@@ -211,6 +221,9 @@ func init() {
 		initCommand,
 		importCommand,
 		exportCommand,
+		importHistoryCommand,
+		exportHistoryCommand,
+		verifyHistoryCommand,
 		importPreimagesCommand,
 		exportPreimagesCommand,
 		removedbCommand,
@@ -17,12 +17,17 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math/big"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/olekukonko/tablewriter"
 	"github.com/rethereum-blockchain/go-rethereum/cmd/utils"
 	"github.com/rethereum-blockchain/go-rethereum/common"
 	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
@@ -39,6 +44,14 @@ import (
 )
 
 var (
+	snapshotTrustedHashFlag = &cli.StringFlag{
+		Name:  "trusted-hash",
+		Usage: "Hash of the trusted block the imported state belongs to",
+	}
+	pruneDryRunFlag = &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Estimate the reclaimable state data without pruning anything",
+	}
 	snapshotCommand = &cli.Command{
 		Name:        "snapshot",
 		Usage:       "A set of commands based on the snapshot",
@@ -52,6 +65,7 @@ var (
 				Flags: flags.Merge([]cli.Flag{
 					utils.CacheTrieJournalFlag,
 					utils.BloomFilterSizeFlag,
+					pruneDryRunFlag,
 				}, utils.NetworkFlags, utils.DatabasePathFlags),
 				Description: `
 geth snapshot prune-state <state-root>
@@ -62,6 +76,10 @@ two version states are available: genesis and the specific one.
 
 The default pruning target is the HEAD-127 state.
 
+The progress is checkpointed periodically, an interrupted pruning resumes from
+the last checkpoint when the command is run again. With --dry-run the stale data
+is only measured and reported per database category, nothing is deleted.
+
 WARNING: It's necessary to delete the trie clean cache after the pruning.
 If you specify another directory for the trie clean cache via "--cache.trie.journal"
 during the use of Geth, please also specify it here for correct deletion. Otherwise
@@ -151,6 +169,38 @@ as the backend data source, making this command a lot faster.
 
 The argument is interpreted as block number or hash. If none is provided, the latest
 block is used.
+`,
+			},
+			{
+				Name:      "export",
+				Usage:     "Export the state of a block into a flat state file",
+				ArgsUsage: "<file> [<blockHash> | <blockNum>]",
+				Action:    exportSnapshot,
+				Flags:     flags.Merge(utils.NetworkFlags, utils.DatabasePathFlags),
+				Description: `
+geth snapshot export <file> [<blockHash> | <blockNum>]
+streams the accounts, storage slots and contract codes of the state of the given
+block (the head block by default) from the snapshot into a chunked, checksummed
+file. Every chunk carries the merkle proof of its boundaries, so the importer can
+verify the file as it goes. The block itself is also included in the file.
+`,
+			},
+			{
+				Name:      "import",
+				Usage:     "Bootstrap the node from a flat state file",
+				ArgsUsage: "<file>",
+				Action:    importSnapshot,
+				Flags: flags.Merge([]cli.Flag{
+					snapshotTrustedHashFlag,
+				}, utils.NetworkFlags, utils.DatabasePathFlags),
+				Description: `
+geth snapshot import <file>
+rebuilds the state tries and the snapshot from a file created by 'geth snapshot
+export', verifying every chunk and the resulting state root against the block in
+the file. The block must either be in the local canonical chain already, or match
+the hash given with --trusted-hash. In both cases the local canonical header chain
+must reach the parent of the block. Once imported, the node is marked as synced
+to the block.
 `,
 			},
 		},
@@ -188,6 +238,23 @@ func pruneState(ctx *cli.Context) error {
 			return err
 		}
 	}
+	if ctx.Bool(pruneDryRunFlag.Name) {
+		stats, err := pruner.Estimate(targetRoot)
+		if err != nil {
+			log.Error("Failed to estimate state pruning", "err", err)
+			return err
+		}
+		var total common.StorageSize
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Database", "Category", "Size", "Items"})
+		for _, stat := range stats {
+			table.Append([]string{stat.Database, stat.Category, stat.Size.String(), fmt.Sprintf("%d", stat.Items)})
+			total += stat.Size
+		}
+		table.SetFooter([]string{"", "Reclaimable", total.String(), " "})
+		table.Render()
+		return nil
+	}
 	if err = pruner.Prune(targetRoot); err != nil {
 		log.Error("Failed to prune state", "err", err)
 		return err
@@ -474,6 +541,181 @@ func traverseRawState(ctx *cli.Context) error {
 	return nil
 }
 
+// snapshotFileVersion is the version of the flat state file format.
+const snapshotFileVersion = 1
+
+// snapshotFileHeader is the leading record of a flat state file, carrying the
+// block the exported state belongs to. It's followed by the state export.
+type snapshotFileHeader struct {
+	Version  uint64
+	Block    *types.Block
+	Receipts []*types.ReceiptForStorage
+	Td       *big.Int
+}
+
+func exportSnapshot(ctx *cli.Context) error {
+	if ctx.NArg() < 1 || ctx.NArg() > 2 {
+		return errors.New("need <file> [<blockHash> | <blockNum>] args")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, true)
+	defer db.Close()
+
+	block := rawdb.ReadHeadBlock(db)
+	if ctx.NArg() == 2 {
+		arg := ctx.Args().Get(1)
+		if hashish(arg) {
+			hash := common.HexToHash(arg)
+			if number := rawdb.ReadHeaderNumber(db, hash); number != nil {
+				block = rawdb.ReadBlock(db, hash, *number)
+			} else {
+				block = nil
+			}
+		} else {
+			number, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				return err
+			}
+			block = rawdb.ReadBlock(db, rawdb.ReadCanonicalHash(db, number), number)
+		}
+	}
+	if block == nil {
+		return errors.New("block not found")
+	}
+	td := rawdb.ReadTd(db, block.Hash(), block.NumberU64())
+	if td == nil {
+		return errors.New("total difficulty not found")
+	}
+	header := &snapshotFileHeader{Version: snapshotFileVersion, Block: block, Td: td}
+	for _, receipt := range rawdb.ReadRawReceipts(db, block.Hash(), block.NumberU64()) {
+		header.Receipts = append(header.Receipts, (*types.ReceiptForStorage)(receipt))
+	}
+	headBlock := rawdb.ReadHeadBlock(db)
+	if headBlock == nil {
+		return errors.New("no head block")
+	}
+	snapconfig := snapshot.Config{
+		CacheSize:  256,
+		Recovery:   false,
+		NoBuild:    true,
+		AsyncBuild: false,
+	}
+	triedb := trie.NewDatabase(db)
+	snaptree, err := snapshot.New(snapconfig, db, triedb, headBlock.Root())
+	if err != nil {
+		return err
+	}
+	// Only the states of the recent blocks are tracked by the snapshot, bail
+	// out before creating the file if the requested one is not among them.
+	if snaptree.Snapshot(block.Root()) == nil {
+		return fmt.Errorf("state of block %d (root %x) is not available in the snapshot, only recent blocks can be exported", block.NumberU64(), block.Root())
+	}
+	file, err := os.Create(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if err := rlp.Encode(w, header); err != nil {
+		return err
+	}
+	log.Info("Exporting state", "number", block.NumberU64(), "hash", block.Hash(), "root", block.Root())
+	if err := snapshot.ExportState(w, snaptree, triedb, db, block.Root()); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func importSnapshot(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("need <file> arg")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, false)
+	defer db.Close()
+
+	file, err := os.Open(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var header snapshotFileHeader
+	if err := rlp.Decode(r, &header); err != nil {
+		return fmt.Errorf("failed to decode file header: %v", err)
+	}
+	if header.Version != snapshotFileVersion {
+		return fmt.Errorf("unsupported file version %d", header.Version)
+	}
+	// Ensure the block is trusted and internally consistent
+	block := header.Block
+	if ctx.IsSet(snapshotTrustedHashFlag.Name) {
+		if trusted := common.HexToHash(ctx.String(snapshotTrustedHashFlag.Name)); block.Hash() != trusted {
+			return fmt.Errorf("block hash mismatch: have %x, trusted %x", block.Hash(), trusted)
+		}
+	} else if canonical := rawdb.ReadCanonicalHash(db, block.NumberU64()); canonical != block.Hash() {
+		return fmt.Errorf("block #%d %x is not canonical, use --%s to trust it", block.NumberU64(), block.Hash(), snapshotTrustedHashFlag.Name)
+	}
+	// The header chain has to reach the parent of the block, the total difficulty
+	// is derived from it and the chain below can't be backfilled afterwards.
+	number := block.NumberU64()
+	if number == 0 || rawdb.ReadCanonicalHash(db, number-1) != block.ParentHash() {
+		return fmt.Errorf("parent of block #%d %x is not in the local canonical chain, sync the headers first", number, block.Hash())
+	}
+	parentTd := rawdb.ReadTd(db, block.ParentHash(), number-1)
+	if parentTd == nil {
+		return fmt.Errorf("total difficulty of parent block #%d %x not found", number-1, block.ParentHash())
+	}
+	td := new(big.Int).Add(parentTd, block.Difficulty())
+	if header.Td.Cmp(td) != 0 {
+		log.Warn("Ignoring mismatching total difficulty in file", "have", header.Td, "want", td)
+	}
+	receipts := make(types.Receipts, len(header.Receipts))
+	for i, receipt := range header.Receipts {
+		receipts[i] = (*types.Receipt)(receipt)
+		if i < len(block.Transactions()) {
+			receipts[i].Type = block.Transactions()[i].Type()
+		}
+	}
+	if root := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); root != block.TxHash() {
+		return fmt.Errorf("transaction root mismatch: have %x, want %x", root, block.TxHash())
+	}
+	if root := types.DeriveSha(receipts, trie.NewStackTrie(nil)); root != block.ReceiptHash() {
+		return fmt.Errorf("receipt root mismatch: have %x, want %x", root, block.ReceiptHash())
+	}
+	if scheme := rawdb.ReadStateScheme(db); scheme == rawdb.PathScheme {
+		return errors.New("importing into the path-based state scheme is not supported")
+	}
+	log.Info("Importing state", "number", block.NumberU64(), "hash", block.Hash(), "root", block.Root())
+	if err := snapshot.ImportState(r, db, rawdb.HashScheme, block.Root()); err != nil {
+		return err
+	}
+	// Mark the node as synced to the block
+	batch := db.NewBatch()
+	rawdb.WriteTd(batch, block.Hash(), block.NumberU64(), td)
+	rawdb.WriteBlock(batch, block)
+	rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), receipts)
+	rawdb.WriteCanonicalHash(batch, block.Hash(), block.NumberU64())
+	rawdb.WriteLastPivotNumber(batch, block.NumberU64())
+	rawdb.WriteHeadHeaderHash(batch, block.Hash())
+	rawdb.WriteHeadFastBlockHash(batch, block.Hash())
+	rawdb.WriteHeadBlockHash(batch, block.Hash())
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Node synced to imported state", "number", block.NumberU64(), "hash", block.Hash())
+	return nil
+}
+
 func parseRoot(input string) (common.Hash, error) {
 	var h common.Hash
 	if err := h.UnmarshalText([]byte(input)); err != nil {
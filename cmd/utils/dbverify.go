@@ -0,0 +1,522 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/common/hexutil"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/state/snapshot"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/trie"
+)
+
+// The checks performed by the database verifier, used to categorize the issues.
+const (
+	VerifyCanonical = "canonical" // Canonical number to hash mappings
+	VerifyFreezer   = "freezer"   // Consistency across the freezer boundary
+	VerifyHeader    = "header"    // Headers and their linkage
+	VerifyBody      = "body"      // Block bodies against the header roots
+	VerifyReceipts  = "receipts"  // Receipts against the header roots
+	VerifyTd        = "td"        // Total difficulties
+	VerifyTxLookup  = "txlookup"  // Transaction lookup entries
+	VerifySnapshot  = "snapshot"  // Snapshot generator and journal
+	VerifyTrie      = "trie"      // Head state trie
+)
+
+// VerifyIssue is an inconsistency found in the database.
+type VerifyIssue struct {
+	Check      string         `json:"check"`
+	Number     hexutil.Uint64 `json:"number"`
+	Hash       common.Hash    `json:"hash,omitempty"`
+	Detail     string         `json:"detail"`
+	Repairable bool           `json:"repairable"`
+	Repaired   bool           `json:"repaired"`
+}
+
+// VerifyReport is the structured result of a database verification.
+type VerifyReport struct {
+	Head         uint64        `json:"head"`
+	Frozen       uint64        `json:"frozen"`
+	Tail         uint64        `json:"tail"`
+	Blocks       uint64        `json:"blocks"`
+	Transactions uint64        `json:"transactions"`
+	Lookups      uint64        `json:"lookups"`
+	Issues       []VerifyIssue `json:"issues"`
+	Elapsed      string        `json:"elapsed"`
+
+	lock sync.Mutex
+}
+
+// report records an issue found by any of the verifier workers.
+func (r *VerifyReport) report(issue VerifyIssue) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	log.Warn("Database inconsistency", "check", issue.Check, "number", uint64(issue.Number), "hash", issue.Hash, "detail", issue.Detail, "repaired", issue.Repaired)
+	r.Issues = append(r.Issues, issue)
+}
+
+// issues returns the number of issues found so far.
+func (r *VerifyReport) issues() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.Issues)
+}
+
+// VerifyDatabase cross-validates the chain data in the key-value store and the
+// freezer, the transaction lookup entries, the snapshot and the head state trie,
+// using the given number of parallel workers. If repair is set, the recoverable
+// inconsistencies (missing canonical mappings, stale mappings shadowed by the
+// freezer, missing or dangling transaction lookups) are fixed along the way.
+func VerifyDatabase(db ethdb.Database, workers int, repair bool) (*VerifyReport, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	head := rawdb.ReadHeadHeaderHash(db)
+	number := rawdb.ReadHeaderNumber(db, head)
+	if number == nil {
+		return nil, errors.New("missing head header")
+	}
+	var (
+		start  = time.Now()
+		report = &VerifyReport{Head: *number}
+	)
+	report.Frozen, _ = db.Ancients()
+	report.Tail, _ = db.Tail()
+
+	v := &verifier{
+		db:     db,
+		kvdb:   rawdb.NewDatabase(db),
+		report: report,
+		repair: repair,
+		head:   head,
+
+		recovered: make(map[uint64]common.Hash),
+	}
+	if tail := rawdb.ReadTxIndexTail(db); tail != nil {
+		v.indexed, v.txTail = true, *tail
+	}
+	log.Info("Verifying chain data", "head", report.Head, "frozen", report.Frozen, "tail", report.Tail, "workers", workers)
+	if err := v.verifyChain(workers); err != nil {
+		return nil, err
+	}
+	log.Info("Verifying transaction lookups", "indexed", v.indexed, "tail", v.txTail)
+	if err := v.verifyLookups(workers); err != nil {
+		return nil, err
+	}
+	headBlock := rawdb.ReadHeadBlockHash(db)
+	if headNumber := rawdb.ReadHeaderNumber(db, headBlock); headNumber != nil {
+		if header := rawdb.ReadHeader(db, headBlock, *headNumber); header != nil {
+			v.verifyState(header)
+		}
+	}
+	report.Blocks = v.blocks.Load()
+	report.Transactions = v.txs.Load()
+	report.Lookups = v.lookups.Load()
+	report.Elapsed = common.PrettyDuration(time.Since(start)).String()
+	return report, nil
+}
+
+// verifier holds the state shared by the database verifier workers.
+type verifier struct {
+	db     ethdb.Database
+	kvdb   ethdb.Database // Key-value store view of the database, bypassing the freezer
+	report *VerifyReport
+	repair bool
+	head   common.Hash // Hash of the head header
+
+	indexed bool   // Whether the transaction index is present
+	txTail  uint64 // First block with indexed transactions
+
+	blocks  atomic.Uint64
+	txs     atomic.Uint64
+	lookups atomic.Uint64
+
+	recovered map[uint64]common.Hash // Canonical hashes recovered for missing mappings
+	lock      sync.Mutex
+}
+
+// issue records an inconsistency, noting if it was repaired.
+func (v *verifier) issue(check string, number uint64, hash common.Hash, repairable bool, format string, args ...interface{}) {
+	v.report.report(VerifyIssue{
+		Check:      check,
+		Number:     hexutil.Uint64(number),
+		Hash:       hash,
+		Detail:     fmt.Sprintf(format, args...),
+		Repairable: repairable,
+		Repaired:   repairable && v.repair,
+	})
+}
+
+// flush writes out the repairs accumulated in the batch if it grew large, or
+// unconditionally if force is set.
+func flush(batch ethdb.Batch, force bool) error {
+	if batch.ValueSize() == 0 || (!force && batch.ValueSize() < ethdb.IdealBatchSize) {
+		return nil
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	batch.Reset()
+	return nil
+}
+
+// verifyChain checks every canonical block from the genesis to the head header
+// in parallel.
+func (v *verifier) verifyChain(workers int) error {
+	var (
+		numbers = make(chan uint64, 4*workers)
+		errc    = make(chan error, workers)
+		abort   = make(chan struct{})
+		aborted sync.Once
+		logged  = time.Now()
+	)
+	for i := 0; i < workers; i++ {
+		go func() {
+			batch := v.db.NewBatch()
+			for number := range numbers {
+				v.verifyBlock(batch, number)
+				if err := flush(batch, false); err != nil {
+					errc <- err
+					aborted.Do(func() { close(abort) })
+					for range numbers {
+					}
+					return
+				}
+				v.blocks.Add(1)
+			}
+			errc <- flush(batch, true)
+		}()
+	}
+loop:
+	for number := uint64(0); number <= v.report.Head; number++ {
+		select {
+		case numbers <- number:
+		case <-abort:
+			break loop
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Verifying chain data", "number", number, "head", v.report.Head, "issues", v.report.issues())
+			logged = time.Now()
+		}
+	}
+	close(numbers)
+
+	var err error
+	for i := 0; i < workers; i++ {
+		if e := <-errc; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// canonicalHash resolves the canonical hash of the given block number. If the
+// mapping is missing, it is recovered from the parent hash of the next block.
+func (v *verifier) canonicalHash(batch ethdb.Batch, number uint64) (common.Hash, bool) {
+	if hash := rawdb.ReadCanonicalHash(v.db, number); hash != (common.Hash{}) {
+		return hash, true
+	}
+	var hash common.Hash
+	if number == v.report.Head {
+		hash = v.head
+	} else if next := rawdb.ReadCanonicalHash(v.db, number+1); next != (common.Hash{}) {
+		if header := rawdb.ReadHeader(v.db, next, number+1); header != nil {
+			hash = header.ParentHash
+		}
+	}
+	if hash == (common.Hash{}) || !rawdb.HasHeader(v.db, hash, number) {
+		v.issue(VerifyCanonical, number, common.Hash{}, false, "missing canonical hash")
+		return common.Hash{}, false
+	}
+	v.issue(VerifyCanonical, number, hash, true, "missing canonical hash")
+
+	v.lock.Lock()
+	v.recovered[number] = hash
+	v.lock.Unlock()
+
+	if v.repair {
+		rawdb.WriteCanonicalHash(batch, hash, number)
+	}
+	return hash, true
+}
+
+// verifyBlock checks the canonical mapping, header, body, receipts, total
+// difficulty and transaction lookups of a single canonical block.
+func (v *verifier) verifyBlock(batch ethdb.Batch, number uint64) {
+	hash, ok := v.canonicalHash(batch, number)
+	if !ok {
+		return
+	}
+	// Leftover mappings in the key-value store below the freezer boundary are
+	// shadowed by the freezer, they must not contradict it
+	if number < v.report.Frozen {
+		if stale := rawdb.ReadCanonicalHash(v.kvdb, number); stale != (common.Hash{}) && stale != hash {
+			v.issue(VerifyFreezer, number, stale, true, "key-value canonical hash contradicts freezer %x", hash)
+			if v.repair {
+				rawdb.DeleteCanonicalHash(batch, number)
+			}
+		}
+	}
+	header := rawdb.ReadHeader(v.db, hash, number)
+	switch {
+	case header == nil:
+		v.issue(VerifyHeader, number, hash, false, "missing header")
+		return
+	case header.Hash() != hash:
+		v.issue(VerifyHeader, number, hash, false, "header hash mismatch: have %x", header.Hash())
+		return
+	case header.Number.Uint64() != number:
+		v.issue(VerifyHeader, number, hash, false, "header number mismatch: have %d", header.Number)
+		return
+	}
+	if number > 0 {
+		if parent := rawdb.ReadCanonicalHash(v.db, number-1); parent != (common.Hash{}) && parent != header.ParentHash {
+			v.issue(VerifyHeader, number, hash, false, "parent hash mismatch: have %x, canonical %x", header.ParentHash, parent)
+		}
+	}
+	v.verifyTd(header)
+
+	// Bodies and receipts below the history tail are expired
+	if number < v.report.Tail {
+		return
+	}
+	body := rawdb.ReadBody(v.db, hash, number)
+	if body == nil {
+		v.issue(VerifyBody, number, hash, false, "missing body")
+		return
+	}
+	hasher := trie.NewStackTrie(nil)
+	if root := types.DeriveSha(types.Transactions(body.Transactions), hasher); root != header.TxHash {
+		v.issue(VerifyBody, number, hash, false, "transaction root mismatch: have %x, want %x", root, header.TxHash)
+	}
+	if uncles := types.CalcUncleHash(body.Uncles); uncles != header.UncleHash {
+		v.issue(VerifyBody, number, hash, false, "uncle hash mismatch: have %x, want %x", uncles, header.UncleHash)
+	}
+	if header.WithdrawalsHash != nil {
+		if root := types.DeriveSha(types.Withdrawals(body.Withdrawals), hasher); root != *header.WithdrawalsHash {
+			v.issue(VerifyBody, number, hash, false, "withdrawals root mismatch: have %x, want %x", root, *header.WithdrawalsHash)
+		}
+	}
+	v.txs.Add(uint64(len(body.Transactions)))
+	v.verifyReceipts(header, body)
+	v.verifyTxLookups(batch, header, body)
+}
+
+// verifyTd checks that the total difficulty of a block is present and extends
+// the one of its parent.
+func (v *verifier) verifyTd(header *types.Header) {
+	var (
+		hash   = header.Hash()
+		number = header.Number.Uint64()
+	)
+	td := rawdb.ReadTd(v.db, hash, number)
+	if td == nil {
+		v.issue(VerifyTd, number, hash, false, "missing total difficulty")
+		return
+	}
+	if number == 0 {
+		return
+	}
+	if parent := rawdb.ReadTd(v.db, header.ParentHash, number-1); parent != nil {
+		if want := new(big.Int).Add(parent, header.Difficulty); td.Cmp(want) != 0 {
+			v.issue(VerifyTd, number, hash, false, "total difficulty mismatch: have %v, want %v", td, want)
+		}
+	}
+}
+
+// verifyReceipts checks that the receipts of a block match its receipt root.
+func (v *verifier) verifyReceipts(header *types.Header, body *types.Body) {
+	var (
+		hash   = header.Hash()
+		number = header.Number.Uint64()
+	)
+	receipts := rawdb.ReadRawReceipts(v.db, hash, number)
+	if receipts == nil && len(body.Transactions) > 0 {
+		v.issue(VerifyReceipts, number, hash, false, "missing receipts")
+		return
+	}
+	if len(receipts) != len(body.Transactions) {
+		v.issue(VerifyReceipts, number, hash, false, "receipt count mismatch: have %d, want %d", len(receipts), len(body.Transactions))
+		return
+	}
+	// The stored receipts lack the transaction type, which is part of the
+	// consensus encoding
+	for i, receipt := range receipts {
+		receipt.Type = body.Transactions[i].Type()
+	}
+	if root := types.DeriveSha(receipts, trie.NewStackTrie(nil)); root != header.ReceiptHash {
+		v.issue(VerifyReceipts, number, hash, false, "receipt root mismatch: have %x, want %x", root, header.ReceiptHash)
+	}
+}
+
+// verifyTxLookups checks that the transactions of an indexed block have lookup
+// entries pointing at it.
+func (v *verifier) verifyTxLookups(batch ethdb.Batch, header *types.Header, body *types.Body) {
+	number := header.Number.Uint64()
+	if !v.indexed || number < v.txTail {
+		return
+	}
+	for _, tx := range body.Transactions {
+		switch entry := rawdb.ReadTxLookupEntry(v.db, tx.Hash()); {
+		case entry == nil:
+			v.issue(VerifyTxLookup, number, tx.Hash(), true, "missing transaction lookup")
+		case *entry != number:
+			v.issue(VerifyTxLookup, number, tx.Hash(), true, "transaction lookup points at block %d", *entry)
+		default:
+			continue
+		}
+		if v.repair {
+			rawdb.WriteTxLookupEntries(batch, number, []common.Hash{tx.Hash()})
+		}
+	}
+}
+
+// verifyLookups iterates all the transaction lookup entries in parallel, split
+// by the first nibble of the transaction hashes, and checks that each of them
+// points at a canonical block containing the transaction.
+func (v *verifier) verifyLookups(workers int) error {
+	var (
+		prefixes = make(chan byte, 16)
+		errc     = make(chan error, workers)
+	)
+	for i := 0; i < 16; i++ {
+		prefixes <- byte(i)
+	}
+	close(prefixes)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			batch := v.db.NewBatch()
+			for nibble := range prefixes {
+				for b := nibble << 4; ; b++ {
+					if err := v.verifyLookupRange(batch, b); err != nil {
+						errc <- err
+						return
+					}
+					if b&0x0f == 0x0f {
+						break
+					}
+				}
+			}
+			errc <- flush(batch, true)
+		}()
+	}
+	var err error
+	for i := 0; i < workers; i++ {
+		if e := <-errc; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// verifyLookupRange checks the transaction lookups with hashes starting with
+// the given byte.
+func (v *verifier) verifyLookupRange(batch ethdb.Batch, prefix byte) error {
+	var err error
+	iterErr := rawdb.IterateTxLookupEntries(v.db, []byte{prefix}, func(hash common.Hash, number *uint64) bool {
+		v.lookups.Add(1)
+
+		switch {
+		case number == nil:
+			v.issue(VerifyTxLookup, 0, hash, true, "undecodable transaction lookup")
+		case *number > v.report.Head:
+			v.issue(VerifyTxLookup, *number, hash, true, "dangling transaction lookup above head")
+		case *number < v.report.Tail:
+			return true // bodies expired, nothing to check against
+		default:
+			if v.hasTransaction(*number, hash) {
+				return true
+			}
+			v.issue(VerifyTxLookup, *number, hash, true, "dangling transaction lookup")
+		}
+		if v.repair {
+			rawdb.DeleteTxLookupEntry(batch, hash)
+			if err = flush(batch, false); err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if iterErr != nil {
+		return iterErr
+	}
+	return err
+}
+
+// hasTransaction reports whether the canonical block with the given number
+// contains the transaction. Canonical mappings found missing during the chain
+// verification are resolved to the recovered hashes, so the lookups of those
+// blocks are not reported as dangling.
+func (v *verifier) hasTransaction(number uint64, txhash common.Hash) bool {
+	hash := rawdb.ReadCanonicalHash(v.db, number)
+	if hash == (common.Hash{}) {
+		v.lock.Lock()
+		hash = v.recovered[number]
+		v.lock.Unlock()
+	}
+	body := rawdb.ReadBody(v.db, hash, number)
+	if body == nil {
+		return false
+	}
+	for _, tx := range body.Transactions {
+		if tx.Hash() == txhash {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyState checks that the state of the head block is present in the trie
+// database and covered by the snapshot.
+func (v *verifier) verifyState(header *types.Header) {
+	number := header.Number.Uint64()
+
+	switch rawdb.ReadStateScheme(v.db) {
+	case rawdb.HashScheme:
+		if !rawdb.HasLegacyTrieNode(v.db, header.Root) {
+			v.issue(VerifyTrie, number, header.Root, false, "missing head state root, the chain will be rewound on startup")
+		}
+	case rawdb.PathScheme:
+		// The persisted state of the path scheme lags behind the head, the
+		// rest being journalled. Ensure the persisted root is present.
+		if blob, _ := rawdb.ReadAccountTrieNode(v.db, nil); len(blob) == 0 {
+			v.issue(VerifyTrie, number, header.Root, false, "missing persisted state root")
+		}
+	default:
+		v.issue(VerifyTrie, number, header.Root, false, "missing state")
+	}
+	if rawdb.ReadSnapshotRoot(v.db) == (common.Hash{}) {
+		log.Info("No snapshot to verify")
+		return
+	}
+	if err := snapshot.CheckConsistency(v.db, header.Root); err != nil {
+		v.issue(VerifySnapshot, number, header.Root, false, "%v", err)
+	}
+}
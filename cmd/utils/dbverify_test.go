@@ -0,0 +1,129 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/consensus/ethash"
+	"github.com/rethereum-blockchain/go-rethereum/core"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/core/vm"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb/memorydb"
+	"github.com/rethereum-blockchain/go-rethereum/params"
+)
+
+func TestVerifyDatabase(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		config  = *params.TestChainConfig
+		count   = 100
+	)
+	config.RethereumForks = &params.RethereumForks{}
+	signer := types.LatestSigner(&config)
+
+	gspec := &core.Genesis{
+		Config: &config,
+		Alloc:  core.GenesisAlloc{address: {Balance: big.NewInt(params.Ether)}},
+	}
+	_, blocks, _ := core.GenerateChainWithGenesis(gspec, ethash.NewFaker(), count, func(i int, b *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), common.Address{0xaa}, big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, key)
+		b.AddTx(tx)
+	})
+	db, err := rawdb.NewDatabaseWithFreezer(memorydb.New(), t.TempDir(), "", false)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	chain, err := core.NewBlockChain(db, nil, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("unable to initialize chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("error inserting chain: %v", err)
+	}
+	chain.Stop()
+
+	if err := db.(interface{ Freeze(uint64) error }).Freeze(10); err != nil {
+		t.Fatalf("failed to freeze chain: %v", err)
+	}
+	if frozen, _ := db.Ancients(); frozen == 0 {
+		t.Fatalf("nothing frozen")
+	}
+	rawdb.WriteTxIndexTail(db, 0)
+
+	// A consistent database must verify cleanly
+	report, err := VerifyDatabase(db, 4, false)
+	if err != nil {
+		t.Fatalf("failed to verify database: %v", err)
+	}
+	if len(report.Issues) != 0 {
+		t.Fatalf("unexpected issues in consistent database: %+v", report.Issues)
+	}
+	if report.Blocks != uint64(count+1) || report.Transactions != uint64(count) {
+		t.Fatalf("verified content mismatch: have %d blocks %d txs, want %d blocks %d txs", report.Blocks, report.Transactions, count+1, count)
+	}
+	// Introduce recoverable inconsistencies and ensure they're found and fixed
+	rawdb.DeleteCanonicalHash(db, 95)
+	rawdb.WriteCanonicalHash(db, common.Hash{0x01}, 5)
+	rawdb.DeleteTxLookupEntry(db, blocks[96].Transactions()[0].Hash())
+	rawdb.WriteTxLookupEntries(db, 20, []common.Hash{{0x02}})
+
+	report, err = VerifyDatabase(db, 4, false)
+	if err != nil {
+		t.Fatalf("failed to verify database: %v", err)
+	}
+	checks := make(map[string]int)
+	for _, issue := range report.Issues {
+		if !issue.Repairable || issue.Repaired {
+			t.Errorf("issue %+v: unexpected repair state", issue)
+		}
+		checks[issue.Check]++
+	}
+	if checks[VerifyCanonical] != 1 || checks[VerifyFreezer] != 1 || checks[VerifyTxLookup] != 2 || len(report.Issues) != 4 {
+		t.Fatalf("issue mismatch: %+v", report.Issues)
+	}
+	if report, err = VerifyDatabase(db, 4, true); err != nil {
+		t.Fatalf("failed to repair database: %v", err)
+	}
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			t.Errorf("issue %+v: not repaired", issue)
+		}
+	}
+	report, err = VerifyDatabase(db, 4, false)
+	if err != nil {
+		t.Fatalf("failed to verify database: %v", err)
+	}
+	if len(report.Issues) != 0 {
+		t.Fatalf("unexpected issues in repaired database: %+v", report.Issues)
+	}
+	// Unrecoverable corruptions must be reported as such
+	rawdb.DeleteReceipts(db, blocks[97].Hash(), blocks[97].NumberU64())
+	if report, err = VerifyDatabase(db, 4, true); err != nil {
+		t.Fatalf("failed to verify database: %v", err)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Check != VerifyReceipts || report.Issues[0].Repaired {
+		t.Fatalf("issue mismatch: %+v", report.Issues)
+	}
+}
@@ -73,6 +73,7 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
 	"github.com/rethereum-blockchain/go-rethereum/p2p/nat"
 	"github.com/rethereum-blockchain/go-rethereum/p2p/netutil"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/relay"
 	"github.com/rethereum-blockchain/go-rethereum/params"
 	"github.com/rethereum-blockchain/go-rethereum/rlp"
 	"github.com/rethereum-blockchain/go-rethereum/rpc"
@@ -111,6 +112,11 @@ var (
 		Usage:    "Root directory for ancient data (default = inside chaindata)",
 		Category: flags.EthCategory,
 	}
+	RemoteAncientFlag = &cli.StringFlag{
+		Name:     "datadir.ancient.remote",
+		Usage:    "URL of a read-only remote ancient store served over HTTP (key-value data stays local)",
+		Category: flags.EthCategory,
+	}
 	MinFreeDiskSpaceFlag = &flags.DirectoryFlag{
 		Name:     "datadir.minfreedisk",
 		Usage:    "Minimum free disk space in MB, once reached triggers auto shut down (default = --cache.gc converted to MB, 0 = disabled)",
@@ -248,6 +254,27 @@ var (
 		Value:    ethconfig.Defaults.TxLookupLimit,
 		Category: flags.EthCategory,
 	}
+	StateSchemeFlag = &cli.StringFlag{
+		Name:     "state.scheme",
+		Usage:    "Scheme to use for storing ethereum state ('hash' or 'path')",
+		Category: flags.EthCategory,
+	}
+	StateHistoryFlag = &cli.Uint64Flag{
+		Name:     "state.history",
+		Usage:    "Number of recent blocks to retain state history for, path scheme only (default = 90,000 blocks, 0 = entire chain)",
+		Value:    ethconfig.Defaults.StateHistory,
+		Category: flags.EthCategory,
+	}
+	StateDiffsFlag = &cli.BoolFlag{
+		Name:     "state.diffs",
+		Usage:    "Keep the flat state diffs of every block to serve historical state (requires full sync from genesis)",
+		Category: flags.EthCategory,
+	}
+	HistoryKeepFlag = &cli.Uint64Flag{
+		Name:     "history.keep",
+		Usage:    "Number of recent blocks to retain the bodies and receipts for, headers are always kept (0 = entire chain)",
+		Category: flags.EthCategory,
+	}
 	LightKDFFlag = &cli.BoolFlag{
 		Name:     "lightkdf",
 		Usage:    "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -854,12 +881,42 @@ var (
 		Usage:    "Sets DNS discovery entry points (use \"\" to disable DNS)",
 		Category: flags.NetworkingCategory,
 	}
+	DiscoveryTopicsFlag = &cli.StringFlag{
+		Name:     "discovery.topics",
+		Usage:    "Comma separated list of extra topics to advertise via V5 discovery (e.g. stratum)",
+		Category: flags.NetworkingCategory,
+	}
+	RelayFlag = &cli.BoolFlag{
+		Name:     "relay",
+		Usage:    "Connects to nodes behind NAT through the relay advertised in their node record",
+		Category: flags.NetworkingCategory,
+	}
+	RelayListenFlag = &cli.StringFlag{
+		Name:     "relay.listen",
+		Usage:    "Relays connections to nodes behind NAT, accepting them on the given TCP address (implies --relay)",
+		Category: flags.NetworkingCategory,
+	}
+	RelayNodesFlag = &cli.StringFlag{
+		Name:     "relay.nodes",
+		Usage:    "Comma separated enode URLs of relays forwarding connections to this node (implies --relay)",
+		Category: flags.NetworkingCategory,
+	}
 	DiscoveryPortFlag = &cli.IntFlag{
 		Name:     "discovery.port",
 		Usage:    "Use a custom UDP port for P2P discovery",
 		Value:    30303,
 		Category: flags.NetworkingCategory,
 	}
+	EthServeLimitFlag = &cli.Float64Flag{
+		Name:     "eth.servelimit",
+		Usage:    "Maximum bandwidth in MB/s for serving eth requests across all peers (0 = unlimited)",
+		Category: flags.NetworkingCategory,
+	}
+	SnapServeLimitFlag = &cli.Float64Flag{
+		Name:     "snap.servelimit",
+		Usage:    "Maximum bandwidth in MB/s for serving snap requests across all peers (0 = unlimited)",
+		Category: flags.NetworkingCategory,
+	}
 
 	// Console
 	JSpathFlag = &flags.DirectoryFlag{
@@ -1011,6 +1068,7 @@ var (
 	DatabasePathFlags = []cli.Flag{
 		DataDirFlag,
 		AncientFlag,
+		RemoteAncientFlag,
 		RemoteDBFlag,
 		HttpHeaderFlag,
 	}
@@ -1438,6 +1496,14 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		cfg.DiscoveryV5 = true
 	}
 
+	if ctx.IsSet(DiscoveryTopicsFlag.Name) {
+		cfg.DiscoveryTopics = SplitAndTrim(ctx.String(DiscoveryTopicsFlag.Name))
+	}
+
+	if ctx.Bool(RelayFlag.Name) || ctx.IsSet(RelayListenFlag.Name) || ctx.IsSet(RelayNodesFlag.Name) {
+		cfg.Dialer = relay.NewDialer(cfg.Dialer)
+	}
+
 	if netrestrict := ctx.String(NetrestrictFlag.Name); netrestrict != "" {
 		list, err := netutil.ParseNetlist(netrestrict)
 		if err != nil {
@@ -1777,8 +1843,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 		cfg.DatabaseCache = ctx.Int(CacheFlag.Name) * ctx.Int(CacheDatabaseFlag.Name) / 100
 	}
 	cfg.DatabaseHandles = MakeDatabaseHandles(ctx.Int(FDLimitFlag.Name))
-	if ctx.IsSet(AncientFlag.Name) {
-		cfg.DatabaseFreezer = ctx.String(AncientFlag.Name)
+	CheckExclusive(ctx, AncientFlag, RemoteAncientFlag)
+	if ctx.IsSet(AncientFlag.Name) || ctx.IsSet(RemoteAncientFlag.Name) {
+		cfg.DatabaseFreezer = ancientLocation(ctx)
 	}
 
 	if gcmode := ctx.String(GCModeFlag.Name); gcmode != "full" && gcmode != "archive" {
@@ -1799,6 +1866,15 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.IsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.Uint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.IsSet(StateSchemeFlag.Name) {
+		cfg.StateScheme = ctx.String(StateSchemeFlag.Name)
+	}
+	if cfg.StateScheme == rawdb.PathScheme && cfg.NoPruning {
+		Fatalf("--%s=archive is not supported with --%s=%s", GCModeFlag.Name, StateSchemeFlag.Name, rawdb.PathScheme)
+	}
+	if ctx.IsSet(StateHistoryFlag.Name) {
+		cfg.StateHistory = ctx.Uint64(StateHistoryFlag.Name)
+	}
 	if ctx.IsSet(CacheFlag.Name) || ctx.IsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.Int(CacheFlag.Name) * ctx.Int(CacheTrieFlag.Name) / 100
 	}
@@ -1826,6 +1902,19 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 			cfg.SnapshotCache = 0 // Disabled
 		}
 	}
+	if ctx.Bool(StateDiffsFlag.Name) {
+		if cfg.SnapshotCache == 0 {
+			Fatalf("--%s requires --%s", StateDiffsFlag.Name, SnapshotFlag.Name)
+		}
+		if ctx.IsSet(SyncModeFlag.Name) && cfg.SyncMode != downloader.FullSync {
+			Fatalf("--%s requires --%s=full", StateDiffsFlag.Name, SyncModeFlag.Name)
+		}
+		cfg.SyncMode = downloader.FullSync
+		cfg.StateDiffs = true
+	}
+	if ctx.IsSet(HistoryKeepFlag.Name) {
+		cfg.HistoryKeep = ctx.Uint64(HistoryKeepFlag.Name)
+	}
 	if ctx.IsSet(DocRootFlag.Name) {
 		cfg.DocRoot = ctx.String(DocRootFlag.Name)
 	}
@@ -1858,6 +1947,12 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 			cfg.EthDiscoveryURLs = SplitAndTrim(urls)
 		}
 	}
+	if ctx.IsSet(EthServeLimitFlag.Name) {
+		cfg.EthServeLimit = uint64(ctx.Float64(EthServeLimitFlag.Name) * 1024 * 1024)
+	}
+	if ctx.IsSet(SnapServeLimitFlag.Name) {
+		cfg.SnapServeLimit = uint64(ctx.Float64(SnapServeLimitFlag.Name) * 1024 * 1024)
+	}
 
 	// Override any default configs for hard coded networks.
 	switch {
@@ -2025,6 +2120,27 @@ func RegisterEthStatsService(stack *node.Node, backend ethapi.Backend, url strin
 	}
 }
 
+// MakeRelayConfig creates the relay configuration from the command line flags.
+func MakeRelayConfig(ctx *cli.Context) relay.Config {
+	cfg := relay.Config{ListenAddr: ctx.String(RelayListenFlag.Name)}
+	for _, url := range SplitAndTrim(ctx.String(RelayNodesFlag.Name)) {
+		node, err := enode.Parse(enode.ValidSchemes, url)
+		if err != nil {
+			Fatalf("Option %q: invalid relay URL %q: %v", RelayNodesFlag.Name, url, err)
+		}
+		cfg.Relays = append(cfg.Relays, node)
+	}
+	return cfg
+}
+
+// RegisterRelayService adds the relay protocol to the node, forwarding
+// connections to nodes behind NAT and registering with the configured relays.
+func RegisterRelayService(stack *node.Node, cfg relay.Config) {
+	r := relay.New(stack.Server(), cfg)
+	stack.RegisterProtocols(r.Protocols())
+	stack.RegisterLifecycle(r)
+}
+
 // RegisterGraphQLService adds the GraphQL API to the node.
 func RegisterGraphQLService(stack *node.Node, backend ethapi.Backend, filterSystem *filters.FilterSystem, cfg *node.Config) {
 	err := graphql.New(stack, backend, filterSystem, cfg.GraphQLCors, cfg.GraphQLVirtualHosts)
@@ -2162,7 +2278,7 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node, readonly bool) ethdb.
 	case ctx.String(SyncModeFlag.Name) == "light":
 		chainDb, err = stack.OpenDatabase("lightchaindata", cache, handles, "", readonly)
 	default:
-		chainDb, err = stack.OpenDatabaseWithFreezer("chaindata", cache, handles, ctx.String(AncientFlag.Name), "", readonly)
+		chainDb, err = stack.OpenDatabaseWithFreezer("chaindata", cache, handles, ancientLocation(ctx), "", readonly)
 	}
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
@@ -2170,6 +2286,19 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node, readonly bool) ethdb.
 	return chainDb
 }
 
+// ancientLocation returns the location of the ancient store, either the URL of
+// a remote store or the local ancient directory.
+func ancientLocation(ctx *cli.Context) string {
+	if ctx.IsSet(RemoteAncientFlag.Name) {
+		url := ctx.String(RemoteAncientFlag.Name)
+		if !rawdb.IsRemoteAncient(url) {
+			Fatalf("--%s must be an http:// or https:// URL", RemoteAncientFlag.Name)
+		}
+		return url
+	}
+	return ctx.String(AncientFlag.Name)
+}
+
 func IsNetworkPreset(ctx *cli.Context) bool {
 	for _, flag := range NetworkFlags {
 		bFlag, _ := flag.(*cli.BoolFlag)
@@ -2247,7 +2376,15 @@ func MakeChain(ctx *cli.Context, stack *node.Node, readonly bool) (*core.BlockCh
 		TrieTimeLimit:       ethconfig.Defaults.TrieTimeout,
 		SnapshotLimit:       ethconfig.Defaults.SnapshotCache,
 		Preimages:           ctx.Bool(CachePreimagesFlag.Name),
+		StateHistory:        ctx.Uint64(StateHistoryFlag.Name),
+		StateDiffs:          ctx.Bool(StateDiffsFlag.Name),
+	}
+	scheme, err := rawdb.ParseStateScheme(ctx.String(StateSchemeFlag.Name), chainDb)
+	if err != nil {
+		Fatalf("%v", err)
 	}
+	cache.StateScheme = scheme
+
 	if cache.TrieDirtyDisabled && !cache.Preimages {
 		cache.Preimages = true
 		log.Info("Enabling recording of key preimages since archive mode is used")
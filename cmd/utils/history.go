@@ -0,0 +1,396 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/internal/era"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/params"
+	"github.com/rethereum-blockchain/go-rethereum/trie"
+)
+
+// historyChecksumsFile is the name of the file listing the SHA256 checksums of
+// the Era1 archives in an exported history directory.
+const historyChecksumsFile = "checksums.txt"
+
+// historyReportLimit is the time limit during history export and import after
+// which progress is reported.
+const historyReportLimit = 8 * time.Second
+
+// historyHeaderCheckFrequency is the rate at which the seals of the imported
+// headers are verified.
+const historyHeaderCheckFrequency = 100
+
+// HistoryNetworkName returns the network name used in the Era1 file names of
+// the chain with the given config.
+func HistoryNetworkName(config *params.ChainConfig) string {
+	if name, ok := params.NetworkNames[config.ChainID.String()]; ok {
+		return strings.ToLower(strings.Fields(name)[0])
+	}
+	return "unknown"
+}
+
+// ExportHistory exports the canonical blocks in the given range, along with
+// their receipts and total difficulties, into Era1 archives of step blocks each.
+// A checksum file listing the SHA256 hash of every archive is also written.
+func ExportHistory(bc *core.BlockChain, dir string, first, last, step uint64) error {
+	log.Info("Exporting blockchain history", "dir", dir)
+
+	if step == 0 || step > uint64(era.MaxEra1Size) {
+		return fmt.Errorf("invalid archive size %d, must be in [1, %d]", step, era.MaxEra1Size)
+	}
+	if first%step != 0 {
+		return fmt.Errorf("first block %d not aligned to archive size %d", first, step)
+	}
+	if head := bc.CurrentBlock().Number.Uint64(); head < last {
+		log.Warn("Last block beyond head, setting last = head", "head", head, "last", last)
+		last = head
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("error creating output directory: %w", err)
+	}
+	var (
+		network   = HistoryNetworkName(bc.Config())
+		start     = time.Now()
+		reported  = time.Now()
+		checksums []string
+	)
+	for i := first; i <= last; i += step {
+		end := i + step - 1
+		if end > last {
+			end = last
+		}
+		checksum, err := exportEra1(bc, dir, network, i, end, step)
+		if err != nil {
+			return err
+		}
+		checksums = append(checksums, checksum)
+
+		if time.Since(reported) >= historyReportLimit {
+			log.Info("Exporting blocks", "exported", i, "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, historyChecksumsFile), []byte(strings.Join(checksums, "\n")), os.ModePerm); err != nil {
+		return err
+	}
+	log.Info("Exported blockchain history", "dir", dir, "archives", len(checksums), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// exportEra1 writes the canonical blocks in the range [first, last] into an
+// Era1 archive, returning the checksum of the resulting file.
+func exportEra1(bc *core.BlockChain, dir string, network string, first, last, step uint64) (string, error) {
+	filename := filepath.Join(dir, era.Filename(network, int(first/step), common.Hash{}))
+	f, err := os.Create(filename)
+	if err != nil {
+		return "", fmt.Errorf("could not create era1 file: %w", err)
+	}
+	defer f.Close()
+
+	w := era.NewBuilder(f)
+	for n := first; n <= last; n++ {
+		block := bc.GetBlockByNumber(n)
+		if block == nil {
+			return "", fmt.Errorf("export failed on #%d: not found", n)
+		}
+		receipts := bc.GetReceiptsByHash(block.Hash())
+		if receipts == nil {
+			return "", fmt.Errorf("export failed on #%d: receipts not found", n)
+		}
+		td := bc.GetTd(block.Hash(), block.NumberU64())
+		if td == nil {
+			return "", fmt.Errorf("export failed on #%d: total difficulty not found", n)
+		}
+		if err := w.Add(block, receipts, td); err != nil {
+			return "", err
+		}
+	}
+	root, err := w.Finalize()
+	if err != nil {
+		return "", fmt.Errorf("export failed to finalize #%d: %w", first, err)
+	}
+	// Set correct filename with root and compute the checksum of the archive
+	if err := os.Rename(filename, filepath.Join(dir, era.Filename(network, int(first/step), root))); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return fileChecksum(f)
+}
+
+// ImportHistory imports the Era1 archives of the given network found in the
+// directory into a chain synced from genesis. Headers, bodies and receipts are
+// imported without executing the blocks, the state has to be synced later.
+func ImportHistory(chain *core.BlockChain, dir string, network string) error {
+	entries, checksums, err := readHistoryDir(dir, network)
+	if err != nil {
+		return err
+	}
+	var (
+		start    = time.Now()
+		reported = time.Now()
+		imported = 0
+	)
+	for i, filename := range entries {
+		err := withEra1(filepath.Join(dir, filename), checksums[i], func(e *era.Era) error {
+			var (
+				headers  []*types.Header
+				blocks   types.Blocks
+				receipts []types.Receipts
+				it       = era.NewIterator(e)
+				head     = chain.CurrentSnapBlock().Number.Uint64()
+			)
+			for it.Next() {
+				block := it.Block()
+				// Skip the blocks already imported, making sure they match
+				if number := block.NumberU64(); number <= head {
+					if hash := chain.GetCanonicalHash(number); hash != block.Hash() {
+						return fmt.Errorf("block #%d mismatch: have %x, want %x", number, hash, block.Hash())
+					}
+					continue
+				}
+				headers = append(headers, block.Header())
+				blocks = append(blocks, block)
+				receipts = append(receipts, it.Receipts())
+			}
+			if it.Error() != nil {
+				return it.Error()
+			}
+			if len(blocks) == 0 {
+				return nil
+			}
+			if n, err := chain.InsertHeaderChain(headers, historyHeaderCheckFrequency); err != nil {
+				return fmt.Errorf("error inserting header #%d: %w", headers[n].Number, err)
+			}
+			// Write the blocks into the key-value store, the chain freezer will
+			// migrate them into the ancient store once they are old enough.
+			if _, err := chain.InsertReceiptChain(blocks, receipts, 0); err != nil {
+				return fmt.Errorf("error inserting blocks #%d-#%d: %w", blocks[0].NumberU64(), blocks[len(blocks)-1].NumberU64(), err)
+			}
+			imported += len(blocks)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %w", filename, err)
+		}
+		if time.Since(reported) >= historyReportLimit {
+			log.Info("Importing Era1 files", "head", chain.CurrentSnapBlock().Number, "imported", imported, "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
+	}
+	log.Info("Imported blockchain history", "head", chain.CurrentSnapBlock().Number, "imported", imported, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// VerifyHistory checks the integrity of the Era1 archives of the given network
+// found in the directory, and verifies their contents against the local header
+// chain. The archives covering blocks beyond the local head are only checked
+// for integrity.
+func VerifyHistory(chain *core.BlockChain, dir string, network string) error {
+	entries, checksums, err := readHistoryDir(dir, network)
+	if err != nil {
+		return err
+	}
+	var (
+		start    = time.Now()
+		reported = time.Now()
+		verified = 0
+	)
+	for i, filename := range entries {
+		err := withEra1(filepath.Join(dir, filename), checksums[i], func(e *era.Era) error {
+			it := era.NewIterator(e)
+			for it.Next() {
+				header := chain.GetHeaderByNumber(it.Number())
+				if header == nil {
+					break // Beyond the local chain
+				}
+				if header.Hash() != it.Block().Hash() {
+					return fmt.Errorf("block #%d mismatch: have %x, want %x", it.Number(), it.Block().Hash(), header.Hash())
+				}
+				if td := chain.GetTd(header.Hash(), it.Number()); td == nil || td.Cmp(it.TotalDifficulty()) != 0 {
+					return fmt.Errorf("total difficulty #%d mismatch: have %v, want %v", it.Number(), it.TotalDifficulty(), td)
+				}
+				verified++
+			}
+			return it.Error()
+		})
+		if err != nil {
+			return fmt.Errorf("failed to verify %s: %w", filename, err)
+		}
+		if time.Since(reported) >= historyReportLimit {
+			log.Info("Verifying Era1 files", "verified", verified, "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
+	}
+	log.Info("Verified blockchain history", "archives", len(entries), "blocks", verified, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// readHistoryDir lists the Era1 archives of the network in the directory along
+// with their expected checksums.
+func readHistoryDir(dir string, network string) ([]string, []string, error) {
+	entries, err := era.ReadDir(dir, network)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading %s: %w", dir, err)
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("no era1 files of network %s found in %s", network, dir)
+	}
+	checksums, err := readList(filepath.Join(dir, historyChecksumsFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read checksums.txt: %w", err)
+	}
+	if len(checksums) != len(entries) {
+		return nil, nil, fmt.Errorf("expected equal number of checksums and entries, have: %d checksums, %d entries", len(checksums), len(entries))
+	}
+	return entries, checksums, nil
+}
+
+// withEra1 opens the Era1 archive, checks its integrity and runs the callback
+// on it.
+func withEra1(filename string, checksum string, fn func(e *era.Era) error) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("unable to open era: %w", err)
+	}
+	defer f.Close()
+
+	have, err := fileChecksum(f)
+	if err != nil {
+		return err
+	}
+	if have != checksum {
+		return fmt.Errorf("checksum mismatch: have %s, want %s", have, checksum)
+	}
+	e, err := era.From(f)
+	if err != nil {
+		return fmt.Errorf("error opening era: %w", err)
+	}
+	if err := verifyEra1(e, filepath.Base(filename)); err != nil {
+		return err
+	}
+	return fn(e)
+}
+
+// verifyEra1 checks the internal consistency of an Era1 archive: the bodies and
+// receipts must match their headers, the blocks must form a chain with correctly
+// accumulated total difficulties, and the accumulator root must match the
+// contents and the file name.
+func verifyEra1(e *era.Era, filename string) error {
+	var (
+		hashes []common.Hash
+		tds    []*big.Int
+		parent *types.Header
+		it     = era.NewIterator(e)
+	)
+	td, err := e.InitialTD()
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		var (
+			block  = it.Block()
+			header = block.Header()
+			number = it.Number()
+		)
+		if header.Number.Uint64() != number {
+			return fmt.Errorf("block #%d: number mismatch: have %d", number, header.Number)
+		}
+		if parent != nil && header.ParentHash != parent.Hash() {
+			return fmt.Errorf("block #%d: parent hash mismatch", number)
+		}
+		if hash := types.CalcUncleHash(block.Uncles()); hash != header.UncleHash {
+			return fmt.Errorf("block #%d: uncle root mismatch: have %x, want %x", number, hash, header.UncleHash)
+		}
+		if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != header.TxHash {
+			return fmt.Errorf("block #%d: transaction root mismatch: have %x, want %x", number, hash, header.TxHash)
+		}
+		if hash := types.DeriveSha(it.Receipts(), trie.NewStackTrie(nil)); hash != header.ReceiptHash {
+			return fmt.Errorf("block #%d: receipt root mismatch: have %x, want %x", number, hash, header.ReceiptHash)
+		}
+		td.Add(td, header.Difficulty)
+		if td.Cmp(it.TotalDifficulty()) != 0 {
+			return fmt.Errorf("block #%d: total difficulty mismatch: have %v, want %v", number, it.TotalDifficulty(), td)
+		}
+		hashes = append(hashes, block.Hash())
+		tds = append(tds, it.TotalDifficulty())
+		parent = header
+	}
+	if it.Error() != nil {
+		return it.Error()
+	}
+	want, err := e.Accumulator()
+	if err != nil {
+		return fmt.Errorf("error reading accumulator: %w", err)
+	}
+	have, err := era.ComputeAccumulator(hashes, tds)
+	if err != nil {
+		return fmt.Errorf("error computing accumulator: %w", err)
+	}
+	if have != want {
+		return fmt.Errorf("accumulator mismatch: have %x, want %x", have, want)
+	}
+	if !strings.HasSuffix(filename, "-"+have.Hex()[2:10]+".era1") {
+		return errors.New("file name does not match accumulator root")
+	}
+	return nil
+}
+
+// fileChecksum computes the SHA256 checksum of the file contents.
+func fileChecksum(f io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("unable to calculate checksum: %w", err)
+	}
+	return common.BytesToHash(h.Sum(nil)).Hex(), nil
+}
+
+// readList reads the non-empty lines of a file.
+func readList(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		lines   []string
+		scanner = bufio.NewScanner(f)
+	)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
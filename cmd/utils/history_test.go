@@ -0,0 +1,121 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/consensus/ethash"
+	"github.com/rethereum-blockchain/go-rethereum/core"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/core/vm"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/internal/era"
+	"github.com/rethereum-blockchain/go-rethereum/params"
+)
+
+func TestHistoryImportAndExport(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		config  = *params.TestChainConfig
+		step    = uint64(16)
+		count   = 100
+	)
+	config.RethereumForks = &params.RethereumForks{}
+	signer := types.LatestSigner(&config)
+
+	gspec := &core.Genesis{
+		Config: &config,
+		Alloc:  core.GenesisAlloc{address: {Balance: big.NewInt(params.Ether)}},
+	}
+	_, blocks, _ := core.GenerateChainWithGenesis(gspec, ethash.NewFaker(), count, func(i int, b *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), common.Address{0xaa}, big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, key)
+		b.AddTx(tx)
+	})
+	chain, err := core.NewBlockChain(rawdb.NewMemoryDatabase(), nil, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("unable to initialize chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("error inserting chain: %v", err)
+	}
+	// Export the history and check the archive layout
+	dir := t.TempDir()
+	if err := ExportHistory(chain, dir, 0, uint64(count), step); err != nil {
+		t.Fatalf("error exporting history: %v", err)
+	}
+	network := HistoryNetworkName(chain.Config())
+	entries, err := era.ReadDir(dir, network)
+	if err != nil {
+		t.Fatalf("error reading era dir: %v", err)
+	}
+	if want := (count + int(step)) / int(step); len(entries) != want {
+		t.Fatalf("archive count mismatch: have %d, want %d", len(entries), want)
+	}
+	if err := VerifyHistory(chain, dir, network); err != nil {
+		t.Fatalf("error verifying history: %v", err)
+	}
+	// Import the history into a fresh chain and compare the contents
+	imported, err := core.NewBlockChain(rawdb.NewMemoryDatabase(), nil, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("unable to initialize chain: %v", err)
+	}
+	defer imported.Stop()
+
+	if err := ImportHistory(imported, dir, network); err != nil {
+		t.Fatalf("failed to import history: %v", err)
+	}
+	if head := imported.CurrentSnapBlock().Number.Uint64(); head != uint64(count) {
+		t.Fatalf("imported head mismatch: have %d, want %d", head, count)
+	}
+	for _, block := range blocks {
+		have := imported.GetBlockByNumber(block.NumberU64())
+		if have == nil || have.Hash() != block.Hash() {
+			t.Fatalf("block #%d missing or mismatching", block.NumberU64())
+		}
+		if want, have := chain.GetTd(block.Hash(), block.NumberU64()), imported.GetTd(block.Hash(), block.NumberU64()); have == nil || have.Cmp(want) != 0 {
+			t.Fatalf("block #%d td mismatch: have %v, want %v", block.NumberU64(), have, want)
+		}
+		if !reflect.DeepEqual(chain.GetReceiptsByHash(block.Hash()), imported.GetReceiptsByHash(block.Hash())) {
+			t.Fatalf("block #%d receipts mismatch", block.NumberU64())
+		}
+	}
+	// Importing again is a noop, corrupting an archive must be detected
+	if err := ImportHistory(imported, dir, network); err != nil {
+		t.Fatalf("failed to reimport history: %v", err)
+	}
+	blob, err := os.ReadFile(filepath.Join(dir, entries[1]))
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	blob[len(blob)/2] ^= 0xff
+	if err := os.WriteFile(filepath.Join(dir, entries[1]), blob, 0600); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	if err := VerifyHistory(chain, dir, network); err == nil {
+		t.Fatalf("corrupted archive verified")
+	}
+}
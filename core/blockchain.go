@@ -136,11 +136,31 @@ type CacheConfig struct {
 	TrieTimeLimit       time.Duration // Time limit after which to flush the current in-memory trie to disk
 	SnapshotLimit       int           // Memory allowance (MB) to use for caching snapshot entries in memory
 	Preimages           bool          // Whether to store preimage of trie key to the disk
+	StateScheme         string        // Scheme used to store the state trie nodes (hash or path)
+	StateHistory        uint64        // Number of recent blocks to keep state history for, path scheme only
+	StateDiffs          bool          // Whether to keep the flat state diffs of every block for historical state queries
+	HistoryKeep         uint64        // Number of recent blocks to keep the bodies and receipts for (0 = entire chain)
 
 	SnapshotNoBuild bool // Whether the background generation is allowed
 	SnapshotWait    bool // Wait for snapshot construction on startup. TODO(karalabe): This is a dirty hack for testing, nuke it
 }
 
+// triedbConfig derives the configs for trie database.
+func (c *CacheConfig) triedbConfig() *trie.Config {
+	config := &trie.Config{
+		Cache:     c.TrieCleanLimit,
+		Journal:   c.TrieCleanJournal,
+		Preimages: c.Preimages,
+	}
+	if c.StateScheme == rawdb.PathScheme {
+		config.PathDB = &trie.PathConfig{
+			StateHistory:   c.StateHistory,
+			DirtyCacheSize: c.TrieDirtyLimit * 1024 * 1024,
+		}
+	}
+	return config
+}
+
 // defaultCacheConfig are the default caching values if none are specified by the
 // user (also used during testing).
 var defaultCacheConfig = &CacheConfig{
@@ -185,6 +205,10 @@ type BlockChain struct {
 	//  * nil: disable tx reindexer/deleter, but still index new blocks
 	txLookupLimit uint64
 
+	// historyLock serializes the transaction indexer with the history expirer,
+	// as both move the index tail and the latter removes the indexed bodies.
+	historyLock sync.Mutex
+
 	hc            *HeaderChain
 	rmLogsFeed    event.Feed
 	chainFeed     event.Feed
@@ -233,12 +257,13 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 	if cacheConfig == nil {
 		cacheConfig = defaultCacheConfig
 	}
+	// The path-based scheme only retains the recent states, archive mode
+	// can't be supported on top of it.
+	if cacheConfig.StateScheme == rawdb.PathScheme && cacheConfig.TrieDirtyDisabled {
+		return nil, errors.New("archive mode is not supported in the path-based state scheme")
+	}
 	// Open trie database with provided config
-	triedb := trie.NewDatabaseWithConfig(db, &trie.Config{
-		Cache:     cacheConfig.TrieCleanLimit,
-		Journal:   cacheConfig.TrieCleanJournal,
-		Preimages: cacheConfig.Preimages,
-	})
+	triedb := trie.NewDatabaseWithConfig(db, cacheConfig.triedbConfig())
 	// Setup the genesis block, commit the provided genesis specification
 	// to database if the genesis block is not present yet, or load the
 	// stored one from database.
@@ -404,6 +429,12 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 		}
 		bc.snaps, _ = snapshot.New(snapconfig, bc.db, bc.triedb, head.Root)
 	}
+	// Start tracking the flat state diffs if the history is requested
+	if bc.cacheConfig.StateDiffs {
+		if err := bc.initStateDiffs(); err != nil {
+			return nil, err
+		}
+	}
 
 	// Start future block processor.
 	bc.wg.Add(1)
@@ -438,6 +469,11 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 		bc.wg.Add(1)
 		go bc.maintainTxIndex()
 	}
+	// Start the history expirer if required.
+	if bc.cacheConfig.HistoryKeep > 0 {
+		bc.wg.Add(1)
+		go bc.maintainHistory()
+	}
 	return bc, nil
 }
 
@@ -644,6 +680,14 @@ func (bc *BlockChain) setHeadBeyondRoot(head uint64, time uint64, root common.Ha
 					if root != (common.Hash{}) && !beyondRoot && newHeadBlock.Root() == root {
 						beyondRoot, rootNumber = true, newHeadBlock.NumberU64()
 					}
+					// In the path-based scheme the historical states can be
+					// restored by reverting the persistent state.
+					if !bc.HasState(newHeadBlock.Root()) && bc.triedb.Recoverable(newHeadBlock.Root()) {
+						if err := bc.triedb.Recover(newHeadBlock.Root()); err != nil {
+							log.Crit("Failed to rollback state", "err", err)
+						}
+						log.Debug("Rolled back state", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash(), "root", newHeadBlock.Root())
+					}
 					if !bc.HasState(newHeadBlock.Root()) {
 						log.Trace("Block state missing, rewinding further", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash())
 						if pivot == nil || newHeadBlock.NumberU64() > *pivot {
@@ -667,6 +711,13 @@ func (bc *BlockChain) setHeadBeyondRoot(head uint64, time uint64, root common.Ha
 							// if the historical chain pruning is enabled. In that case the logic
 							// needs to be improved here.
 							if !bc.HasState(bc.genesisBlock.Root()) {
+								// The trie nodes are overwritten in place in the
+								// path-based scheme, wipe the leftovers first.
+								if bc.triedb.Scheme() == rawdb.PathScheme {
+									if err := bc.triedb.Reset(); err != nil {
+										log.Crit("Failed to reset state", "err", err)
+									}
+								}
 								if err := CommitGenesisState(bc.db, bc.triedb, bc.genesisBlock.Hash()); err != nil {
 									log.Crit("Failed to commit genesis state", "err", err)
 								}
@@ -720,6 +771,9 @@ func (bc *BlockChain) setHeadBeyondRoot(head uint64, time uint64, root common.Ha
 	}
 	// Rewind the header chain, deleting all block bodies until then
 	delFn := func(db ethdb.KeyValueWriter, hash common.Hash, num uint64) {
+		// Retrieve the header before the ancients are truncated
+		header := bc.GetHeader(hash, num)
+
 		// Ignore the error here since light client won't hit this path
 		frozen, _ := bc.db.Ancients()
 		if num+1 <= frozen {
@@ -737,6 +791,9 @@ func (bc *BlockChain) setHeadBeyondRoot(head uint64, time uint64, root common.Ha
 			rawdb.DeleteBody(db, hash, num)
 			rawdb.DeleteReceipts(db, hash, num)
 		}
+		if header != nil && bc.cacheConfig.StateDiffs {
+			bc.unindexStateDiff(db, header)
+		}
 		// Todo(rjl493456442) txlookup, bloombits, etc
 	}
 	// If SetHead was only called as a chain reparation method, try to skip
@@ -785,6 +842,11 @@ func (bc *BlockChain) SnapSyncCommitHead(hash common.Hash) error {
 		return fmt.Errorf("non existent block [%x..]", hash[:4])
 	}
 	root := block.Root()
+	if bc.triedb.Scheme() == rawdb.PathScheme {
+		if err := bc.triedb.Enable(root); err != nil {
+			return err
+		}
+	}
 	if !bc.HasState(root) {
 		return fmt.Errorf("non existent state [%x..]", root[:4])
 	}
@@ -893,6 +955,9 @@ func (bc *BlockChain) writeHeadBlock(block *types.Block) {
 	rawdb.WriteCanonicalHash(batch, block.Hash(), block.NumberU64())
 	rawdb.WriteTxLookupEntriesByBlock(batch, block)
 	rawdb.WriteHeadBlockHash(batch, block.Hash())
+	if bc.cacheConfig.StateDiffs {
+		bc.indexStateDiff(batch, block.Header())
+	}
 
 	// Flush the whole batch into the disk, exit the node if failed
 	if err := batch.Write(); err != nil {
@@ -908,6 +973,103 @@ func (bc *BlockChain) writeHeadBlock(block *types.Block) {
 	headBlockGauge.Update(int64(block.NumberU64()))
 }
 
+// initStateDiffs starts tracking the flat state diffs of the imported blocks.
+// The history must cover every block since genesis, so it can only be enabled
+// on a fresh database, in which case the genesis state is indexed as its base.
+func (bc *BlockChain) initStateDiffs() error {
+	if bc.snaps == nil {
+		return errors.New("state diff history requires the snapshot")
+	}
+	if tail := rawdb.ReadStateDiffTail(bc.db); tail == nil {
+		head := bc.CurrentBlock()
+		if head.Number.Uint64() != 0 {
+			return fmt.Errorf("state diff history can't be enabled on an existing chain (head %d), resync required", head.Number)
+		}
+		batch := bc.db.NewBatch()
+		if err := state.IndexGenesisState(bc.stateCache, head.Root, batch); err != nil {
+			return fmt.Errorf("failed to index genesis state: %v", err)
+		}
+		rawdb.WriteStateDiffTail(batch, 0)
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		log.Info("Initialized state diff history")
+	}
+	bc.snaps.SetUpdateHook(bc.writeStateDiff)
+	return nil
+}
+
+// writeStateDiff persists the flat state diff of a state transition, as it is
+// fed into the snapshot. The diff is only indexed once the block it belongs to
+// becomes canonical.
+func (bc *BlockChain) writeStateDiff(root common.Hash, parent common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) {
+	blob, err := state.EncodeStateDiff(destructs, accounts, storage)
+	if err != nil {
+		log.Error("Failed to encode state diff", "root", root, "err", err)
+		return
+	}
+	rawdb.WriteStateDiff(bc.db, root, parent, blob)
+}
+
+// stateDiffOf retrieves the flat state diff of the given block, nil if the block
+// left the state untouched. An error is returned if the block changed the state
+// but its diff wasn't recorded, e.g. because the snapshot was unavailable while
+// the block was processed.
+func (bc *BlockChain) stateDiffOf(header *types.Header) ([]byte, error) {
+	if header.Number.Sign() == 0 {
+		return nil, nil
+	}
+	parent := bc.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("missing parent of block %d (%x)", header.Number, header.Hash())
+	}
+	if parent.Root == header.Root {
+		return nil, nil
+	}
+	blob := rawdb.ReadStateDiff(bc.db, header.Root, parent.Root)
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("missing state diff of block %d (%x)", header.Number, header.Hash())
+	}
+	return blob, nil
+}
+
+// indexStateDiff adds the flat state diff of the new canonical block to the
+// history index. If the diff is missing, the history is marked as broken from
+// this block on, since the state of later blocks can't be reconstructed anymore.
+func (bc *BlockChain) indexStateDiff(db ethdb.KeyValueWriter, header *types.Header) {
+	number := header.Number.Uint64()
+	blob, err := bc.stateDiffOf(header)
+	if err == nil && len(blob) > 0 {
+		err = state.IndexStateDiff(db, number, blob)
+	}
+	if err != nil {
+		if gap := rawdb.ReadStateDiffGap(bc.db); gap == nil || *gap > number {
+			rawdb.WriteStateDiffGap(db, number)
+		}
+		log.Error("Failed to index state diff, history interrupted", "number", number, "err", err)
+	}
+}
+
+// unindexStateDiff removes the flat state diff of the block, which is not part
+// of the canonical chain anymore, from the history index. The diff itself is
+// retained in case the block becomes canonical again. Blocks are unindexed from
+// the head down, so unindexing the block the history gap was recorded at lifts
+// the gap.
+func (bc *BlockChain) unindexStateDiff(db ethdb.KeyValueWriter, header *types.Header) {
+	number := header.Number.Uint64()
+	if gap := rawdb.ReadStateDiffGap(bc.db); gap != nil && *gap == number {
+		rawdb.DeleteStateDiffGap(db)
+		return
+	}
+	blob, err := bc.stateDiffOf(header)
+	if err == nil && len(blob) > 0 {
+		err = state.UnindexStateDiff(db, number, blob)
+	}
+	if err != nil {
+		log.Error("Failed to unindex state diff", "number", number, "err", err)
+	}
+}
+
 // stopWithoutSaving stops the blockchain service. If any imports are currently in progress
 // it will abort them using the procInterrupt. This method stops all running
 // goroutines, but does not do all the post-stop work of persisting data.
@@ -955,7 +1117,22 @@ func (bc *BlockChain) Stop() {
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
 	//  - HEAD-1:   So we don't do large reorgs if our HEAD becomes an uncle
 	//  - HEAD-127: So we have a hard limit on the number of blocks reexecuted
-	if !bc.cacheConfig.TrieDirtyDisabled {
+	//
+	// In the path-based scheme the in-memory states leading to HEAD are
+	// journalled instead, the older ones can be restored from the state
+	// histories. The HEAD state is flushed if journalling fails.
+	if bc.triedb.Scheme() == rawdb.PathScheme {
+		if root := bc.CurrentBlock().Root; bc.HasState(root) {
+			if err := bc.triedb.Journal(root); err != nil {
+				log.Error("Failed to journal in-memory trie nodes", "err", err)
+
+				log.Info("Writing cached state to disk", "block", bc.CurrentBlock().Number, "root", root)
+				if err := bc.triedb.Commit(root, true); err != nil {
+					log.Error("Failed to commit recent state trie", "err", err)
+				}
+			}
+		}
+	} else if !bc.cacheConfig.TrieDirtyDisabled {
 		triedb := bc.triedb
 
 		for _, offset := range []uint64{0, 1, TriesInMemory - 1} {
@@ -990,6 +1167,9 @@ func (bc *BlockChain) Stop() {
 	if bc.cacheConfig.TrieCleanJournal != "" {
 		bc.triedb.SaveCache(bc.cacheConfig.TrieCleanJournal)
 	}
+	if err := bc.triedb.Close(); err != nil {
+		log.Error("Failed to close trie database", "err", err)
+	}
 	log.Info("Blockchain stopped")
 }
 
@@ -1358,6 +1538,10 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	if err != nil {
 		return err
 	}
+	// The path-based trie database manages the in-memory states on its own
+	if bc.triedb.Scheme() == rawdb.PathScheme {
+		return nil
+	}
 	// If we're running an archive node, always flush
 	if bc.cacheConfig.TrieDirtyDisabled {
 		return bc.triedb.Commit(root, false)
@@ -2154,6 +2338,17 @@ func (bc *BlockChain) reorg(oldHead *types.Header, newHead *types.Block) error {
 		// rewind the canonical chain to a lower point.
 		log.Error("Impossible reorg, please file an issue", "oldnum", oldBlock.Number(), "oldhash", oldBlock.Hash(), "oldblocks", len(oldChain), "newnum", newBlock.Number(), "newhash", newBlock.Hash(), "newblocks", len(newChain))
 	}
+	// Drop the flat state diffs of the old chain from the index before the new
+	// chain is indexed, since the two share the same block numbers.
+	if bc.cacheConfig.StateDiffs && len(oldChain) > 0 {
+		batch := bc.db.NewBatch()
+		for _, block := range oldChain {
+			bc.unindexStateDiff(batch, block.Header())
+		}
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to unindex state diffs", "err", err)
+		}
+	}
 	// Insert the new chain(except the head block(reverse order)),
 	// taking care of the proper incremental order.
 	for i := len(newChain) - 1; i >= 1; i-- {
@@ -2351,6 +2546,14 @@ func (bc *BlockChain) skipBlock(err error, it *insertIterator) bool {
 func (bc *BlockChain) indexBlocks(tail *uint64, head uint64, done chan struct{}) {
 	defer func() { close(done) }()
 
+	// The transactions of the expired history can't be indexed anymore, the
+	// bodies are gone. Move the index tail above them if it lags behind.
+	pruned := bc.HistoryTail()
+	if tail != nil && *tail < pruned {
+		rawdb.WriteTxIndexTail(bc.db, pruned)
+		tail = &pruned
+	}
+
 	// The tail flag is not existent, it means the node is just initialized
 	// and all blocks(may from ancient store) are not indexed yet.
 	if tail == nil {
@@ -2358,6 +2561,9 @@ func (bc *BlockChain) indexBlocks(tail *uint64, head uint64, done chan struct{})
 		if bc.txLookupLimit != 0 && head >= bc.txLookupLimit {
 			from = head - bc.txLookupLimit + 1
 		}
+		if from < pruned {
+			from = pruned
+		}
 		rawdb.IndexTransactions(bc.db, from, head+1, bc.quit)
 		return
 	}
@@ -2371,14 +2577,18 @@ func (bc *BlockChain) indexBlocks(tail *uint64, head uint64, done chan struct{})
 			if end > head+1 {
 				end = head + 1
 			}
-			rawdb.IndexTransactions(bc.db, 0, end, bc.quit)
+			rawdb.IndexTransactions(bc.db, pruned, end, bc.quit)
 		}
 		return
 	}
 	// Update the transaction index to the new chain state
 	if head-bc.txLookupLimit+1 < *tail {
 		// Reindex a part of missing indices and rewind index tail to HEAD-limit
-		rawdb.IndexTransactions(bc.db, head-bc.txLookupLimit+1, *tail, bc.quit)
+		from := head - bc.txLookupLimit + 1
+		if from < pruned {
+			from = pruned
+		}
+		rawdb.IndexTransactions(bc.db, from, *tail, bc.quit)
 	} else {
 		// Unindex a part of stale indices and forward index tail to HEAD-limit
 		rawdb.UnindexTransactions(bc.db, *tail, head-bc.txLookupLimit+1, bc.quit)
@@ -2414,7 +2624,11 @@ func (bc *BlockChain) maintainTxIndex() {
 		case head := <-headCh:
 			if done == nil {
 				done = make(chan struct{})
-				go bc.indexBlocks(rawdb.ReadTxIndexTail(bc.db), head.Block.NumberU64(), done)
+				go func(number uint64, done chan struct{}) {
+					bc.historyLock.Lock()
+					defer bc.historyLock.Unlock()
+					bc.indexBlocks(rawdb.ReadTxIndexTail(bc.db), number, done)
+				}(head.Block.NumberU64(), done)
 			}
 		case <-done:
 			done = nil
@@ -2428,6 +2642,53 @@ func (bc *BlockChain) maintainTxIndex() {
 	}
 }
 
+// pruneHistory expires the block bodies and receipts below the given tail.
+func (bc *BlockChain) pruneHistory(tail uint64, done chan struct{}) {
+	defer close(done)
+
+	bc.historyLock.Lock()
+	defer bc.historyLock.Unlock()
+	if _, err := rawdb.PruneChainHistory(bc.db, tail, bc.quit); err != nil {
+		log.Error("Failed to prune chain history", "tail", tail, "err", err)
+	}
+}
+
+// maintainHistory is responsible for expiring the block bodies and receipts
+// older than the configured number of recent blocks from the ancient store.
+// The header chain is always retained.
+func (bc *BlockChain) maintainHistory() {
+	defer bc.wg.Done()
+
+	var (
+		done   chan struct{}                  // Non-nil if background pruning routine is active.
+		headCh = make(chan ChainHeadEvent, 1) // Buffered to avoid locking up the event feed
+	)
+	sub := bc.SubscribeChainHeadEvent(headCh)
+	if sub == nil {
+		return
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case head := <-headCh:
+			number := head.Block.NumberU64()
+			if done == nil && number > bc.cacheConfig.HistoryKeep {
+				done = make(chan struct{})
+				go bc.pruneHistory(number-bc.cacheConfig.HistoryKeep, done)
+			}
+		case <-done:
+			done = nil
+		case <-bc.quit:
+			if done != nil {
+				log.Info("Waiting background history pruner to exit")
+				<-done
+			}
+			return
+		}
+	}
+}
+
 // reportBlock logs a bad block error.
 func (bc *BlockChain) reportBlock(block *types.Block, receipts types.Receipts, err error) {
 	rawdb.WriteBadBlock(bc.db, block)
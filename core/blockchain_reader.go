@@ -17,6 +17,8 @@
 package core
 
 import (
+	"errors"
+	"fmt"
 	"math/big"
 
 	"github.com/rethereum-blockchain/go-rethereum/common"
@@ -306,6 +308,27 @@ func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return state.New(root, bc.stateCache, bc.snaps)
 }
 
+// HistoricStateAt returns a read-only state of the given canonical block served
+// from the flat state diff history, which is available even if the state trie
+// of the block is long gone. Merkle proofs can't be generated from the returned
+// state.
+func (bc *BlockChain) HistoricStateAt(header *types.Header) (*state.StateDB, error) {
+	if !bc.cacheConfig.StateDiffs {
+		return nil, errors.New("state diff history is not enabled")
+	}
+	number := header.Number.Uint64()
+	if tail := rawdb.ReadStateDiffTail(bc.db); tail == nil || number < *tail {
+		return nil, fmt.Errorf("state diff history of block %d is not available", number)
+	}
+	if gap := rawdb.ReadStateDiffGap(bc.db); gap != nil && number >= *gap {
+		return nil, fmt.Errorf("state diff history of block %d is not available, interrupted at block %d", number, *gap)
+	}
+	if bc.GetCanonicalHash(number) != header.Hash() {
+		return nil, fmt.Errorf("block %d (%x) is not canonical", number, header.Hash())
+	}
+	return state.New(header.Root, state.NewHistoricDatabase(bc.stateCache, number), nil)
+}
+
 // Config retrieves the chain's fork configuration.
 func (bc *BlockChain) Config() *params.ChainConfig { return bc.chainConfig }
 
@@ -359,6 +382,13 @@ func (bc *BlockChain) TxLookupLimit() uint64 {
 	return bc.txLookupLimit
 }
 
+// HistoryTail retrieves the number of the first block whose body and receipts
+// are still available, the ones below have been expired.
+func (bc *BlockChain) HistoryTail() uint64 {
+	tail, _ := bc.db.Tail()
+	return tail
+}
+
 // TrieDB retrieves the low level trie database used for data storage.
 func (bc *BlockChain) TrieDB() *trie.Database {
 	return bc.triedb
@@ -35,6 +35,12 @@ func ReadTxLookupEntry(db ethdb.Reader, hash common.Hash) *uint64 {
 	if len(data) == 0 {
 		return nil
 	}
+	return decodeTxLookupEntry(db, hash, data)
+}
+
+// decodeTxLookupEntry decodes the block number from a transaction lookup entry
+// in any of the supported database formats.
+func decodeTxLookupEntry(db ethdb.Reader, hash common.Hash, data []byte) *uint64 {
 	// Database v6 tx lookup just stores the block number
 	if len(data) < common.HashLength {
 		number := new(big.Int).SetBytes(data).Uint64()
@@ -53,6 +59,23 @@ func ReadTxLookupEntry(db ethdb.Reader, hash common.Hash) *uint64 {
 	return &entry.BlockIndex
 }
 
+// IterateTxLookupEntries iterates over the transaction lookup entries with the
+// hashes starting with the given prefix, invoking the callback with the hash and
+// the block number of each entry. The iteration stops early if the callback
+// returns false.
+func IterateTxLookupEntries(db ethdb.Database, prefix []byte, fn func(hash common.Hash, number *uint64) bool) error {
+	it := NewKeyLengthIterator(db.NewIterator(append(common.CopyBytes(txLookupPrefix), prefix...), nil), len(txLookupPrefix)+common.HashLength)
+	defer it.Release()
+
+	for it.Next() {
+		hash := common.BytesToHash(it.Key()[len(txLookupPrefix):])
+		if !fn(hash, decodeTxLookupEntry(db, hash, it.Value())) {
+			break
+		}
+	}
+	return it.Error()
+}
+
 // writeTxLookupEntry stores a positional metadata for a transaction,
 // enabling hash based transaction and receipt lookups.
 func writeTxLookupEntry(db ethdb.KeyValueWriter, hash common.Hash, numberBytes []byte) {
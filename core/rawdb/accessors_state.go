@@ -17,6 +17,8 @@
 package rawdb
 
 import (
+	"encoding/binary"
+
 	"github.com/rethereum-blockchain/go-rethereum/common"
 	"github.com/rethereum-blockchain/go-rethereum/ethdb"
 	"github.com/rethereum-blockchain/go-rethereum/log"
@@ -92,3 +94,117 @@ func DeleteCode(db ethdb.KeyValueWriter, hash common.Hash) {
 		log.Crit("Failed to delete contract code", "err", err)
 	}
 }
+
+// ReadStateID retrieves the state id with the provided state root.
+func ReadStateID(db ethdb.KeyValueReader, root common.Hash) *uint64 {
+	data, err := db.Get(stateIDKey(root))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteStateID writes the provided state lookup to database.
+func WriteStateID(db ethdb.KeyValueWriter, root common.Hash, id uint64) {
+	var buff [8]byte
+	binary.BigEndian.PutUint64(buff[:], id)
+	if err := db.Put(stateIDKey(root), buff[:]); err != nil {
+		log.Crit("Failed to store state ID", "err", err)
+	}
+}
+
+// DeleteStateID deletes the specified state lookup from the database.
+func DeleteStateID(db ethdb.KeyValueWriter, root common.Hash) {
+	if err := db.Delete(stateIDKey(root)); err != nil {
+		log.Crit("Failed to delete state ID", "err", err)
+	}
+}
+
+// ReadPersistentStateID retrieves the id of the persistent state from the database.
+func ReadPersistentStateID(db ethdb.KeyValueReader) uint64 {
+	data, _ := db.Get(persistentStateIDKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WritePersistentStateID stores the id of the persistent state into database.
+func WritePersistentStateID(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(persistentStateIDKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the persistent state ID", "err", err)
+	}
+}
+
+// ReadTrieJournal retrieves the serialized in-memory trie node layers saved at
+// the last shutdown.
+func ReadTrieJournal(db ethdb.KeyValueReader) []byte {
+	data, _ := db.Get(trieJournalKey)
+	return data
+}
+
+// WriteTrieJournal stores the serialized in-memory trie node layers to save at
+// shutdown.
+func WriteTrieJournal(db ethdb.KeyValueWriter, journal []byte) {
+	if err := db.Put(trieJournalKey, journal); err != nil {
+		log.Crit("Failed to store tries journal", "err", err)
+	}
+}
+
+// DeleteTrieJournal deletes the serialized in-memory trie node layers saved at
+// the last shutdown.
+func DeleteTrieJournal(db ethdb.KeyValueWriter) {
+	if err := db.Delete(trieJournalKey); err != nil {
+		log.Crit("Failed to remove tries journal", "err", err)
+	}
+}
+
+// ReadStateHistory retrieves the state history with the provided id. The
+// history is stored in the freezer at the position id-1, as state ids start
+// from one.
+func ReadStateHistory(db ethdb.AncientReaderOp, id uint64) ([]byte, []byte, error) {
+	meta, err := db.Ancient(stateHistoryMeta, id-1)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := db.Ancient(stateHistoryTrieNodes, id-1)
+	if err != nil {
+		return nil, nil, err
+	}
+	return meta, nodes, nil
+}
+
+// WriteStateHistory writes the provided state history to database.
+func WriteStateHistory(db ethdb.AncientWriter, id uint64, meta []byte, nodes []byte) error {
+	_, err := db.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		if err := op.AppendRaw(stateHistoryMeta, id-1, meta); err != nil {
+			return err
+		}
+		return op.AppendRaw(stateHistoryTrieNodes, id-1, nodes)
+	})
+	return err
+}
+
+// ReadPruningCheckpoint retrieves the serialized progress marker of an offline
+// state pruning interrupted midway.
+func ReadPruningCheckpoint(db ethdb.KeyValueReader) []byte {
+	data, _ := db.Get(pruningCheckpointKey)
+	return data
+}
+
+// WritePruningCheckpoint stores the serialized progress marker of the running
+// offline state pruning.
+func WritePruningCheckpoint(db ethdb.KeyValueWriter, checkpoint []byte) {
+	if err := db.Put(pruningCheckpointKey, checkpoint); err != nil {
+		log.Crit("Failed to store pruning checkpoint", "err", err)
+	}
+}
+
+// DeletePruningCheckpoint deletes the progress marker of the offline state
+// pruning.
+func DeletePruningCheckpoint(db ethdb.KeyValueWriter) {
+	if err := db.Delete(pruningCheckpointKey); err != nil {
+		log.Crit("Failed to remove pruning checkpoint", "err", err)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+)
+
+// ReadStateDiffTail retrieves the number of the first block covered by the
+// flat state diff history, nil if the history is not maintained.
+func ReadStateDiffTail(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(stateDiffTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteStateDiffTail stores the number of the first block covered by the flat
+// state diff history.
+func WriteStateDiffTail(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(stateDiffTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the state diff tail", "err", err)
+	}
+}
+
+// ReadStateDiffGap retrieves the number of the first canonical block whose flat
+// state diff is missing, nil if the history has no gap. The history can't serve
+// the state of that block or any later one.
+func ReadStateDiffGap(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(stateDiffGapKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteStateDiffGap stores the number of the first canonical block whose flat
+// state diff is missing.
+func WriteStateDiffGap(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(stateDiffGapKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the state diff gap", "err", err)
+	}
+}
+
+// DeleteStateDiffGap removes the state diff gap marker.
+func DeleteStateDiffGap(db ethdb.KeyValueWriter) {
+	if err := db.Delete(stateDiffGapKey); err != nil {
+		log.Crit("Failed to delete the state diff gap", "err", err)
+	}
+}
+
+// ReadStateDiff retrieves the flat state diff of the transition from parent to
+// root.
+func ReadStateDiff(db ethdb.KeyValueReader, root common.Hash, parent common.Hash) []byte {
+	data, _ := db.Get(stateDiffKey(root, parent))
+	return data
+}
+
+// WriteStateDiff stores the flat state diff of the transition from parent to
+// root.
+func WriteStateDiff(db ethdb.KeyValueWriter, root common.Hash, parent common.Hash, diff []byte) {
+	if err := db.Put(stateDiffKey(root, parent), diff); err != nil {
+		log.Crit("Failed to store state diff", "err", err)
+	}
+}
+
+// DeleteStateDiff removes the flat state diff of the transition from parent to
+// root.
+func DeleteStateDiff(db ethdb.KeyValueWriter, root common.Hash, parent common.Hash) {
+	if err := db.Delete(stateDiffKey(root, parent)); err != nil {
+		log.Crit("Failed to delete state diff", "err", err)
+	}
+}
+
+// WriteStateDiffAccount indexes the slim account modified in the given block.
+// An empty blob marks a deleted account.
+func WriteStateDiffAccount(db ethdb.KeyValueWriter, accountHash common.Hash, number uint64, account []byte) {
+	if err := db.Put(stateDiffAccountKey(accountHash, number), account); err != nil {
+		log.Crit("Failed to store historic account", "err", err)
+	}
+}
+
+// DeleteStateDiffAccount removes the account index entry of the given block.
+func DeleteStateDiffAccount(db ethdb.KeyValueWriter, accountHash common.Hash, number uint64) {
+	if err := db.Delete(stateDiffAccountKey(accountHash, number)); err != nil {
+		log.Crit("Failed to delete historic account", "err", err)
+	}
+}
+
+// WriteStateDiffStorage indexes the storage slot modified in the given block.
+// An empty blob marks a deleted slot.
+func WriteStateDiffStorage(db ethdb.KeyValueWriter, accountHash, storageHash common.Hash, number uint64, value []byte) {
+	if err := db.Put(stateDiffStorageKey(accountHash, storageHash, number), value); err != nil {
+		log.Crit("Failed to store historic storage slot", "err", err)
+	}
+}
+
+// DeleteStateDiffStorage removes the storage index entry of the given block.
+func DeleteStateDiffStorage(db ethdb.KeyValueWriter, accountHash, storageHash common.Hash, number uint64) {
+	if err := db.Delete(stateDiffStorageKey(accountHash, storageHash, number)); err != nil {
+		log.Crit("Failed to delete historic storage slot", "err", err)
+	}
+}
+
+// WriteStateDiffDestruct marks the storage of the account wiped in the given
+// block.
+func WriteStateDiffDestruct(db ethdb.KeyValueWriter, accountHash common.Hash, number uint64) {
+	if err := db.Put(stateDiffDestructKey(accountHash, number), []byte{0x01}); err != nil {
+		log.Crit("Failed to store historic destruct marker", "err", err)
+	}
+}
+
+// DeleteStateDiffDestruct removes the destruct marker of the given block.
+func DeleteStateDiffDestruct(db ethdb.KeyValueWriter, accountHash common.Hash, number uint64) {
+	if err := db.Delete(stateDiffDestructKey(accountHash, number)); err != nil {
+		log.Crit("Failed to delete historic destruct marker", "err", err)
+	}
+}
+
+// readLatestEntry retrieves the value of the latest index entry under the given
+// prefix, which was written at or before the given block. The number of the
+// block the entry belongs to is also returned.
+func readLatestEntry(db ethdb.Iteratee, prefix []byte, number uint64) ([]byte, uint64, bool) {
+	it := db.NewIterator(prefix, encodeHistoricNumber(number))
+	defer it.Release()
+
+	for it.Next() {
+		if key := it.Key(); len(key) == len(prefix)+8 {
+			return common.CopyBytes(it.Value()), ^binary.BigEndian.Uint64(key[len(prefix):]), true
+		}
+	}
+	return nil, 0, false
+}
+
+// ReadStateDiffAccount retrieves the latest version of the slim account that
+// was modified at or before the given block, along with the number of the
+// block it was modified in.
+func ReadStateDiffAccount(db ethdb.Iteratee, accountHash common.Hash, number uint64) ([]byte, uint64, bool) {
+	return readLatestEntry(db, append(common.CopyBytes(stateDiffAccountPrefix), accountHash.Bytes()...), number)
+}
+
+// ReadStateDiffStorage retrieves the latest version of the storage slot that
+// was modified at or before the given block, along with the number of the
+// block it was modified in.
+func ReadStateDiffStorage(db ethdb.Iteratee, accountHash, storageHash common.Hash, number uint64) ([]byte, uint64, bool) {
+	prefix := append(append(common.CopyBytes(stateDiffStoragePrefix), accountHash.Bytes()...), storageHash.Bytes()...)
+	return readLatestEntry(db, prefix, number)
+}
+
+// ReadStateDiffDestruct retrieves the number of the latest block at or before
+// the given one, in which the storage of the account was wiped.
+func ReadStateDiffDestruct(db ethdb.Iteratee, accountHash common.Hash, number uint64) (uint64, bool) {
+	_, destructed, ok := readLatestEntry(db, append(common.CopyBytes(stateDiffDestructPrefix), accountHash.Bytes()...), number)
+	return destructed, ok
+}
@@ -261,3 +261,45 @@ func DeleteTrieNode(db ethdb.KeyValueWriter, owner common.Hash, path []byte, has
 		panic(fmt.Sprintf("Unknown scheme %v", scheme))
 	}
 }
+
+// ReadStateScheme reads the state scheme of persistent state, or none
+// if the state is not present in database.
+func ReadStateScheme(db ethdb.Reader) string {
+	// Check if state in path-based scheme is present
+	blob, _ := ReadAccountTrieNode(db, nil)
+	if len(blob) != 0 {
+		return PathScheme
+	}
+	// In a hash-based scheme, the genesis state is consistently stored
+	// on the disk. To assess the scheme of the persistent state, it
+	// suffices to inspect the scheme of the genesis state.
+	header := ReadHeader(db, ReadCanonicalHash(db, 0), 0)
+	if header == nil {
+		return "" // empty datadir
+	}
+	if !HasLegacyTrieNode(db, header.Root) {
+		return "" // no state in disk
+	}
+	return HashScheme
+}
+
+// ParseStateScheme checks if the specified state scheme is compatible with
+// the stored state. An empty scheme selects the stored one, falling back to
+// the hash-based scheme for fresh databases.
+func ParseStateScheme(provided string, disk ethdb.Reader) (string, error) {
+	stored := ReadStateScheme(disk)
+	if provided == "" {
+		if stored == "" {
+			return HashScheme, nil
+		}
+		log.Info("State scheme set to already existing", "scheme", stored)
+		return stored, nil
+	}
+	if provided != HashScheme && provided != PathScheme {
+		return "", fmt.Errorf("unknown state scheme %q", provided)
+	}
+	if stored == "" || provided == stored {
+		return provided, nil
+	}
+	return "", fmt.Errorf("incompatible state scheme, stored: %s, provided: %s", stored, provided)
+}
@@ -16,6 +16,8 @@
 
 package rawdb
 
+import "path"
+
 // The list of table names of chain freezer.
 const (
 	// ChainFreezerHeaderTable indicates the name of the freezer header table.
@@ -34,20 +36,53 @@ const (
 	ChainFreezerDifficultyTable = "diffs"
 )
 
-// chainFreezerNoSnappy configures whether compression is disabled for the ancient-tables.
-// Hashes and difficulties don't compress well.
-var chainFreezerNoSnappy = map[string]bool{
-	ChainFreezerHeaderTable:     false,
-	ChainFreezerHashTable:       true,
-	ChainFreezerBodiesTable:     false,
-	ChainFreezerReceiptTable:    false,
-	ChainFreezerDifficultyTable: true,
+// freezerTableConfig contains the settings for a freezer table.
+type freezerTableConfig struct {
+	codec    freezerCodec // compression of the appended items, codecNone for raw tables
+	prunable bool         // true for tables that can be pruned by TruncateTail
+}
+
+// chainFreezerTableConfigs configures the settings for tables in the chain freezer.
+// Hashes and difficulties don't compress well. Bodies and receipts can be pruned
+// to expire the block history, while the header chain is always retained. The
+// compressed tables can be converted to zstd with the freezer-recompress command.
+var chainFreezerTableConfigs = map[string]freezerTableConfig{
+	ChainFreezerHeaderTable:     {codec: codecSnappy, prunable: false},
+	ChainFreezerHashTable:       {codec: codecNone, prunable: false},
+	ChainFreezerBodiesTable:     {codec: codecSnappy, prunable: true},
+	ChainFreezerReceiptTable:    {codec: codecSnappy, prunable: true},
+	ChainFreezerDifficultyTable: {codec: codecNone, prunable: false},
+}
+
+const (
+	// stateHistoryTableSize defines the maximum size of freezer data files.
+	stateHistoryTableSize = 2 * 1000 * 1000 * 1000
+
+	// stateHistoryMeta indicates the name of the freezer state history metadata table.
+	stateHistoryMeta = "history.meta"
+
+	// stateHistoryTrieNodes indicates the name of the freezer state history
+	// table containing the original values of the mutated trie nodes.
+	stateHistoryTrieNodes = "history.trienodes"
+)
+
+// stateFreezerTableConfigs configures the settings for tables in the state freezer.
+var stateFreezerTableConfigs = map[string]freezerTableConfig{
+	stateHistoryMeta:      {codec: codecNone, prunable: true},
+	stateHistoryTrieNodes: {codec: codecSnappy, prunable: true},
 }
 
 // The list of identifiers of ancient stores.
 var (
 	chainFreezerName = "chain" // the folder name of chain segment ancient store.
+	stateFreezerName = "state" // the folder name of reverse diff ancient store.
 )
 
 // freezers the collections of all builtin freezers.
-var freezers = []string{chainFreezerName}
+var freezers = []string{chainFreezerName, stateFreezerName}
+
+// NewStateFreezer initializes the freezer for state history, which holds the
+// reverse diffs of recent states in the path-based state scheme.
+func NewStateFreezer(ancientDir string, readOnly bool) (*ResettableFreezer, error) {
+	return NewResettableFreezer(path.Join(ancientDir, stateFreezerName), "eth/db/state", readOnly, stateHistoryTableSize, stateFreezerTableConfigs)
+}
@@ -18,6 +18,8 @@ package rawdb
 
 import (
 	"fmt"
+	"path"
+	"path/filepath"
 
 	"github.com/rethereum-blockchain/go-rethereum/common"
 	"github.com/rethereum-blockchain/go-rethereum/ethdb"
@@ -60,7 +62,7 @@ func inspectFreezers(db ethdb.Database) ([]freezerInfo, error) {
 			// with the key-value store, inspect the chain store directly.
 			info := freezerInfo{name: freezer}
 			// Retrieve storage size of every contained table.
-			for table := range chainFreezerNoSnappy {
+			for table := range chainFreezerTableConfigs {
 				size, err := db.AncientSize(table)
 				if err != nil {
 					return nil, err
@@ -82,6 +84,24 @@ func inspectFreezers(db ethdb.Database) ([]freezerInfo, error) {
 			info.tail = tail
 			infos = append(infos, info)
 
+		case stateFreezerName:
+			// State history is only maintained in the path-based state scheme,
+			// skip the inspection if it doesn't exist.
+			datadir, err := db.AncientDatadir()
+			if err != nil || !common.FileExist(path.Join(datadir, stateFreezerName)) {
+				continue
+			}
+			f, err := NewStateFreezer(datadir, true)
+			if err != nil {
+				return nil, err
+			}
+			info, err := inspect(freezer, stateFreezerTableConfigs, f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+
 		default:
 			return nil, fmt.Errorf("unknown freezer, supported ones: %v", freezers)
 		}
@@ -89,33 +109,96 @@ func inspectFreezers(db ethdb.Database) ([]freezerInfo, error) {
 	return infos, nil
 }
 
-// InspectFreezerTable dumps out the index of a specific freezer table. The passed
-// ancient indicates the path of root ancient directory where the chain freezer can
-// be opened. Start and end specify the range for dumping out indexes.
-// Note this function can only be used for debugging purposes.
-func InspectFreezerTable(ancient string, freezerName string, tableName string, start, end int64) error {
+// inspect inspects the given standalone freezer.
+func inspect(name string, tables map[string]freezerTableConfig, reader ethdb.AncientReader) (freezerInfo, error) {
+	info := freezerInfo{name: name}
+	for table := range tables {
+		size, err := reader.AncientSize(table)
+		if err != nil {
+			return freezerInfo{}, err
+		}
+		info.sizes = append(info.sizes, tableSize{name: table, size: common.StorageSize(size)})
+	}
+	// Retrieve the number of last stored item
+	ancients, err := reader.Ancients()
+	if err != nil {
+		return freezerInfo{}, err
+	}
+	info.head = ancients - 1
+
+	// Retrieve the number of first stored item
+	tail, err := reader.Tail()
+	if err != nil {
+		return freezerInfo{}, err
+	}
+	info.tail = tail
+	return info, nil
+}
+
+// resolveFreezerTable returns the directory and the configuration of a table
+// in one of the builtin freezers.
+func resolveFreezerTable(ancient string, freezerName string, tableName string) (string, freezerTableConfig, error) {
 	var (
 		path   string
-		tables map[string]bool
+		tables map[string]freezerTableConfig
 	)
 	switch freezerName {
 	case chainFreezerName:
-		path, tables = resolveChainFreezerDir(ancient), chainFreezerNoSnappy
+		path, tables = resolveChainFreezerDir(ancient), chainFreezerTableConfigs
+	case stateFreezerName:
+		path, tables = filepath.Join(ancient, stateFreezerName), stateFreezerTableConfigs
 	default:
-		return fmt.Errorf("unknown freezer, supported ones: %v", freezers)
+		return "", freezerTableConfig{}, fmt.Errorf("unknown freezer, supported ones: %v", freezers)
 	}
-	noSnappy, exist := tables[tableName]
+	config, exist := tables[tableName]
 	if !exist {
 		var names []string
 		for name := range tables {
 			names = append(names, name)
 		}
-		return fmt.Errorf("unknown table, supported ones: %v", names)
+		return "", freezerTableConfig{}, fmt.Errorf("unknown table, supported ones: %v", names)
 	}
-	table, err := newFreezerTable(path, tableName, noSnappy, true)
+	return path, config, nil
+}
+
+// InspectFreezerTable dumps out the index of a specific freezer table. The passed
+// ancient indicates the path of root ancient directory where the chain freezer can
+// be opened. Start and end specify the range for dumping out indexes.
+// Note this function can only be used for debugging purposes.
+func InspectFreezerTable(ancient string, freezerName string, tableName string, start, end int64) error {
+	path, config, err := resolveFreezerTable(ancient, freezerName, tableName)
+	if err != nil {
+		return err
+	}
+	table, err := newFreezerTable(path, tableName, config.codec, true)
 	if err != nil {
 		return err
 	}
 	table.dumpIndexStdout(start, end)
 	return nil
 }
+
+// RecompressFreezerTable converts all the data files of a specific freezer table
+// to the given compression codec ("snappy" or "zstd"), optionally compressing
+// with a zstd dictionary, either in the zstd dictionary format or raw content.
+// The freezer must not be in use while the table is being converted.
+func RecompressFreezerTable(ancient string, freezerName string, tableName string, codecName string, dict []byte) error {
+	path, config, err := resolveFreezerTable(ancient, freezerName, tableName)
+	if err != nil {
+		return err
+	}
+	codec, err := parseFreezerCodec(codecName)
+	if err != nil {
+		return err
+	}
+	if config.codec == codecNone {
+		return fmt.Errorf("table %s is not compressed", tableName)
+	}
+	table, err := newFreezerTable(path, tableName, config.codec, false)
+	if err != nil {
+		return err
+	}
+	defer table.Close()
+
+	return table.recompress(codec, dict)
+}
@@ -17,6 +17,7 @@
 package rawdb
 
 import (
+	"errors"
 	"runtime"
 	"sync/atomic"
 	"time"
@@ -353,3 +354,37 @@ func UnindexTransactions(db ethdb.Database, from uint64, to uint64, interrupt ch
 func unindexTransactionsForTesting(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool) {
 	unindexTransactions(db, from, to, interrupt, hook)
 }
+
+// PruneChainHistory expires the block bodies and receipts below the given block
+// by truncating the tail of the respective ancient tables, leaving the header
+// chain intact. Only the history already moved into the ancient store can be
+// pruned, the target is capped accordingly. The transaction indices of the
+// expired blocks are removed beforehand, as they can't be unindexed anymore
+// once the bodies are gone. The new history tail is returned.
+func PruneChainHistory(db ethdb.Database, tail uint64, interrupt chan struct{}) (uint64, error) {
+	frozen, err := db.Ancients()
+	if err != nil {
+		return 0, err
+	}
+	if tail > frozen {
+		tail = frozen
+	}
+	current, err := db.Tail()
+	if err != nil {
+		return 0, err
+	}
+	if tail <= current {
+		return current, nil
+	}
+	if txTail := ReadTxIndexTail(db); txTail != nil && *txTail < tail {
+		UnindexTransactions(db, *txTail, tail, interrupt)
+		if txTail = ReadTxIndexTail(db); *txTail < tail {
+			return current, errors.New("transaction unindexing interrupted")
+		}
+	}
+	if err := db.TruncateTail(tail); err != nil {
+		return current, err
+	}
+	log.Info("Pruned chain history", "tail", tail, "pruned", tail-current)
+	return tail, nil
+}
@@ -206,3 +206,63 @@ func TestIndexTransactions(t *testing.T) {
 	verify(8, 11, true, 8)
 	verify(0, 8, false, 8)
 }
+
+func TestPruneChainHistory(t *testing.T) {
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), t.TempDir(), "", false)
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend: %v", err)
+	}
+	defer db.Close()
+
+	// Freeze a chain of blocks with a transaction each and index them
+	var (
+		to       = common.BytesToAddress([]byte{0x11})
+		blocks   []*types.Block
+		receipts []types.Receipts
+	)
+	for i := uint64(0); i < 10; i++ {
+		tx := types.NewTx(&types.LegacyTx{Nonce: i, GasPrice: big.NewInt(1), Gas: 21000, To: &to, Value: big.NewInt(1)})
+		block := types.NewBlock(&types.Header{Number: new(big.Int).SetUint64(i)}, []*types.Transaction{tx}, nil, nil, newHasher())
+		blocks = append(blocks, block)
+		receipts = append(receipts, types.Receipts{{Status: types.ReceiptStatusSuccessful, Logs: []*types.Log{}}})
+	}
+	if _, err := WriteAncientBlocks(db, blocks, receipts, big.NewInt(100)); err != nil {
+		t.Fatalf("failed to write ancient blocks: %v", err)
+	}
+	IndexTransactions(db, 0, 10, nil)
+
+	// Prune the history and ensure only the bodies and receipts are gone
+	tail, err := PruneChainHistory(db, 6, nil)
+	if err != nil || tail != 6 {
+		t.Fatalf("failed to prune history: tail %d, err %v", tail, err)
+	}
+	for _, block := range blocks {
+		var (
+			hash   = block.Hash()
+			number = block.NumberU64()
+			pruned = number < tail
+		)
+		if ReadHeader(db, hash, number) == nil || ReadCanonicalHash(db, number) != hash || ReadTd(db, hash, number) == nil {
+			t.Fatalf("block %d: header chain pruned", number)
+		}
+		if have := ReadBodyRLP(db, hash, number) == nil; have != pruned {
+			t.Fatalf("block %d: body pruned mismatch: have %v, want %v", number, have, pruned)
+		}
+		if have := ReadReceiptsRLP(db, hash, number) == nil; have != pruned {
+			t.Fatalf("block %d: receipts pruned mismatch: have %v, want %v", number, have, pruned)
+		}
+		if have := ReadTxLookupEntry(db, block.Transactions()[0].Hash()) == nil; have != pruned {
+			t.Fatalf("block %d: tx index pruned mismatch: have %v, want %v", number, have, pruned)
+		}
+	}
+	if txTail := ReadTxIndexTail(db); txTail == nil || *txTail != tail {
+		t.Fatalf("tx index tail mismatch: have %v, want %d", txTail, tail)
+	}
+	// Pruning below the tail is a noop, beyond the ancients is capped
+	if tail, err := PruneChainHistory(db, 3, nil); err != nil || tail != 6 {
+		t.Fatalf("unexpected lower pruning result: tail %d, err %v", tail, err)
+	}
+	if tail, err := PruneChainHistory(db, 100, nil); err != nil || tail != 10 {
+		t.Fatalf("unexpected capped pruning result: tail %d, err %v", tail, err)
+	}
+}
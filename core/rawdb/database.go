@@ -66,7 +66,7 @@ func (frdb *freezerdb) Close() error {
 // a freeze cycle completes, without having to sleep for a minute to trigger the
 // automatic background run.
 func (frdb *freezerdb) Freeze(threshold uint64) error {
-	if frdb.AncientStore.(*chainFreezer).readonly {
+	if f, ok := frdb.AncientStore.(*chainFreezer); !ok || f.readonly {
 		return errReadOnly
 	}
 	// Set the freezer threshold to a temporary value
@@ -197,9 +197,21 @@ func resolveChainFreezerDir(ancient string) string {
 // value data store with a freezer moving immutable chain segments into cold
 // storage. The passed ancient indicates the path of root ancient directory
 // where the chain freezer can be opened.
+//
+// If the ancient location is an HTTP(S) URL, the chain segments are served from
+// a read-only remote freezer instead, while the key-value store stays local. No
+// data is moved into a remote freezer.
 func NewDatabaseWithFreezer(db ethdb.KeyValueStore, ancient string, namespace string, readonly bool) (ethdb.Database, error) {
 	// Create the idle freezer instance
-	frdb, err := newChainFreezer(resolveChainFreezerDir(ancient), namespace, readonly)
+	var (
+		frdb ethdb.AncientStore
+		err  error
+	)
+	if IsRemoteAncient(ancient) {
+		frdb, err = newRemoteFreezer(ancient, namespace, remoteFreezerCacheSize)
+	} else {
+		frdb, err = newChainFreezer(resolveChainFreezerDir(ancient), namespace, readonly)
+	}
 	if err != nil {
 		printChainMetadata(db)
 		return nil, err
@@ -283,13 +295,18 @@ func NewDatabaseWithFreezer(db ethdb.KeyValueStore, ancient string, namespace st
 		}
 	}
 	// Freezer is consistent with the key-value database, permit combining the two
-	if !frdb.readonly {
-		frdb.wg.Add(1)
+	if f, ok := frdb.(*chainFreezer); ok && !f.readonly {
+		f.wg.Add(1)
 		go func() {
-			frdb.freeze(db)
-			frdb.wg.Done()
+			f.freeze(db)
+			f.wg.Done()
 		}()
 	}
+	// The remote freezer only serves the chain segments, there's no local ancient
+	// directory to place the other freezers (e.g. state history) into.
+	if IsRemoteAncient(ancient) {
+		ancient = ""
+	}
 	return &freezerdb{
 		ancientRoot:   ancient,
 		KeyValueStore: db,
@@ -451,6 +468,11 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		numHashPairings stat
 		hashNumPairings stat
 		tries           stat
+		accountTries    stat
+		storageTries    stat
+		stateLookups    stat
+		stateDiffs      stat
+		stateDiffIndex  stat
 		codes           stat
 		txLookups       stat
 		accountSnaps    stat
@@ -491,8 +513,20 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 			numHashPairings.Add(size)
 		case bytes.HasPrefix(key, headerNumberPrefix) && len(key) == (len(headerNumberPrefix)+common.HashLength):
 			hashNumPairings.Add(size)
+		case IsAccountTrieNode(key):
+			accountTries.Add(size)
+		case IsStorageTrieNode(key):
+			storageTries.Add(size)
+		case bytes.HasPrefix(key, stateIDPrefix) && len(key) == len(stateIDPrefix)+common.HashLength:
+			stateLookups.Add(size)
 		case len(key) == common.HashLength:
 			tries.Add(size)
+		case bytes.HasPrefix(key, stateDiffPrefix) && len(key) == len(stateDiffPrefix)+2*common.HashLength:
+			stateDiffs.Add(size)
+		case bytes.HasPrefix(key, stateDiffAccountPrefix) && len(key) == len(stateDiffAccountPrefix)+common.HashLength+8,
+			bytes.HasPrefix(key, stateDiffStoragePrefix) && len(key) == len(stateDiffStoragePrefix)+2*common.HashLength+8,
+			bytes.HasPrefix(key, stateDiffDestructPrefix) && len(key) == len(stateDiffDestructPrefix)+common.HashLength+8:
+			stateDiffIndex.Add(size)
 		case bytes.HasPrefix(key, CodePrefix) && len(key) == len(CodePrefix)+common.HashLength:
 			codes.Add(size)
 		case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
@@ -530,6 +564,7 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 				lastPivotKey, fastTrieProgressKey, snapshotDisabledKey, SnapshotRootKey, snapshotJournalKey,
 				snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey,
 				uncleanShutdownKey, badBlockKey, transitionStatusKey, skeletonSyncStatusKey,
+				persistentStateIDKey, trieJournalKey, stateDiffTailKey, stateDiffGapKey, pruningCheckpointKey,
 			} {
 				if bytes.Equal(key, meta) {
 					metadata.Add(size)
@@ -559,6 +594,11 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		{"Key-Value store", "Bloombit index", bloomBits.Size(), bloomBits.Count()},
 		{"Key-Value store", "Contract codes", codes.Size(), codes.Count()},
 		{"Key-Value store", "Trie nodes", tries.Size(), tries.Count()},
+		{"Key-Value store", "Path trie account nodes", accountTries.Size(), accountTries.Count()},
+		{"Key-Value store", "Path trie storage nodes", storageTries.Size(), storageTries.Count()},
+		{"Key-Value store", "Path trie state lookups", stateLookups.Size(), stateLookups.Count()},
+		{"Key-Value store", "State diffs", stateDiffs.Size(), stateDiffs.Count()},
+		{"Key-Value store", "State diff index", stateDiffIndex.Size(), stateDiffIndex.Count()},
 		{"Key-Value store", "Trie preimages", preimages.Size(), preimages.Count()},
 		{"Key-Value store", "Account snapshot", accountSnaps.Size(), accountSnaps.Count()},
 		{"Key-Value store", "Storage snapshot", storageSnaps.Size(), storageSnaps.Count()},
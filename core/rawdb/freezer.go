@@ -79,15 +79,16 @@ type Freezer struct {
 // NewChainFreezer is a small utility method around NewFreezer that sets the
 // default parameters for the chain storage.
 func NewChainFreezer(datadir string, namespace string, readonly bool) (*Freezer, error) {
-	return NewFreezer(datadir, namespace, readonly, freezerTableSize, chainFreezerNoSnappy)
+	return NewFreezer(datadir, namespace, readonly, freezerTableSize, chainFreezerTableConfigs)
 }
 
 // NewFreezer creates a freezer instance for maintaining immutable ordered
 // data according to the given parameters.
 //
-// The 'tables' argument defines the data tables. If the value of a map
-// entry is true, snappy compression is disabled for the table.
-func NewFreezer(datadir string, namespace string, readonly bool, maxTableSize uint32, tables map[string]bool) (*Freezer, error) {
+// The 'tables' argument defines the data tables along with their settings. Only
+// the prunable tables are affected by tail truncation, the tail of the others is
+// always zero.
+func NewFreezer(datadir string, namespace string, readonly bool, maxTableSize uint32, tables map[string]freezerTableConfig) (*Freezer, error) {
 	// Create the initial freezer object
 	var (
 		readMeter  = metrics.NewRegisteredMeter(namespace+"ancient/read", nil)
@@ -121,8 +122,8 @@ func NewFreezer(datadir string, namespace string, readonly bool, maxTableSize ui
 	}
 
 	// Create the tables.
-	for name, disableSnappy := range tables {
-		table, err := newTable(datadir, name, readMeter, writeMeter, sizeGauge, maxTableSize, disableSnappy, readonly)
+	for name, config := range tables {
+		table, err := newTable(datadir, name, readMeter, writeMeter, sizeGauge, maxTableSize, config.codec, readonly)
 		if err != nil {
 			for _, table := range freezer.tables {
 				table.Close()
@@ -130,6 +131,7 @@ func NewFreezer(datadir string, namespace string, readonly bool, maxTableSize ui
 			lock.Unlock()
 			return nil, err
 		}
+		table.prunable = config.prunable
 		freezer.tables[name] = table
 	}
 	var err error
@@ -212,7 +214,8 @@ func (f *Freezer) Ancients() (uint64, error) {
 	return f.frozen.Load(), nil
 }
 
-// Tail returns the number of first stored item in the freezer.
+// Tail returns the number of first stored item in the prunable tables of the
+// freezer. Items of the other tables are never deleted from the tail.
 func (f *Freezer) Tail() (uint64, error) {
 	return f.tail.Load(), nil
 }
@@ -293,7 +296,8 @@ func (f *Freezer) TruncateHead(items uint64) error {
 	return nil
 }
 
-// TruncateTail discards any recent data below the provided threshold number.
+// TruncateTail discards any recent data below the provided threshold number
+// from the prunable tables.
 func (f *Freezer) TruncateTail(tail uint64) error {
 	if f.readonly {
 		return errReadOnly
@@ -305,6 +309,9 @@ func (f *Freezer) TruncateTail(tail uint64) error {
 		return nil
 	}
 	for _, table := range f.tables {
+		if !table.prunable {
+			continue
+		}
 		if err := table.truncateTail(tail); err != nil {
 			return err
 		}
@@ -327,31 +334,41 @@ func (f *Freezer) Sync() error {
 	return nil
 }
 
-// validate checks that every table has the same boundary.
+// validate checks that every table has the same boundary, and that all the
+// prunable tables have the same tail while the others are not tail-truncated.
 // Used instead of `repair` in readonly mode.
 func (f *Freezer) validate() error {
 	if len(f.tables) == 0 {
 		return nil
 	}
 	var (
-		head uint64
-		tail uint64
-		name string
+		head     uint64
+		tail     uint64
+		name     string
+		tailName string
 	)
 	// Hack to get boundary of any table
 	for kind, table := range f.tables {
 		head = table.items.Load()
-		tail = table.itemHidden.Load()
 		name = kind
-		break
+		if table.prunable {
+			tail = table.itemHidden.Load()
+			tailName = kind
+		}
 	}
 	// Now check every table against those boundaries.
 	for kind, table := range f.tables {
 		if head != table.items.Load() {
 			return fmt.Errorf("freezer tables %s and %s have differing head: %d != %d", kind, name, table.items.Load(), head)
 		}
+		if !table.prunable {
+			if hidden := table.itemHidden.Load(); hidden != 0 {
+				return fmt.Errorf("non-prunable freezer table %s has a non-zero tail: %d", kind, hidden)
+			}
+			continue
+		}
 		if tail != table.itemHidden.Load() {
-			return fmt.Errorf("freezer tables %s and %s have differing tail: %d != %d", kind, name, table.itemHidden.Load(), tail)
+			return fmt.Errorf("freezer tables %s and %s have differing tail: %d != %d", kind, tailName, table.itemHidden.Load(), tail)
 		}
 	}
 	f.frozen.Store(head)
@@ -359,7 +376,8 @@ func (f *Freezer) validate() error {
 	return nil
 }
 
-// repair truncates all data tables to the same length.
+// repair truncates all data tables to the same length, and the prunable ones
+// to the same tail.
 func (f *Freezer) repair() error {
 	var (
 		head = uint64(math.MaxUint64)
@@ -370,6 +388,9 @@ func (f *Freezer) repair() error {
 		if head > items {
 			head = items
 		}
+		if !table.prunable {
+			continue
+		}
 		hidden := table.itemHidden.Load()
 		if hidden > tail {
 			tail = hidden
@@ -379,6 +400,9 @@ func (f *Freezer) repair() error {
 		if err := table.truncateHead(head); err != nil {
 			return err
 		}
+		if !table.prunable {
+			continue
+		}
 		if err := table.truncateTail(tail); err != nil {
 			return err
 		}
@@ -440,7 +464,7 @@ func (f *Freezer) MigrateTable(kind string, convert convertLegacyFn) error {
 	// Set up new dir for the migrated table, the content of which
 	// we'll at the end move over to the ancients dir.
 	migrationPath := filepath.Join(ancientsPath, "migration")
-	newTable, err := newFreezerTable(migrationPath, kind, table.noCompression, false)
+	newTable, err := newFreezerTable(migrationPath, kind, table.codec, false)
 	if err != nil {
 		return err
 	}
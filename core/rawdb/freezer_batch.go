@@ -19,7 +19,6 @@ package rawdb
 import (
 	"fmt"
 
-	"github.com/golang/snappy"
 	"github.com/rethereum-blockchain/go-rethereum/common/math"
 	"github.com/rethereum-blockchain/go-rethereum/rlp"
 )
@@ -84,8 +83,8 @@ func (batch *freezerBatch) commit() (item uint64, writeSize int64, err error) {
 type freezerTableBatch struct {
 	t *freezerTable
 
-	sb          *snappyBuffer
 	encBuffer   writeBuffer
+	compBuffer  []byte // reusable buffer of the compressed item
 	dataBuffer  []byte
 	indexBuffer []byte
 	curItem     uint64 // expected index of next append
@@ -95,9 +94,6 @@ type freezerTableBatch struct {
 // newBatch creates a new batch for the freezer table.
 func (t *freezerTable) newBatch() *freezerTableBatch {
 	batch := &freezerTableBatch{t: t}
-	if !t.noCompression {
-		batch.sb = new(snappyBuffer)
-	}
 	batch.reset()
 	return batch
 }
@@ -123,11 +119,7 @@ func (batch *freezerTableBatch) Append(item uint64, data interface{}) error {
 	if err := rlp.Encode(&batch.encBuffer, data); err != nil {
 		return err
 	}
-	encItem := batch.encBuffer.data
-	if batch.sb != nil {
-		encItem = batch.sb.compress(encItem)
-	}
-	return batch.appendItem(encItem)
+	return batch.appendCompressed(batch.encBuffer.data)
 }
 
 // AppendRaw injects a binary blob at the end of the freezer table. The item number is a
@@ -138,11 +130,21 @@ func (batch *freezerTableBatch) AppendRaw(item uint64, blob []byte) error {
 		return fmt.Errorf("%w: have %d want %d", errOutOrderInsertion, item, batch.curItem)
 	}
 
-	encItem := blob
-	if batch.sb != nil {
-		encItem = batch.sb.compress(blob)
+	return batch.appendCompressed(blob)
+}
+
+// appendCompressed compresses the item with the codec of the table, and adds
+// it at the end of the batch.
+func (batch *freezerTableBatch) appendCompressed(blob []byte) error {
+	if batch.t.codec == codecNone {
+		return batch.appendItem(blob)
+	}
+	var err error
+	batch.compBuffer, err = batch.t.compressor.compress(batch.t.codec, batch.compBuffer[:0], blob)
+	if err != nil {
+		return err
 	}
-	return batch.appendItem(encItem)
+	return batch.appendItem(batch.compBuffer)
 }
 
 func (batch *freezerTableBatch) appendItem(data []byte) error {
@@ -208,30 +210,6 @@ func (batch *freezerTableBatch) commit() error {
 	return nil
 }
 
-// snappyBuffer writes snappy in block format, and can be reused. It is
-// reset when WriteTo is called.
-type snappyBuffer struct {
-	dst []byte
-}
-
-// compress snappy-compresses the data.
-func (s *snappyBuffer) compress(data []byte) []byte {
-	// The snappy library does not care what the capacity of the buffer is,
-	// but only checks the length. If the length is too small, it will
-	// allocate a brand new buffer.
-	// To avoid that, we check the required size here, and grow the size of the
-	// buffer to utilize the full capacity.
-	if n := snappy.MaxEncodedLen(len(data)); len(s.dst) < n {
-		if cap(s.dst) < n {
-			s.dst = make([]byte, n)
-		}
-		s.dst = s.dst[:n]
-	}
-
-	s.dst = snappy.Encode(s.dst, data)
-	return s.dst
-}
-
 // writeBuffer implements io.Writer for a byte slice.
 type writeBuffer struct {
 	data []byte
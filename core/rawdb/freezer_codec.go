@@ -0,0 +1,216 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// freezerCodec is the compression algorithm the items of a freezer table data
+// file are encoded with.
+type freezerCodec uint8
+
+const (
+	codecNone   freezerCodec = iota // Items are stored raw (.rdat files)
+	codecSnappy                     // Items are snappy compressed in block format
+	codecZstd                       // Items are zstd compressed, optionally with a table dictionary
+)
+
+// String implements fmt.Stringer, returning the name of the codec.
+func (c freezerCodec) String() string {
+	switch c {
+	case codecNone:
+		return "none"
+	case codecSnappy:
+		return "snappy"
+	case codecZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(c))
+	}
+}
+
+// parseFreezerCodec converts a codec name into the codec identifier. Only the
+// compressing codecs are accepted, as raw tables are stored in different files.
+func parseFreezerCodec(name string) (freezerCodec, error) {
+	switch name {
+	case "snappy":
+		return codecSnappy, nil
+	case "zstd":
+		return codecZstd, nil
+	default:
+		return 0, fmt.Errorf("unknown compression codec %q, supported ones: snappy, zstd", name)
+	}
+}
+
+// freezerCodecSpan marks the data files starting from First as compressed with
+// the given codec, until the next span.
+type freezerCodecSpan struct {
+	First uint32 // Number of the first data file in the span
+	Codec uint8  // Compression codec of the data files in the span
+}
+
+// zstdDictMagic is the magic prefix of dictionaries in the zstd dictionary
+// format, anything else is used as a raw content dictionary.
+var zstdDictMagic = []byte{0x37, 0xa4, 0x30, 0xec}
+
+// freezerCompressor encodes and decodes the items of a freezer table with any
+// of the supported codecs. The zstd coders are created on first use, with the
+// dictionary of the table if it has one.
+type freezerCompressor struct {
+	dict []byte // Optional zstd dictionary, formatted or raw content
+
+	once sync.Once
+	zenc *zstd.Encoder
+	zdec *zstd.Decoder
+	zerr error
+}
+
+// newFreezerCompressor creates a compressor with the given zstd dictionary.
+func newFreezerCompressor(dict []byte) *freezerCompressor {
+	return &freezerCompressor{dict: dict}
+}
+
+// dictionaryPath returns the path of the zstd dictionary file of a table.
+func dictionaryPath(path, name string) string {
+	return filepath.Join(path, fmt.Sprintf("%s.dict", name))
+}
+
+// loadDictionary reads the zstd dictionary of a table, nil if it has none.
+func loadDictionary(path, name string) ([]byte, error) {
+	dict, err := os.ReadFile(dictionaryPath(path, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return dict, err
+}
+
+// rawDictionaryID derives the frame identifier of a raw content dictionary,
+// falling into the range reserved for private dictionaries.
+func rawDictionaryID(dict []byte) uint32 {
+	return 32768 + crc32.ChecksumIEEE(dict)%(math.MaxInt32-32768)
+}
+
+// initZstd creates the zstd encoder and decoder if not yet done.
+func (c *freezerCompressor) initZstd() error {
+	c.once.Do(func() {
+		var (
+			encOpts = []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+			decOpts = []zstd.DOption{zstd.WithDecoderConcurrency(0)}
+		)
+		switch {
+		case len(c.dict) == 0:
+		case bytes.HasPrefix(c.dict, zstdDictMagic):
+			encOpts = append(encOpts, zstd.WithEncoderDict(c.dict))
+			decOpts = append(decOpts, zstd.WithDecoderDicts(c.dict))
+		default:
+			id := rawDictionaryID(c.dict)
+			encOpts = append(encOpts, zstd.WithEncoderDictRaw(id, c.dict))
+			decOpts = append(decOpts, zstd.WithDecoderDictRaw(id, c.dict))
+		}
+		if c.zenc, c.zerr = zstd.NewWriter(nil, encOpts...); c.zerr != nil {
+			return
+		}
+		c.zdec, c.zerr = zstd.NewReader(nil, decOpts...)
+	})
+	return c.zerr
+}
+
+// compress appends the encoded form of data to dst. The dst slice is reused
+// where possible, so the result is only valid until the next call.
+func (c *freezerCompressor) compress(codec freezerCodec, dst, data []byte) ([]byte, error) {
+	switch codec {
+	case codecNone:
+		return append(dst, data...), nil
+	case codecSnappy:
+		// The snappy library does not care what the capacity of the buffer is,
+		// but only checks the length. Grow the length to the full capacity to
+		// avoid allocating a brand new buffer.
+		n := len(dst) + snappy.MaxEncodedLen(len(data))
+		if cap(dst) < n {
+			grown := make([]byte, len(dst), n)
+			copy(grown, dst)
+			dst = grown
+		}
+		enc := snappy.Encode(dst[len(dst):n], data)
+		return dst[:len(dst)+len(enc)], nil
+	case codecZstd:
+		if err := c.initZstd(); err != nil {
+			return nil, err
+		}
+		return c.zenc.EncodeAll(data, dst), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %v", codec)
+	}
+}
+
+// decodedLen returns the length of the decoded item, without decoding it if
+// the codec allows that.
+func (c *freezerCompressor) decodedLen(codec freezerCodec, item []byte) (int, error) {
+	switch codec {
+	case codecNone:
+		return len(item), nil
+	case codecSnappy:
+		return snappy.DecodedLen(item)
+	case codecZstd:
+		var header zstd.Header
+		if err := header.Decode(item); err == nil && header.HasFCS {
+			return int(header.FrameContentSize), nil
+		}
+		data, err := c.decompress(codec, item)
+		return len(data), err
+	default:
+		return 0, fmt.Errorf("unsupported compression codec %v", codec)
+	}
+}
+
+// decompress decodes an item compressed with the given codec.
+func (c *freezerCompressor) decompress(codec freezerCodec, item []byte) ([]byte, error) {
+	switch codec {
+	case codecNone:
+		return item, nil
+	case codecSnappy:
+		return snappy.Decode(nil, item)
+	case codecZstd:
+		if err := c.initZstd(); err != nil {
+			return nil, err
+		}
+		return c.zdec.DecodeAll(item, nil)
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %v", codec)
+	}
+}
+
+// close releases the resources held by the zstd coders.
+func (c *freezerCompressor) close() {
+	if c.zenc != nil {
+		c.zenc.Close()
+	}
+	if c.zdec != nil {
+		c.zdec.Close()
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/rethereum-blockchain/go-rethereum/metrics"
+)
+
+// codecChunks returns n compressible items to write into a table.
+func codecChunks(first, n int) map[uint64][]byte {
+	items := make(map[uint64][]byte)
+	for i := first; i < first+n; i++ {
+		items[uint64(i)] = bytes.Repeat([]byte{byte(i)}, 100)
+	}
+	return items
+}
+
+func appendChunks(t *testing.T, f *freezerTable, items map[uint64][]byte, first, n int) {
+	t.Helper()
+
+	batch := f.newBatch()
+	for i := first; i < first+n; i++ {
+		if err := batch.AppendRaw(uint64(i), items[uint64(i)]); err != nil {
+			t.Fatalf("Failed to append item %d: %v", i, err)
+		}
+	}
+	if err := batch.commit(); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+}
+
+// Tests that changing the codec of a compressed table keeps the existing data
+// files readable, and compresses the new items with the new codec.
+func TestFreezerTableCodecSwitch(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dir   = t.TempDir()
+		fname = fmt.Sprintf("codec-%d", rand.Uint64())
+		items = codecChunks(0, 30)
+	)
+	f, err := newTable(dir, fname, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 200, codecSnappy, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendChunks(t, f, items, 0, 10)
+	f.Close()
+
+	// Reopen with zstd, the snappy files must stay intact
+	f, err = newTable(dir, fname, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 200, codecZstd, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switched := f.headId
+	if codec := f.fileCodec(switched - 1); codec != codecSnappy {
+		t.Fatalf("Previous head codec mismatch: have %v, want %v", codec, codecSnappy)
+	}
+	if codec := f.fileCodec(switched); codec != codecZstd {
+		t.Fatalf("New head codec mismatch: have %v, want %v", codec, codecZstd)
+	}
+	appendChunks(t, f, items, 10, 20)
+	checkRetrieve(t, f, items)
+
+	// Truncate back into the snappy files, new items must go into a new file
+	if err := f.truncateHead(5); err != nil {
+		t.Fatal(err)
+	}
+	if codec := f.fileCodec(f.headId); codec != codecZstd {
+		t.Fatalf("Truncated head codec mismatch: have %v, want %v", codec, codecZstd)
+	}
+	appendChunks(t, f, items, 5, 25)
+	f.Close()
+
+	// Reopen and ensure everything is still readable, also in read-only mode
+	f, err = newTable(dir, fname, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 200, codecZstd, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	checkRetrieve(t, f, items)
+}
+
+// Tests that a table can be recompressed, with or without a dictionary.
+func TestFreezerTableRecompress(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dir   = t.TempDir()
+		fname = fmt.Sprintf("recompress-%d", rand.Uint64())
+		items = codecChunks(0, 40)
+		dict  = bytes.Repeat([]byte{0x01, 0x02, 0x03}, 100)
+	)
+	f, err := newTable(dir, fname, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 200, codecSnappy, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendChunks(t, f, items, 0, 40)
+	if err := f.truncateTail(12); err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 12; i++ {
+		delete(items, i)
+	}
+	for _, test := range []struct {
+		codec freezerCodec
+		dict  []byte
+	}{
+		{codecZstd, nil},
+		{codecZstd, dict},
+		{codecSnappy, nil},
+	} {
+		if err := f.recompress(test.codec, test.dict); err != nil {
+			t.Fatalf("Failed to recompress to %v: %v", test.codec, err)
+		}
+		for num := f.tailId; num <= f.headId; num++ {
+			if codec := f.fileCodec(num); codec != test.codec {
+				t.Fatalf("File %d codec mismatch: have %v, want %v", num, codec, test.codec)
+			}
+		}
+		checkRetrieve(t, f, items)
+
+		// Ensure the table reopens fine with the default codec, keeping the new one
+		f.Close()
+		if f, err = newTable(dir, fname, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 200, codecSnappy, false); err != nil {
+			t.Fatal(err)
+		}
+		if codec := f.fileCodec(f.headId); codec != test.codec {
+			t.Fatalf("Reopened head codec mismatch: have %v, want %v", codec, test.codec)
+		}
+		checkRetrieve(t, f, items)
+		if _, err := os.Stat(dictionaryPath(dir, fname)); (err == nil) != (len(test.dict) > 0) {
+			t.Fatalf("Dictionary file presence mismatch: %v", err)
+		}
+	}
+	f.Close()
+
+	// Raw tables can't be recompressed
+	raw, err := newTable(dir, fname+"-raw", metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 200, codecNone, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if err := raw.recompress(codecZstd, nil); err == nil {
+		t.Fatal("Raw table recompressed")
+	}
+}
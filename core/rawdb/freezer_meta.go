@@ -24,7 +24,10 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/rlp"
 )
 
-const freezerVersion = 1 // The initial version tag of freezer table metadata
+const (
+	freezerVersion      = 1 // The initial version tag of freezer table metadata
+	freezerCodecVersion = 2 // Version tag of the metadata tracking the compression codecs of the data files
+)
 
 // freezerTableMeta wraps all the metadata of the freezer table.
 type freezerTableMeta struct {
@@ -36,6 +39,11 @@ type freezerTableMeta struct {
 	// plus the number of items hidden in the table, so it should never
 	// be lower than the "actual tail".
 	VirtualTail uint64
+
+	// Codecs is the list of compression codecs of the data files in ascending
+	// order of the first file they apply to. If empty, the table is entirely
+	// compressed with snappy, or not compressed at all for raw tables.
+	Codecs []freezerCodecSpan `rlp:"optional"`
 }
 
 // newMetadata initializes the metadata object with the given virtual tail.
@@ -0,0 +1,496 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/common/lru"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/metrics"
+	"github.com/rethereum-blockchain/go-rethereum/rlp"
+)
+
+const (
+	// remoteFreezerCacheSize is the maximum size of the ancient items retrieved
+	// from a remote freezer, which are cached locally.
+	remoteFreezerCacheSize = 64 * 1024 * 1024
+
+	// remoteFreezerTimeout is the maximum time allowed for a single request to
+	// the remote freezer.
+	remoteFreezerTimeout = 30 * time.Second
+
+	// remoteFreezerFileLimit is the maximum size of an entire remote file (table
+	// metadata and compression dictionaries) that is retrieved at once.
+	remoteFreezerFileLimit = 16 * 1024 * 1024
+)
+
+// errRemoteNotFound is returned if a file is missing from the remote freezer.
+var errRemoteNotFound = errors.New("remote file not found")
+
+// IsRemoteAncient reports whether the given ancient store location refers to a
+// remote freezer served over HTTP instead of a local directory.
+func IsRemoteAncient(ancient string) bool {
+	return strings.HasPrefix(ancient, "http://") || strings.HasPrefix(ancient, "https://")
+}
+
+// remoteItemKey identifies an item in the local cache of the remote freezer.
+type remoteItemKey struct {
+	kind   string
+	number uint64
+}
+
+// remoteFreezer is a read-only ancient store serving the chain segments from a
+// remote freezer: a static HTTP file server in front of the data, index and
+// metadata files of a chain freezer directory. Ranged requests are used to only
+// retrieve the needed parts of the files, and the retrieved items are cached in
+// a local LRU cache.
+//
+// The content of the remote freezer is loaded once when opened, any items added
+// to it later on are not visible.
+type remoteFreezer struct {
+	url    string
+	client *http.Client
+	tables map[string]*remoteTable
+	cache  *lru.SizeConstrainedCache[remoteItemKey, []byte]
+
+	frozen uint64 // Number of items available in all the tables
+	tail   uint64 // Number of the first item available in the prunable tables
+
+	readMeter metrics.Meter // Meter for measuring the amount of data retrieved remotely
+}
+
+// newRemoteFreezer opens the remote chain freezer at the given URL.
+func newRemoteFreezer(url string, namespace string, cacheSize uint64) (*remoteFreezer, error) {
+	f := &remoteFreezer{
+		url:       strings.TrimSuffix(url, "/"),
+		client:    &http.Client{Timeout: remoteFreezerTimeout},
+		tables:    make(map[string]*remoteTable),
+		cache:     lru.NewSizeConstrainedCache[remoteItemKey, []byte](cacheSize),
+		readMeter: metrics.NewRegisteredMeter(namespace+"ancient/remote/read", nil),
+	}
+	for name, config := range chainFreezerTableConfigs {
+		table, err := f.openTable(name, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open remote table %s: %v", name, err)
+		}
+		f.tables[name] = table
+	}
+	// Align the tables the same way as the local freezer does
+	f.frozen = ^uint64(0)
+	for _, table := range f.tables {
+		if table.items < f.frozen {
+			f.frozen = table.items
+		}
+		if table.prunable && table.hidden > f.tail {
+			f.tail = table.hidden
+		}
+	}
+	log.Info("Opened remote ancient store", "url", f.url, "items", f.frozen, "tail", f.tail)
+	return f, nil
+}
+
+// fetch retrieves the given byte range of a remote file, or the entire file if
+// the length is negative. Ranged requests must be answered with partial content,
+// servers ignoring the range are rejected instead of downloading the whole file.
+func (f *remoteFreezer) fetch(name string, offset int64, length int64) ([]byte, error) {
+	if length == 0 {
+		return nil, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, f.url+"/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	want, limit := http.StatusOK, int64(remoteFreezerFileLimit)
+	if length > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+		want, limit = http.StatusPartialContent, length
+	}
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errRemoteNotFound
+	}
+	if res.StatusCode != want {
+		return nil, fmt.Errorf("remote file %s: unexpected status %s, want %d", name, res.Status, want)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("remote file %s too large: want at most %d bytes", name, limit)
+	}
+	if length > 0 && int64(len(data)) != length {
+		return nil, fmt.Errorf("remote file %s truncated: have %d, want %d", name, len(data), length)
+	}
+	f.readMeter.Mark(int64(len(data)))
+	return data, nil
+}
+
+// size retrieves the size of a remote file.
+func (f *remoteFreezer) size(name string) (int64, error) {
+	res, err := f.client.Head(f.url + "/" + name)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		size, err := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("remote file %s: invalid size: %v", name, err)
+		}
+		return size, nil
+	case http.StatusNotFound:
+		return 0, errRemoteNotFound
+	default:
+		return 0, fmt.Errorf("remote file %s: %s", name, res.Status)
+	}
+}
+
+// openTable loads the metadata and the index boundaries of a remote table.
+func (f *remoteFreezer) openTable(name string, config freezerTableConfig) (*remoteTable, error) {
+	t := &remoteTable{
+		freezer:  f,
+		name:     name,
+		raw:      config.codec == codecNone,
+		prunable: config.prunable,
+	}
+	idxName := fmt.Sprintf("%s.cidx", name)
+	if t.raw {
+		idxName = fmt.Sprintf("%s.ridx", name)
+	}
+	t.index = idxName
+
+	size, err := f.size(idxName)
+	if err != nil {
+		return nil, err
+	}
+	if size < indexEntrySize || size%indexEntrySize != 0 {
+		return nil, fmt.Errorf("invalid index size %d", size)
+	}
+	blob, err := f.fetch(idxName, 0, indexEntrySize)
+	if err != nil {
+		return nil, err
+	}
+	var first indexEntry
+	first.unmarshalBinary(blob)
+
+	t.tailId = first.filenum
+	t.offset = uint64(first.offset)
+	t.items = t.offset + uint64(size/indexEntrySize-1)
+	t.hidden = t.offset
+
+	// Load the virtual tail and the compression codecs from the metadata
+	blob, err = f.fetch(fmt.Sprintf("%s.meta", name), 0, -1)
+	switch {
+	case errors.Is(err, errRemoteNotFound):
+	case err != nil:
+		return nil, err
+	default:
+		var meta freezerTableMeta
+		if err := rlp.Decode(bytes.NewReader(blob), &meta); err != nil {
+			return nil, fmt.Errorf("invalid metadata: %v", err)
+		}
+		if meta.VirtualTail > t.hidden {
+			t.hidden = meta.VirtualTail
+		}
+		t.codecs = meta.Codecs
+	}
+	var dict []byte
+	if !t.raw {
+		dict, err = f.fetch(fmt.Sprintf("%s.dict", name), 0, -1)
+		if err != nil && !errors.Is(err, errRemoteNotFound) {
+			return nil, err
+		}
+	}
+	t.compressor = newFreezerCompressor(dict)
+	return t, nil
+}
+
+// HasAncient returns an indicator whether the specified ancient data exists
+// in the remote freezer.
+func (f *remoteFreezer) HasAncient(kind string, number uint64) (bool, error) {
+	if table := f.tables[kind]; table != nil {
+		return number < f.frozen && number >= table.hidden, nil
+	}
+	return false, nil
+}
+
+// Ancient retrieves an ancient binary blob from the remote freezer.
+func (f *remoteFreezer) Ancient(kind string, number uint64) ([]byte, error) {
+	items, err := f.AncientRange(kind, number, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// AncientRange retrieves multiple items in sequence, starting from the index
+// 'start'. Cached items are served locally, the rest is retrieved remotely. The
+// returned items are copies, the caller is free to modify them.
+func (f *remoteFreezer) AncientRange(kind string, start, count, maxBytes uint64) ([][]byte, error) {
+	table := f.tables[kind]
+	if table == nil {
+		return nil, errUnknownTable
+	}
+	if start >= f.frozen || start < table.hidden || count == 0 {
+		return nil, errOutOfBounds
+	}
+	if start+count > f.frozen {
+		count = f.frozen - start
+	}
+	// Serve the leading items from the cache as long as possible
+	var (
+		output [][]byte
+		size   uint64
+	)
+	for number := start; number < start+count; number++ {
+		item, ok := f.cache.Get(remoteItemKey{kind, number})
+		if !ok {
+			break
+		}
+		if len(output) > 0 && size+uint64(len(item)) > maxBytes {
+			return output, nil
+		}
+		output = append(output, common.CopyBytes(item))
+		size += uint64(len(item))
+	}
+	if uint64(len(output)) == count || (len(output) > 0 && size >= maxBytes) {
+		return output, nil
+	}
+	// Retrieve the remainder remotely and cache all the results
+	next := start + uint64(len(output))
+	var limit uint64
+	if maxBytes > size {
+		limit = maxBytes - size
+	}
+	items, err := table.retrieve(next, count-uint64(len(output)), limit, len(output) == 0)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		f.cache.Add(remoteItemKey{kind, next + uint64(i)}, item)
+		output = append(output, common.CopyBytes(item))
+	}
+	return output, nil
+}
+
+// Ancients returns the number of items available in the remote freezer.
+func (f *remoteFreezer) Ancients() (uint64, error) {
+	return f.frozen, nil
+}
+
+// Tail returns the number of the first item available in the remote freezer.
+func (f *remoteFreezer) Tail() (uint64, error) {
+	return f.tail, nil
+}
+
+// AncientSize returns the total size of the data files of the given table.
+func (f *remoteFreezer) AncientSize(kind string) (uint64, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.totalSize()
+	}
+	return 0, errUnknownTable
+}
+
+// ReadAncients runs the given read operation, the remote freezer is never
+// modified so no locking is needed.
+func (f *remoteFreezer) ReadAncients(fn func(ethdb.AncientReaderOp) error) error {
+	return fn(f)
+}
+
+// ModifyAncients is not supported by the read-only remote freezer.
+func (f *remoteFreezer) ModifyAncients(func(ethdb.AncientWriteOp) error) (int64, error) {
+	return 0, errReadOnly
+}
+
+// TruncateHead is not supported by the read-only remote freezer.
+func (f *remoteFreezer) TruncateHead(items uint64) error {
+	return errReadOnly
+}
+
+// TruncateTail is not supported by the read-only remote freezer.
+func (f *remoteFreezer) TruncateTail(tail uint64) error {
+	return errReadOnly
+}
+
+// Sync is a noop, there is nothing to flush in a read-only freezer.
+func (f *remoteFreezer) Sync() error {
+	return nil
+}
+
+// MigrateTable is not supported by the read-only remote freezer.
+func (f *remoteFreezer) MigrateTable(string, func([]byte) ([]byte, error)) error {
+	return errReadOnly
+}
+
+// Close releases the idle connections to the remote freezer.
+func (f *remoteFreezer) Close() error {
+	for _, table := range f.tables {
+		table.compressor.close()
+	}
+	f.client.CloseIdleConnections()
+	return nil
+}
+
+// remoteTable is a single table of a remote freezer.
+type remoteTable struct {
+	freezer    *remoteFreezer
+	name       string
+	index      string             // Name of the index file
+	raw        bool               // Whether the items are stored uncompressed
+	prunable   bool               // Whether the table can be tail-truncated
+	codecs     []freezerCodecSpan // Codecs of the data files
+	compressor *freezerCompressor
+
+	tailId uint32 // Number of the earliest data file
+	offset uint64 // Number of items removed from the table
+	hidden uint64 // Number of items hidden in the table, at least offset
+	items  uint64 // Number of items in the table, including the removed ones
+
+	sizeOnce sync.Once
+	sizeVal  uint64
+	sizeErr  error
+}
+
+// dataFile returns the name of the given data file.
+func (t *remoteTable) dataFile(num uint32) string {
+	if t.raw {
+		return fmt.Sprintf("%s.%04d.rdat", t.name, num)
+	}
+	return fmt.Sprintf("%s.%04d.cdat", t.name, num)
+}
+
+// totalSize sums up the size of the index and all the data files of the table.
+func (t *remoteTable) totalSize() (uint64, error) {
+	t.sizeOnce.Do(func() {
+		var last indexEntry
+		blob, err := t.freezer.fetch(t.index, int64(t.items-t.offset)*indexEntrySize, indexEntrySize)
+		if err != nil {
+			t.sizeErr = err
+			return
+		}
+		last.unmarshalBinary(blob)
+		if t.items == t.offset {
+			last.filenum = t.tailId
+		}
+		size, err := t.freezer.size(t.index)
+		if err != nil {
+			t.sizeErr = err
+			return
+		}
+		t.sizeVal = uint64(size)
+		for num := t.tailId; num <= last.filenum; num++ {
+			size, err := t.freezer.size(t.dataFile(num))
+			if err != nil {
+				t.sizeErr = err
+				return
+			}
+			t.sizeVal += uint64(size)
+		}
+	})
+	return t.sizeVal, t.sizeErr
+}
+
+// remoteSegment is a contiguous run of items within a single data file.
+type remoteSegment struct {
+	file  uint32
+	start uint32   // Offset of the first item in the file
+	ends  []uint32 // End offsets of the items in the file
+}
+
+// retrieve reads up to 'count' items from the remote table. It reads at least
+// one item if 'atLeastOne' is set, but otherwise avoids retrieving more than
+// maxBytes bytes.
+func (t *remoteTable) retrieve(start, count, maxBytes uint64, atLeastOne bool) ([][]byte, error) {
+	// Retrieve the index entries of the requested items, the first entry of the
+	// index doubles as the tail marker so the first item starts from zero.
+	from := start - t.offset
+	blob, err := t.freezer.fetch(t.index, int64(from)*indexEntrySize, int64(count+1)*indexEntrySize)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]indexEntry, count+1)
+	for i := range indices {
+		indices[i].unmarshalBinary(blob[i*indexEntrySize:])
+	}
+	if from == 0 {
+		indices[0] = indexEntry{filenum: indices[1].filenum, offset: 0}
+	}
+	// Group the items into per-file segments, respecting the byte limit on the
+	// compressed data
+	var (
+		segments []*remoteSegment
+		total    uint64
+	)
+	for i := 0; i < int(count); i++ {
+		begin, end, file := indices[i].bounds(&indices[i+1])
+		if (i > 0 || !atLeastOne) && total+uint64(end-begin) > maxBytes {
+			break
+		}
+		total += uint64(end - begin)
+		if len(segments) == 0 || segments[len(segments)-1].file != file {
+			segments = append(segments, &remoteSegment{file: file, start: begin})
+		}
+		segment := segments[len(segments)-1]
+		segment.ends = append(segment.ends, end)
+	}
+	// Retrieve and decode the segments, respecting the byte limit on the
+	// decompressed data
+	var (
+		output [][]byte
+		size   uint64
+	)
+	for _, segment := range segments {
+		data, err := t.freezer.fetch(t.dataFile(segment.file), int64(segment.start), int64(segment.ends[len(segment.ends)-1]-segment.start))
+		if err != nil {
+			return nil, err
+		}
+		codec := spanCodec(t.raw, t.codecs, segment.file)
+		offset := segment.start
+		for _, end := range segment.ends {
+			item, err := t.compressor.decompress(codec, data[offset-segment.start:end-segment.start])
+			if err != nil {
+				return nil, err
+			}
+			if (len(output) > 0 || !atLeastOne) && size+uint64(len(item)) > maxBytes {
+				return output, nil
+			}
+			output = append(output, common.CopyBytes(item))
+			size += uint64(len(item))
+			offset = end
+		}
+	}
+	return output, nil
+}
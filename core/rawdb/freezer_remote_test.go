@@ -0,0 +1,162 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/metrics"
+)
+
+// Tests that the remote freezer serves the same items as the local freezer it
+// is backed by, across data files, codecs and a truncated tail.
+func TestRemoteFreezer(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dir   = t.TempDir()
+		count = uint64(100)
+	)
+	local, err := NewFreezer(dir, "", false, 512, chainFreezerTableConfigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+
+	_, err = local.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for i := uint64(0); i < count; i++ {
+			for kind := range chainFreezerTableConfigs {
+				item := bytes.Repeat([]byte{byte(i), byte(len(kind))}, int(i%16)+10)
+				if err := op.AppendRaw(kind, i, item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := local.TruncateTail(20); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+
+	remote, err := newRemoteFreezer(srv.URL, "", remoteFreezerCacheSize)
+	if err != nil {
+		t.Fatalf("Failed to open remote freezer: %v", err)
+	}
+	defer remote.Close()
+
+	if have, _ := remote.Ancients(); have != count {
+		t.Fatalf("Item count mismatch: have %d, want %d", have, count)
+	}
+	if have, want := mustTail(t, remote), mustTail(t, local); have != want {
+		t.Fatalf("Tail mismatch: have %d, want %d", have, want)
+	}
+	// Compare single items and ranges, twice to also check the cached results
+	for round := 0; round < 2; round++ {
+		for kind := range chainFreezerTableConfigs {
+			for i := uint64(0); i < count; i++ {
+				want, wantErr := local.Ancient(kind, i)
+				have, haveErr := remote.Ancient(kind, i)
+				if (wantErr == nil) != (haveErr == nil) {
+					t.Fatalf("%s #%d: error mismatch: have %v, want %v", kind, i, haveErr, wantErr)
+				}
+				if !bytes.Equal(have, want) {
+					t.Fatalf("%s #%d: item mismatch: have %x, want %x", kind, i, have, want)
+				}
+				hasLocal, _ := local.HasAncient(kind, i)
+				hasRemote, _ := remote.HasAncient(kind, i)
+				if hasLocal != hasRemote {
+					t.Fatalf("%s #%d: existence mismatch: have %v, want %v", kind, i, hasRemote, hasLocal)
+				}
+			}
+			for _, limit := range []uint64{0, 100, 1000, 100000} {
+				want, _ := local.AncientRange(kind, 30, 60, limit)
+				have, err := remote.AncientRange(kind, 30, 60, limit)
+				if err != nil {
+					t.Fatalf("%s: failed to retrieve range: %v", kind, err)
+				}
+				if !reflect.DeepEqual(have, want) {
+					t.Fatalf("%s: range mismatch with limit %d: have %d items, want %d", kind, limit, len(have), len(want))
+				}
+			}
+		}
+	}
+	// Ensure modifying the returned items doesn't corrupt the cache
+	item, _ := remote.Ancient(ChainFreezerBodiesTable, 50)
+	for i := range item {
+		item[i] = 0xff
+	}
+	want, _ := local.Ancient(ChainFreezerBodiesTable, 50)
+	if have, _ := remote.Ancient(ChainFreezerBodiesTable, 50); !bytes.Equal(have, want) {
+		t.Fatalf("Cached item modified: have %x, want %x", have, want)
+	}
+	// Ensure reads go through the operation callback and writes are rejected
+	err = remote.ReadAncients(func(op ethdb.AncientReaderOp) error {
+		_, err := op.Ancient(ChainFreezerHashTable, count-1)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to read ancients: %v", err)
+	}
+	if _, err := remote.ModifyAncients(func(ethdb.AncientWriteOp) error { return nil }); err != errReadOnly {
+		t.Fatalf("Remote freezer modified: %v", err)
+	}
+	if _, err := remote.Ancient(ChainFreezerHashTable, count); err != errOutOfBounds {
+		t.Fatalf("Out of bounds item retrieved: %v", err)
+	}
+}
+
+// Tests that servers ignoring range requests are rejected instead of the whole
+// file being downloaded.
+func TestRemoteFreezerNoRanges(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte{0xff}, 1024))
+	}))
+	defer srv.Close()
+
+	f := &remoteFreezer{url: srv.URL, client: srv.Client(), readMeter: metrics.NilMeter{}}
+	if _, err := f.fetch("data", 10, 10); err == nil {
+		t.Fatal("Full response accepted for a range request")
+	}
+	if blob, err := f.fetch("data", 0, -1); err != nil || len(blob) != 1024 {
+		t.Fatalf("Failed to fetch entire file: %v", err)
+	}
+}
+
+func mustTail(t *testing.T, f ethdb.AncientReaderOp) uint64 {
+	t.Helper()
+
+	tail, err := f.Tail()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tail
+}
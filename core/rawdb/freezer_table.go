@@ -22,12 +22,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
 
-	"github.com/golang/snappy"
 	"github.com/rethereum-blockchain/go-rethereum/common"
 	"github.com/rethereum-blockchain/go-rethereum/log"
 	"github.com/rethereum-blockchain/go-rethereum/metrics"
@@ -85,7 +85,7 @@ func (i *indexEntry) bounds(end *indexEntry) (startOffset, endOffset, fileId uin
 }
 
 // freezerTable represents a single chained data table within the freezer (e.g. blocks).
-// It consists of a data file (snappy encoded arbitrary data blobs) and an indexEntry
+// It consists of a data file (compressed arbitrary data blobs) and an indexEntry
 // file (uncompressed 64 bit indices into the data file).
 type freezerTable struct {
 	items      atomic.Uint64 // Number of items stored in the table (including items removed from tail)
@@ -98,11 +98,14 @@ type freezerTable struct {
 	// should never be lower than itemOffset.
 	itemHidden atomic.Uint64
 
-	noCompression bool // if true, disables snappy compression. Note: does not work retroactively
-	readonly      bool
-	maxFileSize   uint32 // Max file size for data-files
-	name          string
-	path          string
+	codec       freezerCodec       // codec to compress the appended items with, codecNone for raw tables
+	codecs      []freezerCodecSpan // codecs of the existing data files, see freezerTableMeta
+	compressor  *freezerCompressor // encoder and decoder of the compressed items
+	prunable    bool               // if true, the table is tail-truncated by the freezer, set by the owning freezer
+	readonly    bool
+	maxFileSize uint32 // Max file size for data-files
+	name        string
+	path        string
 
 	head   *os.File            // File descriptor for the data head of the table
 	index  *os.File            // File descriptor for the indexEntry file of the table
@@ -121,23 +124,37 @@ type freezerTable struct {
 }
 
 // newFreezerTable opens the given path as a freezer table.
-func newFreezerTable(path, name string, disableSnappy, readonly bool) (*freezerTable, error) {
-	return newTable(path, name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, freezerTableSize, disableSnappy, readonly)
+func newFreezerTable(path, name string, codec freezerCodec, readonly bool) (*freezerTable, error) {
+	return newTable(path, name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, freezerTableSize, codec, readonly)
 }
 
 // newTable opens a freezer table, creating the data and index files if they are
 // non-existent. Both files are truncated to the shortest common length to ensure
 // they don't go out of sync.
-func newTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFilesize uint32, noCompression, readonly bool) (*freezerTable, error) {
+//
+// The codec of a compressed table can be changed freely, the data files already
+// written stay intact and the new codec is used from the next data file on. The
+// given codec only applies to tables which were never switched though, the ones
+// converted to another codec keep it. Raw tables are stored in different files
+// and can't be converted.
+func newTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFilesize uint32, codec freezerCodec, readonly bool) (*freezerTable, error) {
 	// Ensure the containing directory exists and open the indexEntry file
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, err
 	}
-	var idxName string
-	if noCompression {
+	var (
+		idxName string
+		dict    []byte
+	)
+	if codec == codecNone {
 		idxName = fmt.Sprintf("%s.ridx", name) // raw index file
 	} else {
 		idxName = fmt.Sprintf("%s.cidx", name) // compressed index file
+
+		var err error
+		if dict, err = loadDictionary(path, name); err != nil {
+			return nil, err
+		}
 	}
 	var (
 		err   error
@@ -166,23 +183,37 @@ func newTable(path string, name string, readMeter metrics.Meter, writeMeter metr
 	}
 	// Create the table and repair any past inconsistency
 	tab := &freezerTable{
-		index:         index,
-		meta:          meta,
-		files:         make(map[uint32]*os.File),
-		readMeter:     readMeter,
-		writeMeter:    writeMeter,
-		sizeGauge:     sizeGauge,
-		name:          name,
-		path:          path,
-		logger:        log.New("database", path, "table", name),
-		noCompression: noCompression,
-		readonly:      readonly,
-		maxFileSize:   maxFilesize,
+		index:       index,
+		meta:        meta,
+		files:       make(map[uint32]*os.File),
+		readMeter:   readMeter,
+		writeMeter:  writeMeter,
+		sizeGauge:   sizeGauge,
+		name:        name,
+		path:        path,
+		logger:      log.New("database", path, "table", name),
+		codec:       codec,
+		compressor:  newFreezerCompressor(dict),
+		readonly:    readonly,
+		maxFileSize: maxFilesize,
 	}
 	if err := tab.repair(); err != nil {
 		tab.Close()
 		return nil, err
 	}
+	// Keep the codec of converted tables, see above
+	if codec != codecNone && len(tab.codecs) > 0 {
+		tab.codec = tab.fileCodec(tab.headId)
+	}
+	if !readonly {
+		tab.lock.Lock()
+		err := tab.switchCodec()
+		tab.lock.Unlock()
+		if err != nil {
+			tab.Close()
+			return nil, err
+		}
+	}
 	// Initialize the starting size counter
 	size, err := tab.sizeNolock()
 	if err != nil {
@@ -246,6 +277,7 @@ func (t *freezerTable) repair() error {
 		return err
 	}
 	t.itemHidden.Store(meta.VirtualTail)
+	t.codecs = meta.Codecs
 
 	// Read the last index, use the default value in case the freezer is empty
 	if offsetsSize == indexEntrySize {
@@ -437,6 +469,12 @@ func (t *freezerTable) truncateHead(items uint64) error {
 	t.headBytes = int64(expected.offset)
 	t.items.Store(items)
 
+	// The head might have slipped back into a data file compressed with an
+	// earlier codec, start a new one for the upcoming items if so.
+	if err := t.switchCodec(); err != nil {
+		return err
+	}
+
 	// Retrieve the new size and update the total size counter
 	newSize, err := t.sizeNolock()
 	if err != nil {
@@ -476,7 +514,7 @@ func (t *freezerTable) truncateTail(items uint64) error {
 	}
 	// Update the virtual tail marker and hidden these entries in table.
 	t.itemHidden.Store(items)
-	if err := writeMetadata(t.meta, newMetadata(items)); err != nil {
+	if err := writeMetadata(t.meta, t.metadata()); err != nil {
 		return err
 	}
 	// Hidden items still fall in the current tail file, no data file
@@ -579,6 +617,7 @@ func (t *freezerTable) Close() error {
 	for _, f := range t.files {
 		doClose(f, false, true) // close but do not sync
 	}
+	t.compressor.close()
 	t.index = nil
 	t.meta = nil
 	t.head = nil
@@ -594,7 +633,7 @@ func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error
 	var exist bool
 	if f, exist = t.files[num]; !exist {
 		var name string
-		if t.noCompression {
+		if t.codec == codecNone {
 			name = fmt.Sprintf("%s.%04d.rdat", t.name, num)
 		} else {
 			name = fmt.Sprintf("%s.%04d.cdat", t.name, num)
@@ -695,7 +734,7 @@ func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 // item, it _will_ return one element and possibly overflow the maxBytes.
 func (t *freezerTable) RetrieveItems(start, count, maxBytes uint64) ([][]byte, error) {
 	// First we read the 'raw' data, which might be compressed.
-	diskData, sizes, err := t.retrieveItems(start, count, maxBytes)
+	diskData, sizes, codecs, err := t.retrieveItems(start, count, maxBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -708,22 +747,18 @@ func (t *freezerTable) RetrieveItems(start, count, maxBytes uint64) ([][]byte, e
 	for i, diskSize := range sizes {
 		item := diskData[offset : offset+diskSize]
 		offset += diskSize
-		decompressedSize := diskSize
-		if !t.noCompression {
-			decompressedSize, _ = snappy.DecodedLen(item)
+		decompressedSize, err := t.compressor.decodedLen(codecs[i], item)
+		if err != nil {
+			return nil, err
 		}
 		if i > 0 && uint64(outputSize+decompressedSize) > maxBytes {
 			break
 		}
-		if !t.noCompression {
-			data, err := snappy.Decode(nil, item)
-			if err != nil {
-				return nil, err
-			}
-			output = append(output, data)
-		} else {
-			output = append(output, item)
+		data, err := t.compressor.decompress(codecs[i], item)
+		if err != nil {
+			return nil, err
 		}
+		output = append(output, data)
 		outputSize += decompressedSize
 	}
 	return output, nil
@@ -731,14 +766,14 @@ func (t *freezerTable) RetrieveItems(start, count, maxBytes uint64) ([][]byte, e
 
 // retrieveItems reads up to 'count' items from the table. It reads at least
 // one item, but otherwise avoids reading more than maxBytes bytes.
-// It returns the (potentially compressed) data, and the sizes.
-func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []int, error) {
+// It returns the (potentially compressed) data, the sizes and the codecs.
+func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []int, []freezerCodec, error) {
 	t.lock.RLock()
 	defer t.lock.RUnlock()
 
 	// Ensure the table and the item are accessible
 	if t.index == nil || t.head == nil || t.meta == nil {
-		return nil, nil, errClosed
+		return nil, nil, nil, errClosed
 	}
 	var (
 		items  = t.items.Load()      // the total items(head + 1)
@@ -747,7 +782,7 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 	// Ensure the start is written, not deleted from the tail, and that the
 	// caller actually wants something
 	if items <= start || hidden > start || count == 0 {
-		return nil, nil, errOutOfBounds
+		return nil, nil, nil, errOutOfBounds
 	}
 	if start+count > items {
 		count = items - start
@@ -776,10 +811,11 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 	// Read all the indexes in one go
 	indices, err := t.getIndices(start, count)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	var (
 		sizes      []int               // The sizes for each element
+		codecs     []freezerCodec      // The compression codecs of each element
 		totalSize  = 0                 // The total size of all data read so far
 		readStart  = indices[0].offset // Where, in the file, to start reading
 		unreadSize = 0                 // The size of the as-yet-unread data
@@ -795,7 +831,7 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 			// If we have unread data in the first file, we need to do that read now.
 			if unreadSize > 0 {
 				if err := readData(firstIndex.filenum, readStart, unreadSize); err != nil {
-					return nil, nil, err
+					return nil, nil, nil, err
 				}
 				unreadSize = 0
 			}
@@ -806,7 +842,7 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 			// read this last item, but we need to do the deferred reads now.
 			if unreadSize > 0 {
 				if err := readData(secondIndex.filenum, readStart, unreadSize); err != nil {
-					return nil, nil, err
+					return nil, nil, nil, err
 				}
 			}
 			break
@@ -815,10 +851,11 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 		unreadSize += size
 		totalSize += size
 		sizes = append(sizes, size)
+		codecs = append(codecs, t.fileCodec(secondIndex.filenum))
 		if i == len(indices)-2 || uint64(totalSize) > maxBytes {
 			// Last item, need to do the read now
 			if err := readData(secondIndex.filenum, readStart, unreadSize); err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 			break
 		}
@@ -826,7 +863,7 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 
 	// Update metrics.
 	t.readMeter.Mark(int64(totalSize))
-	return output[:outputSize], sizes, nil
+	return output[:outputSize], sizes, codecs, nil
 }
 
 // has returns an indicator whether the specified number data is still accessible
@@ -861,6 +898,11 @@ func (t *freezerTable) advanceHead() error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
+	return t.advanceHeadNolock()
+}
+
+// advanceHeadNolock opens a new head file without obtaining the mutex first.
+func (t *freezerTable) advanceHeadNolock() error {
 	// We open the next file in truncated mode -- if this file already
 	// exists, we need to start over from scratch on it.
 	nextID := t.headId + 1
@@ -904,6 +946,226 @@ func (t *freezerTable) Sync() error {
 	return err
 }
 
+// metadata assembles the current metadata of the table.
+func (t *freezerTable) metadata() *freezerTableMeta {
+	meta := newMetadata(t.itemHidden.Load())
+	if len(t.codecs) > 0 {
+		meta.Version = freezerCodecVersion
+		meta.Codecs = t.codecs
+	}
+	return meta
+}
+
+// fileCodec returns the codec the items of the given data file are compressed
+// with.
+func (t *freezerTable) fileCodec(num uint32) freezerCodec {
+	return spanCodec(t.codec == codecNone, t.codecs, num)
+}
+
+// spanCodec returns the codec of the given data file of a table, based on the
+// codec spans recorded in its metadata. It backs fileCodec, and is used directly
+// by the tables of the remote freezer.
+func spanCodec(raw bool, spans []freezerCodecSpan, num uint32) freezerCodec {
+	if raw {
+		return codecNone
+	}
+	codec := codecSnappy // Tables without codec spans are snappy compressed
+	for _, span := range spans {
+		if span.First > num {
+			break
+		}
+		codec = freezerCodec(span.Codec)
+	}
+	return codec
+}
+
+// switchCodec ensures the items appended to the head file are compressed with
+// the configured codec. If the head file already contains items of another
+// codec, a new head file is started. The caller must hold the write lock.
+func (t *freezerTable) switchCodec() error {
+	if t.codec == codecNone || t.fileCodec(t.headId) == t.codec {
+		return nil
+	}
+	if t.headBytes > 0 {
+		if err := t.advanceHeadNolock(); err != nil {
+			return err
+		}
+	}
+	var codecs []freezerCodecSpan
+	for _, span := range t.codecs {
+		if span.First < t.headId {
+			codecs = append(codecs, span)
+		}
+	}
+	t.codecs = append(codecs, freezerCodecSpan{First: t.headId, Codec: uint8(t.codec)})
+	t.logger.Info("Switched freezer table compression", "codec", t.codec, "file", t.headId)
+
+	if err := writeMetadata(t.meta, t.metadata()); err != nil {
+		return err
+	}
+	return t.meta.Sync()
+}
+
+// recompress converts all the data files of the table to the given codec, using
+// the given zstd dictionary if any. The data files are rewritten one by one and
+// the index is replaced afterwards, so the table must not be in use, and an
+// aborted conversion may leave the table corrupted.
+func (t *freezerTable) recompress(codec freezerCodec, dict []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.readonly {
+		return errReadOnly
+	}
+	if t.codec == codecNone || codec == codecNone {
+		return errors.New("raw freezer tables can't be recompressed")
+	}
+	if len(dict) > 0 && codec != codecZstd {
+		return fmt.Errorf("dictionaries are not supported by %v", codec)
+	}
+	compressor := newFreezerCompressor(dict)
+	if codec == codecZstd {
+		if err := compressor.initZstd(); err != nil {
+			compressor.close()
+			return err
+		}
+	}
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		compressor.close()
+		return err
+	}
+	// Load the entire index, the first entry of which points to the tail
+	blob, err := os.ReadFile(t.index.Name())
+	if err != nil {
+		compressor.close()
+		return err
+	}
+	entries := make([]indexEntry, len(blob)/indexEntrySize)
+	for i := range entries {
+		entries[i].unmarshalBinary(blob[i*indexEntrySize:])
+	}
+	// Re-encode the data files one by one, skipping the ones not affected. The
+	// items of a file are covered by a contiguous run of index entries.
+	var (
+		dictChanged = !bytes.Equal(dict, t.compressor.dict)
+		start       = 1
+		converted   int
+	)
+	for num := t.tailId; num <= t.headId; num++ {
+		end := start
+		for end < len(entries) && entries[end].filenum == num {
+			end++
+		}
+		old := t.fileCodec(num)
+		if old == codec && (codec != codecZstd || !dictChanged) {
+			start = end
+			continue
+		}
+		if err := t.recompressFile(num, entries[start:end], old, compressor, codec); err != nil {
+			compressor.close()
+			return err
+		}
+		t.logger.Info("Recompressed freezer data file", "file", num, "items", end-start, "from", old, "to", codec)
+		converted++
+		start = end
+	}
+	// Replace the index with the new offsets and persist the new dictionary
+	blob = blob[:0]
+	for _, entry := range entries {
+		blob = entry.append(blob)
+	}
+	if err := writeFileAtomic(t.index.Name(), blob); err != nil {
+		compressor.close()
+		return err
+	}
+	if len(dict) > 0 {
+		err = writeFileAtomic(dictionaryPath(t.path, t.name), dict)
+	} else {
+		err = os.Remove(dictionaryPath(t.path, t.name))
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	}
+	if err != nil {
+		compressor.close()
+		return err
+	}
+	// Swap in the new codec and reopen all the files
+	t.compressor.close()
+	t.compressor, t.codec = compressor, codec
+	t.codecs = nil
+	if codec != codecSnappy {
+		t.codecs = []freezerCodecSpan{{First: t.tailId, Codec: uint8(codec)}}
+	}
+	if err := writeMetadata(t.meta, t.metadata()); err != nil {
+		return err
+	}
+	if err := t.meta.Sync(); err != nil {
+		return err
+	}
+	t.index.Close()
+	if t.index, err = openFreezerFileForAppend(t.index.Name()); err != nil {
+		return err
+	}
+	for num, f := range t.files {
+		f.Close()
+		delete(t.files, num)
+	}
+	if err := t.preopen(); err != nil {
+		return err
+	}
+	stat, err := t.head.Stat()
+	if err != nil {
+		return err
+	}
+	t.headBytes = stat.Size()
+
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Inc(int64(newSize) - int64(oldSize))
+	t.logger.Info("Recompressed freezer table", "files", converted, "codec", codec, "dict", len(dict))
+	return nil
+}
+
+// recompressFile re-encodes the items of a single data file with a new codec,
+// updating the given index entries of the items to the new offsets.
+func (t *freezerTable) recompressFile(num uint32, entries []indexEntry, old freezerCodec, compressor *freezerCompressor, codec freezerCodec) error {
+	f, exist := t.files[num]
+	if !exist {
+		return fmt.Errorf("missing data file %d", num)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	var (
+		output []byte
+		offset uint32
+	)
+	for i := range entries {
+		if entries[i].offset < offset || int(entries[i].offset) > len(data) {
+			return fmt.Errorf("invalid index entry in file %d: offset %d", num, entries[i].offset)
+		}
+		item, err := t.compressor.decompress(old, data[offset:entries[i].offset])
+		if err != nil {
+			return err
+		}
+		offset = entries[i].offset
+
+		if output, err = compressor.compress(codec, output, item); err != nil {
+			return err
+		}
+		if len(output) > math.MaxUint32 {
+			return fmt.Errorf("data file %d overflows after recompression", num)
+		}
+		entries[i].offset = uint32(len(output))
+	}
+	return writeFileAtomic(f.Name(), output)
+}
+
 func (t *freezerTable) dumpIndexStdout(start, stop int64) {
 	t.dumpIndex(os.Stdout, start, stop)
 }
@@ -923,6 +1185,9 @@ func (t *freezerTable) dumpIndex(w io.Writer, start, stop int64) {
 	}
 	fmt.Fprintf(w, "Version %d count %d, deleted %d, hidden %d\n", meta.Version,
 		t.items.Load(), t.itemOffset.Load(), t.itemHidden.Load())
+	for _, span := range meta.Codecs {
+		fmt.Fprintf(w, "Codec %v from file %d\n", freezerCodec(span.Codec), span.First)
+	}
 
 	buf := make([]byte, indexEntrySize)
 
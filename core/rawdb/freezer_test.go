@@ -32,7 +32,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-var freezerTestTableDef = map[string]bool{"test": true}
+var freezerTestTableDef = map[string]freezerTableConfig{"test": {codec: codecNone, prunable: true}}
 
 func TestFreezerModify(t *testing.T) {
 	t.Parallel()
@@ -48,7 +48,7 @@ func TestFreezerModify(t *testing.T) {
 		valuesRLP = append(valuesRLP, iv)
 	}
 
-	tables := map[string]bool{"raw": true, "rlp": false}
+	tables := map[string]freezerTableConfig{"raw": {codec: codecNone}, "rlp": {codec: codecSnappy}}
 	f, _ := newFreezerForTesting(t, tables)
 	defer f.Close()
 
@@ -112,7 +112,7 @@ func TestFreezerModifyRollback(t *testing.T) {
 	f.Close()
 
 	// Reopen and check that the rolled-back data doesn't reappear.
-	tables := map[string]bool{"test": true}
+	tables := map[string]freezerTableConfig{"test": {codec: codecNone, prunable: true}}
 	f2, err := NewFreezer(dir, "", false, 2049, tables)
 	if err != nil {
 		t.Fatalf("can't reopen freezer after failed ModifyAncients: %v", err)
@@ -250,7 +250,7 @@ func TestFreezerConcurrentModifyTruncate(t *testing.T) {
 }
 
 func TestFreezerReadonlyValidate(t *testing.T) {
-	tables := map[string]bool{"a": true, "b": true}
+	tables := map[string]freezerTableConfig{"a": {codec: codecNone}, "b": {codec: codecNone}}
 	dir := t.TempDir()
 	// Open non-readonly freezer and fill individual tables
 	// with different amount of data.
@@ -283,7 +283,58 @@ func TestFreezerReadonlyValidate(t *testing.T) {
 	}
 }
 
-func newFreezerForTesting(t *testing.T, tables map[string]bool) (*Freezer, string) {
+// Tests that tail truncation only affects the prunable tables, and that such a
+// freezer can be reopened both in normal and readonly mode.
+func TestFreezerPrunableTables(t *testing.T) {
+	tables := map[string]freezerTableConfig{"a": {codec: codecNone, prunable: true}, "b": {codec: codecNone}}
+	f, dir := newFreezerForTesting(t, tables)
+
+	// Fill the tables with items spanning multiple data files
+	_, err := f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for i := uint64(0); i < 10; i++ {
+			item := make([]byte, 1024)
+			item[0] = byte(i)
+			if err := op.AppendRaw("a", i, item); err != nil {
+				return err
+			}
+			if err := op.AppendRaw("b", i, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, f.TruncateTail(5))
+
+	check := func(f *Freezer) {
+		t.Helper()
+		if tail, _ := f.Tail(); tail != 5 {
+			t.Fatalf("tail mismatch: have %d, want 5", tail)
+		}
+		for i := uint64(0); i < 10; i++ {
+			if has, _ := f.HasAncient("a", i); has != (i >= 5) {
+				t.Fatalf("prunable item %d presence mismatch: have %v", i, has)
+			}
+			if has, _ := f.HasAncient("b", i); !has {
+				t.Fatalf("non-prunable item %d missing", i)
+			}
+		}
+	}
+	check(f)
+	require.NoError(t, f.Close())
+
+	f, err = NewFreezer(dir, "", false, 2049, tables)
+	require.NoError(t, err)
+	check(f)
+	require.NoError(t, f.Close())
+
+	f, err = NewFreezer(dir, "", true, 2049, tables)
+	require.NoError(t, err)
+	check(f)
+	require.NoError(t, f.Close())
+}
+
+func newFreezerForTesting(t *testing.T, tables map[string]freezerTableConfig) (*Freezer, string) {
 	t.Helper()
 
 	dir := t.TempDir()
@@ -410,7 +461,7 @@ func TestRenameWindows(t *testing.T) {
 
 func TestFreezerCloseSync(t *testing.T) {
 	t.Parallel()
-	f, _ := newFreezerForTesting(t, map[string]bool{"a": true, "b": true})
+	f, _ := newFreezerForTesting(t, map[string]freezerTableConfig{"a": {codec: codecNone}, "b": {codec: codecNone}})
 	defer f.Close()
 
 	// Now, close and sync. This mimics the behaviour if the node is shut down,
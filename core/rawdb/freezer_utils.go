@@ -80,6 +80,31 @@ func copyFrom(srcPath, destPath string, offset uint64, before func(f *os.File) e
 	return nil
 }
 
+// writeFileAtomic replaces the content of the file at 'path' with the given
+// data, by writing it into a temporary file and moving it in place.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "*")
+	if err != nil {
+		return err
+	}
+	fname := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(fname)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(fname)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(fname)
+		return err
+	}
+	return os.Rename(fname, path)
+}
+
 // openFreezerFileForAppend opens a freezer table file and seeks to the end
 func openFreezerFileForAppend(filename string) (*os.File, error) {
 	// Open the file without the O_APPEND flag
@@ -84,6 +84,21 @@ var (
 	// transitionStatusKey tracks the eth2 transition status.
 	transitionStatusKey = []byte("eth2-transition")
 
+	// persistentStateIDKey tracks the id of latest stored state(for path-based only).
+	persistentStateIDKey = []byte("LastStateID")
+
+	// trieJournalKey tracks the in-memory trie node layers across restarts (for path-based only).
+	trieJournalKey = []byte("TrieJournal")
+
+	// stateDiffTailKey tracks the first block covered by the flat state diff history.
+	stateDiffTailKey = []byte("StateDiffTail")
+
+	// stateDiffGapKey tracks the first canonical block whose flat state diff is missing.
+	stateDiffGapKey = []byte("StateDiffGap")
+
+	// pruningCheckpointKey tracks the offline state pruning progress across restarts.
+	pruningCheckpointKey = []byte("PruningCheckpoint")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
@@ -103,6 +118,12 @@ var (
 	// Path-based trie node scheme.
 	trieNodeAccountPrefix = []byte("A") // trieNodeAccountPrefix + hexPath -> trie node
 	trieNodeStoragePrefix = []byte("O") // trieNodeStoragePrefix + accountHash + hexPath -> trie node
+	stateIDPrefix         = []byte("L") // stateIDPrefix + state root -> state id
+
+	stateDiffPrefix         = []byte("sd") // stateDiffPrefix + state root + parent root -> flat state diff
+	stateDiffAccountPrefix  = []byte("sa") // stateDiffAccountPrefix + account hash + ^num (uint64 big endian) -> slim account
+	stateDiffStoragePrefix  = []byte("ss") // stateDiffStoragePrefix + account hash + storage hash + ^num (uint64 big endian) -> storage value
+	stateDiffDestructPrefix = []byte("sx") // stateDiffDestructPrefix + account hash + ^num (uint64 big endian) -> destruct marker
 
 	PreimagePrefix = []byte("secure-key-")       // PreimagePrefix + hash -> preimage
 	configPrefix   = []byte("ethereum-config-")  // config prefix for the db
@@ -248,3 +269,64 @@ func accountTrieNodeKey(path []byte) []byte {
 func storageTrieNodeKey(accountHash common.Hash, path []byte) []byte {
 	return append(append(trieNodeStoragePrefix, accountHash.Bytes()...), path...)
 }
+
+// stateIDKey = stateIDPrefix + root (32 bytes)
+func stateIDKey(root common.Hash) []byte {
+	return append(stateIDPrefix, root.Bytes()...)
+}
+
+// stateDiffKey = stateDiffPrefix + root (32 bytes) + parent (32 bytes)
+func stateDiffKey(root common.Hash, parent common.Hash) []byte {
+	return append(append(stateDiffPrefix, root.Bytes()...), parent.Bytes()...)
+}
+
+// encodeHistoricNumber encodes a block number in inverted big endian order, so
+// that the entries of later blocks are iterated first.
+func encodeHistoricNumber(number uint64) []byte {
+	return encodeBlockNumber(^number)
+}
+
+// stateDiffAccountKey = stateDiffAccountPrefix + account hash + ^num (uint64 big endian)
+func stateDiffAccountKey(accountHash common.Hash, number uint64) []byte {
+	return append(append(stateDiffAccountPrefix, accountHash.Bytes()...), encodeHistoricNumber(number)...)
+}
+
+// stateDiffStorageKey = stateDiffStoragePrefix + account hash + storage hash + ^num (uint64 big endian)
+func stateDiffStorageKey(accountHash, storageHash common.Hash, number uint64) []byte {
+	key := append(append(stateDiffStoragePrefix, accountHash.Bytes()...), storageHash.Bytes()...)
+	return append(key, encodeHistoricNumber(number)...)
+}
+
+// stateDiffDestructKey = stateDiffDestructPrefix + account hash + ^num (uint64 big endian)
+func stateDiffDestructKey(accountHash common.Hash, number uint64) []byte {
+	return append(append(stateDiffDestructPrefix, accountHash.Bytes()...), encodeHistoricNumber(number)...)
+}
+
+// isHexPath reports whether the given path is composed of hex nibbles, with
+// an optional terminator flag.
+func isHexPath(path []byte) bool {
+	if len(path) > 2*common.HashLength+1 {
+		return false
+	}
+	for _, nibble := range path {
+		if nibble > 16 {
+			return false
+		}
+	}
+	return true
+}
+
+// IsAccountTrieNode reports whether a provided database entry is an account
+// trie node in path-based state scheme.
+func IsAccountTrieNode(key []byte) bool {
+	return bytes.HasPrefix(key, trieNodeAccountPrefix) && isHexPath(key[len(trieNodeAccountPrefix):])
+}
+
+// IsStorageTrieNode reports whether a provided database entry is a storage
+// trie node in path-based state scheme.
+func IsStorageTrieNode(key []byte) bool {
+	if !bytes.HasPrefix(key, trieNodeStoragePrefix) || len(key) < len(trieNodeStoragePrefix)+common.HashLength {
+		return false
+	}
+	return isHexPath(key[len(trieNodeStoragePrefix)+common.HashLength:])
+}
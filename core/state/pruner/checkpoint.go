@@ -0,0 +1,102 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/rlp"
+)
+
+// pruneCheckpoint is the persisted progress of an offline pruning, allowing an
+// interrupted run to continue where it was left off instead of starting over.
+type pruneCheckpoint struct {
+	Root     common.Hash // State root the pruning is running against
+	Sweeping bool        // Whether the bloom is complete and the deletion is running
+	Marker   []byte      // Last account marked in the bloom, or last database key swept
+	Accounts uint64      // Number of accounts marked in the bloom so far
+	Slots    uint64      // Number of storage slots marked in the bloom so far
+	Nodes    uint64      // Number of stale entries deleted so far
+	Size     uint64      // Total size of the stale entries deleted so far
+}
+
+// readCheckpoint retrieves the pruning checkpoint from the database, or nil if
+// there is none (or it's corrupted).
+func readCheckpoint(db ethdb.KeyValueReader) *pruneCheckpoint {
+	blob := rawdb.ReadPruningCheckpoint(db)
+	if len(blob) == 0 {
+		return nil
+	}
+	var checkpoint pruneCheckpoint
+	if err := rlp.DecodeBytes(blob, &checkpoint); err != nil {
+		log.Warn("Failed to decode pruning checkpoint", "err", err)
+		return nil
+	}
+	return &checkpoint
+}
+
+// writeCheckpoint stores the pruning checkpoint into the database.
+func writeCheckpoint(db ethdb.KeyValueWriter, checkpoint *pruneCheckpoint) {
+	blob, err := rlp.EncodeToBytes(checkpoint)
+	if err != nil {
+		panic(err) // Cannot happen, here to catch dev errors
+	}
+	rawdb.WritePruningCheckpoint(db, blob)
+}
+
+// keyPosition maps a key onto the 64 bit position of the key space it falls at.
+func keyPosition(key []byte) uint64 {
+	var pos [8]byte
+	copy(pos[:], key)
+	return binary.BigEndian.Uint64(pos[:])
+}
+
+// estimateETA approximates the remaining time of a key space traversal based
+// on the progress made since it was started (or resumed) at origin.
+func estimateETA(origin, current []byte, elapsed time.Duration) time.Duration {
+	from, at := keyPosition(origin), keyPosition(current)
+	if at <= from {
+		return 0
+	}
+	speed := (at-from)/uint64(elapsed/time.Millisecond+1) + 1 // +1 to avoid division by zero
+	return time.Duration((math.MaxUint64-at)/speed) * time.Millisecond
+}
+
+// estimateRate formats the throughput of the given amount of work done.
+func estimateRate(done uint64, elapsed time.Duration) string {
+	return fmt.Sprintf("%d/s", uint64(float64(done)/(elapsed.Seconds()+1e-9)))
+}
+
+// nextKey returns the key immediately following the given one in the key
+// space of equal length keys, or nil if the key is the last one.
+func nextKey(key []byte) []byte {
+	next := common.CopyBytes(key)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next
+		}
+	}
+	return nil
+}
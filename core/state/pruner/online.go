@@ -0,0 +1,512 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/state/snapshot"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/trie"
+)
+
+// Phases of the online pruning reported in its status.
+const (
+	PhaseIdle       = "idle"
+	PhaseMarking    = "marking"
+	PhaseSweeping   = "sweeping"
+	PhaseCompacting = "compacting"
+	PhaseDone       = "done"
+	PhaseFailed     = "failed"
+)
+
+var (
+	// errPruningRunning is returned if an online pruning is requested while
+	// another one is still in progress.
+	errPruningRunning = errors.New("state pruning already running")
+
+	// errPrunerClosed is returned if an online pruning is requested or running
+	// while the pruner is shutting down.
+	errPrunerClosed = errors.New("state pruner closed")
+)
+
+// OnlineConfig includes all the configurations for online pruning.
+type OnlineConfig struct {
+	BloomSize uint64        // The Megabytes of memory allocated to bloom-filter
+	Throttle  time.Duration // Pause between two consecutive deletion batches
+}
+
+// DefaultOnlineConfig contains the default settings for online pruning.
+var DefaultOnlineConfig = OnlineConfig{
+	BloomSize: 2048,
+	Throttle:  10 * time.Millisecond,
+}
+
+// OnlineStatus is the progress report of the online pruning.
+type OnlineStatus struct {
+	Running  bool               `json:"running"`      // Whether a pruning is in progress
+	Phase    string             `json:"phase"`        // Current (or final) phase of the pruning
+	Root     common.Hash        `json:"root"`         // State root the pruning is running against
+	Started  uint64             `json:"started"`      // Unix timestamp of the pruning start
+	Pinned   int                `json:"pinnedLayers"` // Number of diff layer states pinned during marking
+	Nodes    uint64             `json:"deletedNodes"` // Number of trie nodes deleted so far
+	Size     common.StorageSize `json:"deletedSize"`  // Total size of the trie nodes deleted so far
+	Progress float64            `json:"progress"`     // Progress of the sweep phase in [0, 1]
+	Error    string             `json:"error,omitempty"`
+}
+
+// OnlinePruner prunes the stale state in the background while the node keeps
+// importing blocks. The workflow is similar to the offline pruner's:
+//
+//   - mark the trie nodes of the snapshot disk layer's state, regenerated from
+//     the flat snapshot data, along with the nodes of all the states pinned by
+//     the in-memory diff layers and the genesis
+//   - sweep the database, deleting all the trie nodes not marked
+//
+// To coexist with block import, the snapshot diff layers are retained in memory
+// (not flattened) for the entire run and every trie node flushed to disk in the
+// meantime is marked as live before it's written.
+//
+// Contract codes are written directly to the database by block import, without
+// going through the trie database, so they are left alone.
+type OnlinePruner struct {
+	config   OnlineConfig
+	db       ethdb.Database
+	triedb   *trie.Database
+	snaptree *snapshot.Tree
+
+	status  OnlineStatus
+	running bool
+	closed  bool
+	quit    chan struct{}
+	wg      sync.WaitGroup
+	lock    sync.Mutex // Protects the status and lifecycle fields
+
+	sweepLock sync.Mutex // Serializes node deletions with trie node flushes
+}
+
+// NewOnlinePruner creates an online pruner over the given databases. The
+// snapshot tree may be nil if snapshots are disabled, in which case pruning
+// requests are rejected.
+func NewOnlinePruner(db ethdb.Database, triedb *trie.Database, snaptree *snapshot.Tree, config OnlineConfig) *OnlinePruner {
+	if config.BloomSize < 256 {
+		log.Warn("Sanitizing bloomfilter size", "provided(MB)", config.BloomSize, "updated(MB)", 256)
+		config.BloomSize = 256
+	}
+	return &OnlinePruner{
+		config:   config,
+		db:       db,
+		triedb:   triedb,
+		snaptree: snaptree,
+		status:   OnlineStatus{Phase: PhaseIdle},
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start launches a background pruning against the current snapshot disk layer.
+func (p *OnlinePruner) Start() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return errPrunerClosed
+	}
+	if p.running {
+		return errPruningRunning
+	}
+	// Stale trie nodes are overwritten in place in the path-based scheme, there
+	// is nothing to prune.
+	if p.triedb.Scheme() == rawdb.PathScheme {
+		return errors.New("state pruning is not supported in the path-based state scheme")
+	}
+	if p.snaptree == nil {
+		return errors.New("state pruning requires snapshots")
+	}
+	p.running = true
+	p.status = OnlineStatus{
+		Running: true,
+		Phase:   PhaseMarking,
+		Started: uint64(time.Now().Unix()),
+	}
+	p.wg.Add(1)
+	go p.run()
+	return nil
+}
+
+// Stop interrupts any running pruning and waits for it to terminate. The pruner
+// can't be restarted afterwards.
+func (p *OnlinePruner) Stop() {
+	p.lock.Lock()
+	if !p.closed {
+		close(p.quit)
+		p.closed = true
+	}
+	p.lock.Unlock()
+
+	p.wg.Wait()
+}
+
+// Status returns the progress of the running, or the outcome of the last,
+// online pruning.
+func (p *OnlinePruner) Status() OnlineStatus {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.status
+}
+
+// update modifies the pruning status under the lock.
+func (p *OnlinePruner) update(fn func(status *OnlineStatus)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fn(&p.status)
+}
+
+// run executes a single pruning and records its outcome.
+func (p *OnlinePruner) run() {
+	defer p.wg.Done()
+
+	start := time.Now()
+	err := p.prune()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.running = false
+	p.status.Running = false
+	if err != nil {
+		log.Error("Online state pruning failed", "err", err)
+		p.status.Phase, p.status.Error = PhaseFailed, err.Error()
+		return
+	}
+	p.status.Phase = PhaseDone
+	log.Info("Online state pruning successful", "pruned", p.status.Size, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// prune marks the live state and sweeps everything else.
+func (p *OnlinePruner) prune() error {
+	bloom, err := newStateBloomWithSize(p.config.BloomSize)
+	if err != nil {
+		return err
+	}
+	// Mark every trie node flushed from now on as live. The lock ensures that
+	// the sweeper either sees the mark, or deletes the node before it's written.
+	if err := p.triedb.SetWriteHook(func(hash common.Hash) {
+		p.sweepLock.Lock()
+		defer p.sweepLock.Unlock()
+
+		bloom.Put(hash.Bytes(), nil)
+	}); err != nil {
+		return err
+	}
+	defer p.triedb.SetWriteHook(nil)
+
+	if err := p.mark(bloom); err != nil {
+		return err
+	}
+	p.update(func(status *OnlineStatus) { status.Phase = PhaseSweeping })
+
+	count, err := p.sweep(bloom)
+	if err != nil {
+		return err
+	}
+	// Start compactions, will remove the deleted data from the disk immediately.
+	// Note for small pruning, the compaction is skipped.
+	if count >= rangeCompactionThreshold {
+		p.update(func(status *OnlineStatus) { status.Phase = PhaseCompacting })
+		if err := compactDatabase(p.db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mark marks the live state: the state of the snapshot disk layer and the ones
+// pinned by the diff layers on top.
+func (p *OnlinePruner) mark(bloom *stateBloom) error {
+	// Keep the disk layer from going stale while its state is being iterated.
+	// The diff layers on top are still flattened into the accumulator, so the
+	// memory held doesn't grow with every block imported meanwhile.
+	p.snaptree.PinDiskLayer()
+	defer p.snaptree.UnpinDiskLayer()
+
+	root := p.snaptree.DiskRoot()
+	if root == (common.Hash{}) {
+		return errors.New("snapshot not available")
+	}
+	p.update(func(status *OnlineStatus) { status.Root = root })
+	log.Info("Starting online state pruning", "root", root)
+
+	// Mark the states pinned by the diff layers first, before their tries are
+	// garbage collected by the chain progressing. All the layers are retained
+	// while marking, which is brief, so none is flattened away unmarked.
+	p.snaptree.Pin()
+	pinned, err := p.markLayers(bloom)
+	p.snaptree.Unpin()
+	if err != nil {
+		return err
+	}
+	p.update(func(status *OnlineStatus) { status.Pinned = pinned })
+
+	if err := extractGenesis(p.db, bloom); err != nil {
+		return err
+	}
+	if err := snapshot.GenerateTrieWithInterrupt(p.snaptree, root, p.db, bloom, p.quit); err != nil {
+		if errors.Is(err, snapshot.ErrGenerationInterrupted) {
+			return errPrunerClosed
+		}
+		return err
+	}
+	return nil
+}
+
+// layerChanges is the set of accounts and storage slots modified by one or
+// more consecutive diff layers.
+type layerChanges struct {
+	accounts map[common.Hash]struct{}
+	storage  map[common.Hash]map[common.Hash]struct{}
+}
+
+// newLayerChanges creates the change set out of the given parent set, which
+// may be nil, and the modifications of a single diff layer.
+func newLayerChanges(parent *layerChanges, accounts []common.Hash, storage map[common.Hash][]common.Hash) *layerChanges {
+	changes := &layerChanges{
+		accounts: make(map[common.Hash]struct{}),
+		storage:  make(map[common.Hash]map[common.Hash]struct{}),
+	}
+	add := func(account common.Hash, slot common.Hash) {
+		if _, ok := changes.storage[account]; !ok {
+			changes.storage[account] = make(map[common.Hash]struct{})
+		}
+		changes.storage[account][slot] = struct{}{}
+	}
+	if parent != nil {
+		for account := range parent.accounts {
+			changes.accounts[account] = struct{}{}
+		}
+		for account, slots := range parent.storage {
+			for slot := range slots {
+				add(account, slot)
+			}
+		}
+	}
+	for _, account := range accounts {
+		changes.accounts[account] = struct{}{}
+	}
+	for account, slots := range storage {
+		for _, slot := range slots {
+			add(account, slot)
+		}
+	}
+	return changes
+}
+
+// markLayers marks the trie nodes of the states pinned by the in-memory diff
+// layers, which aren't shared with the disk layer's state. Such nodes are all
+// on the paths of the keys modified on top of the disk layer, so it's enough to
+// mark the proofs of the modified keys in the state of each layer.
+//
+// States already garbage collected from the trie database can't be accessed
+// anymore, their modifications are carried over to the first available
+// descendant layers instead. The number of pinned states is returned.
+func (p *OnlinePruner) markLayers(bloom *stateBloom) (int, error) {
+	var (
+		pinned  int
+		pending = make(map[common.Hash]*layerChanges)
+	)
+	for _, root := range p.snaptree.Diffs() {
+		parent, accounts, storage, err := p.snaptree.Changes(root)
+		if err != nil {
+			return 0, err
+		}
+		changes := newLayerChanges(pending[parent], accounts, storage)
+		if _, err := p.triedb.Node(root); err != nil {
+			pending[root] = changes
+			continue
+		}
+		if err := p.markChanges(bloom, root, changes); err != nil {
+			return 0, err
+		}
+		pinned++
+
+		select {
+		case <-p.quit:
+			return 0, errPrunerClosed
+		default:
+		}
+	}
+	return pinned, nil
+}
+
+// markChanges marks the proofs of all the changed keys in the state with the
+// given root.
+func (p *OnlinePruner) markChanges(bloom *stateBloom, root common.Hash, changes *layerChanges) error {
+	tr, err := trie.New(trie.StateTrieID(root), p.triedb)
+	if err != nil {
+		return err
+	}
+	for account := range changes.accounts {
+		if err := tr.Prove(account.Bytes(), 0, bloom); err != nil {
+			return err
+		}
+	}
+	snap := p.snaptree.Snapshot(root)
+	if snap == nil {
+		return errors.New("snapshot layer missing")
+	}
+	for account, slots := range changes.storage {
+		acc, err := snap.Account(account)
+		if err != nil {
+			return err
+		}
+		if acc == nil || len(acc.Root) == 0 || common.BytesToHash(acc.Root) == types.EmptyRootHash {
+			continue
+		}
+		st, err := trie.New(trie.StorageTrieID(root, account, common.BytesToHash(acc.Root)), p.triedb)
+		if err != nil {
+			return err
+		}
+		for slot := range slots {
+			if err := st.Prove(slot.Bytes(), 0, bloom); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sweep iterates the database and deletes all the trie nodes not marked in the
+// bloom filter, in throttled batches. The number of deleted nodes is returned.
+func (p *OnlinePruner) sweep(bloom *stateBloom) (int, error) {
+	var (
+		count  int
+		nodes  []sweepNode
+		size   int
+		pstart = time.Now()
+		logged = time.Now()
+		iter   = p.db.NewIterator(nil, nil)
+	)
+	defer func() { iter.Release() }()
+
+	flush := func(last []byte) error {
+		deleted, dsize, err := p.deleteNodes(bloom, nodes)
+		if err != nil {
+			return err
+		}
+		count += deleted
+		nodes, size = nodes[:0], 0
+
+		progress := float64(binary.BigEndian.Uint64(last[:8])) / math.MaxUint64
+		p.update(func(status *OnlineStatus) {
+			status.Nodes += uint64(deleted)
+			status.Size += dsize
+			status.Progress = progress
+		})
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data", "nodes", count, "progress", progress, "elapsed", common.PrettyDuration(time.Since(pstart)))
+			logged = time.Now()
+		}
+		// Recreate the iterator after every batch commit in order to allow
+		// the underlying compactor to delete the entries.
+		iter.Release()
+		iter = p.db.NewIterator(nil, last)
+
+		select {
+		case <-time.After(p.config.Throttle):
+			return nil
+		case <-p.quit:
+			return errPrunerClosed
+		}
+	}
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != common.HashLength || p.marked(bloom, key) {
+			continue
+		}
+		nodes = append(nodes, sweepNode{key: common.CopyBytes(key), size: len(key) + len(iter.Value())})
+		size += len(key)
+		if size >= ethdb.IdealBatchSize {
+			if err := flush(nodes[len(nodes)-1].key); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return count, err
+	}
+	if len(nodes) > 0 {
+		deleted, dsize, err := p.deleteNodes(bloom, nodes)
+		if err != nil {
+			return count, err
+		}
+		count += deleted
+		p.update(func(status *OnlineStatus) {
+			status.Nodes += uint64(deleted)
+			status.Size += dsize
+		})
+	}
+	p.update(func(status *OnlineStatus) { status.Progress = 1 })
+	log.Info("Pruned state data", "nodes", count, "elapsed", common.PrettyDuration(time.Since(pstart)))
+	return count, nil
+}
+
+// marked reports whether the given key is marked as live in the bloom filter.
+// The filter is written by trie node flushes concurrently, under the same lock.
+func (p *OnlinePruner) marked(bloom *stateBloom, key []byte) bool {
+	p.sweepLock.Lock()
+	defer p.sweepLock.Unlock()
+
+	return bloom.Contain(key)
+}
+
+// sweepNode is a trie node scheduled for deletion.
+type sweepNode struct {
+	key  []byte
+	size int // Size of the database entry
+}
+
+// deleteNodes deletes the given trie nodes unless they were marked in the
+// meantime by a node flush. The number and total size of deleted nodes are
+// returned.
+func (p *OnlinePruner) deleteNodes(bloom *stateBloom, nodes []sweepNode) (int, common.StorageSize, error) {
+	p.sweepLock.Lock()
+	defer p.sweepLock.Unlock()
+
+	var (
+		count int
+		size  common.StorageSize
+		batch = p.db.NewBatch()
+	)
+	for _, node := range nodes {
+		if bloom.Contain(node.key) {
+			continue
+		}
+		batch.Delete(node.key)
+		count++
+		size += common.StorageSize(node.size)
+	}
+	return count, size, batch.Write()
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/consensus/ethash"
+	"github.com/rethereum-blockchain/go-rethereum/core"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/core/vm"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/params"
+	"github.com/rethereum-blockchain/go-rethereum/trie"
+)
+
+// verifyState iterates over the entire state with the given root, directly from
+// the persistent database.
+func verifyState(db ethdb.Database, root common.Hash) error {
+	triedb := trie.NewDatabase(db)
+	tr, err := trie.NewStateTrie(trie.StateTrieID(root), triedb)
+	if err != nil {
+		return err
+	}
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+	}
+	return it.Error()
+}
+
+func TestOnlinePruning(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		config  = *params.TestChainConfig
+		signer  types.Signer
+	)
+	config.RethereumForks = &params.RethereumForks{}
+	signer = types.LatestSigner(&config)
+
+	gspec := &core.Genesis{
+		Config: &config,
+		Alloc:  core.GenesisAlloc{address: {Balance: big.NewInt(params.Ether)}},
+	}
+	_, blocks, _ := core.GenerateChainWithGenesis(gspec, ethash.NewFaker(), 200, func(i int, b *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), common.BigToAddress(big.NewInt(int64(i%16))), big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, key)
+		b.AddTx(tx)
+	})
+	// Run an archive node, so that every single state is persisted
+	db := rawdb.NewMemoryDatabase()
+	chain, err := core.NewBlockChain(db, &core.CacheConfig{
+		TrieCleanLimit:    16,
+		TrieDirtyDisabled: true,
+		SnapshotLimit:     16,
+		SnapshotWait:      true,
+	}, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks[:150]); err != nil {
+		t.Fatalf("Failed to import blocks: %v", err)
+	}
+	// Track the states retained by the snapshot at the start of the pruning
+	live := map[common.Hash]bool{chain.Snapshots().DiskRoot(): true}
+	for _, root := range chain.Snapshots().Diffs() {
+		live[root] = true
+	}
+	pruner := NewOnlinePruner(db, chain.TrieDB(), chain.Snapshots(), OnlineConfig{BloomSize: 256})
+	defer pruner.Stop()
+
+	if err := pruner.Start(); err != nil {
+		t.Fatalf("Failed to start pruning: %v", err)
+	}
+	if err := pruner.Start(); err != errPruningRunning {
+		t.Fatalf("Duplicate pruning error mismatch: have %v, want %v", err, errPruningRunning)
+	}
+	// Keep importing blocks while the pruning is in progress
+	if _, err := chain.InsertChain(blocks[150:]); err != nil {
+		t.Fatalf("Failed to import blocks: %v", err)
+	}
+	for pruner.Status().Running {
+		time.Sleep(10 * time.Millisecond)
+	}
+	status := pruner.Status()
+	if status.Phase != PhaseDone {
+		t.Fatalf("Pruning failed: %v", status.Error)
+	}
+	if status.Nodes == 0 || status.Pinned == 0 || !live[status.Root] {
+		t.Fatalf("Unexpected pruning status: %+v", status)
+	}
+	// All the states retained by the snapshot or imported during the pruning
+	// must be intact, anything else (except the genesis) should be gone.
+	for i, block := range blocks {
+		err := verifyState(db, block.Root())
+		if (live[block.Root()] || i >= 150) && err != nil {
+			t.Fatalf("State of block %d corrupted: %v", block.NumberU64(), err)
+		}
+		if !live[block.Root()] && i < 150 && err == nil {
+			t.Fatalf("State of block %d not pruned", block.NumberU64())
+		}
+	}
+	if err := verifyState(db, gspec.ToBlock().Root()); err != nil {
+		t.Fatalf("Genesis state corrupted: %v", err)
+	}
+}
@@ -18,10 +18,8 @@ package pruner
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
-	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -48,6 +46,14 @@ const (
 	// while it is being written out to detect write aborts.
 	stateBloomFileTempSuffix = ".tmp"
 
+	// stateBloomFilePartialSuffix is the filename suffix of the state bloom
+	// filter checkpointed midway through its construction.
+	stateBloomFilePartialSuffix = ".partial"
+
+	// defaultCheckpointInterval is the default time interval between two
+	// consecutive checkpoints of the state bloom construction.
+	defaultCheckpointInterval = 5 * time.Minute
+
 	// rangeCompactionThreshold is the minimal deleted entry number for
 	// triggering range compaction. It's a quite arbitrary number but just
 	// to avoid triggering range compaction because of small deletion.
@@ -56,9 +62,10 @@ const (
 
 // Config includes all the configurations for pruning.
 type Config struct {
-	Datadir   string // The directory of the state database
-	Cachedir  string // The directory of state clean cache
-	BloomSize uint64 // The Megabytes of memory allocated to bloom-filter
+	Datadir            string        // The directory of the state database
+	Cachedir           string        // The directory of state clean cache
+	BloomSize          uint64        // The Megabytes of memory allocated to bloom-filter
+	CheckpointInterval time.Duration // Time interval between two checkpoints of the bloom construction
 }
 
 // Pruner is an offline tool to prune the stale state with the
@@ -82,6 +89,11 @@ type Pruner struct {
 
 // NewPruner creates the pruner instance.
 func NewPruner(db ethdb.Database, config Config) (*Pruner, error) {
+	// Stale trie nodes are overwritten in place in the path-based scheme, there
+	// is nothing to prune offline.
+	if rawdb.ReadStateScheme(db) == rawdb.PathScheme {
+		return nil, errors.New("offline pruning is not supported in the path-based state scheme")
+	}
 	headBlock := rawdb.ReadHeadBlock(db)
 	if headBlock == nil {
 		return nil, errors.New("failed to load head block")
@@ -101,6 +113,9 @@ func NewPruner(db ethdb.Database, config Config) (*Pruner, error) {
 		log.Warn("Sanitizing bloomfilter size", "provided(MB)", config.BloomSize, "updated(MB)", 256)
 		config.BloomSize = 256
 	}
+	if config.CheckpointInterval <= 0 {
+		config.CheckpointInterval = defaultCheckpointInterval
+	}
 	stateBloom, err := newStateBloomWithSize(config.BloomSize)
 	if err != nil {
 		return nil, err
@@ -114,7 +129,29 @@ func NewPruner(db ethdb.Database, config Config) (*Pruner, error) {
 	}, nil
 }
 
-func prune(snaptree *snapshot.Tree, root common.Hash, maindb ethdb.Database, stateBloom *stateBloom, bloomPath string, middleStateRoots map[common.Hash]struct{}, start time.Time) error {
+// isStale reports whether the database entry is a trie node or contract code
+// not belonging to the states tracked by the bloom filter.
+func isStale(key []byte, stateBloom *stateBloom, middleStateRoots map[common.Hash]struct{}) bool {
+	// All state entries don't belong to specific state and genesis are deleted here
+	// - trie node
+	// - legacy contract code
+	// - new-scheme contract code
+	isCode, codeKey := rawdb.IsCodeKey(key)
+	if len(key) != common.HashLength && !isCode {
+		return false
+	}
+	checkKey := key
+	if isCode {
+		checkKey = codeKey
+	}
+	if _, exist := middleStateRoots[common.BytesToHash(checkKey)]; exist {
+		log.Debug("Forcibly delete the middle state roots", "hash", common.BytesToHash(checkKey))
+		return true
+	}
+	return !stateBloom.Contain(checkKey)
+}
+
+func prune(snaptree *snapshot.Tree, root common.Hash, maindb ethdb.Database, stateBloom *stateBloom, bloomPath string, middleStateRoots map[common.Hash]struct{}, start time.Time, checkpoint *pruneCheckpoint) error {
 	// Delete all stale trie nodes in the disk. With the help of state bloom
 	// the trie nodes(and codes) belong to the active state will be filtered
 	// out. A very small part of stale tries will also be filtered because of
@@ -122,60 +159,52 @@ func prune(snaptree *snapshot.Tree, root common.Hash, maindb ethdb.Database, sta
 	// that the false-positive is low enough(~0.05%). The probablity of the
 	// dangling node is the state root is super low. So the dangling nodes in
 	// theory will never ever be visited again.
+	//
+	// The swept position is checkpointed along with every batch written, so
+	// an interrupted pruning continues from the last deleted key.
 	var (
-		count  int
-		size   common.StorageSize
+		origin = checkpoint.Marker
+		count  = checkpoint.Nodes
+		size   = common.StorageSize(checkpoint.Size)
 		pstart = time.Now()
 		logged = time.Now()
 		batch  = maindb.NewBatch()
-		iter   = maindb.NewIterator(nil, nil)
+		iter   = maindb.NewIterator(nil, origin)
 	)
+	if len(origin) > 0 {
+		log.Info("Resuming state pruning", "marker", fmt.Sprintf("%#x", origin), "nodes", count, "size", size)
+	}
 	for iter.Next() {
 		key := iter.Key()
-
-		// All state entries don't belong to specific state and genesis are deleted here
-		// - trie node
-		// - legacy contract code
-		// - new-scheme contract code
-		isCode, codeKey := rawdb.IsCodeKey(key)
-		if len(key) == common.HashLength || isCode {
-			checkKey := key
-			if isCode {
-				checkKey = codeKey
-			}
-			if _, exist := middleStateRoots[common.BytesToHash(checkKey)]; exist {
-				log.Debug("Forcibly delete the middle state roots", "hash", common.BytesToHash(checkKey))
-			} else {
-				if stateBloom.Contain(checkKey) {
-					continue
-				}
-			}
-			count += 1
-			size += common.StorageSize(len(key) + len(iter.Value()))
-			batch.Delete(key)
-
-			var eta time.Duration // Realistically will never remain uninited
-			if done := binary.BigEndian.Uint64(key[:8]); done > 0 {
-				var (
-					left  = math.MaxUint64 - binary.BigEndian.Uint64(key[:8])
-					speed = done/uint64(time.Since(pstart)/time.Millisecond+1) + 1 // +1s to avoid division by zero
-				)
-				eta = time.Duration(left/speed) * time.Millisecond
-			}
-			if time.Since(logged) > 8*time.Second {
-				log.Info("Pruning state data", "nodes", count, "size", size,
-					"elapsed", common.PrettyDuration(time.Since(pstart)), "eta", common.PrettyDuration(eta))
-				logged = time.Now()
-			}
-			// Recreate the iterator after every batch commit in order
-			// to allow the underlying compactor to delete the entries.
-			if batch.ValueSize() >= ethdb.IdealBatchSize {
-				batch.Write()
-				batch.Reset()
-
-				iter.Release()
-				iter = maindb.NewIterator(nil, key)
-			}
+		if !isStale(key, stateBloom, middleStateRoots) {
+			continue
+		}
+		count += 1
+		size += common.StorageSize(len(key) + len(iter.Value()))
+		batch.Delete(key)
+
+		if time.Since(logged) > 8*time.Second {
+			elapsed := time.Since(pstart)
+			log.Info("Pruning state data", "nodes", count, "size", size,
+				"rate", fmt.Sprintf("%v/s", common.StorageSize(float64(size-common.StorageSize(checkpoint.Size))/elapsed.Seconds())),
+				"elapsed", common.PrettyDuration(elapsed), "eta", common.PrettyDuration(estimateETA(origin, key, elapsed)))
+			logged = time.Now()
+		}
+		// Recreate the iterator after every batch commit in order
+		// to allow the underlying compactor to delete the entries.
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			writeCheckpoint(batch, &pruneCheckpoint{
+				Root:     root,
+				Sweeping: true,
+				Marker:   common.CopyBytes(key),
+				Nodes:    count,
+				Size:     uint64(size),
+			})
+			batch.Write()
+			batch.Reset()
+
+			iter.Release()
+			iter = maindb.NewIterator(nil, key)
 		}
 	}
 	if batch.ValueSize() > 0 {
@@ -198,36 +227,46 @@ func prune(snaptree *snapshot.Tree, root common.Hash, maindb ethdb.Database, sta
 	if _, err := snaptree.Journal(root); err != nil {
 		return err
 	}
-	// Delete the state bloom, it marks the entire pruning procedure is
-	// finished. If any crashes or manual exit happens before this,
-	// `RecoverPruning` will pick it up in the next restarts to redo all
-	// the things.
+	// Delete the checkpoint and the state bloom, the latter marks the entire
+	// pruning procedure is finished. If any crashes or manual exit happens
+	// before this, `RecoverPruning` will pick it up in the next restarts to
+	// redo all the things.
+	rawdb.DeletePruningCheckpoint(maindb)
 	os.RemoveAll(bloomPath)
 
 	// Start compactions, will remove the deleted data from the disk immediately.
 	// Note for small pruning, the compaction is skipped.
 	if count >= rangeCompactionThreshold {
-		cstart := time.Now()
-		for b := 0x00; b <= 0xf0; b += 0x10 {
-			var (
-				start = []byte{byte(b)}
-				end   = []byte{byte(b + 0x10)}
-			)
-			if b == 0xf0 {
-				end = nil
-			}
-			log.Info("Compacting database", "range", fmt.Sprintf("%#x-%#x", start, end), "elapsed", common.PrettyDuration(time.Since(cstart)))
-			if err := maindb.Compact(start, end); err != nil {
-				log.Error("Database compaction failed", "error", err)
-				return err
-			}
+		if err := compactDatabase(maindb); err != nil {
+			return err
 		}
-		log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(cstart)))
 	}
 	log.Info("State pruning successful", "pruned", size, "elapsed", common.PrettyDuration(time.Since(start)))
 	return nil
 }
 
+// compactDatabase runs a range compaction over the entire key space, removing
+// the deleted data from the disk.
+func compactDatabase(db ethdb.Database) error {
+	cstart := time.Now()
+	for b := 0x00; b <= 0xf0; b += 0x10 {
+		var (
+			start = []byte{byte(b)}
+			end   = []byte{byte(b + 0x10)}
+		)
+		if b == 0xf0 {
+			end = nil
+		}
+		log.Info("Compacting database", "range", fmt.Sprintf("%#x-%#x", start, end), "elapsed", common.PrettyDuration(time.Since(cstart)))
+		if err := db.Compact(start, end); err != nil {
+			log.Error("Database compaction failed", "error", err)
+			return err
+		}
+	}
+	log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(cstart)))
+	return nil
+}
+
 // Prune deletes all historical state nodes except the nodes belong to the
 // specified state version. If user doesn't specify the state version, use
 // the bottom-most snapshot diff layer as the target.
@@ -243,6 +282,38 @@ func (p *Pruner) Prune(root common.Hash) error {
 	if stateBloomRoot != (common.Hash{}) {
 		return RecoverPruning(p.config.Datadir, p.db, p.config.Cachedir)
 	}
+	root, middleRoots, err := p.selectTarget(root)
+	if err != nil {
+		return err
+	}
+	// Before start the pruning, delete the clean trie cache first.
+	// It's necessary otherwise in the next restart we will hit the
+	// deleted state root in the "clean cache" so that the incomplete
+	// state is picked for usage.
+	deleteCleanTrieCache(p.config.Cachedir)
+
+	// Traverse the target state, re-construct the whole state trie and
+	// commit to the given bloom filter, checkpointing the progress along
+	// the way.
+	var (
+		start      = time.Now()
+		filterName = bloomFilterName(p.config.Datadir, root)
+	)
+	if err := p.markState(root, filterName+stateBloomFilePartialSuffix); err != nil {
+		return err
+	}
+	log.Info("Writing state bloom to disk", "name", filterName)
+	if err := p.stateBloom.Commit(filterName, filterName+stateBloomFileTempSuffix); err != nil {
+		return err
+	}
+	os.Remove(filterName + stateBloomFilePartialSuffix)
+	log.Info("State bloom filter committed", "name", filterName)
+	return prune(p.snaptree, root, p.db, p.stateBloom, filterName, middleRoots, start, &pruneCheckpoint{Root: root, Sweeping: true})
+}
+
+// selectTarget resolves the state version to prune against, along with the
+// roots of the snapshot layers above it that need to be forcibly deleted.
+func (p *Pruner) selectTarget(root common.Hash) (common.Hash, map[common.Hash]struct{}, error) {
 	// If the target state root is not specified, use the HEAD-127 as the
 	// target. The reason for picking it is:
 	// - in most of the normal cases, the related state is available
@@ -257,7 +328,7 @@ func (p *Pruner) Prune(root common.Hash) error {
 			// Reject if the accumulated diff layers are less than 128. It
 			// means in most of normal cases, there is no associated state
 			// with bottom-most diff layer.
-			return fmt.Errorf("snapshot not old enough yet: need %d more blocks", 128-len(layers))
+			return common.Hash{}, nil, fmt.Errorf("snapshot not old enough yet: need %d more blocks", 128-len(layers))
 		}
 		// Use the bottom-most diff layer as the target
 		root = layers[len(layers)-1].Root()
@@ -288,9 +359,9 @@ func (p *Pruner) Prune(root common.Hash) error {
 		}
 		if !found {
 			if len(layers) > 0 {
-				return errors.New("no snapshot paired state")
+				return common.Hash{}, nil, errors.New("no snapshot paired state")
 			}
-			return fmt.Errorf("associated state[%x] is not present", root)
+			return common.Hash{}, nil, fmt.Errorf("associated state[%x] is not present", root)
 		}
 	} else {
 		if len(layers) > 0 {
@@ -299,12 +370,6 @@ func (p *Pruner) Prune(root common.Hash) error {
 			log.Info("Selecting user-specified state as the pruning target", "root", root)
 		}
 	}
-	// Before start the pruning, delete the clean trie cache first.
-	// It's necessary otherwise in the next restart we will hit the
-	// deleted state root in the "clean cache" so that the incomplete
-	// state is picked for usage.
-	deleteCleanTrieCache(p.config.Cachedir)
-
 	// All the state roots of the middle layer should be forcibly pruned,
 	// otherwise the dangling state will be left.
 	middleRoots := make(map[common.Hash]struct{})
@@ -314,25 +379,262 @@ func (p *Pruner) Prune(root common.Hash) error {
 		}
 		middleRoots[layer.Root()] = struct{}{}
 	}
-	// Traverse the target state, re-construct the whole state trie and
-	// commit to the given bloom filter.
-	start := time.Now()
-	if err := snapshot.GenerateTrie(p.snaptree, root, p.db, p.stateBloom); err != nil {
+	return root, middleRoots, nil
+}
+
+// markState commits all the trie nodes and contract codes of the target state
+// and the genesis into the state bloom. If a partial filename is given, the
+// bloom is periodically flushed into it along with a checkpoint of the last
+// marked account, so that an interrupted construction can be resumed.
+func (p *Pruner) markState(root common.Hash, partial string) error {
+	checkpoint := &pruneCheckpoint{Root: root}
+	if partial != "" {
+		prev := readCheckpoint(p.db)
+		if prev != nil && prev.Root == root && !prev.Sweeping && len(prev.Marker) > 0 && common.FileExist(partial) {
+			stateBloom, err := NewStateBloomFromDisk(partial)
+			if err != nil {
+				log.Warn("Failed to load partial state bloom", "path", partial, "err", err)
+			} else {
+				log.Info("Resuming state bloom construction", "root", root, "marker", common.BytesToHash(prev.Marker), "accounts", prev.Accounts, "slots", prev.Slots)
+				p.stateBloom, checkpoint = stateBloom, prev
+			}
+		}
+	}
+	m := &bloomMarker{
+		pruner:     p,
+		checkpoint: checkpoint,
+		partial:    partial,
+		origin:     common.CopyBytes(checkpoint.Marker),
+		accounts:   checkpoint.Accounts,
+		start:      time.Now(),
+		logged:     time.Now(),
+		saved:      time.Now(),
+	}
+	var err error
+	if len(checkpoint.Marker) == 0 {
+		err = m.markSnapshot()
+	} else {
+		err = m.markTrie()
+	}
+	if err != nil {
 		return err
 	}
+	log.Info("Marked state in bloom", "accounts", checkpoint.Accounts, "slots", checkpoint.Slots, "elapsed", common.PrettyDuration(time.Since(m.start)))
+
 	// Traverse the genesis, put all genesis state entries into the
 	// bloom filter too.
-	if err := extractGenesis(p.db, p.stateBloom); err != nil {
+	return extractGenesis(p.db, p.stateBloom)
+}
+
+// bloomMarker commits a state into the state bloom account by account, tracking
+// and reporting the progress and checkpointing it if requested.
+type bloomMarker struct {
+	pruner     *Pruner
+	checkpoint *pruneCheckpoint
+	partial    string // Filename to checkpoint the bloom into, empty if disabled
+
+	origin   []byte // Account marker the construction was started or resumed at
+	accounts uint64 // Number of accounts marked at the origin
+
+	start  time.Time // Timestamp the construction was started or resumed at
+	logged time.Time // Timestamp of the last progress report
+	saved  time.Time // Timestamp of the last persisted checkpoint
+}
+
+// write is the stack trie callback marking every generated trie node.
+func (m *bloomMarker) write(owner common.Hash, path []byte, hash common.Hash, blob []byte) {
+	m.pruner.stateBloom.Put(hash.Bytes(), nil)
+}
+
+// markSnapshot regenerates the entire account trie from the snapshot, marking
+// all the accounts with their storage tries and codes.
+func (m *bloomMarker) markSnapshot() error {
+	root := m.checkpoint.Root
+	it, err := m.pruner.snaptree.AccountIterator(root, common.Hash{})
+	if err != nil {
+		return err // The required snapshot might not exist.
+	}
+	defer it.Release()
+
+	accTrie := trie.NewStackTrie(m.write)
+	for it.Next() {
+		account, err := snapshot.FullAccount(it.Account())
+		if err != nil {
+			return err
+		}
+		// Insert the account before marking it, ensuring all the subtries on its
+		// left are completed by the time it's checkpointed.
+		blob, err := rlp.EncodeToBytes(account)
+		if err != nil {
+			return err
+		}
+		accTrie.Update(it.Hash().Bytes(), blob)
+
+		if err := m.markAccount(it.Hash(), common.BytesToHash(account.Root), account.CodeHash); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	got, err := accTrie.Commit()
+	if err != nil {
 		return err
 	}
-	filterName := bloomFilterName(p.config.Datadir, root)
+	if got != root {
+		return fmt.Errorf("state root hash mismatch: got %x, want %x", got, root)
+	}
+	return nil
+}
 
-	log.Info("Writing state bloom to disk", "name", filterName)
-	if err := p.stateBloom.Commit(filterName, filterName+stateBloomFileTempSuffix); err != nil {
+// markTrie resumes an interrupted construction, marking the remainder of the
+// account trie after the checkpointed account directly from the database.
+//
+// The stack trie of the interrupted run only emitted the nodes completed before
+// the checkpoint, so the ones along the path of the last marked account (and
+// the next one) are marked from their proofs, the rest by the iteration.
+func (m *bloomMarker) markTrie() error {
+	stateBloom := m.pruner.stateBloom
+	tr, err := trie.NewStateTrie(trie.StateTrieID(m.checkpoint.Root), trie.NewDatabase(m.pruner.db))
+	if err != nil {
 		return err
 	}
-	log.Info("State bloom filter committed", "name", filterName)
-	return prune(p.snaptree, root, p.db, p.stateBloom, filterName, middleRoots, start)
+	if err := tr.Prove(m.checkpoint.Marker, 0, stateBloom); err != nil {
+		return err
+	}
+	origin := nextKey(m.checkpoint.Marker)
+	if origin == nil {
+		return nil // All accounts marked already
+	}
+	if err := tr.Prove(origin, 0, stateBloom); err != nil {
+		return err
+	}
+	it := tr.NodeIterator(origin)
+	for it.Next(true) {
+		// Embedded nodes don't have hash.
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			stateBloom.Put(hash.Bytes(), nil)
+		}
+		if it.Leaf() {
+			var account types.StateAccount
+			if err := rlp.DecodeBytes(it.LeafBlob(), &account); err != nil {
+				return err
+			}
+			if err := m.markAccount(common.BytesToHash(it.LeafKey()), account.Root, account.CodeHash); err != nil {
+				return err
+			}
+		}
+	}
+	return it.Error()
+}
+
+// markAccount commits the storage trie and the code of a single account into the
+// state bloom, reporting and checkpointing the progress afterwards.
+func (m *bloomMarker) markAccount(hash common.Hash, root common.Hash, codeHash []byte) error {
+	var (
+		checkpoint = m.checkpoint
+		stateBloom = m.pruner.stateBloom
+	)
+	if !bytes.Equal(codeHash, types.EmptyCodeHash.Bytes()) {
+		stateBloom.Put(codeHash, nil)
+	}
+	if root != types.EmptyRootHash {
+		it, err := m.pruner.snaptree.StorageIterator(checkpoint.Root, hash, common.Hash{})
+		if err != nil {
+			return err
+		}
+		storageTrie := trie.NewStackTrieWithOwner(m.write, hash)
+		for it.Next() {
+			storageTrie.Update(it.Hash().Bytes(), common.CopyBytes(it.Slot()))
+			checkpoint.Slots++
+		}
+		err = it.Error()
+		it.Release()
+		if err != nil {
+			return err
+		}
+		got, err := storageTrie.Commit()
+		if err != nil {
+			return err
+		}
+		if got != root {
+			return fmt.Errorf("storage root hash mismatch: account %x got %x, want %x", hash, got, root)
+		}
+	}
+	checkpoint.Accounts++
+	checkpoint.Marker = hash.Bytes()
+
+	if time.Since(m.logged) > 8*time.Second {
+		elapsed := time.Since(m.start)
+		log.Info("Marking state in bloom", "accounts", checkpoint.Accounts, "slots", checkpoint.Slots,
+			"rate", estimateRate(checkpoint.Accounts-m.accounts, elapsed), "elapsed", common.PrettyDuration(elapsed),
+			"eta", common.PrettyDuration(estimateETA(m.origin, checkpoint.Marker, elapsed)))
+		m.logged = time.Now()
+	}
+	if m.partial != "" && time.Since(m.saved) > m.pruner.config.CheckpointInterval {
+		if err := stateBloom.Commit(m.partial, m.partial+stateBloomFileTempSuffix); err != nil {
+			return err
+		}
+		writeCheckpoint(m.pruner.db, checkpoint)
+		log.Info("Persisted pruning checkpoint", "root", checkpoint.Root, "marker", hash, "accounts", checkpoint.Accounts)
+		m.saved = time.Now()
+	}
+	return nil
+}
+
+// EstimateStat is the amount of stale data in a database category, named after
+// the ones reported by `geth db inspect`, that would be reclaimed by pruning.
+type EstimateStat struct {
+	Database string
+	Category string
+	Size     common.StorageSize
+	Items    uint64
+}
+
+// Estimate runs the pruning against the specified state version in dry-run
+// mode, reporting the stale data per category without deleting anything.
+func (p *Pruner) Estimate(root common.Hash) ([]EstimateStat, error) {
+	if _, stateBloomRoot, err := findBloomFilter(p.config.Datadir); err != nil {
+		return nil, err
+	} else if stateBloomRoot != (common.Hash{}) {
+		return nil, fmt.Errorf("interrupted pruning of state %x needs to be resumed first", stateBloomRoot)
+	}
+	root, middleRoots, err := p.selectTarget(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.markState(root, ""); err != nil {
+		return nil, err
+	}
+	var (
+		codes  = EstimateStat{Database: "Key-Value store", Category: "Contract codes"}
+		tries  = EstimateStat{Database: "Key-Value store", Category: "Trie nodes"}
+		start  = time.Now()
+		logged = time.Now()
+		iter   = p.db.NewIterator(nil, nil)
+	)
+	defer iter.Release()
+
+	for iter.Next() {
+		key := iter.Key()
+		if !isStale(key, p.stateBloom, middleRoots) {
+			continue
+		}
+		stat := &tries
+		if isCode, _ := rawdb.IsCodeKey(key); isCode {
+			stat = &codes
+		}
+		stat.Size += common.StorageSize(len(key) + len(iter.Value()))
+		stat.Items++
+
+		if time.Since(logged) > 8*time.Second {
+			elapsed := time.Since(start)
+			log.Info("Estimating stale state data", "nodes", tries.Items, "codes", codes.Items, "size", tries.Size+codes.Size,
+				"elapsed", common.PrettyDuration(elapsed), "eta", common.PrettyDuration(estimateETA(nil, key, elapsed)))
+			logged = time.Now()
+		}
+	}
+	return []EstimateStat{codes, tries}, iter.Error()
 }
 
 // RecoverPruning will resume the pruning procedure during the system restart.
@@ -402,7 +704,13 @@ func RecoverPruning(datadir string, db ethdb.Database, trieCachePath string) err
 		log.Error("Pruning target state is not existent")
 		return errors.New("non-existent target state")
 	}
-	return prune(snaptree, stateBloomRoot, db, stateBloom, stateBloomPath, middleRoots, time.Now())
+	// Continue the deletion from the last checkpoint if it belongs to the same
+	// pruning, otherwise sweep the entire database again.
+	checkpoint := readCheckpoint(db)
+	if checkpoint == nil || checkpoint.Root != stateBloomRoot || !checkpoint.Sweeping {
+		checkpoint = &pruneCheckpoint{Root: stateBloomRoot, Sweeping: true}
+	}
+	return prune(snaptree, stateBloomRoot, db, stateBloom, stateBloomPath, middleRoots, time.Now(), checkpoint)
 }
 
 // extractGenesis loads the genesis state and commits all the state entries
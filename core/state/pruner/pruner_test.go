@@ -0,0 +1,181 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bytes"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/consensus/ethash"
+	"github.com/rethereum-blockchain/go-rethereum/core"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/core/vm"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/params"
+)
+
+// countTrieNodes returns the number of hash-scheme trie nodes in the database.
+func countTrieNodes(db ethdb.Iteratee) uint64 {
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	var count uint64
+	for it.Next() {
+		if len(it.Key()) == common.HashLength {
+			count++
+		}
+	}
+	return count
+}
+
+// Tests that an offline pruning interrupted while constructing the state bloom
+// resumes from its checkpoint, and that the dry-run estimate matches the data
+// eventually pruned.
+func TestPruneCheckpointResume(t *testing.T) {
+	var (
+		key, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address   = crypto.PubkeyToAddress(key.PublicKey)
+		config    = *params.TestChainConfig
+		contracts []common.Address
+	)
+	config.RethereumForks = &params.RethereumForks{}
+	signer := types.LatestSigner(&config)
+
+	// Deploy a bunch of contracts storing the block number in every call, with
+	// some initial storage ending up in the snapshot disk layer
+	alloc := core.GenesisAlloc{address: {Balance: big.NewInt(params.Ether)}}
+	for i := 0; i < 16; i++ {
+		contract := common.BigToAddress(big.NewInt(int64(0x100 + i)))
+		alloc[contract] = core.GenesisAccount{
+			Balance: common.Big0,
+			Code:    []byte{byte(vm.NUMBER), byte(vm.NUMBER), byte(vm.SSTORE), byte(vm.STOP)},
+			Storage: map[common.Hash]common.Hash{{0x01}: {0x01}},
+		}
+		contracts = append(contracts, contract)
+	}
+	gspec := &core.Genesis{Config: &config, Alloc: alloc}
+	_, blocks, _ := core.GenerateChainWithGenesis(gspec, ethash.NewFaker(), 200, func(i int, b *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), contracts[i%16], big.NewInt(1000), 100000, b.BaseFee(), nil), signer, key)
+		b.AddTx(tx)
+	})
+	// Run an archive node, so that every single state is persisted
+	db := rawdb.NewMemoryDatabase()
+	chain, err := core.NewBlockChain(db, &core.CacheConfig{
+		TrieCleanLimit:    16,
+		TrieDirtyDisabled: true,
+		SnapshotLimit:     16,
+		SnapshotWait:      true,
+	}, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("Failed to import blocks: %v", err)
+	}
+	chain.Stop()
+
+	var (
+		datadir = t.TempDir()
+		target  = blocks[len(blocks)-128].Root()
+	)
+	newPruner := func() *Pruner {
+		pruner, err := NewPruner(db, Config{Datadir: datadir, Cachedir: filepath.Join(datadir, "triecache"), CheckpointInterval: time.Nanosecond})
+		if err != nil {
+			t.Fatalf("Failed to create pruner: %v", err)
+		}
+		// Shrink the bloom to avoid flushing hundreds of megabytes per checkpoint
+		if pruner.stateBloom, err = newStateBloomWithSize(1); err != nil {
+			t.Fatalf("Failed to create state bloom: %v", err)
+		}
+		return pruner
+	}
+	// Estimate the stale data without touching the database
+	nodes := countTrieNodes(db)
+	stats, err := newPruner().Estimate(common.Hash{})
+	if err != nil {
+		t.Fatalf("Failed to estimate pruning: %v", err)
+	}
+	if have := countTrieNodes(db); have != nodes {
+		t.Fatalf("Dry-run modified database: have %d trie nodes, want %d", have, nodes)
+	}
+	if len(stats) != 2 || stats[0].Category != "Contract codes" || stats[1].Category != "Trie nodes" {
+		t.Fatalf("Unexpected estimate categories: %+v", stats)
+	}
+	if stats[0].Items != 0 || stats[1].Items == 0 || stats[1].Items >= nodes {
+		t.Fatalf("Unexpected estimate: %+v", stats)
+	}
+	// Corrupt the storage snapshot of the contract sorted last, interrupting the
+	// bloom construction after most accounts have been marked.
+	var last common.Hash
+	for _, contract := range contracts {
+		if hash := crypto.Keccak256Hash(contract.Bytes()); bytes.Compare(hash[:], last[:]) > 0 {
+			last = hash
+		}
+	}
+	it := db.NewIterator(append(rawdb.SnapshotStoragePrefix, last.Bytes()...), nil)
+	if !it.Next() {
+		t.Fatalf("Missing storage snapshot of account %x", last)
+	}
+	slotKey, slotVal := common.CopyBytes(it.Key()), common.CopyBytes(it.Value())
+	it.Release()
+	db.Delete(slotKey)
+
+	if err := newPruner().Prune(common.Hash{}); err == nil {
+		t.Fatalf("Pruning succeeded with corrupted snapshot")
+	}
+	checkpoint := readCheckpoint(db)
+	if checkpoint == nil || checkpoint.Root != target || checkpoint.Sweeping || checkpoint.Accounts == 0 {
+		t.Fatalf("Unexpected checkpoint after interruption: %+v", checkpoint)
+	}
+	partial := bloomFilterName(datadir, target) + stateBloomFilePartialSuffix
+	if !common.FileExist(partial) {
+		t.Fatalf("Partial state bloom not persisted")
+	}
+	if have := countTrieNodes(db); have != nodes {
+		t.Fatalf("Interrupted bloom construction modified database: have %d trie nodes, want %d", have, nodes)
+	}
+	// Fix the snapshot and resume the pruning from the checkpoint
+	db.Put(slotKey, slotVal)
+	if err := newPruner().Prune(common.Hash{}); err != nil {
+		t.Fatalf("Failed to resume pruning: %v", err)
+	}
+	if have := countTrieNodes(db); have != nodes-stats[1].Items {
+		t.Fatalf("Pruned trie nodes mismatch: have %d, want %d", nodes-have, stats[1].Items)
+	}
+	if readCheckpoint(db) != nil {
+		t.Fatalf("Checkpoint not deleted after pruning")
+	}
+	if files, _ := os.ReadDir(datadir); len(files) != 0 {
+		t.Fatalf("Leftover files after pruning: %v", files)
+	}
+	if err := verifyState(db, target); err != nil {
+		t.Fatalf("Target state corrupted: %v", err)
+	}
+	if err := verifyState(db, gspec.ToBlock().Root()); err != nil {
+		t.Fatalf("Genesis state corrupted: %v", err)
+	}
+	if err := verifyState(db, blocks[len(blocks)-129].Root()); err == nil {
+		t.Fatalf("Stale state not pruned")
+	}
+}
@@ -65,11 +65,18 @@ func GenerateStorageTrieRoot(account common.Hash, it StorageIterator) (common.Ha
 // accounts as well as the corresponding storages and regenerate the whole state
 // (account trie + all storage tries).
 func GenerateTrie(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethdb.KeyValueWriter) error {
+	return GenerateTrieWithInterrupt(snaptree, root, src, dst, nil)
+}
+
+// GenerateTrieWithInterrupt is a variant of GenerateTrie which stops the
+// generation with ErrGenerationInterrupted once the interrupt channel is closed.
+func GenerateTrieWithInterrupt(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethdb.KeyValueWriter, interrupt <-chan struct{}) error {
 	// Traverse all state by snapshot, re-generate the whole state trie
-	acctIt, err := snaptree.AccountIterator(root, common.Hash{})
+	it, err := snaptree.AccountIterator(root, common.Hash{})
 	if err != nil {
 		return err // The required snapshot might not exist.
 	}
+	acctIt := &interruptibleAccountIterator{AccountIterator: it, interrupt: interrupt}
 	defer acctIt.Release()
 
 	scheme := snaptree.triedb.Scheme()
@@ -83,10 +90,11 @@ func GenerateTrie(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethd
 			rawdb.WriteCode(dst, codeHash, code)
 		}
 		// Then migrate all storage trie nodes into the tmp db.
-		storageIt, err := snaptree.StorageIterator(root, accountHash, common.Hash{})
+		it, err := snaptree.StorageIterator(root, accountHash, common.Hash{})
 		if err != nil {
 			return common.Hash{}, err
 		}
+		storageIt := &interruptibleStorageIterator{StorageIterator: it, interrupt: interrupt}
 		defer storageIt.Release()
 
 		hash, err := generateTrieRoot(dst, scheme, storageIt, accountHash, stackTrieGenerate, nil, stat, false)
@@ -96,6 +104,9 @@ func GenerateTrie(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethd
 		return hash, nil
 	}, newGenerateStats(), true)
 
+	if isInterrupted(interrupt) {
+		return ErrGenerationInterrupted
+	}
 	if err != nil {
 		return err
 	}
@@ -105,6 +116,44 @@ func GenerateTrie(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethd
 	return nil
 }
 
+// ErrGenerationInterrupted is returned if the trie generation was interrupted
+// before reaching the end of the state.
+var ErrGenerationInterrupted = errors.New("trie generation interrupted")
+
+// isInterrupted reports whether the given interrupt channel is closed.
+func isInterrupted(interrupt <-chan struct{}) bool {
+	select {
+	case <-interrupt:
+		return true
+	default:
+		return false
+	}
+}
+
+// interruptibleAccountIterator is an account iterator which terminates early
+// once the interrupt channel is closed.
+type interruptibleAccountIterator struct {
+	AccountIterator
+	interrupt <-chan struct{}
+}
+
+// Next steps the iterator forward, unless it was interrupted.
+func (it *interruptibleAccountIterator) Next() bool {
+	return !isInterrupted(it.interrupt) && it.AccountIterator.Next()
+}
+
+// interruptibleStorageIterator is a storage iterator which terminates early
+// once the interrupt channel is closed.
+type interruptibleStorageIterator struct {
+	StorageIterator
+	interrupt <-chan struct{}
+}
+
+// Next steps the iterator forward, unless it was interrupted.
+func (it *interruptibleStorageIterator) Next() bool {
+	return !isInterrupted(it.interrupt) && it.StorageIterator.Next()
+}
+
 // generateStats is a collection of statistics gathered by the trie generator
 // for logging purposes.
 type generateStats struct {
@@ -0,0 +1,476 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb/memorydb"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/rlp"
+	"github.com/rethereum-blockchain/go-rethereum/trie"
+)
+
+// The state export is a stream of checksummed chunks, each carrying a range of
+// consecutive accounts or storage slots of a single trie along with the merkle
+// proof of the range boundaries. Every account chunk is followed by the storage
+// chunks of the accounts in it, so the importer can rebuild all the tries with
+// stack tries, verifying every chunk as it arrives.
+
+// exportVersion is the version of the state export format.
+const exportVersion uint64 = 1
+
+var (
+	// exportChunkSize is the approximate size of the key-value data in a chunk.
+	// It's a variable so tests can exercise multi-chunk tries.
+	exportChunkSize = 512 * 1024
+
+	// errExportChecksum is returned if a chunk of a state export is corrupted.
+	errExportChecksum = errors.New("chunk checksum mismatch")
+
+	// errExportRoot is returned if a state export doesn't contain the expected
+	// state.
+	errExportRoot = errors.New("state root mismatch")
+)
+
+// exportPreamble is the leading record of a state export.
+type exportPreamble struct {
+	Version uint64
+	Root    common.Hash
+}
+
+// exportRecord is a chunk of a state export along with its checksum.
+type exportRecord struct {
+	Chunk    []byte      // RLP encoded exportChunk
+	Checksum common.Hash // Keccak256 hash of the chunk
+}
+
+// exportChunk is a range of consecutive accounts or storage slots.
+type exportChunk struct {
+	Owner common.Hash   // Account hash for storage chunks, empty for account chunks
+	Root  common.Hash   // Root of the trie the range belongs to
+	Keys  []common.Hash // Hashes of the accounts or storage slots
+	Vals  [][]byte      // Slim accounts, or RLP encoded storage slot values
+	Codes [][]byte      // Contract codes of the accounts in an account chunk
+	Proof [][]byte      // Merkle proof of the range boundaries, empty for complete tries
+}
+
+// exportChunker accumulates the ranges of a single trie into chunks.
+type exportChunker struct {
+	w      io.Writer
+	triedb *trie.Database
+	state  common.Hash // Root of the exported state
+	chunk  *exportChunk
+	origin common.Hash // Key the current chunk starts from
+	first  bool        // Whether the current chunk is the first of its trie
+	size   int
+}
+
+// newExportChunker creates a chunker for the trie with the given owner and root.
+func newExportChunker(w io.Writer, triedb *trie.Database, state common.Hash, owner common.Hash, root common.Hash) *exportChunker {
+	return &exportChunker{
+		w:      w,
+		triedb: triedb,
+		state:  state,
+		chunk:  &exportChunk{Owner: owner, Root: root},
+		first:  true,
+	}
+}
+
+// add appends an entry to the current chunk, flushing it if it grew large. The
+// returned flag reports whether the chunk was flushed.
+func (c *exportChunker) add(key common.Hash, val []byte, code []byte) (bool, error) {
+	c.chunk.Keys = append(c.chunk.Keys, key)
+	c.chunk.Vals = append(c.chunk.Vals, val)
+	c.size += common.HashLength + len(val)
+	if code != nil {
+		c.chunk.Codes = append(c.chunk.Codes, code)
+		c.size += len(code)
+	}
+	if c.size >= exportChunkSize {
+		return true, c.flush(false)
+	}
+	return false, nil
+}
+
+// flush writes out the current chunk, proving its boundaries unless the entire
+// trie is contained in it.
+func (c *exportChunker) flush(last bool) error {
+	if len(c.chunk.Keys) == 0 {
+		return nil
+	}
+	if !(c.first && last) {
+		id := trie.StateTrieID(c.state)
+		if c.chunk.Owner != (common.Hash{}) {
+			id = trie.StorageTrieID(c.state, c.chunk.Owner, c.chunk.Root)
+		}
+		tr, err := trie.New(id, c.triedb)
+		if err != nil {
+			return err
+		}
+		proof := memorydb.New()
+		if err := tr.Prove(c.origin[:], 0, proof); err != nil {
+			return err
+		}
+		if err := tr.Prove(c.chunk.Keys[len(c.chunk.Keys)-1][:], 0, proof); err != nil {
+			return err
+		}
+		it := proof.NewIterator(nil, nil)
+		for it.Next() {
+			c.chunk.Proof = append(c.chunk.Proof, common.CopyBytes(it.Value()))
+		}
+		it.Release()
+	}
+	blob, err := rlp.EncodeToBytes(c.chunk)
+	if err != nil {
+		return err
+	}
+	if err := rlp.Encode(c.w, &exportRecord{Chunk: blob, Checksum: crypto.Keccak256Hash(blob)}); err != nil {
+		return err
+	}
+	// The next chunk starts right after the last key of this one
+	next := increaseKey(common.CopyBytes(c.chunk.Keys[len(c.chunk.Keys)-1][:]))
+	c.origin = common.BytesToHash(next)
+	c.chunk = &exportChunk{Owner: c.chunk.Owner, Root: c.chunk.Root}
+	c.first = false
+	c.size = 0
+	return nil
+}
+
+// ExportState streams the accounts and storage slots of the state with the
+// given root from the snapshot into the writer, along with the contract codes.
+// The trie database is used to prove the boundaries of the exported ranges.
+func ExportState(w io.Writer, t *Tree, triedb *trie.Database, codes ethdb.KeyValueReader, root common.Hash) error {
+	if err := rlp.Encode(w, &exportPreamble{Version: exportVersion, Root: root}); err != nil {
+		return err
+	}
+	accIt, err := t.AccountIterator(root, common.Hash{})
+	if err != nil {
+		return err
+	}
+	defer accIt.Release()
+
+	var (
+		start    = time.Now()
+		logged   = time.Now()
+		accounts uint64
+		slots    uint64
+		chunker  = newExportChunker(w, triedb, root, common.Hash{}, root)
+		storage  []common.Hash // Accounts with storage in the current account chunk
+		roots    = make(map[common.Hash]common.Hash)
+	)
+	// exportStorage writes out the storage of the accounts in the last chunk
+	exportStorage := func() error {
+		for _, account := range storage {
+			storageIt, err := t.StorageIterator(root, account, common.Hash{})
+			if err != nil {
+				return err
+			}
+			sc := newExportChunker(w, triedb, root, account, roots[account])
+			for storageIt.Next() {
+				if _, err := sc.add(storageIt.Hash(), common.CopyBytes(storageIt.Slot()), nil); err != nil {
+					storageIt.Release()
+					return err
+				}
+				slots++
+			}
+			err = storageIt.Error()
+			storageIt.Release()
+			if err != nil {
+				return err
+			}
+			if err := sc.flush(true); err != nil {
+				return err
+			}
+		}
+		storage = storage[:0]
+		for account := range roots {
+			delete(roots, account)
+		}
+		return nil
+	}
+	for accIt.Next() {
+		blob := common.CopyBytes(accIt.Account())
+		account, err := FullAccount(blob)
+		if err != nil {
+			return err
+		}
+		var code []byte
+		if codeHash := common.BytesToHash(account.CodeHash); codeHash != types.EmptyCodeHash {
+			if code = rawdb.ReadCode(codes, codeHash); len(code) == 0 {
+				return fmt.Errorf("missing code %x of account %x", codeHash, accIt.Hash())
+			}
+		}
+		if storageRoot := common.BytesToHash(account.Root); storageRoot != types.EmptyRootHash {
+			storage = append(storage, accIt.Hash())
+			roots[accIt.Hash()] = storageRoot
+		}
+		accounts++
+
+		// If the account chunk was flushed, follow it with the storage
+		flushed, err := chunker.add(accIt.Hash(), blob, code)
+		if err != nil {
+			return err
+		}
+		if flushed {
+			if err := exportStorage(); err != nil {
+				return err
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting state", "root", root, "at", accIt.Hash(), "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := accIt.Error(); err != nil {
+		return err
+	}
+	if err := chunker.flush(true); err != nil {
+		return err
+	}
+	if err := exportStorage(); err != nil {
+		return err
+	}
+	log.Info("Exported state", "root", root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// importTrie rebuilds a single trie from the chunks of a state export.
+type importTrie struct {
+	owner  common.Hash
+	root   common.Hash
+	origin common.Hash // Key the next chunk must start from
+	stack  *trie.StackTrie
+}
+
+// newImportTrie creates a stack trie to rebuild the trie with the given owner
+// and root into the database.
+func newImportTrie(db ethdb.KeyValueWriter, scheme string, owner common.Hash, root common.Hash) *importTrie {
+	return &importTrie{
+		owner: owner,
+		root:  root,
+		stack: trie.NewStackTrieWithOwner(func(owner common.Hash, path []byte, hash common.Hash, blob []byte) {
+			rawdb.WriteTrieNode(db, owner, path, hash, blob, scheme)
+		}, owner),
+	}
+}
+
+// verify checks the range proof of a chunk, and that it continues right where
+// the previous chunk of the trie ended.
+func (t *importTrie) verify(chunk *exportChunk, vals [][]byte) error {
+	keys := make([][]byte, len(chunk.Keys))
+	for i := range chunk.Keys {
+		keys[i] = chunk.Keys[i][:]
+	}
+	var proof *memorydb.Database
+	if len(chunk.Proof) > 0 {
+		proof = memorydb.New()
+		for _, node := range chunk.Proof {
+			proof.Put(crypto.Keccak256(node), node)
+		}
+	} else if t.origin != (common.Hash{}) {
+		return errors.New("missing range proof")
+	}
+	var err error
+	if proof == nil {
+		// Complete tries are verified without proofs
+		_, err = trie.VerifyRangeProof(t.root, nil, nil, keys, vals, nil)
+	} else {
+		_, err = trie.VerifyRangeProof(t.root, t.origin[:], keys[len(keys)-1], keys, vals, proof)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid range proof of trie %x at %x: %v", t.owner, t.origin, err)
+	}
+	t.origin = common.BytesToHash(increaseKey(common.CopyBytes(keys[len(keys)-1])))
+	for i, key := range keys {
+		t.stack.Update(key, vals[i])
+	}
+	return nil
+}
+
+// commit finalizes the trie, ensuring it matches the expected root.
+func (t *importTrie) commit() error {
+	root, err := t.stack.Commit()
+	if err != nil {
+		return err
+	}
+	if root != t.root {
+		return fmt.Errorf("%w: trie %x: have %x, want %x", errExportRoot, t.owner, root, t.root)
+	}
+	return nil
+}
+
+// ImportState rebuilds the state with the given root from a state export read
+// from the reader. The snapshot, the tries and the contract codes are written
+// into the database, and the snapshot is marked as fully generated.
+func ImportState(r io.Reader, db ethdb.KeyValueStore, scheme string, root common.Hash) error {
+	stream := rlp.NewStream(r, 0)
+
+	var preamble exportPreamble
+	if err := stream.Decode(&preamble); err != nil {
+		return fmt.Errorf("failed to decode preamble: %v", err)
+	}
+	if preamble.Version != exportVersion {
+		return fmt.Errorf("unsupported state export version %d", preamble.Version)
+	}
+	if preamble.Root != root {
+		return fmt.Errorf("%w: have %x, want %x", errExportRoot, preamble.Root, root)
+	}
+	// Wipe any previous snapshot, it's being replaced
+	rawdb.DeleteSnapshotRoot(db)
+	rawdb.DeleteSnapshotJournal(db)
+	rawdb.DeleteSnapshotGenerator(db)
+
+	var (
+		start    = time.Now()
+		logged   = time.Now()
+		batch    = db.NewBatch()
+		accTrie  = newImportTrie(batch, scheme, common.Hash{}, root)
+		stTrie   *importTrie
+		pending  = make(map[common.Hash]common.Hash) // Accounts awaiting their storage
+		accounts uint64
+		slots    uint64
+	)
+	// finishStorage commits the storage trie being rebuilt, if any
+	finishStorage := func() error {
+		if stTrie == nil {
+			return nil
+		}
+		if err := stTrie.commit(); err != nil {
+			return err
+		}
+		delete(pending, stTrie.owner)
+		stTrie = nil
+		return nil
+	}
+	for {
+		var record exportRecord
+		if err := stream.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("failed to decode chunk: %v", err)
+		}
+		if crypto.Keccak256Hash(record.Chunk) != record.Checksum {
+			return errExportChecksum
+		}
+		var chunk exportChunk
+		if err := rlp.DecodeBytes(record.Chunk, &chunk); err != nil {
+			return fmt.Errorf("failed to decode chunk: %v", err)
+		}
+		if len(chunk.Keys) == 0 || len(chunk.Keys) != len(chunk.Vals) {
+			return errors.New("malformed chunk")
+		}
+		if chunk.Owner == (common.Hash{}) {
+			// Account chunk, all the storage of the previous one must be done
+			if err := finishStorage(); err != nil {
+				return err
+			}
+			if len(pending) > 0 {
+				return fmt.Errorf("missing storage of %d accounts", len(pending))
+			}
+			if chunk.Root != root {
+				return fmt.Errorf("%w: have %x, want %x", errExportRoot, chunk.Root, root)
+			}
+			codes := make(map[common.Hash]struct{})
+			for _, code := range chunk.Codes {
+				hash := crypto.Keccak256Hash(code)
+				rawdb.WriteCode(batch, hash, code)
+				codes[hash] = struct{}{}
+			}
+			vals := make([][]byte, len(chunk.Vals))
+			for i, blob := range chunk.Vals {
+				account, err := FullAccount(blob)
+				if err != nil {
+					return err
+				}
+				if vals[i], err = rlp.EncodeToBytes(account); err != nil {
+					return err
+				}
+				codeHash := common.BytesToHash(account.CodeHash)
+				if _, ok := codes[codeHash]; !ok && codeHash != types.EmptyCodeHash && !rawdb.HasCode(db, codeHash) {
+					return fmt.Errorf("missing code %x of account %x", codeHash, chunk.Keys[i])
+				}
+				if storageRoot := common.BytesToHash(account.Root); storageRoot != types.EmptyRootHash {
+					pending[chunk.Keys[i]] = storageRoot
+				}
+				rawdb.WriteAccountSnapshot(batch, chunk.Keys[i], blob)
+			}
+			if err := accTrie.verify(&chunk, vals); err != nil {
+				return err
+			}
+			accounts += uint64(len(chunk.Keys))
+		} else {
+			// Storage chunk, either continuing the current trie or starting a new one
+			if stTrie == nil || stTrie.owner != chunk.Owner {
+				if err := finishStorage(); err != nil {
+					return err
+				}
+				want, ok := pending[chunk.Owner]
+				if !ok {
+					return fmt.Errorf("unexpected storage of account %x", chunk.Owner)
+				}
+				if chunk.Root != want {
+					return fmt.Errorf("%w: storage of %x: have %x, want %x", errExportRoot, chunk.Owner, chunk.Root, want)
+				}
+				stTrie = newImportTrie(batch, scheme, chunk.Owner, chunk.Root)
+			}
+			if err := stTrie.verify(&chunk, chunk.Vals); err != nil {
+				return err
+			}
+			for i, key := range chunk.Keys {
+				rawdb.WriteStorageSnapshot(batch, chunk.Owner, key, chunk.Vals[i])
+			}
+			slots += uint64(len(chunk.Keys))
+		}
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Importing state", "root", root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := finishStorage(); err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("missing storage of %d accounts", len(pending))
+	}
+	if err := accTrie.commit(); err != nil {
+		return err
+	}
+	// The state is complete, mark the snapshot as generated
+	rawdb.WriteSnapshotRoot(batch, root)
+	journalProgress(batch, nil, &generatorStats{accounts: accounts, slots: slots})
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Imported state", "root", root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/trie"
+)
+
+// Tests that a state exported from the snapshot can be imported into an empty
+// database, rebuilding the exact same tries, and that corruptions are detected.
+func TestExportImportState(t *testing.T) {
+	defer func(old int) { exportChunkSize = old }(exportChunkSize)
+	exportChunkSize = 2048
+
+	var (
+		helper = newHelper()
+		code   = []byte{0x60, 0x00, 0x60, 0x00, 0xf3}
+	)
+	rawdb.WriteCode(helper.diskdb, crypto.Keccak256Hash(code), code)
+
+	for i := 0; i < 200; i++ {
+		acc := &Account{Balance: big.NewInt(int64(i)), Root: types.EmptyRootHash.Bytes(), CodeHash: types.EmptyCodeHash.Bytes()}
+		key := fmt.Sprintf("acc-%d", i)
+		if i%20 == 0 {
+			var keys, vals []string
+			for j := 0; j < 10*i+1; j++ {
+				keys = append(keys, fmt.Sprintf("key-%d", j))
+				vals = append(vals, fmt.Sprintf("val-%d", j))
+			}
+			acc.Root = helper.makeStorageTrie(common.Hash{}, hashData([]byte(key)), keys, vals, true)
+			acc.CodeHash = crypto.Keccak256(code)
+		}
+		helper.addTrieAccount(key, acc)
+	}
+	root := helper.Commit()
+
+	tree, err := New(Config{CacheSize: 16}, helper.diskdb, helper.triedb, root)
+	if err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := ExportState(&buf, tree, helper.triedb, helper.diskdb, root); err != nil {
+		t.Fatalf("Failed to export state: %v", err)
+	}
+	export := buf.Bytes()
+
+	// Import into an empty database and check the state is complete
+	db := rawdb.NewMemoryDatabase()
+	if err := ImportState(bytes.NewReader(export), db, rawdb.HashScheme, root); err != nil {
+		t.Fatalf("Failed to import state: %v", err)
+	}
+	if have := rawdb.ReadSnapshotRoot(db); have != root {
+		t.Fatalf("Snapshot root mismatch: have %x, want %x", have, root)
+	}
+	if err := CheckConsistency(db, root); err != nil {
+		t.Fatalf("Inconsistent snapshot: %v", err)
+	}
+	imported, err := New(Config{CacheSize: 16, NoBuild: true}, db, trie.NewDatabase(db), root)
+	if err != nil {
+		t.Fatalf("Failed to open imported snapshot: %v", err)
+	}
+	if err := imported.Verify(root); err != nil {
+		t.Fatalf("Failed to verify imported snapshot: %v", err)
+	}
+	tr, err := trie.NewStateTrie(trie.StateTrieID(root), trie.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("Failed to open imported trie: %v", err)
+	}
+	var accounts int
+	for it := trie.NewIterator(tr.NodeIterator(nil)); it.Next(); {
+		accounts++
+	}
+	if accounts != 200 {
+		t.Fatalf("Imported account count mismatch: have %d, want %d", accounts, 200)
+	}
+	if !rawdb.HasCode(db, crypto.Keccak256Hash(code)) {
+		t.Fatalf("Contract code not imported")
+	}
+	// Importing against a different root must be rejected
+	if err := ImportState(bytes.NewReader(export), rawdb.NewMemoryDatabase(), rawdb.HashScheme, common.Hash{0x01}); !errors.Is(err, errExportRoot) {
+		t.Fatalf("Import with wrong root: have %v, want %v", err, errExportRoot)
+	}
+	// Corrupting any chunk must be detected
+	corrupt := common.CopyBytes(export)
+	corrupt[len(corrupt)/2] ^= 0xff
+	if err := ImportState(bytes.NewReader(corrupt), rawdb.NewMemoryDatabase(), rawdb.HashScheme, root); err == nil {
+		t.Fatalf("Corrupted export imported")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/rethereum-blockchain/go-rethereum/common"
@@ -169,8 +170,12 @@ type Tree struct {
 	diskdb ethdb.KeyValueStore      // Persistent database to store the snapshot
 	triedb *trie.Database           // In-memory cache to access the trie through
 	layers map[common.Hash]snapshot // Collection of all known layers
+	pins   int                      // Number of active pins suspending diff layer flattening
+	dpins  int                      // Number of active pins suspending disk layer persistence
 	lock   sync.RWMutex
 
+	onUpdate UpdateHook // Hook invoked with the modifications of every new layer
+
 	// Test hooks
 	onFlatten func() // Hook invoked when the bottom most diff layers are flattened
 }
@@ -337,6 +342,68 @@ func (t *Tree) Snapshots(root common.Hash, limits int, nodisk bool) []Snapshot {
 	return ret
 }
 
+// Diffs returns the root hashes of all the in-memory diff layers, ordered from
+// the ones closest to the disk layer upwards, so that every layer is preceded by
+// its parent.
+func (t *Tree) Diffs() []common.Hash {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	var (
+		roots  []common.Hash
+		depths = make(map[common.Hash]int)
+	)
+	for root, layer := range t.layers {
+		if _, ok := layer.(*diffLayer); !ok {
+			continue
+		}
+		var depth int
+		for parent := layer.Parent(); parent != nil; parent = parent.Parent() {
+			depth++
+		}
+		roots, depths[root] = append(roots, root), depth
+	}
+	sort.Slice(roots, func(i, j int) bool { return depths[roots[i]] < depths[roots[j]] })
+	return roots
+}
+
+// Changes returns the parent root of the diff layer with the given root, along
+// with the hashes of the accounts and storage slots modified by it, including
+// the deleted ones.
+func (t *Tree) Changes(root common.Hash) (common.Hash, []common.Hash, map[common.Hash][]common.Hash, error) {
+	t.lock.RLock()
+	layer := t.layers[root]
+	t.lock.RUnlock()
+
+	diff, ok := layer.(*diffLayer)
+	if !ok {
+		return common.Hash{}, nil, nil, fmt.Errorf("diff layer [%#x] missing", root)
+	}
+	accounts := diff.AccountList()
+	storage := make(map[common.Hash][]common.Hash)
+	for _, account := range accounts {
+		if slots, _ := diff.StorageList(account); len(slots) > 0 {
+			storage[account] = slots
+		}
+	}
+	return diff.Parent().Root(), accounts, storage, nil
+}
+
+// UpdateHook is a callback invoked with the flat state modifications of every
+// update of the snapshot tree. The maps are retained by the tree, so they must
+// not be modified.
+type UpdateHook func(root common.Hash, parent common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte)
+
+// SetUpdateHook installs a callback which is invoked with the modifications of
+// every state transition the tree is updated with, even if the parent layer is
+// not available. Passing nil removes the installed hook.
+func (t *Tree) SetUpdateHook(hook UpdateHook) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.onUpdate = hook
+}
+
 // Update adds a new snapshot into the tree, if that can be linked to an existing
 // old parent. It is disallowed to insert a disk layer (the origin of all).
 func (t *Tree) Update(blockRoot common.Hash, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
@@ -349,6 +416,12 @@ func (t *Tree) Update(blockRoot common.Hash, parentRoot common.Hash, destructs m
 	if blockRoot == parentRoot {
 		return errSnapshotCycle
 	}
+	t.lock.RLock()
+	hook := t.onUpdate
+	t.lock.RUnlock()
+	if hook != nil {
+		hook(blockRoot, parentRoot, destructs, accounts, storage)
+	}
 	// Generate a new snapshot on top of the parent
 	parent := t.Snapshot(parentRoot)
 	if parent == nil {
@@ -394,6 +467,11 @@ func (t *Tree) Cap(root common.Hash, layers int) error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
+	// If the layers are pinned, retain every diff layer in memory until released
+	if t.pins > 0 && layers > 0 {
+		return nil
+	}
+
 	// Flattening the bottom-most diff layer requires special casing since there's
 	// no child to rewire to the grandparent. In that case we can fake a temporary
 	// child for the capping and then remove it.
@@ -446,6 +524,57 @@ func (t *Tree) Cap(root common.Hash, layers int) error {
 	return nil
 }
 
+// Pin suspends flattening the diff layers into the disk layer, keeping all the
+// live layers (including the disk one) from going stale until the pin is
+// released. Explicit full flattening via Cap(root, 0) is still honoured.
+//
+// Note, the diff layers accumulate in memory while pinned, so the pin should
+// only be held as long as necessary.
+func (t *Tree) Pin() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.pins++
+}
+
+// Unpin releases a previously acquired pin. The accumulated diff layers are
+// flattened by the next capping.
+func (t *Tree) Unpin() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.pins == 0 {
+		log.Error("Unbalanced snapshot unpin")
+		return
+	}
+	t.pins--
+}
+
+// PinDiskLayer suspends merging the diff layers into the disk layer, keeping it
+// from going stale until the pin is released. As opposed to Pin, the diff layers
+// are still flattened into the bottom-most accumulator layer, so the memory held
+// grows with the distinct state modified in the meantime only. Explicit full
+// flattening via Cap(root, 0) is still honoured.
+func (t *Tree) PinDiskLayer() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.dpins++
+}
+
+// UnpinDiskLayer releases a previously acquired disk layer pin. The accumulator
+// layer is persisted by the next capping.
+func (t *Tree) UnpinDiskLayer() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.dpins == 0 {
+		log.Error("Unbalanced snapshot disk layer unpin")
+		return
+	}
+	t.dpins--
+}
+
 // cap traverses downwards the diff tree until the number of allowed layers are
 // crossed. All diffs beyond the permitted number are flattened downwards. If the
 // layer limit is reached, memory cap is also enforced (but not before).
@@ -503,6 +632,10 @@ func (t *Tree) cap(diff *diffLayer, layers int) *diskLayer {
 	default:
 		panic(fmt.Sprintf("unknown data layer: %T", parent))
 	}
+	// If the disk layer is pinned, keep accumulating until released
+	if t.dpins > 0 {
+		return nil
+	}
 	// If the bottom-most layer is larger than our memory cap, persist to disk
 	bottom := diff.parent.(*diffLayer)
 
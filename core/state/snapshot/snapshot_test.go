@@ -181,6 +181,102 @@ func TestDiskLayerExternalInvalidationPartialFlatten(t *testing.T) {
 	}
 }
 
+// Tests that pinned snapshot layers are not flattened by capping, keeping the
+// disk layer alive until the pin is released.
+func TestPinnedLayersRetained(t *testing.T) {
+	base := &diskLayer{
+		diskdb: rawdb.NewMemoryDatabase(),
+		root:   common.HexToHash("0x01"),
+		cache:  fastcache.New(1024 * 500),
+	}
+	snaps := &Tree{
+		layers: map[common.Hash]snapshot{
+			base.root: base,
+		},
+	}
+	ref := snaps.Snapshot(base.root)
+
+	accounts := map[common.Hash][]byte{
+		common.HexToHash("0xa1"): randomAccount(),
+	}
+	for i := 2; i <= 4; i++ {
+		if err := snaps.Update(common.BigToHash(big.NewInt(int64(i))), common.BigToHash(big.NewInt(int64(i-1))), nil, accounts, nil); err != nil {
+			t.Fatalf("failed to create a diff layer: %v", err)
+		}
+	}
+	defer func(memcap uint64) { aggregatorMemoryLimit = memcap }(aggregatorMemoryLimit)
+	aggregatorMemoryLimit = 0
+
+	snaps.Pin()
+	if err := snaps.Cap(common.HexToHash("0x04"), 1); err != nil {
+		t.Fatalf("failed to cap pinned layers: %v", err)
+	}
+	if n := len(snaps.layers); n != 4 {
+		t.Errorf("pinned layer count mismatch: have %d, want %d", n, 4)
+	}
+	if _, err := ref.Account(common.HexToHash("0xa1")); err != nil {
+		t.Errorf("pinned disk layer went stale: %v", err)
+	}
+	snaps.Unpin()
+	if err := snaps.Cap(common.HexToHash("0x04"), 1); err != nil {
+		t.Fatalf("failed to cap released layers: %v", err)
+	}
+	if n := len(snaps.layers); n != 2 {
+		t.Errorf("released layer count mismatch: have %d, want %d", n, 2)
+	}
+	if _, err := ref.Account(common.HexToHash("0xa1")); err != ErrSnapshotStale {
+		t.Errorf("released disk layer not stale: %v", err)
+	}
+}
+
+// Tests that a pinned disk layer is not merged into by capping, while the diff
+// layers on top are still flattened into the accumulator.
+func TestPinnedDiskLayerRetained(t *testing.T) {
+	base := &diskLayer{
+		diskdb: rawdb.NewMemoryDatabase(),
+		root:   common.HexToHash("0x01"),
+		cache:  fastcache.New(1024 * 500),
+	}
+	snaps := &Tree{
+		layers: map[common.Hash]snapshot{
+			base.root: base,
+		},
+	}
+	ref := snaps.Snapshot(base.root)
+
+	accounts := map[common.Hash][]byte{
+		common.HexToHash("0xa1"): randomAccount(),
+	}
+	for i := 2; i <= 4; i++ {
+		if err := snaps.Update(common.BigToHash(big.NewInt(int64(i))), common.BigToHash(big.NewInt(int64(i-1))), nil, accounts, nil); err != nil {
+			t.Fatalf("failed to create a diff layer: %v", err)
+		}
+	}
+	defer func(memcap uint64) { aggregatorMemoryLimit = memcap }(aggregatorMemoryLimit)
+	aggregatorMemoryLimit = 0
+
+	snaps.PinDiskLayer()
+	if err := snaps.Cap(common.HexToHash("0x04"), 1); err != nil {
+		t.Fatalf("failed to cap pinned layers: %v", err)
+	}
+	if n := len(snaps.layers); n != 3 {
+		t.Errorf("pinned layer count mismatch: have %d, want %d", n, 3)
+	}
+	if _, err := ref.Account(common.HexToHash("0xa1")); err != nil {
+		t.Errorf("pinned disk layer went stale: %v", err)
+	}
+	snaps.UnpinDiskLayer()
+	if err := snaps.Cap(common.HexToHash("0x04"), 1); err != nil {
+		t.Fatalf("failed to cap released layers: %v", err)
+	}
+	if n := len(snaps.layers); n != 2 {
+		t.Errorf("released layer count mismatch: have %d, want %d", n, 2)
+	}
+	if _, err := ref.Account(common.HexToHash("0xa1")); err != ErrSnapshotStale {
+		t.Errorf("released disk layer not stale: %v", err)
+	}
+}
+
 // Tests that if a diff layer becomes stale, no active external references will
 // be returned with junk data. This version of the test retains the bottom diff
 // layer to check the usual mode of operation where the accumulator is retained.
@@ -18,6 +18,7 @@ package snapshot
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"time"
 
@@ -150,3 +151,55 @@ func CheckJournalAccount(db ethdb.KeyValueStore, hash common.Hash) error {
 		return nil
 	})
 }
+
+// CheckConsistency verifies that the persisted snapshot is consistent with the
+// state of the given head block: the generator marker must be decodable and
+// well formed, and the journal must be continuous with the disk layer and cover
+// the head state.
+func CheckConsistency(db ethdb.KeyValueStore, head common.Hash) error {
+	base := rawdb.ReadSnapshotRoot(db)
+	if base == (common.Hash{}) {
+		return errors.New("missing snapshot root")
+	}
+	blob := rawdb.ReadSnapshotGenerator(db)
+	if len(blob) == 0 {
+		return errors.New("missing snapshot generator")
+	}
+	var generator journalGenerator
+	if err := rlp.DecodeBytes(blob, &generator); err != nil {
+		return fmt.Errorf("failed to decode snapshot generator: %v", err)
+	}
+	switch len(generator.Marker) {
+	case 0:
+		if !generator.Done {
+			return errors.New("snapshot generator not done without progress marker")
+		}
+	case common.HashLength, 2 * common.HashLength:
+		if generator.Done {
+			return fmt.Errorf("snapshot generator done with progress marker %#x", generator.Marker)
+		}
+	default:
+		return fmt.Errorf("invalid snapshot generator marker %#x", generator.Marker)
+	}
+	if len(rawdb.ReadSnapshotJournal(db)) == 0 {
+		if base != head {
+			return fmt.Errorf("missing snapshot journal, disk root %x is not head %x", base, head)
+		}
+		return nil
+	}
+	roots := map[common.Hash]bool{base: true}
+	err := iterateJournal(db, func(parent common.Hash, root common.Hash, _ map[common.Hash]struct{}, _ map[common.Hash][]byte, _ map[common.Hash]map[common.Hash][]byte) error {
+		if !roots[parent] {
+			return fmt.Errorf("discontinuous journal layer %x, unknown parent %x", root, parent)
+		}
+		roots[root] = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("invalid snapshot journal: %v", err)
+	}
+	if !roots[head] {
+		return fmt.Errorf("head state %x not covered by the snapshot", head)
+	}
+	return nil
+}
@@ -974,6 +974,30 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 		nodes                   = trie.NewMergedNodeSet()
 		codeWriter              = s.db.DiskDB().NewBatch()
 	)
+	// In the path-based scheme the stale trie nodes are overwritten in place
+	// rather than garbage collected, so the storage of the destructed accounts
+	// has to be wiped explicitly.
+	if s.db.TrieDB().Scheme() == rawdb.PathScheme {
+		for addr := range s.stateObjectsDestruct {
+			set, aborted, err := s.deleteStorage(addr)
+			if err != nil {
+				return common.Hash{}, err
+			}
+			if aborted {
+				// The leftover nodes are unreachable from the new state and
+				// don't affect it, they are only wasted space.
+				storageDeleteSkipMeter.Mark(1)
+				log.Warn("Skipped deletion of large storage", "address", addr, "limit", common.StorageSize(storageDeleteLimit))
+			}
+			if set != nil {
+				if err := nodes.Merge(set); err != nil {
+					return common.Hash{}, err
+				}
+				_, deleted := set.Size()
+				storageTrieNodesDeleted += deleted
+			}
+		}
+	}
 	for addr := range s.stateObjectsDirty {
 		if obj := s.stateObjects[addr]; !obj.deleted {
 			// Write any contract code associated with the state object
@@ -997,11 +1021,9 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 			}
 		}
 		// If the contract is destructed, the storage is still left in the
-		// database as dangling data. Theoretically it's should be wiped from
-		// database as well, but in hash-based-scheme it's extremely hard to
-		// determine that if the trie nodes are also referenced by other storage,
-		// and in path-based-scheme some technical challenges are still unsolved.
-		// Although it won't affect the correctness but please fix it TODO(rjl493456442).
+		// database as dangling data in the hash-based scheme, as it's extremely
+		// hard to determine if the trie nodes are also referenced by other
+		// storage. It won't affect the correctness though.
 	}
 	if len(s.stateObjectsDirty) > 0 {
 		s.stateObjectsDirty = make(map[common.Address]struct{})
@@ -1071,7 +1093,7 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	}
 	if root != origin {
 		start := time.Now()
-		if err := s.db.TrieDB().Update(nodes); err != nil {
+		if err := s.db.TrieDB().Update(root, origin, nodes); err != nil {
 			return common.Hash{}, err
 		}
 		s.originalRoot = root
@@ -1082,6 +1104,54 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	return root, nil
 }
 
+// storageDeleteLimit denotes the highest permissible memory allocation
+// employed for deleting the storage trie of a destructed account.
+const storageDeleteLimit = 512 * 1024 * 1024
+
+// deleteStorage collects all the nodes of the storage trie of the given account
+// as it was in the original state, marking them as deleted. If the storage trie
+// is too large to be wiped in a single commit, the deletion is aborted and the
+// nodes are left in the database.
+func (s *StateDB) deleteStorage(addr common.Address) (*trie.NodeSet, bool, error) {
+	tr, err := s.db.OpenTrie(s.originalRoot)
+	if err != nil {
+		return nil, false, err
+	}
+	acct, err := tr.GetAccount(addr)
+	if err != nil {
+		return nil, false, err
+	}
+	if acct == nil || acct.Root == types.EmptyRootHash {
+		return nil, false, nil
+	}
+	addrHash := crypto.Keccak256Hash(addr.Bytes())
+	stTrie, err := s.db.OpenStorageTrie(s.originalRoot, addrHash, acct.Root)
+	if err != nil {
+		return nil, false, err
+	}
+	var (
+		set  = trie.NewNodeSet(addrHash, nil)
+		it   = stTrie.NodeIterator(nil)
+		size common.StorageSize
+	)
+	for it.Next(true) {
+		// Embedded nodes are not stored on their own
+		if it.Hash() == (common.Hash{}) {
+			continue
+		}
+		blob := it.NodeBlob()
+		size += common.StorageSize(len(it.Path()) + len(blob))
+		if size > storageDeleteLimit {
+			return nil, true, nil
+		}
+		set.MarkDeleted(it.Path(), blob)
+	}
+	if err := it.Error(); err != nil {
+		return nil, false, err
+	}
+	return set, false, nil
+}
+
 // Prepare handles the preparatory steps for executing a state transition with.
 // This method must be invoked before state transition.
 //
@@ -32,6 +32,7 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/common"
 	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
 	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/trie"
 )
 
 // Tests that updating a state trie does not leak any database writes prior to
@@ -965,6 +966,62 @@ func TestFlushOrderDataLoss(t *testing.T) {
 	}
 }
 
+// Tests that the storage of destructed accounts is wiped from disk in the
+// path-based scheme, including accounts resurrected in the same block.
+func TestDeleteStoragePathScheme(t *testing.T) {
+	var (
+		memdb    = rawdb.NewMemoryDatabase()
+		triedb   = trie.NewDatabaseWithConfig(memdb, &trie.Config{PathDB: &trie.PathConfig{}})
+		statedb  = NewDatabaseWithNodeDB(memdb, triedb)
+		addr     = common.Address{0x1}
+		state, _ = New(types.EmptyRootHash, statedb, nil)
+	)
+	state.SetBalance(addr, big.NewInt(1))
+	for i := byte(0); i < 64; i++ {
+		state.SetState(addr, common.Hash{i}, common.Hash{i + 1})
+	}
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	// Destruct the account and resurrect it with a single slot
+	state, _ = New(root, statedb, nil)
+	state.Suicide(addr)
+	state.Finalise(true)
+	state.SetBalance(addr, big.NewInt(2))
+	state.SetState(addr, common.Hash{0xff}, common.Hash{0xff})
+
+	root, err = state.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := triedb.Commit(root, false); err != nil {
+		t.Fatalf("failed to flush state: %v", err)
+	}
+	// Only the root node of the resurrected storage is expected on disk
+	var nodes int
+	it := memdb.NewIterator(nil, nil)
+	for it.Next() {
+		if rawdb.IsStorageTrieNode(it.Key()) {
+			nodes++
+		}
+	}
+	it.Release()
+	if nodes != 1 {
+		t.Fatalf("storage node count mismatch: have %d, want %d", nodes, 1)
+	}
+	state, err = New(root, NewDatabaseWithConfig(memdb, &trie.Config{PathDB: &trie.PathConfig{}}), nil)
+	if err != nil {
+		t.Fatalf("failed to reopen state: %v", err)
+	}
+	if have := state.GetState(addr, common.Hash{0xff}); have != (common.Hash{0xff}) {
+		t.Fatalf("resurrected slot mismatch: have %x", have)
+	}
+	if have := state.GetState(addr, common.Hash{0x1}); have != (common.Hash{}) {
+		t.Fatalf("destructed slot still present: have %x", have)
+	}
+}
+
 func TestStateDBTransientStorage(t *testing.T) {
 	memDb := rawdb.NewMemoryDatabase()
 	db := NewDatabase(memDb)
@@ -0,0 +1,303 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/state/snapshot"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/rlp"
+	"github.com/rethereum-blockchain/go-rethereum/trie"
+)
+
+// The flat state diff history is an alternative to the archive mode. Instead
+// of retaining all the trie nodes of every state, the flat account and storage
+// modifications of each block (as tracked by the snapshot diff layers) are
+// stored and indexed by block number, serving historical account and storage
+// reads without any trie at hand.
+
+var (
+	// errHistoricStateReadOnly is returned if a historical state served from
+	// the flat state diff history is attempted to be modified.
+	errHistoricStateReadOnly = errors.New("historical state is read-only")
+
+	// errHistoricProof is returned if a merkle proof is requested from a
+	// historical state served from the flat state diff history.
+	errHistoricProof = errors.New("proofs are not supported for historical state")
+)
+
+// stateDiff is the flat state modifications of a single block.
+type stateDiff struct {
+	Destructs []common.Hash
+	Accounts  []stateDiffAccount
+	Storage   []stateDiffStorage
+}
+
+// stateDiffAccount is a modified account in slim format, empty if deleted.
+type stateDiffAccount struct {
+	Hash common.Hash
+	Blob []byte
+}
+
+// stateDiffStorage is the set of modified storage slots of an account, empty
+// values meaning deleted slots.
+type stateDiffStorage struct {
+	Hash   common.Hash
+	Keys   []common.Hash
+	Values [][]byte
+}
+
+// sortedHashes returns the keys of the given map in ascending order.
+func sortedHashes[V any](m map[common.Hash]V) []common.Hash {
+	hashes := make([]common.Hash, 0, len(m))
+	for hash := range m {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+	return hashes
+}
+
+// EncodeStateDiff serializes the flat state modifications of a block, in the
+// format accepted by the snapshot tree updates.
+func EncodeStateDiff(destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) ([]byte, error) {
+	diff := &stateDiff{Destructs: sortedHashes(destructs)}
+	for _, hash := range sortedHashes(accounts) {
+		diff.Accounts = append(diff.Accounts, stateDiffAccount{Hash: hash, Blob: accounts[hash]})
+	}
+	for _, hash := range sortedHashes(storage) {
+		slots := stateDiffStorage{Hash: hash}
+		for _, key := range sortedHashes(storage[hash]) {
+			slots.Keys = append(slots.Keys, key)
+			slots.Values = append(slots.Values, storage[hash][key])
+		}
+		diff.Storage = append(diff.Storage, slots)
+	}
+	return rlp.EncodeToBytes(diff)
+}
+
+// IndexStateDiff indexes the encoded flat state diff of the canonical block
+// with the given number.
+func IndexStateDiff(db ethdb.KeyValueWriter, number uint64, blob []byte) error {
+	var diff stateDiff
+	if err := rlp.DecodeBytes(blob, &diff); err != nil {
+		return err
+	}
+	for _, hash := range diff.Destructs {
+		rawdb.WriteStateDiffDestruct(db, hash, number)
+	}
+	for _, account := range diff.Accounts {
+		rawdb.WriteStateDiffAccount(db, account.Hash, number, account.Blob)
+	}
+	for _, storage := range diff.Storage {
+		for i, key := range storage.Keys {
+			rawdb.WriteStateDiffStorage(db, storage.Hash, key, number, storage.Values[i])
+		}
+	}
+	return nil
+}
+
+// UnindexStateDiff removes the index entries of the encoded flat state diff of
+// the block with the given number, which is not canonical anymore.
+func UnindexStateDiff(db ethdb.KeyValueWriter, number uint64, blob []byte) error {
+	var diff stateDiff
+	if err := rlp.DecodeBytes(blob, &diff); err != nil {
+		return err
+	}
+	for _, hash := range diff.Destructs {
+		rawdb.DeleteStateDiffDestruct(db, hash, number)
+	}
+	for _, account := range diff.Accounts {
+		rawdb.DeleteStateDiffAccount(db, account.Hash, number)
+	}
+	for _, storage := range diff.Storage {
+		for _, key := range storage.Keys {
+			rawdb.DeleteStateDiffStorage(db, storage.Hash, key, number)
+		}
+	}
+	return nil
+}
+
+// IndexGenesisState indexes the entire state with the given root as the state
+// diff of the genesis block, forming the base of the flat state diff history.
+func IndexGenesisState(db Database, root common.Hash, batch ethdb.KeyValueWriter) error {
+	tr, err := db.OpenTrie(root)
+	if err != nil {
+		return err
+	}
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		var account types.StateAccount
+		if err := rlp.DecodeBytes(it.Value, &account); err != nil {
+			return err
+		}
+		hash := common.BytesToHash(it.Key)
+		rawdb.WriteStateDiffAccount(batch, hash, 0, snapshot.SlimAccountRLP(account.Nonce, account.Balance, account.Root, account.CodeHash))
+
+		if account.Root == types.EmptyRootHash {
+			continue
+		}
+		st, err := db.OpenStorageTrie(root, hash, account.Root)
+		if err != nil {
+			return err
+		}
+		sit := trie.NewIterator(st.NodeIterator(nil))
+		for sit.Next() {
+			rawdb.WriteStateDiffStorage(batch, hash, common.BytesToHash(sit.Key), 0, common.CopyBytes(sit.Value))
+		}
+		if sit.Err != nil {
+			return sit.Err
+		}
+	}
+	return it.Err
+}
+
+// historicDatabase is a state database serving the state of a canonical block
+// out of the flat state diff history. Contract codes are still retrieved from
+// the wrapped database.
+type historicDatabase struct {
+	Database
+	number uint64
+}
+
+// NewHistoricDatabase creates a state database, which serves the state of the
+// canonical block with the given number from the flat state diff history. The
+// state is read-only and merkle proofs are not available.
+func NewHistoricDatabase(db Database, number uint64) Database {
+	return &historicDatabase{Database: db, number: number}
+}
+
+// OpenTrie opens the historical account trie.
+func (db *historicDatabase) OpenTrie(root common.Hash) (Trie, error) {
+	return &historicTrie{db: db.DiskDB(), number: db.number, root: root}, nil
+}
+
+// OpenStorageTrie opens the historical storage trie of an account.
+func (db *historicDatabase) OpenStorageTrie(stateRoot common.Hash, addrHash, root common.Hash) (Trie, error) {
+	return &historicTrie{db: db.DiskDB(), number: db.number, owner: addrHash, root: root}, nil
+}
+
+// CopyTrie returns an independent copy of the given trie.
+func (db *historicDatabase) CopyTrie(t Trie) Trie {
+	if ht, ok := t.(*historicTrie); ok {
+		cpy := *ht
+		return &cpy
+	}
+	return db.Database.CopyTrie(t)
+}
+
+// historicTrie is a read-only trie, serving the historical accounts or storage
+// slots of an account from the flat state diff history.
+type historicTrie struct {
+	db     ethdb.KeyValueStore
+	number uint64
+	owner  common.Hash // Account hash for storage tries, empty for the account trie
+	root   common.Hash
+}
+
+// GetKey returns the sha3 preimage of a hashed key, which is not tracked.
+func (t *historicTrie) GetKey([]byte) []byte {
+	return nil
+}
+
+// GetStorage returns the value of the storage slot at the block.
+func (t *historicTrie) GetStorage(_ common.Address, key []byte) ([]byte, error) {
+	value, written, ok := rawdb.ReadStateDiffStorage(t.db, t.owner, crypto.Keccak256Hash(key), t.number)
+	if !ok {
+		return nil, nil
+	}
+	// Any storage written before the latest wipe of the account is gone. The
+	// slots written in the same block are of the recreated account.
+	if destructed, ok := rawdb.ReadStateDiffDestruct(t.db, t.owner, t.number); ok && destructed > written {
+		return nil, nil
+	}
+	if len(value) == 0 {
+		return nil, nil
+	}
+	return value, nil
+}
+
+// GetAccount returns the account at the block, nil if it didn't exist.
+func (t *historicTrie) GetAccount(address common.Address) (*types.StateAccount, error) {
+	hash := crypto.Keccak256Hash(address.Bytes())
+	blob, written, ok := rawdb.ReadStateDiffAccount(t.db, hash, t.number)
+	if !ok || len(blob) == 0 {
+		return nil, nil
+	}
+	// Destructed accounts are not tracked as modified unless they were also
+	// recreated in the same block, check whether the account got wiped since.
+	if destructed, ok := rawdb.ReadStateDiffDestruct(t.db, hash, t.number); ok && destructed > written {
+		return nil, nil
+	}
+	acc, err := snapshot.FullAccount(blob)
+	if err != nil {
+		return nil, err
+	}
+	return &types.StateAccount{
+		Nonce:    acc.Nonce,
+		Balance:  acc.Balance,
+		Root:     common.BytesToHash(acc.Root),
+		CodeHash: acc.CodeHash,
+	}, nil
+}
+
+// UpdateStorage implements Trie, historical state can't be modified.
+func (t *historicTrie) UpdateStorage(common.Address, []byte, []byte) error {
+	return errHistoricStateReadOnly
+}
+
+// UpdateAccount implements Trie, historical state can't be modified.
+func (t *historicTrie) UpdateAccount(common.Address, *types.StateAccount) error {
+	return errHistoricStateReadOnly
+}
+
+// DeleteStorage implements Trie, historical state can't be modified.
+func (t *historicTrie) DeleteStorage(common.Address, []byte) error {
+	return errHistoricStateReadOnly
+}
+
+// DeleteAccount implements Trie, historical state can't be modified.
+func (t *historicTrie) DeleteAccount(common.Address) error {
+	return errHistoricStateReadOnly
+}
+
+// Hash returns the root hash of the historical trie.
+func (t *historicTrie) Hash() common.Hash {
+	return t.root
+}
+
+// Commit implements Trie, there is never anything to commit.
+func (t *historicTrie) Commit(bool) (common.Hash, *trie.NodeSet) {
+	return t.root, nil
+}
+
+// NodeIterator implements Trie, historical state is not iterable and an
+// exhausted iterator is returned.
+func (t *historicTrie) NodeIterator([]byte) trie.NodeIterator {
+	return trie.NewEmpty(nil).NodeIterator(nil)
+}
+
+// Prove implements Trie, proofs are not available for historical state.
+func (t *historicTrie) Prove([]byte, uint, ethdb.KeyValueWriter) error {
+	return errHistoricProof
+}
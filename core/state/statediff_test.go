@@ -0,0 +1,108 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/state/snapshot"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+)
+
+// Tests that the historical state served from the flat state diff history
+// reflects the account and storage modifications of each block, including the
+// storage wipes of destructed accounts.
+func TestHistoricState(t *testing.T) {
+	var (
+		db   = rawdb.NewMemoryDatabase()
+		addr = common.HexToAddress("0x1")
+		hash = crypto.Keccak256Hash(addr.Bytes())
+		slot = common.HexToHash("0x2")
+		key  = crypto.Keccak256Hash(slot.Bytes())
+	)
+	account := func(balance int64) map[common.Hash][]byte {
+		return map[common.Hash][]byte{hash: snapshot.SlimAccountRLP(0, big.NewInt(balance), common.Hash{0x01}, types.EmptyCodeHash.Bytes())}
+	}
+	storage := func(value byte) map[common.Hash]map[common.Hash][]byte {
+		return map[common.Hash]map[common.Hash][]byte{hash: {key: {value}}}
+	}
+	diffs := []struct {
+		destructs map[common.Hash]struct{}
+		accounts  map[common.Hash][]byte
+		storage   map[common.Hash]map[common.Hash][]byte
+	}{
+		{nil, account(1), storage(1)},                         // block 1: created with a slot
+		{nil, account(2), nil},                                // block 2: balance changed
+		{map[common.Hash]struct{}{hash: {}}, nil, nil},        // block 3: destructed
+		{map[common.Hash]struct{}{hash: {}}, account(4), nil}, // block 4: recreated without storage
+		{nil, nil, storage(5)},                                // block 5: slot written again
+	}
+	for i, diff := range diffs {
+		blob, err := EncodeStateDiff(diff.destructs, diff.accounts, diff.storage)
+		if err != nil {
+			t.Fatalf("block %d: failed to encode diff: %v", i+1, err)
+		}
+		if err := IndexStateDiff(db, uint64(i+1), blob); err != nil {
+			t.Fatalf("block %d: failed to index diff: %v", i+1, err)
+		}
+	}
+	tests := []struct {
+		number  uint64
+		balance int64
+		exist   bool
+		value   common.Hash
+	}{
+		{0, 0, false, common.Hash{}},
+		{1, 1, true, common.BytesToHash([]byte{1})},
+		{2, 2, true, common.BytesToHash([]byte{1})},
+		{3, 0, false, common.Hash{}},
+		{4, 4, true, common.Hash{}},
+		{5, 4, true, common.BytesToHash([]byte{5})},
+		{6, 4, true, common.BytesToHash([]byte{5})},
+	}
+	for _, tt := range tests {
+		state, err := New(common.Hash{}, NewHistoricDatabase(NewDatabase(db), tt.number), nil)
+		if err != nil {
+			t.Fatalf("block %d: failed to open state: %v", tt.number, err)
+		}
+		if exist := state.Exist(addr); exist != tt.exist {
+			t.Errorf("block %d: existence mismatch: have %v, want %v", tt.number, exist, tt.exist)
+		}
+		if balance := state.GetBalance(addr); balance.Cmp(big.NewInt(tt.balance)) != 0 {
+			t.Errorf("block %d: balance mismatch: have %v, want %v", tt.number, balance, tt.balance)
+		}
+		if value := state.GetState(addr, slot); value != tt.value {
+			t.Errorf("block %d: storage mismatch: have %x, want %x", tt.number, value, tt.value)
+		}
+		if _, err := state.GetStorageProof(addr, slot); err == nil {
+			t.Errorf("block %d: historical proof generated", tt.number)
+		}
+	}
+	// Drop the last block from the index and ensure the previous slot is gone
+	blob, _ := EncodeStateDiff(diffs[4].destructs, diffs[4].accounts, diffs[4].storage)
+	if err := UnindexStateDiff(db, 5, blob); err != nil {
+		t.Fatalf("Failed to unindex diff: %v", err)
+	}
+	state, _ := New(common.Hash{}, NewHistoricDatabase(NewDatabase(db), 6), nil)
+	if value := state.GetState(addr, slot); value != (common.Hash{}) {
+		t.Errorf("Unindexed storage mismatch: have %x, want empty", value)
+	}
+}
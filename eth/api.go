@@ -33,7 +33,9 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/core"
 	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
 	"github.com/rethereum-blockchain/go-rethereum/core/state"
+	"github.com/rethereum-blockchain/go-rethereum/core/state/pruner"
 	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/eth/protocols/snap"
 	"github.com/rethereum-blockchain/go-rethereum/internal/ethapi"
 	"github.com/rethereum-blockchain/go-rethereum/log"
 	"github.com/rethereum-blockchain/go-rethereum/rlp"
@@ -612,3 +614,22 @@ func (api *DebugAPI) SetTrieFlushInterval(interval string) error {
 	api.eth.blockchain.SetTrieFlushInterval(t)
 	return nil
 }
+
+// PruneState starts pruning the stale state in the background, against the
+// current snapshot disk layer. The progress can be tracked via PruneStatus.
+func (api *DebugAPI) PruneState() error {
+	return api.eth.pruner.Start()
+}
+
+// PruneStatus returns the progress of the running, or the outcome of the last,
+// background state pruning.
+func (api *DebugAPI) PruneStatus() pruner.OnlineStatus {
+	return api.eth.pruner.Status()
+}
+
+// SnapSyncStatus returns a detailed report of the snap sync progress, including
+// the remaining account ranges, the healing queue, the measured throughput of
+// the peers synced from and the snap requests served to remote peers.
+func (api *DebugAPI) SnapSyncStatus() *snap.SyncStatus {
+	return api.eth.Downloader().SnapSyncer.Status()
+}
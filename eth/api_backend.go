@@ -37,6 +37,8 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/eth/tracers"
 	"github.com/rethereum-blockchain/go-rethereum/ethdb"
 	"github.com/rethereum-blockchain/go-rethereum/event"
+	"github.com/rethereum-blockchain/go-rethereum/internal/ethapi"
+	"github.com/rethereum-blockchain/go-rethereum/log"
 	"github.com/rethereum-blockchain/go-rethereum/miner"
 	"github.com/rethereum-blockchain/go-rethereum/params"
 	"github.com/rethereum-blockchain/go-rethereum/rpc"
@@ -149,11 +151,21 @@ func (b *EthAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumbe
 		}
 		return b.eth.blockchain.GetBlock(header.Hash(), header.Number.Uint64()), nil
 	}
-	return b.eth.blockchain.GetBlockByNumber(uint64(number)), nil
+	block := b.eth.blockchain.GetBlockByNumber(uint64(number))
+	if block == nil {
+		return nil, b.historyPruned(uint64(number))
+	}
+	return block, nil
 }
 
 func (b *EthAPIBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
-	return b.eth.blockchain.GetBlockByHash(hash), nil
+	block := b.eth.blockchain.GetBlockByHash(hash)
+	if block == nil {
+		if header := b.eth.blockchain.GetHeaderByHash(hash); header != nil {
+			return nil, b.historyPruned(header.Number.Uint64())
+		}
+	}
+	return block, nil
 }
 
 // GetBody returns body of a block. It does not resolve special block numbers.
@@ -164,6 +176,9 @@ func (b *EthAPIBackend) GetBody(ctx context.Context, hash common.Hash, number rp
 	if body := b.eth.blockchain.GetBody(hash); body != nil {
 		return body, nil
 	}
+	if err := b.historyPruned(uint64(number)); err != nil {
+		return nil, err
+	}
 	return nil, errors.New("block body not found")
 }
 
@@ -181,6 +196,9 @@ func (b *EthAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash r
 		}
 		block := b.eth.blockchain.GetBlock(hash, header.Number.Uint64())
 		if block == nil {
+			if err := b.historyPruned(header.Number.Uint64()); err != nil {
+				return nil, err
+			}
 			return nil, errors.New("header found, but block body is missing")
 		}
 		return block, nil
@@ -206,10 +224,26 @@ func (b *EthAPIBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.B
 	if header == nil {
 		return nil, nil, errors.New("header not found")
 	}
-	stateDb, err := b.eth.BlockChain().StateAt(header.Root)
+	stateDb, err := b.stateAt(header)
 	return stateDb, header, err
 }
 
+// stateAt returns the state of the given block, falling back to the flat state
+// diff history if the state trie is not available anymore. If neither is
+// available, the original error of the state trie is returned.
+func (b *EthAPIBackend) stateAt(header *types.Header) (*state.StateDB, error) {
+	stateDb, err := b.eth.BlockChain().StateAt(header.Root)
+	if err == nil {
+		return stateDb, nil
+	}
+	historic, herr := b.eth.BlockChain().HistoricStateAt(header)
+	if herr != nil {
+		log.Debug("Historic state unavailable", "number", header.Number, "err", herr)
+		return nil, err
+	}
+	return historic, nil
+}
+
 func (b *EthAPIBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
 	if blockNr, ok := blockNrOrHash.Number(); ok {
 		return b.StateAndHeaderByNumber(ctx, blockNr)
@@ -225,20 +259,38 @@ func (b *EthAPIBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockN
 		if blockNrOrHash.RequireCanonical && b.eth.blockchain.GetCanonicalHash(header.Number.Uint64()) != hash {
 			return nil, nil, errors.New("hash is not currently canonical")
 		}
-		stateDb, err := b.eth.BlockChain().StateAt(header.Root)
+		stateDb, err := b.stateAt(header)
 		return stateDb, header, err
 	}
 	return nil, nil, errors.New("invalid arguments; neither block nor hash specified")
 }
 
 func (b *EthAPIBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
-	return b.eth.blockchain.GetReceiptsByHash(hash), nil
+	receipts := b.eth.blockchain.GetReceiptsByHash(hash)
+	if receipts == nil {
+		if header := b.eth.blockchain.GetHeaderByHash(hash); header != nil {
+			return nil, b.historyPruned(header.Number.Uint64())
+		}
+	}
+	return receipts, nil
 }
 
 func (b *EthAPIBackend) GetLogs(ctx context.Context, hash common.Hash, number uint64) ([][]*types.Log, error) {
+	if err := b.historyPruned(number); err != nil {
+		return nil, err
+	}
 	return rawdb.ReadLogs(b.eth.chainDb, hash, number, b.ChainConfig()), nil
 }
 
+// historyPruned returns an error if the body and receipts of the block with the
+// given number were expired from the local chain, nil otherwise.
+func (b *EthAPIBackend) historyPruned(number uint64) error {
+	if tail := b.eth.blockchain.HistoryTail(); number < tail {
+		return &ethapi.PrunedHistoryError{Tail: tail}
+	}
+	return nil
+}
+
 func (b *EthAPIBackend) GetTd(ctx context.Context, hash common.Hash) *big.Int {
 	if header := b.eth.blockchain.GetHeaderByHash(hash); header != nil {
 		return b.eth.blockchain.GetTd(hash, header.Number.Uint64())
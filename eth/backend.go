@@ -72,6 +72,7 @@ type Ethereum struct {
 	ethDialCandidates  enode.Iterator
 	snapDialCandidates enode.Iterator
 	merger             *consensus.Merger
+	pruner             *pruner.OnlinePruner
 
 	// DB interfaces
 	chainDb ethdb.Database // Block chain database
@@ -176,6 +177,10 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 			rawdb.WriteDatabaseVersion(chainDb, core.BlockChainVersion)
 		}
 	}
+	scheme, err := rawdb.ParseStateScheme(config.StateScheme, chainDb)
+	if err != nil {
+		return nil, err
+	}
 	var (
 		vmConfig = vm.Config{
 			EnablePreimageRecording: config.EnablePreimageRecording,
@@ -190,6 +195,10 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 			TrieTimeLimit:       config.TrieTimeout,
 			SnapshotLimit:       config.SnapshotCache,
 			Preimages:           config.Preimages,
+			StateScheme:         scheme,
+			StateHistory:        config.StateHistory,
+			StateDiffs:          config.StateDiffs,
+			HistoryKeep:         config.HistoryKeep,
 		}
 	)
 	// Override the chain config with provided settings.
@@ -202,6 +211,7 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		return nil, err
 	}
 	eth.bloomIndexer.Start(eth.blockchain)
+	eth.pruner = pruner.NewOnlinePruner(chainDb, eth.blockchain.TrieDB(), eth.blockchain.Snapshots(), pruner.DefaultOnlineConfig)
 
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
@@ -486,9 +496,18 @@ func (s *Ethereum) SyncMode() downloader.SyncMode {
 // Protocols returns all the currently configured
 // network protocols to start.
 func (s *Ethereum) Protocols() []p2p.Protocol {
-	protos := eth.MakeProtocols((*ethHandler)(s.handler), s.networkID, s.ethDialCandidates)
+	protos := eth.MakeProtocols((*ethHandler)(s.handler), s.networkID, s.ethDialCandidates, p2p.NewServeLimiter(s.config.EthServeLimit))
+	if s.config.NoPruning {
+		for i := range protos {
+			protos[i].Topics = []string{eth.ArchiveTopic}
+		}
+	}
 	if s.config.SnapshotCache > 0 {
-		protos = append(protos, snap.MakeProtocols((*snapHandler)(s.handler), s.snapDialCandidates)...)
+		snapProtos := snap.MakeProtocols((*snapHandler)(s.handler), s.snapDialCandidates, p2p.NewServeLimiter(s.config.SnapServeLimit))
+		for i := range snapProtos {
+			snapProtos[i].Topics = []string{snap.ServingTopic}
+		}
+		protos = append(protos, snapProtos...)
 	}
 	return protos
 }
@@ -530,6 +549,7 @@ func (s *Ethereum) Stop() error {
 	close(s.closeBloomHandler)
 	s.txPool.Stop()
 	s.miner.Close()
+	s.pruner.Stop()
 	s.blockchain.Stop()
 	s.engine.Close()
 
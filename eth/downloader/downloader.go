@@ -408,6 +408,11 @@ func (d *Downloader) synchronise(id string, hash common.Hash, td, ttd *big.Int,
 		if snapshots := d.blockchain.Snapshots(); snapshots != nil { // Only nil in tests
 			snapshots.Disable()
 		}
+		// The synced state is written directly into the disk, drop the states
+		// held by the trie database as its nodes might be overwritten.
+		if err := d.blockchain.TrieDB().Disable(); err != nil {
+			return err
+		}
 	}
 	// Reset the queue, peer set and wake channels to clean any internal leftover state
 	d.queue.Reset(blockCacheMaxItems, blockCacheInitialItems)
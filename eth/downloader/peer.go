@@ -181,6 +181,24 @@ func (p *peerConnection) Lacks(hash common.Hash) bool {
 	return ok
 }
 
+// blockRanger is implemented by the peers advertising the range of blocks they
+// are able to serve.
+type blockRanger interface {
+	BlockRange() (earliest uint64, latest uint64, ok bool)
+}
+
+// Serves retrieves whether the peer is able to serve the block bodies and receipts
+// of the given block, based on the block range it advertised. Peers that do not
+// advertise their ranges are assumed to serve everything.
+func (p *peerConnection) Serves(number uint64) bool {
+	ranger, ok := p.peer.(blockRanger)
+	if !ok {
+		return true
+	}
+	earliest, latest, ok := ranger.BlockRange()
+	return !ok || (number >= earliest && number <= latest)
+}
+
 // peeringEvent is sent on the peer event feed when a remote peer connects or
 // disconnects.
 type peeringEvent struct {
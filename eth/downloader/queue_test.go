@@ -91,6 +91,45 @@ func dummyPeer(id string) *peerConnection {
 	return p
 }
 
+// rangedPeer is a dummy peer advertising the range of blocks it can serve.
+type rangedPeer struct {
+	Peer
+	earliest, latest uint64
+}
+
+func (p *rangedPeer) BlockRange() (uint64, uint64, bool) { return p.earliest, p.latest, true }
+
+// Tests that block data is only reserved from peers advertising to serve it.
+func TestReserveBlockRange(t *testing.T) {
+	q := newQueue(100, 100)
+	q.Prepare(1, FullSync)
+
+	headers := chain.headers()
+	hashes := make([]common.Hash, len(headers))
+	for i, header := range headers {
+		hashes[i] = header.Hash()
+	}
+	q.Schedule(headers, hashes, 1)
+
+	peer := dummyPeer("peer-1")
+	peer.peer = &rangedPeer{earliest: 5, latest: 20}
+
+	fetchReq, _, _ := q.ReserveBodies(peer, 50)
+	if fetchReq == nil || len(fetchReq.Headers) == 0 {
+		t.Fatal("no bodies reserved")
+	}
+	for _, header := range fetchReq.Headers {
+		if number := header.Number.Uint64(); number < 5 || number > 20 {
+			t.Fatalf("reserved body %d outside of advertised range", number)
+		}
+	}
+	// A peer not advertising its range should pick up the rest
+	fetchReq, _, _ = q.ReserveBodies(dummyPeer("peer-2"), 50)
+	if fetchReq == nil || fetchReq.Headers[0].Number.Uint64() != 1 {
+		t.Fatalf("skipped bodies not reserved by other peer")
+	}
+}
+
 func TestBasics(t *testing.T) {
 	numOfBlocks := len(emptyChain.blocks)
 	numOfReceipts := len(emptyChain.blocks) / 2
@@ -73,6 +73,7 @@ var Defaults = Config{
 	},
 	NetworkId:               622277,
 	TxLookupLimit:           2350000,
+	StateHistory:            90000,
 	LightServ:               20,
 	LightPeers:              100,
 	UltraLightFraction:      75,
@@ -133,11 +134,30 @@ type Config struct {
 	EthDiscoveryURLs  []string
 	SnapDiscoveryURLs []string
 
+	// Bandwidth limits in bytes per second for serving the `eth` and `snap`
+	// requests of all remote peers combined. Zero means unlimited.
+	EthServeLimit  uint64 `toml:",omitempty"`
+	SnapServeLimit uint64 `toml:",omitempty"`
+
 	NoPruning  bool // Whether to disable pruning and flush everything to disk
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
 
+	// StateScheme is the scheme used to store the state trie nodes, either
+	// hash or path. Empty selects the scheme of the existing database.
+	StateScheme  string `toml:",omitempty"`
+	StateHistory uint64 `toml:",omitempty"` // The maximum number of blocks from head whose state histories are reserved.
+
+	// StateDiffs enables keeping the flat state diffs of every block, serving
+	// historical state reads without an archive node.
+	StateDiffs bool `toml:",omitempty"`
+
+	// HistoryKeep is the number of recent blocks to retain the bodies and
+	// receipts for, older ones are expired from the ancient store. The header
+	// chain is always retained. Zero keeps the entire history.
+	HistoryKeep uint64 `toml:",omitempty"`
+
 	// RequiredBlocks is a set of block number -> hash mappings which must be in the
 	// canonical chain of all remote peers. Setting the option makes geth verify the
 	// presence of these blocks for every new peer connection.
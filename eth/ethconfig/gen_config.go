@@ -23,9 +23,15 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		SyncMode                downloader.SyncMode
 		EthDiscoveryURLs        []string
 		SnapDiscoveryURLs       []string
+		EthServeLimit           uint64 `toml:",omitempty"`
+		SnapServeLimit          uint64 `toml:",omitempty"`
 		NoPruning               bool
 		NoPrefetch              bool
 		TxLookupLimit           uint64                 `toml:",omitempty"`
+		StateScheme             string                 `toml:",omitempty"`
+		StateHistory            uint64                 `toml:",omitempty"`
+		StateDiffs              bool                   `toml:",omitempty"`
+		HistoryKeep             uint64                 `toml:",omitempty"`
 		RequiredBlocks          map[uint64]common.Hash `toml:"-"`
 		LightServ               int                    `toml:",omitempty"`
 		LightIngress            int                    `toml:",omitempty"`
@@ -68,9 +74,15 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.SyncMode = c.SyncMode
 	enc.EthDiscoveryURLs = c.EthDiscoveryURLs
 	enc.SnapDiscoveryURLs = c.SnapDiscoveryURLs
+	enc.EthServeLimit = c.EthServeLimit
+	enc.SnapServeLimit = c.SnapServeLimit
 	enc.NoPruning = c.NoPruning
 	enc.NoPrefetch = c.NoPrefetch
 	enc.TxLookupLimit = c.TxLookupLimit
+	enc.StateScheme = c.StateScheme
+	enc.StateHistory = c.StateHistory
+	enc.StateDiffs = c.StateDiffs
+	enc.HistoryKeep = c.HistoryKeep
 	enc.RequiredBlocks = c.RequiredBlocks
 	enc.LightServ = c.LightServ
 	enc.LightIngress = c.LightIngress
@@ -117,9 +129,15 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		SyncMode                *downloader.SyncMode
 		EthDiscoveryURLs        []string
 		SnapDiscoveryURLs       []string
+		EthServeLimit           *uint64 `toml:",omitempty"`
+		SnapServeLimit          *uint64 `toml:",omitempty"`
 		NoPruning               *bool
 		NoPrefetch              *bool
 		TxLookupLimit           *uint64                `toml:",omitempty"`
+		StateScheme             *string                `toml:",omitempty"`
+		StateHistory            *uint64                `toml:",omitempty"`
+		StateDiffs              *bool                  `toml:",omitempty"`
+		HistoryKeep             *uint64                `toml:",omitempty"`
 		RequiredBlocks          map[uint64]common.Hash `toml:"-"`
 		LightServ               *int                   `toml:",omitempty"`
 		LightIngress            *int                   `toml:",omitempty"`
@@ -175,6 +193,12 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.SnapDiscoveryURLs != nil {
 		c.SnapDiscoveryURLs = dec.SnapDiscoveryURLs
 	}
+	if dec.EthServeLimit != nil {
+		c.EthServeLimit = *dec.EthServeLimit
+	}
+	if dec.SnapServeLimit != nil {
+		c.SnapServeLimit = *dec.SnapServeLimit
+	}
 	if dec.NoPruning != nil {
 		c.NoPruning = *dec.NoPruning
 	}
@@ -184,6 +208,18 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.TxLookupLimit != nil {
 		c.TxLookupLimit = *dec.TxLookupLimit
 	}
+	if dec.StateScheme != nil {
+		c.StateScheme = *dec.StateScheme
+	}
+	if dec.StateHistory != nil {
+		c.StateHistory = *dec.StateHistory
+	}
+	if dec.StateDiffs != nil {
+		c.StateDiffs = *dec.StateDiffs
+	}
+	if dec.HistoryKeep != nil {
+		c.HistoryKeep = *dec.HistoryKeep
+	}
 	if dec.RequiredBlocks != nil {
 		c.RequiredBlocks = dec.RequiredBlocks
 	}
@@ -0,0 +1,538 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ethsim runs networks of in-process full nodes for testing block
+// propagation and synchronisation under controlled network conditions.
+//
+// All nodes run on a p2p/simulations network built on the SimAdapter, connected
+// in a static topology whose links can be given latency and packet loss. The
+// chains are generated with core.GenerateChain and sealed by a fake ethash, so
+// a simulation with the same configuration always produces the same blocks.
+package ethsim
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/consensus/ethash"
+	"github.com/rethereum-blockchain/go-rethereum/core"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/eth"
+	"github.com/rethereum-blockchain/go-rethereum/eth/downloader"
+	"github.com/rethereum-blockchain/go-rethereum/eth/ethconfig"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/node"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/simulations"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/simulations/adapters"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/simulations/pipes"
+	"github.com/rethereum-blockchain/go-rethereum/params"
+)
+
+const (
+	serviceName    = "eth"
+	defaultTimeout = 10 * time.Second
+	pollInterval   = 10 * time.Millisecond
+)
+
+var errTimeout = errors.New("simulation timed out")
+
+// Config is the configuration of a simulation.
+type Config struct {
+	Nodes    int                   // Number of nodes started with the simulation
+	Topology Topology              // Connections between the nodes (default: full mesh)
+	Link     pipes.Link            // Quality of all links
+	Links    map[[2]int]pipes.Link // Per-link overrides, keyed by node indexes in ascending order
+	Seed     int64                 // Seed of the node keys and the packet loss
+	Blocks   int                   // Length of the chain all initial nodes start with
+	Genesis  *core.Genesis         // Genesis of the chain (default: ethash test chain)
+	SyncMode downloader.SyncMode   // Sync mode of the nodes (default: full sync)
+	Timeout  time.Duration         // Maximum time to wait for a block round or a sync
+}
+
+// Topology returns the connections of a network of n nodes as pairs of node
+// indexes.
+type Topology func(n int) [][2]int
+
+// Full connects every node to every other node.
+func Full(n int) [][2]int {
+	var edges [][2]int
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			edges = append(edges, [2]int{i, j})
+		}
+	}
+	return edges
+}
+
+// Chain connects the nodes in a line.
+func Chain(n int) [][2]int {
+	var edges [][2]int
+	for i := 0; i < n-1; i++ {
+		edges = append(edges, [2]int{i, i + 1})
+	}
+	return edges
+}
+
+// Ring connects the nodes in a circle.
+func Ring(n int) [][2]int {
+	edges := Chain(n)
+	if n > 2 {
+		edges = append(edges, [2]int{0, n - 1})
+	}
+	return edges
+}
+
+// Star connects all nodes to the first one.
+func Star(n int) [][2]int {
+	var edges [][2]int
+	for i := 1; i < n; i++ {
+		edges = append(edges, [2]int{0, i})
+	}
+	return edges
+}
+
+// Simulation is a running network of full nodes.
+type Simulation struct {
+	config  Config
+	genesis *core.Genesis
+	chain   []*types.Block // Blocks the initial nodes start with
+	gendb   ethdb.Database // State of all blocks generated during the simulation
+
+	adapter *adapters.SimAdapter
+	network *simulations.Network
+
+	lock     sync.Mutex
+	ids      []enode.ID
+	index    map[enode.ID]int
+	backends map[enode.ID]*eth.Ethereum
+	arrivals map[common.Hash]map[int]time.Time // First import of each block per node
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a simulation and starts its initial nodes, each with the chain of
+// the configured length, connected in the configured topology.
+func New(config Config) (*Simulation, error) {
+	if config.Topology == nil {
+		config.Topology = Full
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	genesis := config.Genesis
+	if genesis == nil {
+		genesis = &core.Genesis{
+			Config:     params.TestChainConfig,
+			Difficulty: params.MinimumDifficulty,
+		}
+	}
+	gendb, chain, _ := core.GenerateChainWithGenesis(genesis, ethash.NewFaker(), config.Blocks, nil)
+
+	s := &Simulation{
+		config:   config,
+		genesis:  genesis,
+		chain:    chain,
+		gendb:    gendb,
+		index:    make(map[enode.ID]int),
+		backends: make(map[enode.ID]*eth.Ethereum),
+		arrivals: make(map[common.Hash]map[int]time.Time),
+		quit:     make(chan struct{}),
+	}
+	s.adapter = adapters.NewSimAdapterWithLinks(adapters.LifecycleConstructors{serviceName: s.newBackend}, s.link)
+	s.network = simulations.NewNetwork(s.adapter, &simulations.NetworkConfig{ID: "ethsim", DefaultService: serviceName})
+
+	for i := 0; i < config.Nodes; i++ {
+		if _, err := s.addNode(chain); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if err := s.connect(config.Topology(config.Nodes)); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close stops all nodes of the simulation.
+func (s *Simulation) Close() {
+	close(s.quit)
+	s.network.Shutdown()
+	s.wg.Wait()
+}
+
+// Len returns the number of nodes in the simulation.
+func (s *Simulation) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.ids)
+}
+
+// Node returns the Ethereum service of a node.
+func (s *Simulation) Node(i int) *eth.Ethereum {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.backends[s.ids[i]]
+}
+
+// Network returns the underlying p2p simulation network.
+func (s *Simulation) Network() *simulations.Network {
+	return s.network
+}
+
+// newBackend is the service constructor of the simulation nodes.
+func (s *Simulation) newBackend(ctx *adapters.ServiceContext, stack *node.Node) (node.Lifecycle, error) {
+	config := ethconfig.Defaults
+	config.Genesis = s.genesis
+	config.NetworkId = s.genesis.Config.ChainID.Uint64()
+	config.SyncMode = s.config.SyncMode
+	config.NoPruning = true // Side blocks are only reported if their parent state is present
+	config.Ethash.PowMode = ethash.ModeFake
+	config.TrieCleanCache = 16
+	config.TrieDirtyCache = 16
+	config.SnapshotCache = 16
+
+	backend, err := eth.New(stack, &config)
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	s.backends[ctx.Config.ID] = backend
+	s.lock.Unlock()
+	return backend, nil
+}
+
+// link creates the connection between two nodes, applying the link quality
+// configured for them.
+func (s *Simulation) link(dialer, dest enode.ID) (net.Conn, net.Conn, error) {
+	s.lock.Lock()
+	a, b := s.index[dialer], s.index[dest]
+	s.lock.Unlock()
+
+	if a > b {
+		a, b = b, a
+	}
+	link := s.config.Link
+	if l, ok := s.config.Links[[2]int{a, b}]; ok {
+		link = l
+	}
+	// Every link gets its own loss sequence.
+	return pipes.LinkPipe(link, s.config.Seed+int64(a)<<32+int64(b)<<1)
+}
+
+// nodeKey derives the private key of a node from the simulation seed.
+func (s *Simulation) nodeKey(i int) (*ecdsa.PrivateKey, error) {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(s.config.Seed))
+	binary.BigEndian.PutUint64(buf[8:], uint64(i))
+	return crypto.ToECDSA(crypto.Keccak256(buf[:]))
+}
+
+// addNode creates and starts a new node, importing the given chain into it.
+func (s *Simulation) addNode(chain []*types.Block) (int, error) {
+	s.lock.Lock()
+	i := len(s.ids)
+	s.lock.Unlock()
+
+	key, err := s.nodeKey(i)
+	if err != nil {
+		return 0, err
+	}
+	config := &adapters.NodeConfig{
+		ID:         enode.PubkeyToIDV4(&key.PublicKey),
+		PrivateKey: key,
+		Name:       fmt.Sprintf("node%02d", i),
+		Port:       30303, // Not listened on, but the dialer requires a port
+		Lifecycles: []string{serviceName},
+	}
+	s.lock.Lock()
+	s.ids = append(s.ids, config.ID)
+	s.index[config.ID] = i
+	s.lock.Unlock()
+
+	if _, err := s.network.NewNodeWithConfig(config); err != nil {
+		return 0, err
+	}
+	if err := s.network.Start(config.ID); err != nil {
+		return 0, err
+	}
+	backend := s.Node(i)
+	if len(chain) > 0 {
+		if _, err := backend.BlockChain().InsertChain(chain); err != nil {
+			return 0, fmt.Errorf("node %d: failed to import chain: %v", i, err)
+		}
+	}
+	s.wg.Add(1)
+	go s.watch(i, backend.BlockChain())
+	return i, nil
+}
+
+// connect connects the given pairs of nodes and waits until they are all peered
+// over the eth protocol.
+func (s *Simulation) connect(edges [][2]int) error {
+	for _, e := range edges {
+		if err := s.network.Connect(s.id(e[0]), s.id(e[1])); err != nil {
+			return err
+		}
+	}
+	return s.waitFor(func() bool {
+		for _, e := range edges {
+			if !s.peered(e[0], e[1]) || !s.peered(e[1], e[0]) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (s *Simulation) id(i int) enode.ID {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.ids[i]
+}
+
+// peered reports whether node i finished the eth handshake with node j.
+func (s *Simulation) peered(i, j int) bool {
+	sn, ok := s.adapter.GetNode(s.id(i))
+	if !ok || sn.Server() == nil {
+		return false
+	}
+	id := s.id(j).String()
+	for _, info := range sn.Server().PeersInfo() {
+		if info.ID != id {
+			continue
+		}
+		if proto, ok := info.Protocols[serviceName]; ok && proto != "handshake" {
+			return true
+		}
+	}
+	return false
+}
+
+// watch records the first import of every block by a node.
+func (s *Simulation) watch(i int, chain *core.BlockChain) {
+	defer s.wg.Done()
+
+	var (
+		headCh  = make(chan core.ChainEvent, 64)
+		sideCh  = make(chan core.ChainSideEvent, 64)
+		headSub = chain.SubscribeChainEvent(headCh)
+		sideSub = chain.SubscribeChainSideEvent(sideCh)
+	)
+	defer headSub.Unsubscribe()
+	defer sideSub.Unsubscribe()
+
+	for {
+		select {
+		case ev := <-headCh:
+			s.arrived(i, ev.Block.Hash())
+		case ev := <-sideCh:
+			s.arrived(i, ev.Block.Hash())
+		case <-headSub.Err():
+			return
+		case <-sideSub.Err():
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *Simulation) arrived(i int, hash common.Hash) {
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	nodes := s.arrivals[hash]
+	if nodes == nil {
+		nodes = make(map[int]time.Time)
+		s.arrivals[hash] = nodes
+	}
+	if _, ok := nodes[i]; !ok {
+		nodes[i] = now
+	}
+}
+
+// arrival returns the time a node first imported a block.
+func (s *Simulation) arrival(i int, hash common.Hash) (time.Time, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	at, ok := s.arrivals[hash][i]
+	return at, ok
+}
+
+// waitFor polls the condition until it holds or the timeout expires.
+func (s *Simulation) waitFor(cond func() bool) error {
+	deadline := time.Now().Add(s.config.Timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return errTimeout
+		}
+		select {
+		case <-time.After(pollInterval):
+		case <-s.quit:
+			return errors.New("simulation closed")
+		}
+	}
+	return nil
+}
+
+// minerAddress is the coinbase of the blocks produced by a node.
+func minerAddress(i int) common.Address {
+	return common.BigToAddress(big.NewInt(int64(i + 1)))
+}
+
+// Propagate runs the given number of block production rounds. In every round,
+// each of the miners produces a block on top of its current head and broadcasts
+// it, then the round lasts until every node imported all of the round's blocks,
+// or the timeout expires. Miners producing blocks at the same height compete,
+// turning all but one of them into uncles.
+//
+// The uncle rate is measured against the canonical chain of the first node.
+func (s *Simulation) Propagate(rounds int, miners ...int) (*PropagationStats, error) {
+	if len(miners) == 0 {
+		miners = []int{0}
+	}
+	var (
+		stats     = new(PropagationStats)
+		published = make(map[common.Hash]time.Time)
+		produced  []*types.Block
+	)
+	for r := 0; r < rounds; r++ {
+		var blocks []*types.Block
+		for _, m := range miners {
+			block, err := s.produce(m)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, block)
+		}
+		for i, m := range miners {
+			backend := s.Node(m)
+			published[blocks[i].Hash()] = time.Now()
+			if _, err := backend.BlockChain().InsertChain(types.Blocks{blocks[i]}); err != nil {
+				return nil, fmt.Errorf("miner %d: failed to import block: %v", m, err)
+			}
+			backend.EventMux().Post(core.NewMinedBlockEvent{Block: blocks[i]})
+		}
+		produced = append(produced, blocks...)
+
+		// Wait for the round to be delivered everywhere. Missing deliveries are
+		// accounted below, a timeout doesn't abort the simulation.
+		n := s.Len()
+		s.waitFor(func() bool {
+			for _, block := range blocks {
+				for i := 0; i < n; i++ {
+					if _, ok := s.arrival(i, block.Hash()); !ok {
+						return false
+					}
+				}
+			}
+			return true
+		})
+	}
+	// Collect the propagation delays and check which blocks made it.
+	var (
+		n         = s.Len()
+		reference = s.Node(0).BlockChain()
+	)
+	for i, block := range produced {
+		miner := miners[i%len(miners)]
+		for j := 0; j < n; j++ {
+			if j == miner {
+				continue
+			}
+			at, ok := s.arrival(j, block.Hash())
+			if !ok {
+				stats.Missed++
+				continue
+			}
+			stats.Latencies = append(stats.Latencies, at.Sub(published[block.Hash()]))
+		}
+		if reference.GetCanonicalHash(block.NumberU64()) != block.Hash() {
+			stats.Stale++
+		}
+	}
+	stats.Blocks = len(produced)
+	stats.sort()
+	return stats, nil
+}
+
+// produce generates a new block on top of the current head of a node.
+func (s *Simulation) produce(miner int) (*types.Block, error) {
+	chain := s.Node(miner).BlockChain()
+	head := chain.CurrentBlock()
+	parent := chain.GetBlock(head.Hash(), head.Number.Uint64())
+	if parent == nil {
+		return nil, fmt.Errorf("miner %d: missing head block %x", miner, head.Hash())
+	}
+	blocks, _ := core.GenerateChain(s.genesis.Config, parent, ethash.NewFaker(), s.gendb, 1, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(minerAddress(miner))
+	})
+	return blocks[0], nil
+}
+
+// Join adds a node with an empty chain to the simulation, connects it to the
+// given nodes (default: the first one) and waits until it synchronised up to
+// the highest head among them, returning the time the sync took. The new node
+// gets the next free index.
+//
+// Note, the nodes only start syncing once they have enough peers or their
+// forced sync cycle passes, so joining few peers includes a wait.
+func (s *Simulation) Join(peers ...int) (time.Duration, error) {
+	if len(peers) == 0 {
+		peers = []int{0}
+	}
+	var target uint64
+	for _, p := range peers {
+		if number := s.Node(p).BlockChain().CurrentBlock().Number.Uint64(); number > target {
+			target = number
+		}
+	}
+	i, err := s.addNode(nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+
+	edges := make([][2]int, 0, len(peers))
+	for _, p := range peers {
+		edges = append(edges, [2]int{i, p})
+	}
+	if err := s.connect(edges); err != nil {
+		return 0, err
+	}
+	chain := s.Node(i).BlockChain()
+	if err := s.waitFor(func() bool { return chain.CurrentBlock().Number.Uint64() >= target }); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
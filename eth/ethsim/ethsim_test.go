@@ -0,0 +1,97 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethsim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/p2p/simulations/pipes"
+)
+
+func TestTopologies(t *testing.T) {
+	tests := []struct {
+		topology Topology
+		edges    int
+	}{
+		{Full, 10},
+		{Chain, 4},
+		{Ring, 5},
+		{Star, 4},
+	}
+	for i, tt := range tests {
+		if edges := tt.topology(5); len(edges) != tt.edges {
+			t.Errorf("test %d: wrong number of edges: have %d, want %d", i, len(edges), tt.edges)
+		}
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	sim, err := New(Config{
+		Nodes:    5,
+		Topology: Ring,
+		Link:     pipes.Link{Latency: 5 * time.Millisecond, Loss: 0.05},
+		Seed:     1,
+		Blocks:   16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	// A single miner never produces uncles.
+	stats, err := sim.Propagate(3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Blocks != 3 || stats.Stale != 0 || stats.Missed != 0 {
+		t.Fatalf("wrong single miner stats: %v", stats)
+	}
+	if len(stats.Latencies) != 3*4 {
+		t.Fatalf("wrong number of deliveries: have %d, want %d", len(stats.Latencies), 3*4)
+	}
+	if stats.Percentile(0) < 5*time.Millisecond {
+		t.Fatalf("delivery faster than link latency: %v", stats.Percentile(0))
+	}
+	// Competing miners produce one uncle per round.
+	stats, err = sim.Propagate(2, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Blocks != 4 || stats.Stale != 2 {
+		t.Fatalf("wrong competing miner stats: %v", stats)
+	}
+	t.Log(stats)
+}
+
+func TestJoin(t *testing.T) {
+	sim, err := New(Config{Nodes: 5, Blocks: 64, Seed: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	elapsed, err := sim.Join(0, 1, 2, 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := sim.Node(5).BlockChain().CurrentBlock()
+	if head.Number.Uint64() != 64 || head.Hash() != sim.Node(0).BlockChain().CurrentBlock().Hash() {
+		t.Fatalf("joined node not synced: head #%d %x", head.Number, head.Hash())
+	}
+	t.Log("sync time", elapsed)
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethsim
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PropagationStats summarizes the propagation of the blocks produced during a
+// simulation.
+type PropagationStats struct {
+	Blocks    int             // Number of blocks produced
+	Stale     int             // Produced blocks not in the canonical chain
+	Missed    int             // Block deliveries that didn't happen within the timeout
+	Latencies []time.Duration // Delays between publishing and importing a block, sorted
+}
+
+func (st *PropagationStats) sort() {
+	sort.Slice(st.Latencies, func(i, j int) bool { return st.Latencies[i] < st.Latencies[j] })
+}
+
+// UncleRate returns the share of the produced blocks which didn't make it into
+// the canonical chain.
+func (st *PropagationStats) UncleRate() float64 {
+	if st.Blocks == 0 {
+		return 0
+	}
+	return float64(st.Stale) / float64(st.Blocks)
+}
+
+// Mean returns the average propagation latency.
+func (st *PropagationStats) Mean() time.Duration {
+	if len(st.Latencies) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, l := range st.Latencies {
+		sum += l
+	}
+	return sum / time.Duration(len(st.Latencies))
+}
+
+// Percentile returns the propagation latency below which the given share (0-1)
+// of the deliveries happened.
+func (st *PropagationStats) Percentile(p float64) time.Duration {
+	if len(st.Latencies) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(st.Latencies)))
+	if i >= len(st.Latencies) {
+		i = len(st.Latencies) - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return st.Latencies[i]
+}
+
+// String implements fmt.Stringer.
+func (st *PropagationStats) String() string {
+	return fmt.Sprintf("blocks=%d uncles=%.2f%% missed=%d mean=%v p50=%v p95=%v max=%v",
+		st.Blocks, 100*st.UncleRate(), st.Missed, st.Mean(), st.Percentile(0.5), st.Percentile(0.95), st.Percentile(1))
+}
@@ -64,6 +64,13 @@ var (
 	headerFilterOutMeter = metrics.NewRegisteredMeter("eth/fetcher/block/filter/headers/out", nil)
 	bodyFilterInMeter    = metrics.NewRegisteredMeter("eth/fetcher/block/filter/bodies/in", nil)
 	bodyFilterOutMeter   = metrics.NewRegisteredMeter("eth/fetcher/block/filter/bodies/out", nil)
+
+	compactInMeter       = metrics.NewRegisteredMeter("eth/fetcher/block/compact/in", nil)
+	compactTxHitMeter    = metrics.NewRegisteredMeter("eth/fetcher/block/compact/txs/hit", nil)
+	compactTxMissMeter   = metrics.NewRegisteredMeter("eth/fetcher/block/compact/txs/miss", nil)
+	compactFetchMeter    = metrics.NewRegisteredMeter("eth/fetcher/block/compact/fetch", nil)
+	compactCompleteMeter = metrics.NewRegisteredMeter("eth/fetcher/block/compact/complete", nil)
+	compactFailMeter     = metrics.NewRegisteredMeter("eth/fetcher/block/compact/fail", nil)
 )
 
 var errTerminated = errors.New("terminated")
@@ -80,6 +87,15 @@ type headerRequesterFn func(common.Hash, chan *eth.Response) (*eth.Request, erro
 // bodyRequesterFn is a callback type for sending a body retrieval request.
 type bodyRequesterFn func([]common.Hash, chan *eth.Response) (*eth.Request, error)
 
+// compactTxsRequesterFn is a callback type for sending a request for the missing
+// transactions of a compact block.
+type compactTxsRequesterFn func(common.Hash, []uint64, chan *eth.Response) (*eth.Request, error)
+
+// compactTxsResolverFn is a callback type for looking up the transactions of a
+// compact block locally, returning them (nil where not found) along with the
+// indexes of the missing ones.
+type compactTxsResolverFn func() ([]*types.Transaction, []uint64)
+
 // headerVerifierFn is a callback type to verify a block's header for fast propagation.
 type headerVerifierFn func(header *types.Header) error
 
@@ -112,6 +128,24 @@ type blockAnnounce struct {
 	fetchBodies bodyRequesterFn   // Fetcher function to retrieve the body of an announced block
 }
 
+// compactBlock is a block propagated in compact form, with the body partially
+// reconstructed from the local transaction pool.
+type compactBlock struct {
+	header  *types.Header        // Header of the propagated block
+	uncles  []*types.Header      // Uncles of the propagated block
+	txs     []*types.Transaction // Transactions of the block, nil where not found locally
+	missing []uint64             // Indexes of the transactions not found locally
+	fetched bool                 // Whether the missing transactions were delivered by the peer
+	time    time.Time            // Timestamp of the propagation
+
+	origin string // Identifier of the peer propagating the block
+
+	resolveTxs  compactTxsResolverFn  // Lookup function to find the transactions locally
+	fetchTxs    compactTxsRequesterFn // Fetcher function to retrieve the missing transactions
+	fetchHeader headerRequesterFn     // Fetcher function to retrieve the header if reconstruction fails
+	fetchBodies bodyRequesterFn       // Fetcher function to retrieve the body if reconstruction fails
+}
+
 // headerFilterTask represents a batch of headers needing fetcher filtering.
 type headerFilterTask struct {
 	peer    string          // The source peer of block headers
@@ -158,8 +192,10 @@ type BlockFetcher struct {
 	light bool // The indicator whether it's a light fetcher or normal one.
 
 	// Various event channels
-	notify chan *blockAnnounce
-	inject chan *blockOrHeaderInject
+	notify      chan *blockAnnounce
+	inject      chan *blockOrHeaderInject
+	compact     chan *compactBlock
+	compactDone chan *compactBlock
 
 	headerFilter chan chan *headerFilterTask
 	bodyFilter   chan chan *bodyFilterTask
@@ -173,6 +209,7 @@ type BlockFetcher struct {
 	fetching   map[common.Hash]*blockAnnounce   // Announced blocks, currently fetching
 	fetched    map[common.Hash][]*blockAnnounce // Blocks with headers fetched, scheduled for body retrieval
 	completing map[common.Hash]*blockAnnounce   // Blocks with headers, currently body-completing
+	compacting map[common.Hash]*compactBlock    // Compact blocks, currently fetching missing transactions
 
 	// Block cache
 	queue  *prque.Prque[int64, *blockOrHeaderInject] // Queue containing the import operations (block number sorted)
@@ -203,6 +240,8 @@ func NewBlockFetcher(light bool, getHeader HeaderRetrievalFn, getBlock blockRetr
 		light:          light,
 		notify:         make(chan *blockAnnounce),
 		inject:         make(chan *blockOrHeaderInject),
+		compact:        make(chan *compactBlock),
+		compactDone:    make(chan *compactBlock),
 		headerFilter:   make(chan chan *headerFilterTask),
 		bodyFilter:     make(chan chan *bodyFilterTask),
 		done:           make(chan common.Hash),
@@ -212,6 +251,7 @@ func NewBlockFetcher(light bool, getHeader HeaderRetrievalFn, getBlock blockRetr
 		fetching:       make(map[common.Hash]*blockAnnounce),
 		fetched:        make(map[common.Hash][]*blockAnnounce),
 		completing:     make(map[common.Hash]*blockAnnounce),
+		compacting:     make(map[common.Hash]*compactBlock),
 		queue:          prque.New[int64, *blockOrHeaderInject](nil),
 		queues:         make(map[string]int),
 		queued:         make(map[common.Hash]*blockOrHeaderInject),
@@ -272,6 +312,31 @@ func (f *BlockFetcher) Enqueue(peer string, block *types.Block) error {
 	}
 }
 
+// EnqueueCompact schedules a block propagated in compact form for import. Unless
+// the block is already known or too far from the chain head, its transactions
+// are looked up locally with the resolver and the missing ones are requested
+// from the peer before the block is assembled. If the block can't be
+// reconstructed, its body is fetched like for an announced block.
+func (f *BlockFetcher) EnqueueCompact(peer string, header *types.Header, uncles []*types.Header, time time.Time,
+	txsResolver compactTxsResolverFn, txsFetcher compactTxsRequesterFn, headerFetcher headerRequesterFn, bodyFetcher bodyRequesterFn) error {
+	block := &compactBlock{
+		header:      header,
+		uncles:      uncles,
+		time:        time,
+		origin:      peer,
+		resolveTxs:  txsResolver,
+		fetchTxs:    txsFetcher,
+		fetchHeader: headerFetcher,
+		fetchBodies: bodyFetcher,
+	}
+	select {
+	case f.compact <- block:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
 // FilterHeaders extracts all the headers that were explicitly requested by the fetcher,
 // returning those that should be handled differently.
 func (f *BlockFetcher) FilterHeaders(peer string, headers []*types.Header, time time.Time) []*types.Header {
@@ -428,6 +493,31 @@ func (f *BlockFetcher) loop() {
 			}
 			f.enqueue(op.origin, nil, op.block)
 
+		case block := <-f.compact:
+			// A compact block was propagated, reconstruct it if still unknown
+			compactInMeter.Mark(1)
+
+			if f.light {
+				continue
+			}
+			hash, number := block.header.Hash(), block.header.Number.Uint64()
+			if f.compacting[hash] != nil || f.completing[hash] != nil || f.queued[hash] != nil || f.getBlock(hash) != nil {
+				break
+			}
+			if dist := int64(number) - int64(f.chainHeight()); dist < -maxUncleDist || dist > maxQueueDist {
+				log.Debug("Peer discarded compact block", "peer", block.origin, "number", number, "hash", hash, "distance", dist)
+				blockBroadcastDropMeter.Mark(1)
+				break
+			}
+			// Look up the transactions and retrieve the missing ones from the peer
+			f.compacting[hash] = block
+			go f.fetchCompactTxs(block)
+
+		case block := <-f.compactDone:
+			// The missing transactions of a compact block arrived (or not)
+			delete(f.compacting, block.header.Hash())
+			f.completeCompact(block, completeTimer)
+
 		case hash := <-f.done:
 			// A pending import finished, remove all traces of the notification
 			f.forgetHash(hash)
@@ -717,6 +807,118 @@ func (f *BlockFetcher) loop() {
 	}
 }
 
+// fetchCompactTxs looks up the transactions of a compact block locally and
+// requests the missing ones from the peer that propagated it, filling them in on
+// arrival. The block is delivered back to the fetcher loop whether the retrieval
+// succeeded or not.
+func (f *BlockFetcher) fetchCompactTxs(block *compactBlock) {
+	block.txs, block.missing = block.resolveTxs()
+	compactTxHitMeter.Mark(int64(len(block.txs) - len(block.missing)))
+	compactTxMissMeter.Mark(int64(len(block.missing)))
+
+	if len(block.missing) > 0 {
+		compactFetchMeter.Mark(1)
+		f.requestCompactTxs(block)
+	}
+	select {
+	case f.compactDone <- block:
+	case <-f.quit:
+	}
+}
+
+// requestCompactTxs retrieves the missing transactions of a compact block from
+// the peer that propagated it. An empty response means the peer doesn't have
+// them anymore, whereas a response of the wrong size is marked as delivered so
+// the peer is held accountable when the block is assembled.
+func (f *BlockFetcher) requestCompactTxs(block *compactBlock) {
+	resCh := make(chan *eth.Response)
+
+	req, err := block.fetchTxs(block.header.Hash(), block.missing, resCh)
+	if err == nil {
+		defer req.Close()
+
+		timeout := time.NewTimer(fetchTimeout)
+		defer timeout.Stop()
+
+		select {
+		case res := <-resCh:
+			res.Done <- nil
+			txs := *res.Res.(*eth.CompactBlockTxsPacket)
+			if len(txs) == 0 {
+				return
+			}
+			block.fetched = true
+			if len(txs) == len(block.missing) {
+				for i, index := range block.missing {
+					block.txs[index] = txs[i]
+				}
+			}
+		case <-timeout.C:
+			// The peer didn't respond in time, fall back to body retrieval
+		case <-f.quit:
+		}
+	}
+}
+
+// completeCompact assembles a compact block and schedules it for import. If any
+// transactions are missing or they don't match the header, the body of the block
+// is scheduled for retrieval instead. Peers delivering transactions that don't
+// rebuild the header are dropped.
+func (f *BlockFetcher) completeCompact(block *compactBlock, complete *time.Timer) {
+	hash := block.header.Hash()
+
+	reconstructed := true
+	for _, tx := range block.txs {
+		if tx == nil {
+			reconstructed = false
+			break
+		}
+	}
+	if reconstructed && types.DeriveSha(types.Transactions(block.txs), trie.NewStackTrie(nil)) == block.header.TxHash {
+		compactCompleteMeter.Mark(1)
+
+		full := types.NewBlockWithHeader(block.header).WithBody(block.txs, block.uncles)
+		full.ReceivedAt = block.time
+		f.enqueue(block.origin, nil, full)
+		return
+	}
+	compactFailMeter.Mark(1)
+	if block.fetched {
+		// The peer answered with transactions of its own block that don't add up,
+		// either the wrong number of them or ones that collide with the pool. The
+		// salt is picked by the peer, so collisions are its responsibility too.
+		log.Debug("Peer delivered invalid compact block transactions", "peer", block.origin, "number", block.header.Number, "hash", hash)
+		f.dropPeer(block.origin)
+		return
+	}
+	log.Debug("Failed to reconstruct compact block", "peer", block.origin, "number", block.header.Number, "hash", hash)
+
+	// Schedule the body for retrieval as if the header was fetched, unless it's
+	// already being retrieved
+	if _, ok := f.completing[hash]; ok || f.getBlock(hash) != nil {
+		return
+	}
+	count := f.announces[block.origin] + 1
+	if count > hashLimit {
+		log.Debug("Peer exceeded outstanding announces", "peer", block.origin, "limit", hashLimit)
+		blockAnnounceDOSMeter.Mark(1)
+		return
+	}
+	f.announces[block.origin] = count
+	f.fetched[hash] = append(f.fetched[hash], &blockAnnounce{
+		hash:        hash,
+		number:      block.header.Number.Uint64(),
+		header:      block.header,
+		time:        block.time,
+		origin:      block.origin,
+		fetchHeader: block.fetchHeader,
+		fetchBodies: block.fetchBodies,
+	})
+	if len(f.fetched) == 1 {
+		f.rescheduleComplete(complete)
+	}
+}
+
 // rescheduleFetch resets the specified fetch timer to the next blockAnnounce timeout.
 func (f *BlockFetcher) rescheduleFetch(fetch *time.Timer) {
 	// Short circuit if no blocks are announced
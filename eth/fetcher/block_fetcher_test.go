@@ -266,6 +266,37 @@ func (f *fetcherTester) makeBodyFetcher(peer string, blocks map[common.Hash]*typ
 	}
 }
 
+// makeCompactTxsFetcher retrieves a compact block transaction fetcher associated
+// with a simulated peer.
+func (f *fetcherTester) makeCompactTxsFetcher(peer string, blocks map[common.Hash]*types.Block) compactTxsRequesterFn {
+	closure := make(map[common.Hash]*types.Block)
+	for hash, block := range blocks {
+		closure[hash] = block
+	}
+	// Create a function that returns transactions from the closure
+	return func(hash common.Hash, indexes []uint64, sink chan *eth.Response) (*eth.Request, error) {
+		var txs eth.CompactBlockTxsPacket
+		if block, ok := closure[hash]; ok {
+			for _, index := range indexes {
+				txs = append(txs, block.Transactions()[index])
+			}
+		}
+		// Return on a new thread
+		req := &eth.Request{
+			Peer: peer,
+		}
+		res := &eth.Response{
+			Req:  req,
+			Res:  &txs,
+			Done: make(chan error, 1), // Ignore the returned status
+		}
+		go func() {
+			sink <- res
+		}()
+		return req, nil
+	}
+}
+
 // verifyFetchingEvent verifies that one single event arrive on a fetching channel.
 func verifyFetchingEvent(t *testing.T, fetching chan []common.Hash, arrive bool) {
 	t.Helper()
@@ -846,6 +877,103 @@ func TestEmptyBlockShortCircuit(t *testing.T) {
 	verifyImportDone(t, imported)
 }
 
+// Tests that blocks propagated in compact form are reconstructed, retrieving the
+// missing transactions from the peer, and that their bodies are fetched if the
+// reconstruction fails.
+func TestCompactBlockReconstruction(t *testing.T) {
+	// Create a chain of blocks to import, every third one has a transaction
+	hashes, blocks := makeChain(7, 0, genesis)
+
+	tester := newTester(false)
+	defer tester.fetcher.Stop()
+	headerFetcher := tester.makeHeaderFetcher("valid", blocks, -gatherSlack)
+	bodyFetcher := tester.makeBodyFetcher("valid", blocks, 0)
+	txsFetcher := tester.makeCompactTxsFetcher("valid", blocks)
+	emptyTxsFetcher := tester.makeCompactTxsFetcher("valid", nil)
+
+	completing := make(chan []common.Hash)
+	tester.fetcher.completingHook = func(hashes []common.Hash) { completing <- hashes }
+
+	imported := make(chan interface{})
+	tester.fetcher.importedHook = func(header *types.Header, block *types.Block) { imported <- block }
+
+	// A transaction which is not in any block, to simulate short ID collisions
+	signer := types.MakeSigner(params.TestChainConfig, big.NewInt(1))
+	other, _ := types.SignTx(types.NewTransaction(100, common.Address{}, big.NewInt(1), params.TxGas, big.NewInt(params.InitialBaseFee), nil), signer, testKey)
+
+	for i := len(hashes) - 2; i >= 0; i-- {
+		var (
+			block   = blocks[hashes[i]]
+			txs     = append([]*types.Transaction{}, block.Transactions()...)
+			missing []uint64
+			fetcher = txsFetcher
+			fail    bool
+		)
+		switch block.NumberU64() {
+		case 1:
+			// Colliding transaction found in the pool, body must be fetched
+			txs[0], fail = other, true
+		case 4:
+			// Transaction missing from the pool, retrieved from the peer
+			txs[0], missing = nil, []uint64{0}
+		case 7:
+			// Transaction missing from the pool and from the peer too
+			txs[0], missing, fetcher, fail = nil, []uint64{0}, emptyTxsFetcher, true
+		}
+		resolve := func() ([]*types.Transaction, []uint64) { return txs, missing }
+		tester.fetcher.EnqueueCompact("valid", block.Header(), block.Uncles(), time.Now(), resolve, fetcher, headerFetcher, bodyFetcher)
+
+		verifyCompletingEvent(t, completing, fail)
+		verifyImportEvent(t, imported, true)
+	}
+	verifyImportDone(t, imported)
+	verifyChainHeight(t, tester, uint64(len(hashes)-1))
+}
+
+// Tests that a peer delivering compact block transactions that don't match the
+// header is dropped, and that known blocks aren't looked up in the pool at all.
+func TestCompactBlockInvalidTxs(t *testing.T) {
+	hashes, blocks := makeChain(3, 0, genesis)
+
+	tester := newTester(false)
+	defer tester.fetcher.Stop()
+
+	// Serve a different transaction in place of the one in block #1
+	block := blocks[hashes[len(hashes)-2]]
+	if len(block.Transactions()) != 1 {
+		t.Fatalf("test block has %d transactions, want 1", len(block.Transactions()))
+	}
+	signer := types.MakeSigner(params.TestChainConfig, big.NewInt(1))
+	other, _ := types.SignTx(types.NewTransaction(100, common.Address{}, big.NewInt(1), params.TxGas, big.NewInt(params.InitialBaseFee), nil), signer, testKey)
+	forged := map[common.Hash]*types.Block{block.Hash(): types.NewBlockWithHeader(block.Header()).WithBody([]*types.Transaction{other}, nil)}
+
+	var resolved atomic.Int32
+	resolve := func() ([]*types.Transaction, []uint64) {
+		resolved.Add(1)
+		return make([]*types.Transaction, len(block.Transactions())), []uint64{0}
+	}
+	tester.fetcher.EnqueueCompact("bad", block.Header(), block.Uncles(), time.Now(), resolve,
+		tester.makeCompactTxsFetcher("bad", forged), tester.makeHeaderFetcher("bad", blocks, -gatherSlack), tester.makeBodyFetcher("bad", blocks, 0))
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		tester.lock.RLock()
+		dropped := tester.drops["bad"]
+		tester.lock.RUnlock()
+		if dropped {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("peer with invalid compact block transactions not dropped")
+		}
+	}
+	// Known blocks must be discarded before resolving their transactions
+	tester.fetcher.EnqueueCompact("good", genesis.Header(), nil, time.Now(), resolve, nil, nil, nil)
+	time.Sleep(50 * time.Millisecond)
+	if n := resolved.Load(); n != 1 {
+		t.Fatalf("known block resolved: %d lookups", n)
+	}
+}
+
 // Tests that a peer is unable to use unbounded memory with sending infinite
 // block announcements to a node, but that even in the face of such an attack,
 // the fetcher remains operational.
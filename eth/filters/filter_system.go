@@ -250,6 +250,12 @@ func NewEventSystem(sys *FilterSystem, lightMode bool) *EventSystem {
 	return m
 }
 
+// Stop terminates the event loop, releasing the backend event subscriptions.
+// Subscriptions created from the system must be unsubscribed beforehand.
+func (es *EventSystem) Stop() {
+	es.txsSub.Unsubscribe()
+}
+
 // Subscription is created when the client registers itself for a particular event.
 type Subscription struct {
 	ID        rpc.ID
@@ -45,6 +45,13 @@ const (
 	// txChanSize is the size of channel listening to NewTxsEvent.
 	// The number is referenced from the size of tx pool.
 	txChanSize = 4096
+
+	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
+	chainHeadChanSize = 10
+
+	// blockRangeUpdateInterval is the number of blocks the local chain needs to
+	// progress before announcing the new block range to eth/69 peers.
+	blockRangeUpdateInterval = 32
 )
 
 var (
@@ -114,6 +121,8 @@ type handler struct {
 	txsCh         chan core.NewTxsEvent
 	txsSub        event.Subscription
 	minedBlockSub *event.TypeMuxSubscription
+	chainHeadCh   chan core.ChainHeadEvent
+	chainHeadSub  event.Subscription
 
 	requiredBlocks map[uint64]common.Hash
 
@@ -325,10 +334,18 @@ func (h *handler) runEthPeer(peer *eth.Peer, handler eth.Handler) error {
 		td      = h.chain.GetTd(hash, number)
 	)
 	forkID := forkid.NewID(h.chain.Config(), genesis.Hash(), number, head.Time)
-	if err := peer.Handshake(h.networkID, td, hash, genesis.Hash(), forkID, h.forkFilter); err != nil {
+	if err := peer.Handshake(h.networkID, td, hash, genesis.Hash(), forkID, h.forkFilter, h.blockRange()); err != nil {
 		peer.Log().Debug("Ethereum handshake failed", "err", err)
 		return err
 	}
+	// Peers from eth/69 onwards don't advertise their total difficulty, resolve
+	// it locally if their head is known
+	if _, latest, ok := peer.BlockRange(); ok {
+		head, _ := peer.Head()
+		if td := h.chain.GetTd(head, latest); td != nil {
+			peer.SetHead(head, td)
+		}
+	}
 	reject := false // reserved peer slots
 	if h.snapSync.Load() {
 		if snap == nil {
@@ -418,6 +435,7 @@ func (h *handler) runEthPeer(peer *eth.Peer, handler eth.Handler) error {
 					return
 				}
 				if headers[0].Hash() != h.checkpointHash {
+					peer.Peer.Penalize(p2p.PenaltyInvalid, "checkpoint hash mismatch")
 					res.Done <- errors.New("checkpoint hash mismatch")
 					return
 				}
@@ -463,6 +481,7 @@ func (h *handler) runEthPeer(peer *eth.Peer, handler eth.Handler) error {
 				}
 				if headers[0].Number.Uint64() != number || headers[0].Hash() != hash {
 					peer.Log().Info("Required block mismatch, dropping peer", "number", number, "hash", headers[0].Hash(), "want", hash)
+					peer.Peer.Penalize(p2p.PenaltyInvalid, "required block mismatch")
 					res.Done <- errors.New("required block mismatch")
 					return
 				}
@@ -493,10 +512,12 @@ func (h *handler) runSnapExtension(peer *snap.Peer, handler snap.Handler) error
 	return handler(peer)
 }
 
-// removePeer requests disconnection of a peer.
+// removePeer requests disconnection of a peer dropped for misbehaving, lowering
+// its reputation too.
 func (h *handler) removePeer(id string) {
 	peer := h.peers.peer(id)
 	if peer != nil {
+		peer.Peer.Penalize(p2p.PenaltyInvalid, "dropped by syncer")
 		peer.Peer.Disconnect(p2p.DiscUselessPeer)
 	}
 }
@@ -546,6 +567,12 @@ func (h *handler) Start(maxPeers int) {
 	h.minedBlockSub = h.eventMux.Subscribe(core.NewMinedBlockEvent{})
 	go h.minedBroadcastLoop()
 
+	// announce block range changes
+	h.wg.Add(1)
+	h.chainHeadCh = make(chan core.ChainHeadEvent, chainHeadChanSize)
+	h.chainHeadSub = h.chain.SubscribeChainHeadEvent(h.chainHeadCh)
+	go h.blockRangeLoop()
+
 	// start sync handlers
 	h.wg.Add(1)
 	go h.chainSync.loop()
@@ -554,6 +581,7 @@ func (h *handler) Start(maxPeers int) {
 func (h *handler) Stop() {
 	h.txsSub.Unsubscribe()        // quits txBroadcastLoop
 	h.minedBlockSub.Unsubscribe() // quits blockBroadcastLoop
+	h.chainHeadSub.Unsubscribe()  // quits blockRangeLoop
 
 	// Quit chainSync and txsync64.
 	// After this is done, no new peers will be accepted.
@@ -669,6 +697,45 @@ func (h *handler) minedBroadcastLoop() {
 	}
 }
 
+// blockRange returns the range of blocks available locally for serving.
+func (h *handler) blockRange() eth.BlockRangeUpdatePacket {
+	head := h.chain.CurrentBlock()
+	if snap := h.chain.CurrentSnapBlock(); snap.Number.Cmp(head.Number) > 0 {
+		head = snap
+	}
+	return eth.BlockRangeUpdatePacket{
+		EarliestBlock:   h.chain.HistoryTail(),
+		LatestBlock:     head.Number.Uint64(),
+		LatestBlockHash: head.Hash(),
+	}
+}
+
+// blockRangeLoop announces the changes in the range of locally available blocks
+// to eth/69 peers. To avoid spamming the network, the range is only announced
+// when the chain progressed by a number of blocks or the history got expired.
+func (h *handler) blockRangeLoop() {
+	defer h.wg.Done()
+
+	last := h.blockRange()
+	for {
+		select {
+		case <-h.chainHeadCh:
+			update := h.blockRange()
+			if update.EarliestBlock == last.EarliestBlock && update.LatestBlock < last.LatestBlock+blockRangeUpdateInterval && update.LatestBlock >= last.LatestBlock {
+				continue
+			}
+			for _, peer := range h.peers.ethPeersWithBlockRange() {
+				if err := peer.SendBlockRangeUpdate(update); err != nil {
+					peer.Log().Debug("Failed to announce block range", "err", err)
+				}
+			}
+			last = update
+		case <-h.chainHeadSub.Err():
+			return
+		}
+	}
+}
+
 // txBroadcastLoop announces new transactions to connected peers.
 func (h *handler) txBroadcastLoop() {
 	defer h.wg.Done()
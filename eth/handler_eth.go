@@ -66,6 +66,9 @@ func (h *ethHandler) Handle(peer *eth.Peer, packet eth.Packet) error {
 	case *eth.NewBlockPacket:
 		return h.handleBlockBroadcast(peer, packet.Block, packet.TD)
 
+	case *eth.NewCompactBlockPacket:
+		return h.handleCompactBlockBroadcast(peer, packet)
+
 	case *eth.NewPooledTransactionHashesPacket66:
 		return h.txFetcher.Notify(peer.ID(), *packet)
 
@@ -78,6 +81,10 @@ func (h *ethHandler) Handle(peer *eth.Peer, packet eth.Packet) error {
 	case *eth.PooledTransactionsPacket:
 		return h.txFetcher.Enqueue(peer.ID(), *packet, true)
 
+	case *eth.BlockRangeUpdatePacket:
+		// The peer's range was already updated, nothing else to do
+		return nil
+
 	default:
 		return fmt.Errorf("unexpected eth packet type: %T", packet)
 	}
@@ -125,16 +132,79 @@ func (h *ethHandler) handleBlockBroadcast(peer *eth.Peer, block *types.Block, td
 	// Schedule the block for import
 	h.blockFetcher.Enqueue(peer.ID(), block)
 
+	h.updatePeerHead(peer, block.Header(), td)
+	return nil
+}
+
+// handleCompactBlockBroadcast is invoked from a peer's message handler when it
+// transmits a compact block broadcast for the local node to process.
+func (h *ethHandler) handleCompactBlockBroadcast(peer *eth.Peer, packet *eth.NewCompactBlockPacket) error {
+	// Drop all incoming block announces from the p2p network if
+	// the chain already entered the pos stage and disconnect the
+	// remote peer.
+	if h.merger.PoSFinalized() {
+		return nil
+	}
+	// Let the fetcher decide whether the block is worth reconstructing before
+	// looking up its transactions in the local pool, retrieving the rest
+	resolve := func() ([]*types.Transaction, []uint64) {
+		return h.resolveCompactTxs(packet.Salt, packet.ShortIDs)
+	}
+	h.blockFetcher.EnqueueCompact(peer.ID(), packet.Header, packet.Uncles, time.Now(), resolve,
+		peer.RequestCompactBlockTxs, peer.RequestOneHeader, peer.RequestBodies)
+
+	h.updatePeerHead(peer, packet.Header, packet.TD)
+	return nil
+}
+
+// resolveCompactTxs looks up the transactions of a compact block in the local
+// pool, returning them (nil where not found) along with the indexes of the
+// missing ones. The short IDs are salted by the sender, so the pool has to be
+// rehashed for every block, stopping as soon as all transactions are found.
+func (h *ethHandler) resolveCompactTxs(salt uint64, ids []eth.ShortTxID) ([]*types.Transaction, []uint64) {
+	var (
+		txs     = make([]*types.Transaction, len(ids))
+		missing []uint64
+	)
+	if len(ids) == 0 {
+		return txs, nil
+	}
+	wanted := make(map[eth.ShortTxID][]int, len(ids))
+	for i, id := range ids {
+		wanted[id] = append(wanted[id], i)
+	}
+	for _, batch := range h.txpool.Pending(false) {
+		for _, tx := range batch {
+			id := eth.NewShortTxID(salt, tx.Hash())
+			for _, i := range wanted[id] {
+				txs[i] = tx
+			}
+			delete(wanted, id)
+		}
+		if len(wanted) == 0 {
+			break
+		}
+	}
+	for i, tx := range txs {
+		if tx == nil {
+			missing = append(missing, uint64(i))
+		}
+	}
+	return txs, missing
+}
+
+// updatePeerHead updates the head and total difficulty of a peer after it
+// propagated the given block.
+func (h *ethHandler) updatePeerHead(peer *eth.Peer, header *types.Header, td *big.Int) {
 	// Assuming the block is importable by the peer, but possibly not yet done so,
 	// calculate the head hash and TD that the peer truly must have.
 	var (
-		trueHead = block.ParentHash()
-		trueTD   = new(big.Int).Sub(td, block.Difficulty())
+		trueHead = header.ParentHash
+		trueTD   = new(big.Int).Sub(td, header.Difficulty)
 	)
 	// Update the peer's total difficulty if better than the previous
 	if _, td := peer.Head(); trueTD.Cmp(td) > 0 {
 		peer.SetHead(trueHead, trueTD)
 		h.chainSync.handlePeerEvent(peer)
 	}
-	return nil
 }
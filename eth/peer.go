@@ -24,7 +24,9 @@ import (
 // ethPeerInfo represents a short summary of the `eth` sub-protocol metadata known
 // about a connected peer.
 type ethPeerInfo struct {
-	Version uint `json:"version"` // Ethereum protocol version negotiated
+	Version  uint    `json:"version"`            // Ethereum protocol version negotiated
+	Earliest *uint64 `json:"earliest,omitempty"` // Earliest block available, advertised since eth/69
+	Latest   *uint64 `json:"latest,omitempty"`   // Latest block available, advertised since eth/69
 }
 
 // ethPeer is a wrapper around eth.Peer to maintain a few extra metadata.
@@ -35,9 +37,13 @@ type ethPeer struct {
 
 // info gathers and returns some `eth` protocol metadata known about a peer.
 func (p *ethPeer) info() *ethPeerInfo {
-	return &ethPeerInfo{
+	info := &ethPeerInfo{
 		Version: p.Version(),
 	}
+	if earliest, latest, ok := p.BlockRange(); ok {
+		info.Earliest, info.Latest = &earliest, &latest
+	}
+	return info
 }
 
 // snapPeerInfo represents a short summary of the `snap` sub-protocol metadata known
@@ -247,6 +247,40 @@ func (ps *peerSet) peerWithHighestTD() *eth.Peer {
 	return bestPeer
 }
 
+// peerWithHighestBlock retrieves the known peer advertising the highest latest
+// block within its available block range. Only eth/69 peers and later advertise
+// their block ranges.
+func (ps *peerSet) peerWithHighestBlock() *eth.Peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	var (
+		bestPeer   *eth.Peer
+		bestLatest uint64
+	)
+	for _, p := range ps.peers {
+		if _, latest, ok := p.BlockRange(); ok && (bestPeer == nil || latest > bestLatest) {
+			bestPeer, bestLatest = p.Peer, latest
+		}
+	}
+	return bestPeer
+}
+
+// ethPeersWithBlockRange retrieves a list of peers that advertise their block
+// ranges, i.e. the eth/69 peers and later.
+func (ps *peerSet) ethPeersWithBlockRange() []*ethPeer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*ethPeer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		if _, _, ok := p.BlockRange(); ok {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
 // close disconnects all peers.
 func (ps *peerSet) close() {
 	ps.lock.Lock()
@@ -43,7 +43,13 @@ func (p *Peer) broadcastBlocks() {
 	for {
 		select {
 		case prop := <-p.queuedBlocks:
-			if err := p.SendNewBlock(prop.block, prop.td); err != nil {
+			// Since eth/70 blocks are propagated in compact form, unless they
+			// carry withdrawals which the compact message can't express
+			send := p.SendNewBlock
+			if p.version >= ETH70 && prop.block.Withdrawals() == nil {
+				send = p.SendNewCompactBlock
+			}
+			if err := send(prop.block, prop.td); err != nil {
 				return
 			}
 			p.Log().Trace("Propagated block", "number", prop.block.Number(), "hash", prop.block.Hash(), "td", prop.td)
@@ -23,6 +23,10 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/rlp"
 )
 
+// ArchiveTopic is the discovery topic advertised by nodes keeping the full state
+// history, i.e. running with pruning disabled.
+const ArchiveTopic = "archive"
+
 // enrEntry is the ENR entry which advertises `eth` protocol on the discovery.
 type enrEntry struct {
 	ForkID forkid.ID // Fork identifier per EIP-2124
@@ -17,6 +17,7 @@
 package eth
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"time"
@@ -93,8 +94,9 @@ type TxPool interface {
 	Get(hash common.Hash) *types.Transaction
 }
 
-// MakeProtocols constructs the P2P protocol definitions for `eth`.
-func MakeProtocols(backend Backend, network uint64, dnsdisc enode.Iterator) []p2p.Protocol {
+// MakeProtocols constructs the P2P protocol definitions for `eth`. The optional
+// limiter throttles the responses served to remote peers.
+func MakeProtocols(backend Backend, network uint64, dnsdisc enode.Iterator, limiter *p2p.ServeLimiter) []p2p.Protocol {
 	protocols := make([]p2p.Protocol, len(ProtocolVersions))
 	for i, version := range ProtocolVersions {
 		version := version // Closure
@@ -104,6 +106,8 @@ func MakeProtocols(backend Backend, network uint64, dnsdisc enode.Iterator) []p2
 			Version: version,
 			Length:  protocolLengths[version],
 			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				rw = limiter.Wrap(p, rw, BlockHeadersMsg, BlockBodiesMsg, NodeDataMsg, ReceiptsMsg, PooledTransactionsMsg, CompactBlockTxsMsg)
+
 				peer := NewPeer(version, p, rw, backend.TxPool())
 				defer peer.Close()
 
@@ -155,11 +159,23 @@ func Handle(backend Backend, peer *Peer) error {
 	for {
 		if err := handleMessage(backend, peer); err != nil {
 			peer.Log().Debug("Message handling failed in `eth`", "err", err)
+			if isViolation(err) {
+				peer.Penalize(p2p.PenaltyViolation, err.Error())
+			}
 			return err
 		}
 	}
 }
 
+// isViolation reports whether a message handling error was caused by the remote
+// peer breaking the protocol, as opposed to a network or local failure.
+func isViolation(err error) bool {
+	return errors.Is(err, errDecode) || errors.Is(err, errMsgTooLarge) ||
+		errors.Is(err, errInvalidMsgCode) || errors.Is(err, errDanglingResponse) ||
+		errors.Is(err, errMismatchingResponseType) || errors.Is(err, errInvalidBlockRange) ||
+		errors.Is(err, errInvalidTxIndex)
+}
+
 type msgHandler func(backend Backend, msg Decoder, peer *Peer) error
 type Decoder interface {
 	Decode(val interface{}) error
@@ -213,6 +229,41 @@ var eth68 = map[uint64]msgHandler{
 	PooledTransactionsMsg:         handlePooledTransactions66,
 }
 
+var eth69 = map[uint64]msgHandler{
+	NewBlockHashesMsg:             handleNewBlockhashes,
+	NewBlockMsg:                   handleNewBlock,
+	TransactionsMsg:               handleTransactions,
+	NewPooledTransactionHashesMsg: handleNewPooledTransactionHashes68,
+	GetBlockHeadersMsg:            handleGetBlockHeaders66,
+	BlockHeadersMsg:               handleBlockHeaders66,
+	GetBlockBodiesMsg:             handleGetBlockBodies66,
+	BlockBodiesMsg:                handleBlockBodies66,
+	GetReceiptsMsg:                handleGetReceipts66,
+	ReceiptsMsg:                   handleReceipts66,
+	GetPooledTransactionsMsg:      handleGetPooledTransactions66,
+	PooledTransactionsMsg:         handlePooledTransactions66,
+	BlockRangeUpdateMsg:           handleBlockRangeUpdate,
+}
+
+var eth70 = map[uint64]msgHandler{
+	NewBlockHashesMsg:             handleNewBlockhashes,
+	NewBlockMsg:                   handleNewBlock,
+	TransactionsMsg:               handleTransactions,
+	NewPooledTransactionHashesMsg: handleNewPooledTransactionHashes68,
+	GetBlockHeadersMsg:            handleGetBlockHeaders66,
+	BlockHeadersMsg:               handleBlockHeaders66,
+	GetBlockBodiesMsg:             handleGetBlockBodies66,
+	BlockBodiesMsg:                handleBlockBodies66,
+	GetReceiptsMsg:                handleGetReceipts66,
+	ReceiptsMsg:                   handleReceipts66,
+	GetPooledTransactionsMsg:      handleGetPooledTransactions66,
+	PooledTransactionsMsg:         handlePooledTransactions66,
+	BlockRangeUpdateMsg:           handleBlockRangeUpdate,
+	NewCompactBlockMsg:            handleNewCompactBlock,
+	GetCompactBlockTxsMsg:         handleGetCompactBlockTxs,
+	CompactBlockTxsMsg:            handleCompactBlockTxs,
+}
+
 // handleMessage is invoked whenever an inbound message is received from a remote
 // peer. The remote connection is torn down upon returning any error.
 func handleMessage(backend Backend, peer *Peer) error {
@@ -230,9 +281,15 @@ func handleMessage(backend Backend, peer *Peer) error {
 	if peer.Version() == ETH67 {
 		handlers = eth67
 	}
-	if peer.Version() >= ETH68 {
+	if peer.Version() == ETH68 {
 		handlers = eth68
 	}
+	if peer.Version() == ETH69 {
+		handlers = eth69
+	}
+	if peer.Version() >= ETH70 {
+		handlers = eth70
+	}
 
 	// Track the amount of time it takes to serve the request and run the handler
 	if metrics.Enabled {
@@ -17,10 +17,12 @@
 package eth
 
 import (
+	"errors"
 	"math"
 	"math/big"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/rethereum-blockchain/go-rethereum/common"
 	"github.com/rethereum-blockchain/go-rethereum/consensus"
@@ -620,3 +622,151 @@ func testGetBlockReceipts(t *testing.T, protocol uint) {
 		t.Errorf("receipts mismatch: %v", err)
 	}
 }
+
+// Tests that the transactions of compact blocks can be retrieved, both for blocks
+// in the chain and for blocks propagated but not yet imported.
+func TestGetCompactBlockTxs70(t *testing.T) {
+	t.Parallel()
+
+	signer := types.HomesteadSigner{}
+	generator := func(i int, block *core.BlockGen) {
+		for j := 0; j < 3; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testAddr), common.Address{byte(j)}, big.NewInt(1000), params.TxGas, block.BaseFee(), nil), signer, testKey)
+			block.AddTx(tx)
+		}
+	}
+	backend := newTestBackendWithGenerator(2, false, generator)
+	defer backend.close()
+
+	peer, errc := newTestPeer("peer", ETH70, backend)
+	defer peer.close()
+
+	// Transactions of blocks in the chain are served by index
+	block := backend.chain.GetBlockByNumber(1)
+	p2p.Send(peer.app, GetCompactBlockTxsMsg, &GetCompactBlockTxsPacket{
+		RequestId: 1,
+		BlockHash: block.Hash(),
+		Indexes:   []uint64{2, 0},
+	})
+	if err := p2p.ExpectMsg(peer.app, CompactBlockTxsMsg, &CompactBlockTxsPacket70{
+		RequestId:             1,
+		CompactBlockTxsPacket: []*types.Transaction{block.Transactions()[2], block.Transactions()[0]},
+	}); err != nil {
+		t.Errorf("chain block txs mismatch: %v", err)
+	}
+	// Transactions of unknown blocks are not served
+	p2p.Send(peer.app, GetCompactBlockTxsMsg, &GetCompactBlockTxsPacket{
+		RequestId: 2,
+		BlockHash: common.Hash{0xff},
+		Indexes:   []uint64{0},
+	})
+	if err := p2p.ExpectMsg(peer.app, CompactBlockTxsMsg, &CompactBlockTxsPacket70{RequestId: 2}); err != nil {
+		t.Errorf("unknown block txs mismatch: %v", err)
+	}
+	// Propagate a block not yet in the chain and check the short IDs
+	pending := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(3), Difficulty: big.NewInt(1)}).WithBody(block.Transactions(), nil)
+	go peer.SendNewCompactBlock(pending, big.NewInt(100))
+
+	msg, err := peer.app.ReadMsg()
+	if err != nil {
+		t.Fatalf("failed to read compact block: %v", err)
+	}
+	if msg.Code != NewCompactBlockMsg {
+		t.Fatalf("message code mismatch: have %d, want %d", msg.Code, NewCompactBlockMsg)
+	}
+	var ann NewCompactBlockPacket
+	if err := msg.Decode(&ann); err != nil {
+		t.Fatalf("failed to decode compact block: %v", err)
+	}
+	if ann.Header.Hash() != pending.Hash() || ann.TD.Uint64() != 100 || len(ann.ShortIDs) != len(pending.Transactions()) {
+		t.Fatalf("compact block mismatch")
+	}
+	for i, tx := range pending.Transactions() {
+		if id := NewShortTxID(ann.Salt, tx.Hash()); ann.ShortIDs[i] != id {
+			t.Errorf("short ID %d mismatch: have %x, want %x", i, ann.ShortIDs[i], id)
+		}
+	}
+	p2p.Send(peer.app, GetCompactBlockTxsMsg, &GetCompactBlockTxsPacket{
+		RequestId: 3,
+		BlockHash: pending.Hash(),
+		Indexes:   []uint64{1},
+	})
+	if err := p2p.ExpectMsg(peer.app, CompactBlockTxsMsg, &CompactBlockTxsPacket70{
+		RequestId:             3,
+		CompactBlockTxsPacket: []*types.Transaction{pending.Transactions()[1]},
+	}); err != nil {
+		t.Errorf("propagated block txs mismatch: %v", err)
+	}
+	// Requesting transactions beyond the end of the block is a violation
+	p2p.Send(peer.app, GetCompactBlockTxsMsg, &GetCompactBlockTxsPacket{
+		RequestId: 4,
+		BlockHash: block.Hash(),
+		Indexes:   []uint64{3},
+	})
+	select {
+	case err := <-errc:
+		if !errors.Is(err, errInvalidTxIndex) {
+			t.Errorf("wrong error: have %v, want %v", err, errInvalidTxIndex)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("peer not disconnected")
+	}
+}
+
+// Tests that the bodies and receipts of expired chain history are not served.
+func TestGetPrunedHistory(t *testing.T) {
+	t.Parallel()
+
+	var (
+		config = *params.TestChainConfig
+		gspec  = &core.Genesis{
+			Config: &config,
+			Alloc:  core.GenesisAlloc{testAddr: {Balance: big.NewInt(100_000_000_000_000_000)}},
+		}
+		signer = types.HomesteadSigner{}
+	)
+	config.RethereumForks = &params.RethereumForks{}
+
+	_, blocks, receipts := core.GenerateChainWithGenesis(gspec, ethash.NewFaker(), 8, func(i int, block *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testAddr), common.Address{0xaa}, big.NewInt(1), params.TxGas, block.BaseFee(), nil), signer, testKey)
+		block.AddTx(tx)
+	})
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), t.TempDir(), "", false)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	chain, err := core.NewBlockChain(db, nil, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if _, err := chain.InsertHeaderChain(headers, 0); err != nil {
+		t.Fatalf("Failed to insert headers: %v", err)
+	}
+	if _, err := chain.InsertReceiptChain(blocks, receipts, uint64(len(blocks))); err != nil {
+		t.Fatalf("Failed to insert receipts: %v", err)
+	}
+	if _, err := rawdb.PruneChainHistory(db, 5, nil); err != nil {
+		t.Fatalf("Failed to prune history: %v", err)
+	}
+	hashes := make([]common.Hash, len(blocks))
+	for i, block := range blocks {
+		hashes[i] = block.Hash()
+	}
+	if bodies := ServiceGetBlockBodiesQuery(chain, hashes); len(bodies) != 4 {
+		t.Errorf("Served bodies mismatch: have %d, want %d", len(bodies), 4)
+	}
+	if receipts := ServiceGetReceiptsQuery(chain, hashes); len(receipts) != 4 {
+		t.Errorf("Served receipts mismatch: have %d, want %d", len(receipts), 4)
+	}
+	if header := chain.GetHeaderByNumber(1); header == nil {
+		t.Errorf("Header of pruned block missing")
+	}
+}
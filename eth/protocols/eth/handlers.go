@@ -219,12 +219,16 @@ func ServiceGetBlockBodiesQuery(chain *core.BlockChain, query GetBlockBodiesPack
 	var (
 		bytes  int
 		bodies []rlp.RawValue
+		tail   = chain.HistoryTail()
 	)
 	for lookups, hash := range query {
 		if bytes >= softResponseLimit || len(bodies) >= maxBodiesServe ||
 			lookups >= 2*maxBodiesServe {
 			break
 		}
+		if historyPruned(chain, hash, tail) {
+			continue
+		}
 		if data := chain.GetBodyRLP(hash); len(data) != 0 {
 			bodies = append(bodies, data)
 			bytes += len(data)
@@ -233,6 +237,16 @@ func ServiceGetBlockBodiesQuery(chain *core.BlockChain, query GetBlockBodiesPack
 	return bodies
 }
 
+// historyPruned reports whether the body and receipts of the block with the
+// given hash were expired from the local chain and can't be served anymore.
+func historyPruned(chain *core.BlockChain, hash common.Hash, tail uint64) bool {
+	if tail == 0 {
+		return false
+	}
+	header := chain.GetHeaderByHash(hash)
+	return header != nil && header.Number.Uint64() < tail
+}
+
 func handleGetNodeData66(backend Backend, msg Decoder, peer *Peer) error {
 	// Decode the trie node data retrieval message
 	var query GetNodeDataPacket66
@@ -287,12 +301,16 @@ func ServiceGetReceiptsQuery(chain *core.BlockChain, query GetReceiptsPacket) []
 	var (
 		bytes    int
 		receipts []rlp.RawValue
+		tail     = chain.HistoryTail()
 	)
 	for lookups, hash := range query {
 		if bytes >= softResponseLimit || len(receipts) >= maxReceiptsServe ||
 			lookups >= 2*maxReceiptsServe {
 			break
 		}
+		if historyPruned(chain, hash, tail) {
+			continue
+		}
 		// Retrieve the requested block's receipts
 		results := chain.GetReceiptsByHash(hash)
 		if results == nil {
@@ -351,6 +369,64 @@ func handleNewBlock(backend Backend, msg Decoder, peer *Peer) error {
 	return backend.Handle(peer, ann)
 }
 
+func handleNewCompactBlock(backend Backend, msg Decoder, peer *Peer) error {
+	// Retrieve and decode the propagated compact block
+	ann := new(NewCompactBlockPacket)
+	if err := msg.Decode(ann); err != nil {
+		return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+	}
+	if err := ann.sanityCheck(); err != nil {
+		return err
+	}
+	if hash := types.CalcUncleHash(ann.Uncles); hash != ann.Header.UncleHash {
+		log.Warn("Propagated compact block has invalid uncles", "have", hash, "exp", ann.Header.UncleHash)
+		return nil
+	}
+	// Mark the peer as owning the block, the transactions are checked against
+	// the header once the body is reconstructed
+	peer.markBlock(ann.Header.Hash())
+
+	return backend.Handle(peer, ann)
+}
+
+func handleGetCompactBlockTxs(backend Backend, msg Decoder, peer *Peer) error {
+	// Decode the compact block transaction retrieval message
+	var query GetCompactBlockTxsPacket
+	if err := msg.Decode(&query); err != nil {
+		return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+	}
+	// Blocks are propagated before being imported, so look among the ones
+	// recently sent to the peer before checking the chain
+	block := peer.compactBlock(query.BlockHash)
+	if block == nil {
+		block = backend.Chain().GetBlockByHash(query.BlockHash)
+	}
+	var txs []*types.Transaction
+	if block != nil {
+		all := block.Transactions()
+		for _, index := range query.Indexes {
+			if index >= uint64(len(all)) {
+				return fmt.Errorf("%w: %d >= %d", errInvalidTxIndex, index, len(all))
+			}
+			txs = append(txs, all[index])
+		}
+	}
+	return peer.ReplyCompactBlockTxs(query.RequestId, txs)
+}
+
+func handleBlockRangeUpdate(backend Backend, msg Decoder, peer *Peer) error {
+	// A peer announced a change in the range of blocks it can serve
+	update := new(BlockRangeUpdatePacket)
+	if err := msg.Decode(update); err != nil {
+		return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+	}
+	if update.EarliestBlock > update.LatestBlock {
+		return fmt.Errorf("%w: %d > %d", errInvalidBlockRange, update.EarliestBlock, update.LatestBlock)
+	}
+	peer.SetBlockRange(update.EarliestBlock, update.LatestBlock, update.LatestBlockHash)
+	return backend.Handle(peer, update)
+}
+
 func handleBlockHeaders66(backend Backend, msg Decoder, peer *Peer) error {
 	// A batch of headers arrived to one of our previous requests
 	res := new(BlockHeadersPacket66)
@@ -400,6 +476,19 @@ func handleBlockBodies66(backend Backend, msg Decoder, peer *Peer) error {
 	}, metadata)
 }
 
+func handleCompactBlockTxs(backend Backend, msg Decoder, peer *Peer) error {
+	// A batch of compact block transactions arrived to one of our previous requests
+	res := new(CompactBlockTxsPacket70)
+	if err := msg.Decode(res); err != nil {
+		return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+	}
+	return peer.dispatchResponse(&Response{
+		id:   res.RequestId,
+		code: CompactBlockTxsMsg,
+		Res:  &res.CompactBlockTxsPacket,
+	}, nil)
+}
+
 func handleNodeData66(backend Backend, msg Decoder, peer *Peer) error {
 	// A batch of node state data arrived to one of our previous requests
 	res := new(NodeDataPacket66)
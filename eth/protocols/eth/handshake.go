@@ -33,25 +33,74 @@ const (
 )
 
 // Handshake executes the eth protocol handshake, negotiating version number,
-// network IDs, difficulties, head and genesis blocks.
-func (p *Peer) Handshake(network uint64, td *big.Int, head common.Hash, genesis common.Hash, forkID forkid.ID, forkFilter forkid.Filter) error {
+// network IDs, difficulties, head and genesis blocks. From eth/69 onwards, the
+// total difficulty is replaced by the range of blocks available locally.
+func (p *Peer) Handshake(network uint64, td *big.Int, head common.Hash, genesis common.Hash, forkID forkid.ID, forkFilter forkid.Filter, blockRange BlockRangeUpdatePacket) error {
+	if p.version >= ETH69 {
+		return p.handshake69(network, genesis, forkID, forkFilter, blockRange)
+	}
+	var status StatusPacket // safe to read after two values have been received from errc
+
+	err := p.exchangeStatus(&StatusPacket{
+		ProtocolVersion: uint32(p.version),
+		NetworkID:       network,
+		TD:              td,
+		Head:            head,
+		Genesis:         genesis,
+		ForkID:          forkID,
+	}, func() error {
+		return p.readStatus(network, &status, genesis, forkFilter)
+	})
+	if err != nil {
+		return err
+	}
+	p.td, p.head = status.TD, status.Head
+
+	// TD at mainnet block #7753254 is 76 bits. If it becomes 100 million times
+	// larger, it will still fit within 100 bits
+	if tdlen := p.td.BitLen(); tdlen > 100 {
+		return fmt.Errorf("too large total difficulty: bitlen %d", tdlen)
+	}
+	return nil
+}
+
+// handshake69 executes the eth/69 protocol handshake, negotiating version number,
+// network IDs, genesis blocks and the ranges of blocks available.
+func (p *Peer) handshake69(network uint64, genesis common.Hash, forkID forkid.ID, forkFilter forkid.Filter, blockRange BlockRangeUpdatePacket) error {
+	var status StatusPacket69 // safe to read after two values have been received from errc
+
+	err := p.exchangeStatus(&StatusPacket69{
+		ProtocolVersion: uint32(p.version),
+		NetworkID:       network,
+		Genesis:         genesis,
+		ForkID:          forkID,
+		EarliestBlock:   blockRange.EarliestBlock,
+		LatestBlock:     blockRange.LatestBlock,
+		LatestBlockHash: blockRange.LatestBlockHash,
+	}, func() error {
+		return p.readStatus69(network, &status, genesis, forkFilter)
+	})
+	if err != nil {
+		return err
+	}
+	// The total difficulty of the head is not advertised anymore. It stays unknown
+	// until resolved locally or announced along with a new block.
+	p.td, p.head = new(big.Int), status.LatestBlockHash
+	p.earliest, p.latest = status.EarliestBlock, status.LatestBlock
+	return nil
+}
+
+// exchangeStatus sends the local status packet and concurrently reads the remote
+// one, waiting for both to complete or the handshake to time out.
+func (p *Peer) exchangeStatus(status Packet, read func() error) error {
 	// Send out own handshake in a new thread
 	errc := make(chan error, 2)
 
-	var status StatusPacket // safe to read after two values have been received from errc
-
 	go func() {
-		errc <- p2p.Send(p.rw, StatusMsg, &StatusPacket{
-			ProtocolVersion: uint32(p.version),
-			NetworkID:       network,
-			TD:              td,
-			Head:            head,
-			Genesis:         genesis,
-			ForkID:          forkID,
-		})
+		errc <- p2p.Send(p.rw, StatusMsg, status)
 	}()
 	go func() {
-		errc <- p.readStatus(network, &status, genesis, forkFilter)
+		errc <- read()
 	}()
 	timeout := time.NewTimer(handshakeTimeout)
 	defer timeout.Stop()
@@ -65,13 +114,6 @@ func (p *Peer) Handshake(network uint64, td *big.Int, head common.Hash, genesis
 			return p2p.DiscReadTimeout
 		}
 	}
-	p.td, p.head = status.TD, status.Head
-
-	// TD at mainnet block #7753254 is 76 bits. If it becomes 100 million times
-	// larger, it will still fit within 100 bits
-	if tdlen := p.td.BitLen(); tdlen > 100 {
-		return fmt.Errorf("too large total difficulty: bitlen %d", tdlen)
-	}
 	return nil
 }
 
@@ -91,16 +133,47 @@ func (p *Peer) readStatus(network uint64, status *StatusPacket, genesis common.H
 	if err := msg.Decode(&status); err != nil {
 		return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
 	}
-	if status.NetworkID != network {
-		return fmt.Errorf("%w: %d (!= %d)", errNetworkIDMismatch, status.NetworkID, network)
+	return p.checkStatus(network, status.NetworkID, status.ProtocolVersion, genesis, status.Genesis, forkFilter, status.ForkID)
+}
+
+// readStatus69 reads the remote eth/69 handshake message.
+func (p *Peer) readStatus69(network uint64, status *StatusPacket69, genesis common.Hash, forkFilter forkid.Filter) error {
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Code != StatusMsg {
+		return fmt.Errorf("%w: first msg has code %x (!= %x)", errNoStatusMsg, msg.Code, StatusMsg)
+	}
+	if msg.Size > maxMessageSize {
+		return fmt.Errorf("%w: %v > %v", errMsgTooLarge, msg.Size, maxMessageSize)
+	}
+	// Decode the handshake and make sure everything matches
+	if err := msg.Decode(&status); err != nil {
+		return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+	}
+	if err := p.checkStatus(network, status.NetworkID, status.ProtocolVersion, genesis, status.Genesis, forkFilter, status.ForkID); err != nil {
+		return err
+	}
+	if status.EarliestBlock > status.LatestBlock {
+		return fmt.Errorf("%w: %d > %d", errInvalidBlockRange, status.EarliestBlock, status.LatestBlock)
+	}
+	return nil
+}
+
+// checkStatus validates the fields of the remote handshake message shared by all
+// the protocol versions.
+func (p *Peer) checkStatus(network, remoteNetwork uint64, remoteVersion uint32, genesis, remoteGenesis common.Hash, forkFilter forkid.Filter, remoteForkID forkid.ID) error {
+	if remoteNetwork != network {
+		return fmt.Errorf("%w: %d (!= %d)", errNetworkIDMismatch, remoteNetwork, network)
 	}
-	if uint(status.ProtocolVersion) != p.version {
-		return fmt.Errorf("%w: %d (!= %d)", errProtocolVersionMismatch, status.ProtocolVersion, p.version)
+	if uint(remoteVersion) != p.version {
+		return fmt.Errorf("%w: %d (!= %d)", errProtocolVersionMismatch, remoteVersion, p.version)
 	}
-	if status.Genesis != genesis {
-		return fmt.Errorf("%w: %x (!= %x)", errGenesisMismatch, status.Genesis, genesis)
+	if remoteGenesis != genesis {
+		return fmt.Errorf("%w: %x (!= %x)", errGenesisMismatch, remoteGenesis, genesis)
 	}
-	if err := forkFilter(status.ForkID); err != nil {
+	if err := forkFilter(remoteForkID); err != nil {
 		return fmt.Errorf("%w: %v", errForkIDRejected, err)
 	}
 	return nil
@@ -80,7 +80,7 @@ func testHandshake(t *testing.T, protocol uint) {
 		// Send the junk test with one peer, check the handshake failure
 		go p2p.Send(app, test.code, test.data)
 
-		err := peer.Handshake(1, td, head.Hash(), genesis.Hash(), forkID, forkid.NewFilter(backend.chain))
+		err := peer.Handshake(1, td, head.Hash(), genesis.Hash(), forkID, forkid.NewFilter(backend.chain), BlockRangeUpdatePacket{})
 		if err == nil {
 			t.Errorf("test %d: protocol returned nil error, want %q", i, test.want)
 		} else if !errors.Is(err, test.want) {
@@ -88,3 +88,81 @@ func testHandshake(t *testing.T, protocol uint) {
 		}
 	}
 }
+
+// Tests that eth/69 handshake failures are detected and reported correctly, and
+// that the advertised block ranges are tracked.
+func TestHandshake69(t *testing.T) {
+	t.Parallel()
+
+	// Create a test backend only to have some valid genesis chain
+	backend := newTestBackend(3)
+	defer backend.close()
+
+	var (
+		genesis = backend.chain.Genesis()
+		head    = backend.chain.CurrentBlock()
+		number  = head.Number.Uint64()
+		forkID  = forkid.NewID(backend.chain.Config(), backend.chain.Genesis().Hash(), backend.chain.CurrentHeader().Number.Uint64(), backend.chain.CurrentHeader().Time)
+		local   = BlockRangeUpdatePacket{EarliestBlock: 0, LatestBlock: number, LatestBlockHash: head.Hash()}
+	)
+	tests := []struct {
+		code uint64
+		data interface{}
+		want error
+	}{
+		{
+			code: StatusMsg, data: StatusPacket69{ETH68, 1, genesis.Hash(), forkID, 0, number, head.Hash()},
+			want: errProtocolVersionMismatch,
+		},
+		{
+			code: StatusMsg, data: StatusPacket69{ETH69, 999, genesis.Hash(), forkID, 0, number, head.Hash()},
+			want: errNetworkIDMismatch,
+		},
+		{
+			code: StatusMsg, data: StatusPacket69{ETH69, 1, common.Hash{3}, forkID, 0, number, head.Hash()},
+			want: errGenesisMismatch,
+		},
+		{
+			code: StatusMsg, data: StatusPacket69{ETH69, 1, genesis.Hash(), forkid.ID{Hash: [4]byte{0x00, 0x01, 0x02, 0x03}}, 0, number, head.Hash()},
+			want: errForkIDRejected,
+		},
+		{
+			code: StatusMsg, data: StatusPacket69{ETH69, 1, genesis.Hash(), forkID, number + 1, number, head.Hash()},
+			want: errInvalidBlockRange,
+		},
+		{
+			code: StatusMsg, data: StatusPacket69{ETH69, 1, genesis.Hash(), forkID, 1, number, head.Hash()},
+			want: nil,
+		},
+	}
+	for i, test := range tests {
+		// Create the two peers to shake with each other
+		app, net := p2p.MsgPipe()
+		defer app.Close()
+		defer net.Close()
+
+		peer := NewPeer(ETH69, p2p.NewPeer(enode.ID{}, "peer", nil), net, nil)
+		defer peer.Close()
+
+		// Send the test status with one peer, drain the local one with the other
+		go p2p.Send(app, test.code, test.data)
+		go func() {
+			if msg, err := app.ReadMsg(); err == nil {
+				msg.Discard()
+			}
+		}()
+		err := peer.Handshake(1, nil, common.Hash{}, genesis.Hash(), forkID, forkid.NewFilter(backend.chain), local)
+		if !errors.Is(err, test.want) {
+			t.Errorf("test %d: wrong error: got %v, want %v", i, err, test.want)
+		}
+		if test.want != nil {
+			continue
+		}
+		if earliest, latest, ok := peer.BlockRange(); !ok || earliest != 1 || latest != number {
+			t.Errorf("test %d: block range mismatch: have [%d, %d] (%v), want [1, %d]", i, earliest, latest, ok, number)
+		}
+		if hash, td := peer.Head(); hash != head.Hash() || td.Sign() != 0 {
+			t.Errorf("test %d: head mismatch: have %x (td %v), want %x (td 0)", i, hash, td, head.Hash())
+		}
+	}
+}
@@ -54,6 +54,10 @@ const (
 	// dropping broadcasts. Similarly to block propagations, there's no point to queue
 	// above some healthy uncle limit, so use that.
 	maxQueuedBlockAnns = 4
+
+	// maxCompactBlocks is the maximum number of blocks propagated in compact form
+	// to keep around for serving the transactions missing on the remote side.
+	maxCompactBlocks = 4
 )
 
 // max is a helper function which returns the larger of the two given integers.
@@ -75,9 +79,13 @@ type Peer struct {
 	head common.Hash // Latest advertised head block hash
 	td   *big.Int    // Latest advertised head block total difficulty
 
+	earliest uint64 // Earliest block available, advertised since eth/69
+	latest   uint64 // Latest block available, advertised since eth/69
+
 	knownBlocks     *knownCache            // Set of block hashes known to be known by this peer
 	queuedBlocks    chan *blockPropagation // Queue of blocks to broadcast to the peer
 	queuedBlockAnns chan *types.Block      // Queue of blocks to announce to the peer
+	compactBlocks   []*types.Block         // Blocks recently propagated in compact form, since eth/70
 
 	txpool      TxPool             // Transaction pool used by the broadcasters for liveness checks
 	knownTxs    *knownCache        // Set of transaction hashes known to be known by this peer
@@ -156,6 +164,29 @@ func (p *Peer) SetHead(hash common.Hash, td *big.Int) {
 	p.td.Set(td)
 }
 
+// BlockRange retrieves the range of blocks the peer advertised to be able to
+// serve. The range is only known for eth/69 peers and later, otherwise ok is
+// false.
+func (p *Peer) BlockRange() (earliest uint64, latest uint64, ok bool) {
+	if p.version < ETH69 {
+		return 0, 0, false
+	}
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.earliest, p.latest, true
+}
+
+// SetBlockRange updates the range of blocks the peer is able to serve, along
+// with its head block hash.
+func (p *Peer) SetBlockRange(earliest uint64, latest uint64, hash common.Hash) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.earliest, p.latest = earliest, latest
+	copy(p.head[:], hash[:])
+}
+
 // KnownBlock returns whether peer is known to already have a block.
 func (p *Peer) KnownBlock(hash common.Hash) bool {
 	return p.knownBlocks.Contains(hash)
@@ -287,6 +318,12 @@ func (p *Peer) AsyncSendNewBlockHash(block *types.Block) {
 	}
 }
 
+// SendBlockRangeUpdate announces a change in the range of blocks available
+// locally to an eth/69 peer.
+func (p *Peer) SendBlockRangeUpdate(update BlockRangeUpdatePacket) error {
+	return p2p.Send(p.rw, BlockRangeUpdateMsg, &update)
+}
+
 // SendNewBlock propagates an entire block to a remote peer.
 func (p *Peer) SendNewBlock(block *types.Block, td *big.Int) error {
 	// Mark all the block hash as known, but ensure we don't overflow our limits
@@ -297,6 +334,50 @@ func (p *Peer) SendNewBlock(block *types.Block, td *big.Int) error {
 	})
 }
 
+// SendNewCompactBlock propagates a block to a remote peer, replacing the
+// transactions with their short identifiers. The block is retained to serve the
+// transactions the peer doesn't have.
+func (p *Peer) SendNewCompactBlock(block *types.Block, td *big.Int) error {
+	// Mark all the block hash as known, but ensure we don't overflow our limits
+	p.knownBlocks.Add(block.Hash())
+
+	p.lock.Lock()
+	p.compactBlocks = append(p.compactBlocks, block)
+	if len(p.compactBlocks) > maxCompactBlocks {
+		p.compactBlocks = p.compactBlocks[len(p.compactBlocks)-maxCompactBlocks:]
+	}
+	p.lock.Unlock()
+
+	var (
+		salt = rand.Uint64()
+		txs  = block.Transactions()
+		ids  = make([]ShortTxID, len(txs))
+	)
+	for i, tx := range txs {
+		ids[i] = NewShortTxID(salt, tx.Hash())
+	}
+	return p2p.Send(p.rw, NewCompactBlockMsg, &NewCompactBlockPacket{
+		Header:   block.Header(),
+		Uncles:   block.Uncles(),
+		TD:       td,
+		Salt:     salt,
+		ShortIDs: ids,
+	})
+}
+
+// compactBlock retrieves a block recently propagated in compact form to the peer.
+func (p *Peer) compactBlock(hash common.Hash) *types.Block {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, block := range p.compactBlocks {
+		if block.Hash() == hash {
+			return block
+		}
+	}
+	return nil
+}
+
 // AsyncSendNewBlock queues an entire block for propagation to a remote peer. If
 // the peer's broadcast queue is full, the event is silently dropped.
 func (p *Peer) AsyncSendNewBlock(block *types.Block, td *big.Int) {
@@ -326,6 +407,14 @@ func (p *Peer) ReplyBlockBodiesRLP(id uint64, bodies []rlp.RawValue) error {
 	})
 }
 
+// ReplyCompactBlockTxs is the eth/70 response to GetCompactBlockTxs.
+func (p *Peer) ReplyCompactBlockTxs(id uint64, txs []*types.Transaction) error {
+	return p2p.Send(p.rw, CompactBlockTxsMsg, &CompactBlockTxsPacket70{
+		RequestId:             id,
+		CompactBlockTxsPacket: txs,
+	})
+}
+
 // ReplyNodeData is the eth/66 response to GetNodeData.
 func (p *Peer) ReplyNodeData(id uint64, data [][]byte) error {
 	return p2p.Send(p.rw, NodeDataMsg, &NodeDataPacket66{
@@ -445,6 +534,29 @@ func (p *Peer) RequestBodies(hashes []common.Hash, sink chan *Response) (*Reques
 	return req, nil
 }
 
+// RequestCompactBlockTxs fetches the transactions of a compact block at the
+// given indexes, which couldn't be found locally.
+func (p *Peer) RequestCompactBlockTxs(hash common.Hash, indexes []uint64, sink chan *Response) (*Request, error) {
+	p.Log().Debug("Fetching compact block transactions", "hash", hash, "count", len(indexes))
+	id := rand.Uint64()
+
+	req := &Request{
+		id:   id,
+		sink: sink,
+		code: GetCompactBlockTxsMsg,
+		want: CompactBlockTxsMsg,
+		data: &GetCompactBlockTxsPacket{
+			RequestId: id,
+			BlockHash: hash,
+			Indexes:   indexes,
+		},
+	}
+	if err := p.dispatchRequest(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
 // RequestNodeData fetches a batch of arbitrary data from a node's known state
 // data, corresponding to the specified hashes.
 func (p *Peer) RequestNodeData(hashes []common.Hash, sink chan *Response) (*Request, error) {
@@ -17,6 +17,7 @@
 package eth
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -25,6 +26,7 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/common"
 	"github.com/rethereum-blockchain/go-rethereum/core/forkid"
 	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
 	"github.com/rethereum-blockchain/go-rethereum/rlp"
 )
 
@@ -33,6 +35,8 @@ const (
 	ETH66 = 66
 	ETH67 = 67
 	ETH68 = 68
+	ETH69 = 69
+	ETH70 = 70
 )
 
 // ProtocolName is the official short name of the `eth` protocol used during
@@ -41,11 +45,11 @@ const ProtocolName = "eth"
 
 // ProtocolVersions are the supported versions of the `eth` protocol (first
 // is primary).
-var ProtocolVersions = []uint{ETH68, ETH67, ETH66}
+var ProtocolVersions = []uint{ETH70, ETH69, ETH68, ETH67, ETH66}
 
 // protocolLengths are the number of implemented message corresponding to
 // different protocol versions.
-var protocolLengths = map[uint]uint64{ETH68: 17, ETH67: 17, ETH66: 17}
+var protocolLengths = map[uint]uint64{ETH70: 21, ETH69: 18, ETH68: 17, ETH67: 17, ETH66: 17}
 
 // maxMessageSize is the maximum cap on the size of a protocol message.
 const maxMessageSize = 10 * 1024 * 1024
@@ -66,6 +70,10 @@ const (
 	NewPooledTransactionHashesMsg = 0x08
 	GetPooledTransactionsMsg      = 0x09
 	PooledTransactionsMsg         = 0x0a
+	BlockRangeUpdateMsg           = 0x11
+	NewCompactBlockMsg            = 0x12
+	GetCompactBlockTxsMsg         = 0x13
+	CompactBlockTxsMsg            = 0x14
 )
 
 var (
@@ -77,6 +85,8 @@ var (
 	errNetworkIDMismatch       = errors.New("network ID mismatch")
 	errGenesisMismatch         = errors.New("genesis mismatch")
 	errForkIDRejected          = errors.New("fork ID rejected")
+	errInvalidBlockRange       = errors.New("invalid block range")
+	errInvalidTxIndex          = errors.New("invalid transaction index")
 )
 
 // Packet represents a p2p message in the `eth` protocol.
@@ -95,6 +105,27 @@ type StatusPacket struct {
 	ForkID          forkid.ID
 }
 
+// StatusPacket69 is the network packet for the status message for eth/69. The
+// total difficulty is dropped in favour of the range of blocks the peer is able
+// to serve, the latest of which denotes its head.
+type StatusPacket69 struct {
+	ProtocolVersion uint32
+	NetworkID       uint64
+	Genesis         common.Hash
+	ForkID          forkid.ID
+	EarliestBlock   uint64
+	LatestBlock     uint64
+	LatestBlockHash common.Hash
+}
+
+// BlockRangeUpdatePacket is the network packet announcing a change in the range
+// of blocks a peer is able to serve.
+type BlockRangeUpdatePacket struct {
+	EarliestBlock   uint64
+	LatestBlock     uint64
+	LatestBlockHash common.Hash
+}
+
 // NewBlockHashesPacket is the network packet for the block announcements.
 type NewBlockHashesPacket []struct {
 	Hash   common.Hash // Hash of one particular block being announced
@@ -206,6 +237,65 @@ func (request *NewBlockPacket) sanityCheck() error {
 	return nil
 }
 
+// ShortTxID is the short identifier of a transaction in a compact block. It is
+// derived from the transaction hash and a salt, which keeps third parties from
+// crafting colliding transactions ahead of time. The salt is picked by the sender
+// of the block though, who can craft collisions at will, so reconstructed blocks
+// must always be verified against the header.
+type ShortTxID [6]byte
+
+// NewShortTxID computes the short identifier of a transaction with the given salt.
+func NewShortTxID(salt uint64, hash common.Hash) ShortTxID {
+	var buf [8 + common.HashLength]byte
+	binary.BigEndian.PutUint64(buf[:8], salt)
+	copy(buf[8:], hash[:])
+
+	var id ShortTxID
+	copy(id[:], crypto.Keccak256(buf[:]))
+	return id
+}
+
+// NewCompactBlockPacket is the network packet for the compact block propagation
+// message since eth/70. Instead of the transactions, only their short identifiers
+// are sent, the receiver is expected to find them in its transaction pool.
+type NewCompactBlockPacket struct {
+	Header   *types.Header
+	Uncles   []*types.Header
+	TD       *big.Int
+	Salt     uint64
+	ShortIDs []ShortTxID
+}
+
+// sanityCheck verifies that the values are reasonable, as a DoS protection
+func (request *NewCompactBlockPacket) sanityCheck() error {
+	if err := request.Header.SanityCheck(); err != nil {
+		return err
+	}
+	if tdlen := request.TD.BitLen(); tdlen > 100 {
+		return fmt.Errorf("too large block TD: bitlen %d", tdlen)
+	}
+	return nil
+}
+
+// GetCompactBlockTxsPacket represents a query for the transactions of a compact
+// block, which the requester couldn't find locally.
+type GetCompactBlockTxsPacket struct {
+	RequestId uint64
+	BlockHash common.Hash // Hash of the compact block
+	Indexes   []uint64    // Indexes of the requested transactions in the block
+}
+
+// CompactBlockTxsPacket is the network packet for the transactions of a compact
+// block, in the order they were requested.
+type CompactBlockTxsPacket []*types.Transaction
+
+// CompactBlockTxsPacket70 is the network packet for the transactions of a compact
+// block over eth/70.
+type CompactBlockTxsPacket70 struct {
+	RequestId uint64
+	CompactBlockTxsPacket
+}
+
 // GetBlockBodiesPacket represents a block body query.
 type GetBlockBodiesPacket []common.Hash
 
@@ -342,6 +432,12 @@ type PooledTransactionsRLPPacket66 struct {
 func (*StatusPacket) Name() string { return "Status" }
 func (*StatusPacket) Kind() byte   { return StatusMsg }
 
+func (*StatusPacket69) Name() string { return "Status" }
+func (*StatusPacket69) Kind() byte   { return StatusMsg }
+
+func (*BlockRangeUpdatePacket) Name() string { return "BlockRangeUpdate" }
+func (*BlockRangeUpdatePacket) Kind() byte   { return BlockRangeUpdateMsg }
+
 func (*NewBlockHashesPacket) Name() string { return "NewBlockHashes" }
 func (*NewBlockHashesPacket) Kind() byte   { return NewBlockHashesMsg }
 
@@ -363,6 +459,15 @@ func (*BlockBodiesPacket) Kind() byte   { return BlockBodiesMsg }
 func (*NewBlockPacket) Name() string { return "NewBlock" }
 func (*NewBlockPacket) Kind() byte   { return NewBlockMsg }
 
+func (*NewCompactBlockPacket) Name() string { return "NewCompactBlock" }
+func (*NewCompactBlockPacket) Kind() byte   { return NewCompactBlockMsg }
+
+func (*GetCompactBlockTxsPacket) Name() string { return "GetCompactBlockTxs" }
+func (*GetCompactBlockTxsPacket) Kind() byte   { return GetCompactBlockTxsMsg }
+
+func (*CompactBlockTxsPacket) Name() string { return "CompactBlockTxs" }
+func (*CompactBlockTxsPacket) Kind() byte   { return CompactBlockTxsMsg }
+
 func (*GetNodeDataPacket) Name() string { return "GetNodeData" }
 func (*GetNodeDataPacket) Kind() byte   { return GetNodeDataMsg }
 
@@ -20,6 +20,9 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/rlp"
 )
 
+// ServingTopic is the discovery topic advertised by nodes serving snap sync.
+const ServingTopic = "snap-serving"
+
 // enrEntry is the ENR entry which advertises `snap` protocol on the discovery.
 type enrEntry struct {
 	// Ignore additional fields (for forward compatibility).
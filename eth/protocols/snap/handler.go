@@ -18,6 +18,7 @@ package snap
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"time"
 
@@ -81,8 +82,9 @@ type Backend interface {
 	Handle(peer *Peer, packet Packet) error
 }
 
-// MakeProtocols constructs the P2P protocol definitions for `snap`.
-func MakeProtocols(backend Backend, dnsdisc enode.Iterator) []p2p.Protocol {
+// MakeProtocols constructs the P2P protocol definitions for `snap`. The optional
+// limiter throttles the responses served to remote peers.
+func MakeProtocols(backend Backend, dnsdisc enode.Iterator, limiter *p2p.ServeLimiter) []p2p.Protocol {
 	// Filter the discovery iterator for nodes advertising snap support.
 	dnsdisc = enode.Filter(dnsdisc, func(n *enode.Node) bool {
 		var snap enrEntry
@@ -98,6 +100,7 @@ func MakeProtocols(backend Backend, dnsdisc enode.Iterator) []p2p.Protocol {
 			Version: version,
 			Length:  protocolLengths[version],
 			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				rw = limiter.Wrap(p, rw, AccountRangeMsg, StorageRangesMsg, ByteCodesMsg, TrieNodesMsg)
 				return backend.RunPeer(NewPeer(version, p, rw), func(peer *Peer) error {
 					return Handle(backend, peer)
 				})
@@ -121,11 +124,21 @@ func Handle(backend Backend, peer *Peer) error {
 	for {
 		if err := HandleMessage(backend, peer); err != nil {
 			peer.Log().Debug("Message handling failed in `snap`", "err", err)
+			if isViolation(err) {
+				peer.Penalize(p2p.PenaltyViolation, err.Error())
+			}
 			return err
 		}
 	}
 }
 
+// isViolation reports whether a message handling error was caused by the remote
+// peer breaking the protocol, as opposed to a network or local failure.
+func isViolation(err error) bool {
+	return errors.Is(err, errDecode) || errors.Is(err, errMsgTooLarge) ||
+		errors.Is(err, errInvalidMsgCode) || errors.Is(err, errBadRequest)
+}
+
 // HandleMessage is invoked whenever an inbound message is received from a
 // remote peer on the `snap` protocol. The remote connection is torn down upon
 // returning any error.
@@ -158,10 +171,12 @@ func HandleMessage(backend Backend, peer *Peer) error {
 		// Decode the account retrieval request
 		var req GetAccountRangePacket
 		if err := msg.Decode(&req); err != nil {
+			recordServe(GetAccountRangeMsg, false)
 			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
 		}
 		// Service the request, potentially returning nothing in case of errors
 		accounts, proofs := ServiceGetAccountRangeQuery(backend.Chain(), &req)
+		recordServe(GetAccountRangeMsg, true)
 
 		// Send back anything accumulated (or empty in case of errors)
 		return p2p.Send(peer.rw, AccountRangeMsg, &AccountRangePacket{
@@ -190,10 +205,12 @@ func HandleMessage(backend Backend, peer *Peer) error {
 		// Decode the storage retrieval request
 		var req GetStorageRangesPacket
 		if err := msg.Decode(&req); err != nil {
+			recordServe(GetStorageRangesMsg, false)
 			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
 		}
 		// Service the request, potentially returning nothing in case of errors
 		slots, proofs := ServiceGetStorageRangesQuery(backend.Chain(), &req)
+		recordServe(GetStorageRangesMsg, true)
 
 		// Send back anything accumulated (or empty in case of errors)
 		return p2p.Send(peer.rw, StorageRangesMsg, &StorageRangesPacket{
@@ -224,10 +241,12 @@ func HandleMessage(backend Backend, peer *Peer) error {
 		// Decode bytecode retrieval request
 		var req GetByteCodesPacket
 		if err := msg.Decode(&req); err != nil {
+			recordServe(GetByteCodesMsg, false)
 			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
 		}
 		// Service the request, potentially returning nothing in case of errors
 		codes := ServiceGetByteCodesQuery(backend.Chain(), &req)
+		recordServe(GetByteCodesMsg, true)
 
 		// Send back anything accumulated (or empty in case of errors)
 		return p2p.Send(peer.rw, ByteCodesMsg, &ByteCodesPacket{
@@ -249,10 +268,12 @@ func HandleMessage(backend Backend, peer *Peer) error {
 		// Decode trie node retrieval request
 		var req GetTrieNodesPacket
 		if err := msg.Decode(&req); err != nil {
+			recordServe(GetTrieNodesMsg, false)
 			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
 		}
 		// Service the request, potentially returning nothing in case of errors
 		nodes, err := ServiceGetTrieNodesQuery(backend.Chain(), &req, start)
+		recordServe(GetTrieNodesMsg, err == nil)
 		if err != nil {
 			return err
 		}
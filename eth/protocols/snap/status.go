@@ -0,0 +1,214 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+)
+
+// statusRefreshInterval is the minimum time between refreshes of the status
+// report while syncing.
+const statusRefreshInterval = time.Second
+
+// SyncStatus is a detailed report of the snap sync progress, along with the
+// statistics of the requests served to remote peers.
+type SyncStatus struct {
+	Running   bool        `json:"running"`   // Whether a sync cycle is in progress
+	Phase     string      `json:"phase"`     // Phase of the last sync cycle: "snap" or "heal"
+	Root      common.Hash `json:"root"`      // State root being synced
+	Started   uint64      `json:"started"`   // Unix timestamp of the first sync cycle start
+	Remaining float64     `json:"remaining"` // Fraction of the account hash space left to download
+
+	AccountTasks []*AccountTaskStatus     `json:"accountTasks"` // Account ranges still being downloaded
+	Healing      HealStatus               `json:"healing"`
+	Peers        map[string]*PeerRates    `json:"peers"`   // Measured throughput of the peers synced from
+	Serving      map[string]*ServeCounter `json:"serving"` // Requests served to remote peers, by message
+}
+
+// AccountTaskStatus reports the progress of a chunk of the account hash space.
+type AccountTaskStatus struct {
+	Next         common.Hash          `json:"next"`         // Next account to download
+	Last         common.Hash          `json:"last"`         // Last account of the chunk
+	Remaining    float64              `json:"remaining"`    // Fraction of the hash space between next and last
+	StorageTasks []*StorageTaskStatus `json:"storageTasks"` // Large contracts whose storage is downloaded in chunks
+}
+
+// StorageTaskStatus reports the remaining storage ranges of a large contract.
+type StorageTaskStatus struct {
+	Account common.Hash    `json:"account"`
+	Ranges  []StorageRange `json:"ranges"`
+}
+
+// StorageRange is a range of storage slots still being downloaded.
+type StorageRange struct {
+	Next common.Hash `json:"next"`
+	Last common.Hash `json:"last"`
+}
+
+// HealStatus reports the progress of the healing phase.
+type HealStatus struct {
+	PendingTrienodes uint64  `json:"pendingTrienodes"` // Trie nodes waiting to be retrieved
+	PendingBytecodes uint64  `json:"pendingBytecodes"` // Bytecodes waiting to be retrieved
+	Scheduled        int     `json:"scheduled"`        // Items queued in the heal scheduler
+	Rate             float64 `json:"rate"`             // Trie nodes processed per second
+	ETA              uint64  `json:"eta"`              // Estimated seconds until the current queue is drained
+}
+
+// PeerRates is the measured throughput of a peer, in items per second.
+type PeerRates struct {
+	Accounts  float64 `json:"accounts"`
+	Storage   float64 `json:"storage"`
+	Bytecodes float64 `json:"bytecodes"`
+	Trienodes float64 `json:"trienodes"`
+	RoundTrip uint64  `json:"roundTrip"` // Estimated round trip time in milliseconds
+}
+
+// ServeCounter counts the requests of one kind served to remote peers. Requests
+// are rejected if they can't be decoded or are invalid. Responses which are empty,
+// e.g. because the requested state is not available, still count as served.
+type ServeCounter struct {
+	Served   uint64 `json:"served"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// serveCounter is the live version of ServeCounter.
+type serveCounter struct {
+	served   atomic.Uint64
+	rejected atomic.Uint64
+}
+
+// serveStats are the counters of all request kinds served by the local node.
+var serveStats = map[uint64]*serveCounter{
+	GetAccountRangeMsg:  new(serveCounter),
+	GetStorageRangesMsg: new(serveCounter),
+	GetByteCodesMsg:     new(serveCounter),
+	GetTrieNodesMsg:     new(serveCounter),
+}
+
+// serveStatNames are the names of the request kinds in the status report.
+var serveStatNames = map[uint64]string{
+	GetAccountRangeMsg:  "accountRange",
+	GetStorageRangesMsg: "storageRanges",
+	GetByteCodesMsg:     "byteCodes",
+	GetTrieNodesMsg:     "trieNodes",
+}
+
+// recordServe counts a request served to a remote peer.
+func recordServe(code uint64, served bool) {
+	if served {
+		serveStats[code].served.Add(1)
+	} else {
+		serveStats[code].rejected.Add(1)
+	}
+}
+
+// Status returns a detailed report of the sync progress. The report of the
+// account tasks and the heal queue is refreshed at most once per second while
+// syncing.
+func (s *Syncer) Status() *SyncStatus {
+	s.lock.RLock()
+	status := &SyncStatus{
+		Running: s.running,
+		Root:    s.root,
+		Peers:   make(map[string]*PeerRates),
+		Serving: make(map[string]*ServeCounter),
+	}
+	if s.extStatus != nil {
+		status.Phase = s.extStatus.Phase
+		status.Started = s.extStatus.Started
+		status.Remaining = s.extStatus.Remaining
+		status.AccountTasks = s.extStatus.AccountTasks
+		status.Healing = s.extStatus.Healing
+	}
+	s.lock.RUnlock()
+
+	for id, stats := range s.rates.Stats() {
+		status.Peers[id] = &PeerRates{
+			Accounts:  stats.Capacity[AccountRangeMsg],
+			Storage:   stats.Capacity[StorageRangesMsg],
+			Bytecodes: stats.Capacity[ByteCodesMsg],
+			Trienodes: stats.Capacity[TrieNodesMsg],
+			RoundTrip: uint64(stats.RoundTrip / time.Millisecond),
+		}
+	}
+	for code, counter := range serveStats {
+		status.Serving[serveStatNames[code]] = &ServeCounter{
+			Served:   counter.served.Load(),
+			Rejected: counter.rejected.Load(),
+		}
+	}
+	return status
+}
+
+// updateStatus refreshes the status report exposed by Status. It must be called
+// from the sync loop with the lock held, as it accesses the tasks and the healer.
+// Unless forced, the report is refreshed at most once per statusRefreshInterval.
+func (s *Syncer) updateStatus(force bool) {
+	if !force && time.Since(s.statusTime) < statusRefreshInterval {
+		return
+	}
+	s.statusTime = time.Now()
+
+	status := &SyncStatus{
+		Phase:        "snap",
+		Started:      uint64(s.startTime.Unix()),
+		AccountTasks: make([]*AccountTaskStatus, 0, len(s.tasks)),
+	}
+	if len(s.tasks) == 0 {
+		status.Phase = "heal"
+	}
+	hashSpaceF := new(big.Float).SetInt(hashSpace)
+	for _, task := range s.tasks {
+		gap := new(big.Int).Sub(task.Last.Big(), task.Next.Big())
+		remaining, _ := new(big.Float).Quo(new(big.Float).SetInt(gap), hashSpaceF).Float64()
+
+		ts := &AccountTaskStatus{
+			Next:         task.Next,
+			Last:         task.Last,
+			Remaining:    remaining,
+			StorageTasks: make([]*StorageTaskStatus, 0, len(task.SubTasks)),
+		}
+		for account, subtasks := range task.SubTasks {
+			st := &StorageTaskStatus{Account: account}
+			for _, subtask := range subtasks {
+				st.Ranges = append(st.Ranges, StorageRange{Next: subtask.Next, Last: subtask.Last})
+			}
+			ts.StorageTasks = append(ts.StorageTasks, st)
+		}
+		sort.Slice(ts.StorageTasks, func(i, j int) bool {
+			return bytes.Compare(ts.StorageTasks[i].Account[:], ts.StorageTasks[j].Account[:]) < 0
+		})
+		status.AccountTasks = append(status.AccountTasks, ts)
+		status.Remaining += remaining
+	}
+	if s.healer != nil {
+		status.Healing.PendingTrienodes = uint64(len(s.healer.trieTasks))
+		status.Healing.PendingBytecodes = uint64(len(s.healer.codeTasks))
+		status.Healing.Scheduled = s.healer.scheduler.Pending()
+	}
+	status.Healing.Rate = s.trienodeHealRate
+	if queued := status.Healing.PendingTrienodes + uint64(status.Healing.Scheduled); queued > 0 && s.trienodeHealRate > 0 {
+		status.Healing.ETA = uint64(float64(queued) / s.trienodeHealRate)
+	}
+	s.extStatus = status
+}
@@ -40,6 +40,7 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/event"
 	"github.com/rethereum-blockchain/go-rethereum/light"
 	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/p2p"
 	"github.com/rethereum-blockchain/go-rethereum/p2p/msgrate"
 	"github.com/rethereum-blockchain/go-rethereum/rlp"
 	"github.com/rethereum-blockchain/go-rethereum/trie"
@@ -397,6 +398,20 @@ type SyncPeer interface {
 	Log() log.Logger
 }
 
+// penalizer is implemented by the sync peers whose reputation is tracked, i.e.
+// the ones connected through the p2p server.
+type penalizer interface {
+	// Penalize reports a misbehaviour of the peer, lowering its reputation.
+	Penalize(penalty int, reason string)
+}
+
+// penalize reports an invalid response of the peer, if its reputation is tracked.
+func penalize(peer SyncPeer, reason string) {
+	if p, ok := peer.(penalizer); ok {
+		p.Penalize(p2p.PenaltyInvalid, reason)
+	}
+}
+
 // Syncer is an Ethereum account and storage trie syncer based on snapshots and
 // the  snap protocol. It's purpose is to download all the accounts and storage
 // slots from remote peers and reassemble chunks of the state trie, on top of
@@ -441,6 +456,9 @@ type Syncer struct {
 	storageBytes   common.StorageSize // Number of storage trie bytes persisted to disk
 
 	extProgress *SyncProgress // progress that can be exposed to external caller.
+	extStatus   *SyncStatus   // detailed progress report exposed for debugging
+	statusTime  time.Time     // time instance when the report was last refreshed
+	running     bool          // whether a sync cycle is in progress
 
 	// Request tracking during healing phase
 	trienodeHealIdlers map[string]struct{} // Peers that aren't serving trie node requests
@@ -580,8 +598,14 @@ func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
 		codeTasks: make(map[common.Hash]struct{}),
 	}
 	s.statelessPeers = make(map[string]struct{})
+	s.running = true
 	s.lock.Unlock()
 
+	defer func() {
+		s.lock.Lock()
+		s.running = false
+		s.lock.Unlock()
+	}()
 	if s.startTime == (time.Time{}) {
 		s.startTime = time.Now()
 	}
@@ -621,6 +645,7 @@ func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
 		s.bytecodeReqs = make(map[uint64]*bytecodeRequest)
 		s.trienodeHealReqs = make(map[uint64]*trienodeHealRequest)
 		s.bytecodeHealReqs = make(map[uint64]*bytecodeHealRequest)
+		s.updateStatus(true)
 		s.lock.Unlock()
 	}()
 	// Keep scheduling sync tasks
@@ -678,6 +703,7 @@ func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
 			BytecodeHealSynced: s.bytecodeHealSynced,
 			BytecodeHealBytes:  s.bytecodeHealBytes,
 		}
+		s.updateStatus(false)
 		s.lock.Unlock()
 		// Wait for something to happen
 		select {
@@ -2406,6 +2432,7 @@ func (s *Syncer) OnAccounts(peer SyncPeer, id uint64, hashes []common.Hash, acco
 	cont, err := trie.VerifyRangeProof(root, req.origin[:], end, keys, accounts, proofdb)
 	if err != nil {
 		logger.Warn("Account range failed proof", "err", err)
+		penalize(peer, "account range failed proof")
 		// Signal this request as failed, and ready for rescheduling
 		s.scheduleRevertAccountRequest(req)
 		return err
@@ -2525,6 +2552,7 @@ func (s *Syncer) onByteCodes(peer SyncPeer, id uint64, bytecodes [][]byte) error
 		}
 		// We've either ran out of hashes, or got unrequested data
 		logger.Warn("Unexpected bytecodes", "count", len(bytecodes)-i)
+		penalize(peer, "unexpected bytecodes")
 		// Signal this request as failed, and ready for rescheduling
 		s.scheduleRevertBytecodeRequest(req)
 		return errors.New("unexpected bytecode")
@@ -2608,12 +2636,14 @@ func (s *Syncer) OnStorage(peer SyncPeer, id uint64, hashes [][]common.Hash, slo
 		s.lock.Unlock()
 		s.scheduleRevertStorageRequest(req) // reschedule request
 		logger.Warn("Hash and slot set size mismatch", "hashset", len(hashes), "slotset", len(slots))
+		penalize(peer, "hash and slot set size mismatch")
 		return errors.New("hash and slot set size mismatch")
 	}
 	if len(hashes) > len(req.accounts) {
 		s.lock.Unlock()
 		s.scheduleRevertStorageRequest(req) // reschedule request
 		logger.Warn("Hash set larger than requested", "hashset", len(hashes), "requested", len(req.accounts))
+		penalize(peer, "hash set larger than requested")
 		return errors.New("hash set larger than requested")
 	}
 	// Response is valid, but check if peer is signalling that it does not have
@@ -2652,6 +2682,7 @@ func (s *Syncer) OnStorage(peer SyncPeer, id uint64, hashes [][]common.Hash, slo
 			if err != nil {
 				s.scheduleRevertStorageRequest(req) // reschedule request
 				logger.Warn("Storage slots failed proof", "err", err)
+				penalize(peer, "storage slots failed proof")
 				return err
 			}
 		} else {
@@ -2667,6 +2698,7 @@ func (s *Syncer) OnStorage(peer SyncPeer, id uint64, hashes [][]common.Hash, slo
 			if err != nil {
 				s.scheduleRevertStorageRequest(req) // reschedule request
 				logger.Warn("Storage range failed proof", "err", err)
+				penalize(peer, "storage range failed proof")
 				return err
 			}
 		}
@@ -2772,6 +2804,7 @@ func (s *Syncer) OnTrieNodes(peer SyncPeer, id uint64, trienodes [][]byte) error
 		}
 		// We've either ran out of hashes, or got unrequested data
 		logger.Warn("Unexpected healing trienodes", "count", len(trienodes)-i)
+		penalize(peer, "unexpected healing trienodes")
 
 		// Signal this request as failed, and ready for rescheduling
 		s.scheduleRevertTrienodeHealRequest(req)
@@ -2876,6 +2909,7 @@ func (s *Syncer) onHealByteCodes(peer SyncPeer, id uint64, bytecodes [][]byte) e
 		}
 		// We've either ran out of hashes, or got unrequested data
 		logger.Warn("Unexpected healing bytecodes", "count", len(bytecodes)-i)
+		penalize(peer, "unexpected healing bytecodes")
 		// Signal this request as failed, and ready for rescheduling
 		s.scheduleRevertBytecodeHealRequest(req)
 		return errors.New("unexpected healing bytecode")
@@ -661,6 +661,64 @@ func TestSync(t *testing.T) {
 	verifyTrie(syncer.db, sourceAccountTrie.Hash(), t)
 }
 
+// TestSyncStatus tests the detailed progress report of both an interrupted and
+// a completed sync.
+func TestSyncStatus(t *testing.T) {
+	t.Parallel()
+
+	var (
+		once   sync.Once
+		cancel = make(chan struct{})
+		term   = func() {
+			once.Do(func() {
+				close(cancel)
+			})
+		}
+	)
+	nodeScheme, sourceAccountTrie, elems := makeAccountTrieNoStorage(100)
+
+	// Interrupt the sync right away, leaving all account ranges unfilled.
+	stalled := newTestPeer("stalled", t, term)
+	stalled.accountRequestHandler = func(t *testPeer, requestId uint64, root common.Hash, origin common.Hash, limit common.Hash, cap uint64) error {
+		term()
+		return nil
+	}
+	syncer := setupSyncer(nodeScheme, stalled)
+	if err := syncer.Sync(sourceAccountTrie.Hash(), cancel); err != ErrCancelled {
+		t.Fatalf("wrong sync error: %v", err)
+	}
+	status := syncer.Status()
+	if status.Running || status.Phase != "snap" || status.Root != sourceAccountTrie.Hash() {
+		t.Fatalf("wrong status: running %v, phase %q, root %x", status.Running, status.Phase, status.Root)
+	}
+	if len(status.AccountTasks) != accountConcurrency {
+		t.Fatalf("wrong number of account tasks: have %d, want %d", len(status.AccountTasks), accountConcurrency)
+	}
+	if status.Remaining < 0.99 || status.Remaining > 1 {
+		t.Errorf("wrong remaining fraction %v", status.Remaining)
+	}
+	if len(status.Serving) != 4 {
+		t.Errorf("wrong number of serving counters: %d", len(status.Serving))
+	}
+
+	// Complete the sync with a responsive peer.
+	source := newTestPeer("source", t, term)
+	source.accountTrie = sourceAccountTrie.Copy()
+	source.accountValues = elems
+
+	syncer = setupSyncer(nodeScheme, source)
+	if err := syncer.Sync(sourceAccountTrie.Hash(), make(chan struct{})); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	status = syncer.Status()
+	if status.Running || status.Phase != "heal" || len(status.AccountTasks) != 0 || status.Remaining != 0 {
+		t.Fatalf("wrong status: running %v, phase %q, tasks %d, remaining %v", status.Running, status.Phase, len(status.AccountTasks), status.Remaining)
+	}
+	if rates := status.Peers["source"]; rates == nil || rates.Accounts == 0 {
+		t.Errorf("missing account rate of peer: %+v", rates)
+	}
+}
+
 // TestSyncTinyTriePanic tests a basic sync with one peer, and a tiny trie. This caused a
 // panic within the prover
 func TestSyncTinyTriePanic(t *testing.T) {
@@ -1389,7 +1447,7 @@ func makeAccountTrieNoStorage(n int) (string, *trie.Trie, entrySlice) {
 	// Commit the state changes into db and re-create the trie
 	// for accessing later.
 	root, nodes := accTrie.Commit(false)
-	db.Update(trie.NewWithNodeSet(nodes))
+	db.Update(root, types.EmptyRootHash, trie.NewWithNodeSet(nodes))
 
 	accTrie, _ = trie.New(trie.StateTrieID(root), db)
 	return db.Scheme(), accTrie, entries
@@ -1451,7 +1509,7 @@ func makeBoundaryAccountTrie(n int) (string, *trie.Trie, entrySlice) {
 	// Commit the state changes into db and re-create the trie
 	// for accessing later.
 	root, nodes := accTrie.Commit(false)
-	db.Update(trie.NewWithNodeSet(nodes))
+	db.Update(root, types.EmptyRootHash, trie.NewWithNodeSet(nodes))
 
 	accTrie, _ = trie.New(trie.StateTrieID(root), db)
 	return db.Scheme(), accTrie, entries
@@ -1500,7 +1558,7 @@ func makeAccountTrieWithStorageWithUniqueStorage(accounts, slots int, code bool)
 	nodes.Merge(set)
 
 	// Commit gathered dirty nodes into database
-	db.Update(nodes)
+	db.Update(root, types.EmptyRootHash, nodes)
 
 	// Re-create tries with new root
 	accTrie, _ = trie.New(trie.StateTrieID(root), db)
@@ -1565,7 +1623,7 @@ func makeAccountTrieWithStorage(accounts, slots int, code, boundary bool) (strin
 	nodes.Merge(set)
 
 	// Commit gathered dirty nodes into database
-	db.Update(nodes)
+	db.Update(root, types.EmptyRootHash, nodes)
 
 	// Re-create tries with new root
 	accTrie, err := trie.New(trie.StateTrieID(root), db)
@@ -24,6 +24,7 @@ import (
 
 	"github.com/rethereum-blockchain/go-rethereum/common"
 	"github.com/rethereum-blockchain/go-rethereum/core"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
 	"github.com/rethereum-blockchain/go-rethereum/core/state"
 	"github.com/rethereum-blockchain/go-rethereum/core/types"
 	"github.com/rethereum-blockchain/go-rethereum/core/vm"
@@ -64,6 +65,11 @@ func (eth *Ethereum) StateAtBlock(ctx context.Context, block *types.Block, reexe
 		report   = true
 		origin   = block.NumberU64()
 	)
+	// The path-based scheme only retains the recent states in the live database
+	// and the historical ones can't be regenerated on an ephemeral database.
+	if eth.blockchain.TrieDB().Scheme() == rawdb.PathScheme {
+		return eth.pathStateAtBlock(ctx, block, reexec, base, readOnly, preferDisk)
+	}
 	// The state is only for reading purposes, check the state presence in
 	// live database.
 	if readOnly {
@@ -188,6 +194,88 @@ func (eth *Ethereum) StateAtBlock(ctx context.Context, block *types.Block, reexe
 	return statedb, func() { database.TrieDB().Dereference(block.Root()) }, nil
 }
 
+// detachedDatabase serves the state from the live database, but absorbs the
+// commits into an ephemeral trie database, isolating the live one.
+type detachedDatabase struct {
+	state.Database
+	triedb *trie.Database
+}
+
+// TrieDB implements state.Database, returning the ephemeral trie database.
+func (db *detachedDatabase) TrieDB() *trie.Database {
+	return db.triedb
+}
+
+// pathStateAtBlock retrieves the state of the given block in the path-based
+// scheme. Only the recent states are retained in the live database, the older
+// ones are regenerated in memory by re-executing at most reexec blocks on top
+// of a retained ancestor, or just the given block on top of the provided base.
+// Re-executed blocks are never committed, and states requested for writing are
+// detached from the live database so that nothing the caller commits can end
+// up in it.
+func (eth *Ethereum) pathStateAtBlock(ctx context.Context, block *types.Block, reexec uint64, base *state.StateDB, readOnly bool, preferDisk bool) (*state.StateDB, tracers.StateReleaseFunc, error) {
+	open := func(root common.Hash) (*state.StateDB, error) {
+		if readOnly {
+			return eth.blockchain.StateAt(root)
+		}
+		database := &detachedDatabase{
+			Database: eth.blockchain.StateCache(),
+			triedb:   trie.NewDatabase(rawdb.NewMemoryDatabase()),
+		}
+		return state.New(root, database, nil)
+	}
+	var (
+		statedb *state.StateDB
+		pending []*types.Block // Blocks to re-execute, in reverse order
+		err     error
+	)
+	if base != nil {
+		if preferDisk {
+			if statedb, err = open(block.Root()); err == nil {
+				return statedb, noopReleaser, nil
+			}
+		}
+		// The optional base statedb is given, re-execute the block on top
+		statedb, pending = base, []*types.Block{block}
+	} else {
+		if statedb, err = open(block.Root()); err == nil {
+			return statedb, noopReleaser, nil
+		}
+		// Walk back to the nearest ancestor whose state is still retained
+		current := block
+		for i := uint64(0); i < reexec && statedb == nil; i++ {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+			if current.NumberU64() == 0 {
+				return nil, nil, errors.New("genesis state is missing")
+			}
+			parent := eth.blockchain.GetBlock(current.ParentHash(), current.NumberU64()-1)
+			if parent == nil {
+				return nil, nil, fmt.Errorf("missing block %v %d", current.ParentHash(), current.NumberU64()-1)
+			}
+			pending, current = append(pending, current), parent
+			statedb, _ = open(current.Root())
+		}
+		if statedb == nil {
+			return nil, nil, fmt.Errorf("historical state is not available for block %d (path scheme, reexec=%d)", block.NumberU64(), reexec)
+		}
+	}
+	for i := len(pending) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		current := pending[i]
+		if _, _, _, err := eth.blockchain.Processor().Process(current, statedb, vm.Config{}); err != nil {
+			return nil, nil, fmt.Errorf("processing block %d failed: %v", current.NumberU64(), err)
+		}
+		if root := statedb.IntermediateRoot(eth.blockchain.Config().IsEIP158(current.Number())); root != current.Root() {
+			return nil, nil, fmt.Errorf("state root mismatch after block %d: have %x, want %x", current.NumberU64(), root, current.Root())
+		}
+	}
+	return statedb, noopReleaser, nil
+}
+
 // stateAtTransaction returns the execution environment of a certain transaction.
 func (eth *Ethereum) stateAtTransaction(ctx context.Context, block *types.Block, txIndex int, reexec uint64) (*core.Message, vm.BlockContext, *state.StateDB, tracers.StateReleaseFunc, error) {
 	// Short circuit if it's genesis block.
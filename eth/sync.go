@@ -74,7 +74,7 @@ type chainSyncer struct {
 type chainSyncOp struct {
 	mode downloader.SyncMode
 	peer *eth.Peer
-	td   *big.Int
+	td   *big.Int // Total difficulty of the peer's head, nil if unknown
 	head common.Hash
 }
 
@@ -185,6 +185,21 @@ func (cs *chainSyncer) nextSyncOp() *chainSyncOp {
 	mode, ourTD := cs.modeAndLocalHead()
 	op := peerToSyncOp(mode, peer)
 	if op.td.Cmp(ourTD) <= 0 {
+		// Peers from eth/69 onwards don't advertise their total difficulty, it's
+		// only known from their block propagations or if their head is known
+		// locally. Sync with them only once their total difficulty is known, as
+		// the downloader relies on it to detect stalling peers.
+		if peer := cs.handler.peers.peerWithHighestBlock(); peer != nil {
+			if _, latest, _ := peer.BlockRange(); latest > cs.handler.chain.CurrentHeader().Number.Uint64() {
+				head, _ := peer.Head()
+				if td := cs.handler.chain.GetTd(head, latest); td != nil {
+					peer.SetHead(head, td)
+					if td.Cmp(ourTD) > 0 {
+						return &chainSyncOp{mode: mode, peer: peer, td: td, head: head}
+					}
+				}
+			}
+		}
 		// We seem to be in sync according to the legacy rules. In the merge
 		// world, it can also mean we're stuck on the merge block, waiting for
 		// a beacon client. In the latter case, notify the user.
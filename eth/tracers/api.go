@@ -66,6 +66,11 @@ const (
     // for tracing. The creation of trace state will be paused if the unused
     // trace states exceed this limit.
     maximumPendingTraceStates = 128
+
+    // maxTraceTransactionsBatch is the maximum number of transactions which can
+    // be traced by a single debug_traceTransactions call or traceTransactionsStream
+    // subscription.
+    maxTraceTransactionsBatch = 256
 )
 
 var errTxNotFound = errors.New("transaction not found")
@@ -591,7 +596,7 @@ func (api *API) traceBlock(ctx context.Context, block *types.Block, config *Trac
     // in separate worker threads.
     if config != nil && config.Tracer != nil && *config.Tracer != "" {
         if isJS := DefaultDirectory.IsJS(*config.Tracer); isJS {
-            return api.traceBlockParallel(ctx, block, statedb, config)
+            return api.traceBlockParallel(ctx, block, statedb, config, nil)
         }
     }
     // Native tracers have low overhead
@@ -627,7 +632,11 @@ func (api *API) traceBlock(ctx context.Context, block *types.Block, config *Trac
 // traceBlockParallel is for tracers that have a high overhead (read JS tracers). One thread
 // runs along and executes txes without tracing enabled to generate their prestate.
 // Worker threads take the tasks and the prestate and trace them.
-func (api *API) traceBlockParallel(ctx context.Context, block *types.Block, statedb *state.StateDB, config *TraceConfig) ([]*txTraceResult, error) {
+//
+// If a set of transaction indices is given, only those transactions are traced
+// and execution stops after the last one of them. The results of the skipped
+// transactions are left nil.
+func (api *API) traceBlockParallel(ctx context.Context, block *types.Block, statedb *state.StateDB, config *TraceConfig, indices map[int]struct{}) ([]*txTraceResult, error) {
     // Execute all the transaction contained within the block concurrently
     var (
         txs       = block.Transactions()
@@ -637,9 +646,18 @@ func (api *API) traceBlockParallel(ctx context.Context, block *types.Block, stat
         results   = make([]*txTraceResult, len(txs))
         pend      sync.WaitGroup
     )
+    tasks, last := len(txs), len(txs)-1
+    if indices != nil {
+        tasks, last = len(indices), -1
+        for index := range indices {
+            if index > last {
+                last = index
+            }
+        }
+    }
     threads := runtime.NumCPU()
-    if threads > len(txs) {
-        threads = len(txs)
+    if threads > tasks {
+        threads = tasks
     }
     jobs := make(chan *txTraceTask, threads)
     for th := 0; th < threads; th++ {
@@ -669,15 +687,19 @@ func (api *API) traceBlockParallel(ctx context.Context, block *types.Block, stat
     var failed error
 txloop:
     for i, tx := range txs {
+        if i > last {
+            break
+        }
         // Send the trace task over for execution
-        task := &txTraceTask{statedb: statedb.Copy(), index: i}
-        select {
-        case <-ctx.Done():
-            failed = ctx.Err()
-            break txloop
-        case jobs <- task:
+        if _, ok := indices[i]; ok || indices == nil {
+            task := &txTraceTask{statedb: statedb.Copy(), index: i}
+            select {
+            case <-ctx.Done():
+                failed = ctx.Err()
+                break txloop
+            case jobs <- task:
+            }
         }
-
         // Generate the next state snapshot fast without tracing
         msg, _ := core.TransactionToMessage(tx, signer, block.BaseFee())
         statedb.SetTxContext(tx.Hash(), i)
@@ -861,6 +883,169 @@ func (api *API) TraceTransaction(ctx context.Context, hash common.Hash, config *
     return api.traceTx(ctx, msg, txctx, vmctx, statedb, config)
 }
 
+// TraceTransactions returns the structured logs created during the execution of
+// EVM for a batch of transactions, in the order they were requested. The
+// transactions are grouped by block, so the state of every block involved is
+// only regenerated once, instead of once per transaction. Transactions which
+// cannot be traced are reported with an error in their own result.
+func (api *API) TraceTransactions(ctx context.Context, hashes []common.Hash, config *TraceConfig) ([]*txTraceResult, error) {
+    if len(hashes) > maxTraceTransactionsBatch {
+        return nil, fmt.Errorf("too many transactions to trace (%d > %d)", len(hashes), maxTraceTransactionsBatch)
+    }
+    results := make([]*txTraceResult, 0, len(hashes))
+    for res := range api.traceTransactions(ctx, hashes, config) {
+        results = append(results, res)
+    }
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    return results, nil
+}
+
+// TraceTransactionsStream is the subscription version of TraceTransactions,
+// which streams the trace of every transaction back in the order they were
+// requested as soon as it's available.
+func (api *API) TraceTransactionsStream(ctx context.Context, hashes []common.Hash, config *TraceConfig) (*rpc.Subscription, error) {
+    if len(hashes) > maxTraceTransactionsBatch {
+        return nil, fmt.Errorf("too many transactions to trace (%d > %d)", len(hashes), maxTraceTransactionsBatch)
+    }
+    // Tracing a large batch is a **long** operation, only do with subscriptions
+    notifier, supported := rpc.NotifierFromContext(ctx)
+    if !supported {
+        return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+    }
+    sub := notifier.CreateSubscription()
+
+    traceCtx, cancel := context.WithCancel(context.Background())
+    go func() {
+        select {
+        case <-notifier.Closed():
+        case <-traceCtx.Done():
+        }
+        cancel()
+    }()
+    resCh := api.traceTransactions(traceCtx, hashes, config)
+    go func() {
+        defer cancel()
+        for result := range resCh {
+            notifier.Notify(sub.ID, result)
+        }
+    }()
+    return sub, nil
+}
+
+// txTraceRequest is a single transaction of a batch trace, resolved to its
+// location in the chain.
+type txTraceRequest struct {
+    hash    common.Hash // Hash of the transaction to trace
+    index   int         // Position of the transaction in the request
+    txIndex int         // Position of the transaction in its block
+}
+
+// traceTransactions traces a batch of transactions and streams the results back
+// in request order. The transactions are grouped by block, and the blocks are
+// traced in the order of their first appearance in the request, so results can
+// be streamed back as early as possible. The stream is aborted if the context
+// is cancelled.
+func (api *API) traceTransactions(ctx context.Context, hashes []common.Hash, config *TraceConfig) <-chan *txTraceResult {
+    resCh := make(chan *txTraceResult)
+    go func() {
+        defer close(resCh)
+
+        var (
+            results = make([]*txTraceResult, len(hashes))
+            next    int
+
+            blocks  []common.Hash // Blocks in the order of first appearance
+            numbers = make(map[common.Hash]uint64)
+            pending = make(map[common.Hash][]*txTraceRequest)
+        )
+        // flush streams out all the results completed in request order and
+        // reports whether the consumer is still interested in more.
+        flush := func() bool {
+            for ; next < len(results) && results[next] != nil; next++ {
+                select {
+                case resCh <- results[next]:
+                case <-ctx.Done():
+                    return false
+                }
+            }
+            return true
+        }
+        // Resolve all the transactions and group them by block
+        for i, hash := range hashes {
+            tx, blockHash, blockNumber, index, err := api.backend.GetTransaction(ctx, hash)
+            switch {
+            case err != nil:
+                results[i] = &txTraceResult{TxHash: hash, Error: err.Error()}
+            case tx == nil:
+                results[i] = &txTraceResult{TxHash: hash, Error: errTxNotFound.Error()}
+            case blockNumber == 0:
+                results[i] = &txTraceResult{TxHash: hash, Error: "genesis is not traceable"}
+            default:
+                if _, ok := pending[blockHash]; !ok {
+                    blocks = append(blocks, blockHash)
+                    numbers[blockHash] = blockNumber
+                }
+                pending[blockHash] = append(pending[blockHash], &txTraceRequest{hash: hash, index: i, txIndex: int(index)})
+            }
+        }
+        // Regenerate the state of every block once and trace the requested
+        // transactions in it, streaming out the results as they complete
+        for _, blockHash := range blocks {
+            if !flush() {
+                return
+            }
+            reqs := pending[blockHash]
+            traces, err := api.traceBlockTransactions(ctx, numbers[blockHash], blockHash, reqs, config)
+            for _, req := range reqs {
+                switch {
+                case err != nil:
+                    results[req.index] = &txTraceResult{TxHash: req.hash, Error: err.Error()}
+                case traces[req.txIndex] == nil:
+                    results[req.index] = &txTraceResult{TxHash: req.hash, Error: errTxNotFound.Error()}
+                default:
+                    results[req.index] = traces[req.txIndex]
+                }
+            }
+        }
+        flush()
+    }()
+    return resCh
+}
+
+// traceBlockTransactions regenerates the parent state of a block and traces the
+// requested subset of its transactions in parallel. The returned results are
+// indexed by transaction position in the block.
+func (api *API) traceBlockTransactions(ctx context.Context, number uint64, hash common.Hash, reqs []*txTraceRequest, config *TraceConfig) ([]*txTraceResult, error) {
+    block, err := api.blockByNumberAndHash(ctx, rpc.BlockNumber(number), hash)
+    if err != nil {
+        return nil, err
+    }
+    parent, err := api.blockByNumberAndHash(ctx, rpc.BlockNumber(number-1), block.ParentHash())
+    if err != nil {
+        return nil, err
+    }
+    indices := make(map[int]struct{}, len(reqs))
+    for _, req := range reqs {
+        if req.txIndex >= len(block.Transactions()) {
+            return nil, fmt.Errorf("transaction index %d out of range in block %#x", req.txIndex, hash)
+        }
+        indices[req.txIndex] = struct{}{}
+    }
+    reexec := defaultTraceReexec
+    if config != nil && config.Reexec != nil {
+        reexec = *config.Reexec
+    }
+    statedb, release, err := api.backend.StateAtBlock(ctx, parent, reexec, nil, true, false)
+    if err != nil {
+        return nil, err
+    }
+    defer release()
+
+    return api.traceBlockParallel(ctx, block, statedb, config, indices)
+}
+
 // TraceCall lets you trace a given eth_call. It collects the structured logs
 // created during the execution of EVM if the given transaction was added on
 // top of the provided block and returns them as a JSON object.
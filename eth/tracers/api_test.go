@@ -369,6 +369,69 @@ func TestTraceTransaction(t *testing.T) {
 	}
 }
 
+func TestTraceTransactions(t *testing.T) {
+	t.Parallel()
+
+	// Initialize test accounts
+	accounts := newAccounts(2)
+	genesis := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			accounts[0].addr: {Balance: big.NewInt(params.Ether)},
+			accounts[1].addr: {Balance: big.NewInt(params.Ether)},
+		},
+	}
+	var (
+		hashes []common.Hash
+		nonce  uint64
+		signer = types.HomesteadSigner{}
+	)
+	backend := newTestBackend(t, 4, genesis, func(i int, b *core.BlockGen) {
+		// Transfer from account[0] to account[1] twice per block
+		for j := 0; j < 2; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(nonce, accounts[1].addr, big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, accounts[0].key)
+			b.AddTx(tx)
+			hashes = append(hashes, tx.Hash())
+			nonce++
+		}
+	})
+	defer backend.chain.Stop()
+	api := NewAPI(backend)
+
+	// Request transactions out of chain order, with duplicates and a missing one
+	request := []common.Hash{hashes[5], hashes[0], common.Hash{42}, hashes[7], hashes[0], hashes[2], hashes[6]}
+	results, err := api.TraceTransactions(context.Background(), request, nil)
+	if err != nil {
+		t.Fatalf("failed to trace transactions: %v", err)
+	}
+	if len(results) != len(request) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(request))
+	}
+	for i, hash := range request {
+		if results[i].TxHash != hash {
+			t.Errorf("result %d: hash mismatch, have %x, want %x", i, results[i].TxHash, hash)
+		}
+		want, err := api.TraceTransaction(context.Background(), hash, nil)
+		if err != nil {
+			if results[i].Error != err.Error() {
+				t.Errorf("result %d: error mismatch, have %q, want %q", i, results[i].Error, err)
+			}
+			continue
+		}
+		have, _ := json.Marshal(results[i].Result)
+		if string(have) != string(want.(json.RawMessage)) {
+			t.Errorf("result %d: trace mismatch, have %s, want %s", i, have, want)
+		}
+	}
+	// Oversized batches must be rejected
+	if _, err := api.TraceTransactions(context.Background(), make([]common.Hash, maxTraceTransactionsBatch+1), nil); err == nil {
+		t.Fatalf("oversized batch accepted")
+	}
+	if _, err := api.TraceTransactionsStream(context.Background(), make([]common.Hash, maxTraceTransactionsBatch+1), nil); err == nil {
+		t.Fatalf("oversized stream accepted")
+	}
+}
+
 func TestTraceBlock(t *testing.T) {
 	t.Parallel()
 
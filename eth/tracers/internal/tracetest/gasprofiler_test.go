@@ -0,0 +1,167 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracetest
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/vm"
+	"github.com/rethereum-blockchain/go-rethereum/eth/tracers"
+	"github.com/rethereum-blockchain/go-rethereum/params"
+	"github.com/rethereum-blockchain/go-rethereum/tests"
+)
+
+// gasProfile is the result of a gasProfiler run.
+type gasProfile struct {
+	GasUsed      uint64 `json:"gasUsed"`
+	IntrinsicGas uint64 `json:"intrinsicGas"`
+	ExecutionGas uint64 `json:"executionGas"`
+	Refund       uint64 `json:"refund"`
+	Opcodes      []struct {
+		Address common.Address `json:"address"`
+		PC      uint64         `json:"pc"`
+		Op      string         `json:"op"`
+		Count   uint64         `json:"count"`
+		Gas     uint64         `json:"gas"`
+	} `json:"opcodes"`
+	Stacks []struct {
+		Stack string `json:"stack"`
+		Gas   uint64 `json:"gas"`
+	} `json:"stacks"`
+}
+
+var (
+	profiledCaller = common.HexToAddress("0x00000000000000000000000000000000deadbeef")
+	profiledCallee = common.HexToAddress("0x00000000000000000000000000000000000000ff")
+)
+
+// runGasProfiler executes a transaction against a caller contract which calls
+// into a callee writing a storage slot, profiling it with the given config.
+func runGasProfiler(t *testing.T, cfg json.RawMessage) (json.RawMessage, *core.ExecutionResult) {
+	origin := common.HexToAddress("0x00000000000000000000000000000000feed")
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(),
+		core.GenesisAlloc{
+			profiledCaller: core.GenesisAccount{
+				Code: []byte{
+					byte(vm.PUSH1), 0x0, byte(vm.DUP1), byte(vm.DUP1), byte(vm.DUP1), // in and outs zero
+					byte(vm.DUP1), byte(vm.PUSH1), 0xff, byte(vm.GAS), // value=0,address=0xff, gas=GAS
+					byte(vm.CALL),
+				},
+			},
+			profiledCallee: core.GenesisAccount{
+				Code: []byte{
+					byte(vm.PUSH1), 0x1, byte(vm.PUSH1), 0x0, byte(vm.SSTORE), // slot 0 = 1
+				},
+			},
+			origin: core.GenesisAccount{
+				Balance: big.NewInt(500000000000000),
+			},
+		}, false)
+
+	tracer, err := tracers.DefaultDirectory.New("gasProfiler", nil, cfg)
+	if err != nil {
+		t.Fatalf("failed to create gas profiler: %v", err)
+	}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		BlockNumber: new(big.Int).SetUint64(8000000),
+		Time:        5,
+		Difficulty:  big.NewInt(0x30000),
+		GasLimit:    uint64(6000000),
+	}
+	evm := vm.NewEVM(context, vm.TxContext{Origin: origin, GasPrice: big.NewInt(1)}, statedb, params.MainnetChainConfig, vm.Config{Tracer: tracer})
+	msg := &core.Message{
+		To:        &profiledCaller,
+		From:      origin,
+		Value:     big.NewInt(0),
+		GasLimit:  100000,
+		GasPrice:  big.NewInt(0),
+		GasFeeCap: big.NewInt(0),
+		GasTipCap: big.NewInt(0),
+	}
+	ret, err := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(msg.GasLimit)).TransitionDb()
+	if err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	return res, ret
+}
+
+func TestGasProfilerJSON(t *testing.T) {
+	res, ret := runGasProfiler(t, nil)
+
+	var prof gasProfile
+	if err := json.Unmarshal(res, &prof); err != nil {
+		t.Fatalf("failed to unmarshal gas profile: %v", err)
+	}
+	if prof.GasUsed != ret.UsedGas {
+		t.Fatalf("gas used mismatch: have %d, want %d", prof.GasUsed, ret.UsedGas)
+	}
+	if prof.IntrinsicGas != params.TxGas {
+		t.Fatalf("intrinsic gas mismatch: have %d, want %d", prof.IntrinsicGas, params.TxGas)
+	}
+	if prof.IntrinsicGas+prof.ExecutionGas-prof.Refund != prof.GasUsed {
+		t.Fatalf("gas breakdown mismatch: intrinsic %d + execution %d - refund %d != %d", prof.IntrinsicGas, prof.ExecutionGas, prof.Refund, prof.GasUsed)
+	}
+	var opGas, stackGas uint64
+	for _, op := range prof.Opcodes {
+		opGas += op.Gas
+	}
+	for _, s := range prof.Stacks {
+		stackGas += s.Gas
+	}
+	if opGas != prof.ExecutionGas || stackGas != prof.ExecutionGas {
+		t.Fatalf("profiled gas mismatch: opcodes %d, stacks %d, want %d", opGas, stackGas, prof.ExecutionGas)
+	}
+	if top := prof.Opcodes[0]; top.Address != profiledCallee || top.PC != 4 || top.Op != "SSTORE" || top.Gas != 22100 {
+		t.Fatalf("unexpected top opcode: %+v", top)
+	}
+}
+
+func TestGasProfilerCollapsed(t *testing.T) {
+	res, _ := runGasProfiler(t, json.RawMessage(`{"format": "collapsed"}`))
+
+	var have string
+	if err := json.Unmarshal(res, &have); err != nil {
+		t.Fatalf("failed to unmarshal collapsed stacks: %v", err)
+	}
+	var (
+		caller = profiledCaller.Hex()
+		callee = profiledCallee.Hex()
+	)
+	want := strings.Join([]string{
+		caller + ";" + callee + ";SSTORE 22100",
+		caller + ";CALL 2600",
+		caller + ";DUP1 12",
+		caller + ";" + callee + ";PUSH1 6",
+		caller + ";PUSH1 6",
+		caller + ";GAS 2",
+	}, "\n") + "\n"
+	if have != want {
+		t.Fatalf("collapsed stacks mismatch\n have: %v\n want: %v\n", have, want)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracetest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/vm"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/eth/tracers"
+	"github.com/rethereum-blockchain/go-rethereum/params"
+	"github.com/rethereum-blockchain/go-rethereum/tests"
+)
+
+// Tests that the state diff tracer decodes mapping and struct slots from the
+// hashing done during execution, and turns Transfer events into balances.
+func TestStateDiffTracer(t *testing.T) {
+	var (
+		token  = common.HexToAddress("0x00000000000000000000000000000000deadbeef")
+		holder = common.HexToAddress("0x5b38da6a701c568545dcfcb03fcb875f56beddc4")
+		origin = common.HexToAddress("0x00000000000000000000000000000000feed")
+		topic  = crypto.Keccak256([]byte("Transfer(address,address,uint256)"))
+	)
+	code := []byte{byte(vm.PUSH20)}
+	code = append(code, holder.Bytes()...)
+	code = append(code,
+		byte(vm.PUSH1), 0x0, byte(vm.MSTORE), // mem[0:32] = holder
+		// balances[holder] = 100, with balances at slot 0
+		byte(vm.PUSH1), 0x0, byte(vm.PUSH1), 0x20, byte(vm.MSTORE),
+		byte(vm.PUSH1), 100, byte(vm.PUSH1), 0x40, byte(vm.PUSH1), 0x0, byte(vm.KECCAK256), byte(vm.SSTORE),
+		// infos[holder].second = 7, with infos at slot 2
+		byte(vm.PUSH1), 0x2, byte(vm.PUSH1), 0x20, byte(vm.MSTORE),
+		byte(vm.PUSH1), 7, byte(vm.PUSH1), 0x1, byte(vm.PUSH1), 0x40, byte(vm.PUSH1), 0x0, byte(vm.KECCAK256), byte(vm.ADD), byte(vm.SSTORE),
+		// emit Transfer(0x0, holder, 100)
+		byte(vm.PUSH1), 100, byte(vm.PUSH1), 0x40, byte(vm.MSTORE),
+		byte(vm.PUSH20),
+	)
+	code = append(code, holder.Bytes()...)
+	code = append(code, byte(vm.PUSH1), 0x0, byte(vm.PUSH32))
+	code = append(code, topic...)
+	code = append(code, byte(vm.PUSH1), 0x20, byte(vm.PUSH1), 0x40, byte(vm.LOG3))
+
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(),
+		core.GenesisAlloc{
+			token: core.GenesisAccount{
+				Code: code,
+			},
+			origin: core.GenesisAccount{
+				Balance: big.NewInt(500000000000000),
+			},
+		}, false)
+
+	tracer, err := tracers.DefaultDirectory.New("stateDiffTracer", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create state diff tracer: %v", err)
+	}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		BlockNumber: new(big.Int).SetUint64(8000000),
+		Time:        5,
+		Difficulty:  big.NewInt(0x30000),
+		GasLimit:    uint64(6000000),
+	}
+	evm := vm.NewEVM(context, vm.TxContext{Origin: origin, GasPrice: big.NewInt(0)}, statedb, params.MainnetChainConfig, vm.Config{Tracer: tracer})
+	msg := &core.Message{
+		To:        &token,
+		From:      origin,
+		Value:     big.NewInt(0),
+		GasLimit:  200000,
+		GasPrice:  big.NewInt(0),
+		GasFeeCap: big.NewInt(0),
+		GasTipCap: big.NewInt(0),
+	}
+	if _, err := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(msg.GasLimit)).TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	want := `{"0x000000000000000000000000000000000000feed":{"nonce":{"from":"0","to":"1"}},"0x00000000000000000000000000000000deadbeef":{"storage":{"0x58f8e73c330daffe64653449eb9a999c1162911d5129dd8193c7233d46ade2d5":{"location":"0[0x5B38Da6a701c568545dCfcB03FcB875f56beddC4]","from":"0x0000000000000000000000000000000000000000000000000000000000000000","to":"0x0000000000000000000000000000000000000000000000000000000000000064"},"0xb314f101a00aa0d8cc6704cc6dd1e9dd7551ec98c9df52079c192c560ba66c4b":{"location":"2[0x5B38Da6a701c568545dCfcB03FcB875f56beddC4]+1","from":"0x0000000000000000000000000000000000000000000000000000000000000000","to":"0x0000000000000000000000000000000000000000000000000000000000000007"}}},"0x5b38da6a701c568545dcfcb03fcb875f56beddc4":{"tokens":{"0x00000000000000000000000000000000deadbeef":{"standard":"ERC20","change":"100"}}}}`
+	if string(res) != want {
+		t.Fatalf("trace mismatch\n have: %v\n want: %v\n", string(res), want)
+	}
+}
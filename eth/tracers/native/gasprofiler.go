@@ -0,0 +1,347 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/vm"
+	"github.com/rethereum-blockchain/go-rethereum/eth/tracers"
+)
+
+func init() {
+	tracers.DefaultDirectory.Register("gasProfiler", newGasProfiler, false)
+}
+
+const (
+	// GasProfilerFormatJSON makes the gas profiler return the aggregated
+	// opcode and call stack tables as a JSON object.
+	GasProfilerFormatJSON = "json"
+
+	// GasProfilerFormatCollapsed makes the gas profiler return a JSON string
+	// holding the call stacks in collapsed-stack (flamegraph) format.
+	GasProfilerFormatCollapsed = "collapsed"
+)
+
+// opLocation identifies a single instruction within a contract's code.
+type opLocation struct {
+	addr common.Address
+	pc   uint64
+	op   vm.OpCode
+}
+
+// opProfile is the aggregated gas usage of a single code location.
+type opProfile struct {
+	Address common.Address `json:"address"`
+	PC      uint64         `json:"pc"`
+	Op      string         `json:"op"`
+	Count   uint64         `json:"count"`
+	Gas     uint64         `json:"gas"`
+}
+
+// stackProfile is the aggregated gas usage of a single call stack path.
+type stackProfile struct {
+	Stack string `json:"stack"`
+	Gas   uint64 `json:"gas"`
+}
+
+// gasProfile is the JSON result of the gas profiler.
+type gasProfile struct {
+	GasUsed      uint64         `json:"gasUsed"`
+	IntrinsicGas uint64         `json:"intrinsicGas"`
+	ExecutionGas uint64         `json:"executionGas"`
+	Refund       uint64         `json:"refund"`
+	Opcodes      []opProfile    `json:"opcodes"`
+	Stacks       []stackProfile `json:"stacks"`
+}
+
+// profileFrame tracks the gas accounting of a single call frame while it's
+// being executed. Gas is attributed to an opcode only once the next opcode
+// (or the frame exit) reveals how much gas it really consumed, which makes
+// the accounting exact for dynamic costs, refunded call gas and stipends.
+type profileFrame struct {
+	addr  common.Address // Address whose code runs in this frame
+	path  string         // Collapsed call stack path leading to this frame
+	gas   uint64         // Gas available to the frame on entry
+	ops   int            // Number of opcodes executed in the frame
+	child uint64         // Gas used by child frames of the pending opcode
+
+	pending    bool       // Whether an opcode is waiting for its gas to be attributed
+	pendingLoc opLocation // Location of the pending opcode
+	pendingGas uint64     // Gas available before the pending opcode ran
+}
+
+// gasProfiler is a native go tracer which aggregates the gas used by a
+// transaction per code location (contract address, pc and opcode) and per
+// call stack path. The latter can be rendered in the collapsed-stack format
+// understood by flamegraph tooling.
+//
+// Example:
+//
+//	> debug.traceTransaction("0x...", {tracer: "gasProfiler", tracerConfig: {format: "collapsed"}})
+//	"0x3fc9...;0x25d2...;SSTORE 22100\n0x3fc9...;CALL 2600\n..."
+type gasProfiler struct {
+	noopTracer
+	config gasProfilerConfig
+
+	frames   []*profileFrame
+	opcodes  map[opLocation]*opProfile
+	stacks   map[string]uint64
+	gasLimit uint64 // Gas limit of the transaction, zero outside of tx tracing
+	gasStart uint64 // Gas available to the top level call
+	gasUsed  uint64 // Gas used by the top level call
+	restGas  uint64 // Gas left after the transaction, including refunds
+	txEnded  bool   // Whether CaptureTxEnd has been called
+
+	interrupt atomic.Bool // Atomic flag to signal execution interruption
+	reason    error       // Textual reason for the interruption
+}
+
+type gasProfilerConfig struct {
+	Format string `json:"format"` // Output format, either "json" (default) or "collapsed"
+}
+
+// newGasProfiler returns a native go tracer which profiles the gas usage of
+// a tx, and implements vm.EVMLogger.
+func newGasProfiler(ctx *tracers.Context, cfg json.RawMessage) (tracers.Tracer, error) {
+	var config gasProfilerConfig
+	if cfg != nil {
+		if err := json.Unmarshal(cfg, &config); err != nil {
+			return nil, err
+		}
+	}
+	switch config.Format {
+	case "":
+		config.Format = GasProfilerFormatJSON
+	case GasProfilerFormatJSON, GasProfilerFormatCollapsed:
+	default:
+		return nil, fmt.Errorf("unknown gas profile format %q", config.Format)
+	}
+	return &gasProfiler{
+		config:  config,
+		opcodes: make(map[opLocation]*opProfile),
+		stacks:  make(map[string]uint64),
+	}, nil
+}
+
+// CaptureTxStart implements the EVMLogger interface to initialize the tracing operation.
+func (t *gasProfiler) CaptureTxStart(gasLimit uint64) {
+	t.gasLimit = gasLimit
+}
+
+// CaptureTxEnd implements the EVMLogger interface to finalize the tracing operation.
+func (t *gasProfiler) CaptureTxEnd(restGas uint64) {
+	t.restGas = restGas
+	t.txEnded = true
+}
+
+// CaptureStart implements the EVMLogger interface to initialize the tracing operation.
+func (t *gasProfiler) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.gasStart = gas
+	t.frames = append(t.frames[:0], &profileFrame{
+		addr: to,
+		path: to.Hex(),
+		gas:  gas,
+	})
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *gasProfiler) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	t.gasUsed = gasUsed
+	if len(t.frames) != 1 {
+		return
+	}
+	t.closeFrame(t.frames[0], gasUsed)
+	t.frames = t.frames[:0]
+}
+
+// CaptureState implements the EVMLogger interface to trace a single step of VM execution.
+func (t *gasProfiler) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if t.interrupt.Load() || len(t.frames) == 0 {
+		return
+	}
+	frame := t.frames[len(t.frames)-1]
+	if frame.pending {
+		var consumed uint64
+		if frame.pendingGas > gas {
+			consumed = frame.pendingGas - gas
+		}
+		t.attribute(frame, consumed)
+	}
+	frame.pending = true
+	frame.pendingLoc = opLocation{addr: frame.addr, pc: pc, op: op}
+	frame.pendingGas = gas
+	frame.ops++
+}
+
+// CaptureEnter is called when EVM enters a new scope (via call, create or selfdestruct).
+func (t *gasProfiler) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	if t.interrupt.Load() || len(t.frames) == 0 {
+		return
+	}
+	parent := t.frames[len(t.frames)-1]
+	t.frames = append(t.frames, &profileFrame{
+		addr: to,
+		path: parent.path + ";" + to.Hex(),
+		gas:  gas,
+	})
+}
+
+// CaptureExit is called when EVM exits a scope, even if the scope didn't
+// execute any code.
+func (t *gasProfiler) CaptureExit(output []byte, gasUsed uint64, err error) {
+	if t.interrupt.Load() || len(t.frames) <= 1 {
+		return
+	}
+	frame := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+	t.closeFrame(frame, gasUsed)
+
+	// Subtract the child's usage from the call opcode that spawned it, so
+	// the gas is only accounted for once, inside the child frame.
+	t.frames[len(t.frames)-1].child += gasUsed
+}
+
+// closeFrame attributes the remaining gas of a frame once it returns. Frames
+// which did not execute any code (precompiles, plain transfers) are profiled
+// as a whole under their own call stack path.
+func (t *gasProfiler) closeFrame(frame *profileFrame, gasUsed uint64) {
+	if frame.pending {
+		var left uint64
+		if gasUsed < frame.gas {
+			left = frame.gas - gasUsed
+		}
+		t.attribute(frame, frame.pendingGas-left)
+	}
+	if frame.ops == 0 && gasUsed > frame.child {
+		t.stacks[frame.path] += gasUsed - frame.child
+	}
+}
+
+// attribute charges the gas consumed by the pending opcode of a frame, minus
+// the gas used by any child frames it spawned.
+func (t *gasProfiler) attribute(frame *profileFrame, consumed uint64) {
+	var used uint64
+	if consumed > frame.child {
+		used = consumed - frame.child
+	}
+	loc := frame.pendingLoc
+
+	prof, ok := t.opcodes[loc]
+	if !ok {
+		prof = &opProfile{Address: loc.addr, PC: loc.pc, Op: loc.op.String()}
+		t.opcodes[loc] = prof
+	}
+	prof.Count++
+	prof.Gas += used
+	t.stacks[frame.path+";"+loc.op.String()] += used
+
+	frame.pending = false
+	frame.child = 0
+}
+
+// profile assembles the aggregated gas profile, sorted by descending gas usage.
+func (t *gasProfiler) profile() *gasProfile {
+	res := &gasProfile{
+		GasUsed:      t.gasUsed,
+		ExecutionGas: t.gasUsed,
+		Opcodes:      make([]opProfile, 0, len(t.opcodes)),
+		Stacks:       make([]stackProfile, 0, len(t.stacks)),
+	}
+	if t.txEnded && t.gasLimit >= t.restGas {
+		res.GasUsed = t.gasLimit - t.restGas
+		res.IntrinsicGas = t.gasLimit - t.gasStart
+		if total := res.IntrinsicGas + res.ExecutionGas; total > res.GasUsed {
+			res.Refund = total - res.GasUsed
+		}
+	}
+	for _, prof := range t.opcodes {
+		res.Opcodes = append(res.Opcodes, *prof)
+	}
+	sort.Slice(res.Opcodes, func(i, j int) bool {
+		a, b := res.Opcodes[i], res.Opcodes[j]
+		if a.Gas != b.Gas {
+			return a.Gas > b.Gas
+		}
+		if a.Address != b.Address {
+			return a.Address.Hex() < b.Address.Hex()
+		}
+		return a.PC < b.PC
+	})
+	for stack, gas := range t.stacks {
+		res.Stacks = append(res.Stacks, stackProfile{Stack: stack, Gas: gas})
+	}
+	sort.Slice(res.Stacks, func(i, j int) bool {
+		a, b := res.Stacks[i], res.Stacks[j]
+		if a.Gas != b.Gas {
+			return a.Gas > b.Gas
+		}
+		return a.Stack < b.Stack
+	})
+	return res
+}
+
+// GetResult returns the json-encoded gas profile, and any error arising from
+// the encoding or forceful termination (via `Stop`).
+func (t *gasProfiler) GetResult() (json.RawMessage, error) {
+	if len(t.frames) != 0 && t.reason == nil {
+		return nil, errors.New("incomplete call stack")
+	}
+	prof := t.profile()
+
+	var (
+		res []byte
+		err error
+	)
+	switch t.config.Format {
+	case GasProfilerFormatCollapsed:
+		res, err = json.Marshal(collapsedStacks(prof.Stacks))
+	default:
+		res, err = json.Marshal(prof)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(res), t.reason
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *gasProfiler) Stop(err error) {
+	t.reason = err
+	t.interrupt.Store(true)
+}
+
+// collapsedStacks renders stack profiles in the collapsed-stack format used
+// by flamegraph tooling: one semicolon separated path per line, followed by
+// the gas attributed to it. Paths without any gas are omitted.
+func collapsedStacks(stacks []stackProfile) string {
+	var b strings.Builder
+	for _, s := range stacks {
+		if s.Gas == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s %d\n", s.Stack, s.Gas)
+	}
+	return b.String()
+}
@@ -0,0 +1,481 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/holiman/uint256"
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/common/hexutil"
+	"github.com/rethereum-blockchain/go-rethereum/core/vm"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/eth/tracers"
+)
+
+func init() {
+	tracers.DefaultDirectory.Register("stateDiffTracer", newStateDiffTracer, false)
+}
+
+var (
+	// transferEventTopic is the topic of the Transfer event shared by the
+	// ERC-20 and ERC-721 token standards.
+	transferEventTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+	// maxSlotOffset is the largest offset from a hashed slot which is still
+	// decoded as a struct field or array element of the hashed location.
+	maxSlotOffset = uint256.NewInt(1024)
+)
+
+// valueDiff is the human readable change of a single account field.
+type valueDiff struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// storageDiff is the change of a single storage slot, along with its decoded
+// position in the Solidity storage layout if it could be resolved.
+type storageDiff struct {
+	Location string      `json:"location,omitempty"`
+	From     common.Hash `json:"from"`
+	To       common.Hash `json:"to"`
+}
+
+// tokenDiff is the change of a holder's balance in a single token contract,
+// as derived from the Transfer events emitted during execution.
+type tokenDiff struct {
+	Standard string   `json:"standard"`
+	Change   string   `json:"change,omitempty"`
+	Received []string `json:"received,omitempty"`
+	Sent     []string `json:"sent,omitempty"`
+
+	change *big.Int
+}
+
+// accountDiff is the human readable state diff of a single account.
+type accountDiff struct {
+	Created   bool                          `json:"created,omitempty"`
+	Destroyed bool                          `json:"destroyed,omitempty"`
+	Balance   *valueDiff                    `json:"balance,omitempty"`
+	Nonce     *valueDiff                    `json:"nonce,omitempty"`
+	Code      *valueDiff                    `json:"code,omitempty"`
+	Storage   map[common.Hash]*storageDiff  `json:"storage,omitempty"`
+	Tokens    map[common.Address]*tokenDiff `json:"tokens,omitempty"`
+}
+
+// stateDiffTracer is a native go tracer which produces the state changes of a
+// transaction in a form readable without knowledge of the contracts involved:
+//
+//   - balances and nonces are rendered in decimal,
+//   - storage slots are decoded into their Solidity storage layout position
+//     (e.g. `3[0x5b38...]+1` for the second field of a struct stored in the
+//     mapping at slot 3), using the KECCAK256 preimages seen during execution,
+//   - ERC-20 and ERC-721 Transfer events are turned into token balance changes
+//     of the holders.
+//
+// Example:
+//
+//	> debug.traceTransaction("0x...", {tracer: "stateDiffTracer"})
+//	{
+//	  "0x5b38da6a701c568545dcfcb03fcb875f56beddc4": {
+//	    "balance": {"from": "1000000000000000000", "to": "999790000000000000"},
+//	    "nonce": {"from": "4", "to": "5"},
+//	    "tokens": {"0xd9145cce52d386f254917e481eb44e9943f39138": {"standard": "ERC20", "change": "-100"}}
+//	  },
+//	  "0xd9145cce52d386f254917e481eb44e9943f39138": {
+//	    "storage": {"0x...": {"location": "0[0x5B38Da6a701c568545dCfcB03FcB875f56beddC4]", "from": "0x...", "to": "0x..."}}
+//	  }
+//	}
+type stateDiffTracer struct {
+	noopTracer
+	env       *vm.EVM
+	pre       state
+	created   map[common.Address]bool
+	deleted   map[common.Address]bool
+	preimages map[common.Hash][]byte // KECCAK256 inputs of up to two words
+	logs      [][]callLog            // Logs emitted by each active call frame
+	gasLimit  uint64                 // Amount of gas bought for the whole tx
+	result    map[common.Address]*accountDiff
+	interrupt atomic.Bool // Atomic flag to signal execution interruption
+	reason    error       // Textual reason for the interruption
+}
+
+// newStateDiffTracer returns a native go tracer which produces a human
+// readable state diff of a tx, and implements vm.EVMLogger.
+func newStateDiffTracer(ctx *tracers.Context, _ json.RawMessage) (tracers.Tracer, error) {
+	return &stateDiffTracer{
+		pre:       state{},
+		created:   make(map[common.Address]bool),
+		deleted:   make(map[common.Address]bool),
+		preimages: make(map[common.Hash][]byte),
+		result:    make(map[common.Address]*accountDiff),
+	}, nil
+}
+
+// CaptureStart implements the EVMLogger interface to initialize the tracing operation.
+func (t *stateDiffTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.env = env
+	t.logs = [][]callLog{nil}
+
+	t.lookupAccount(from)
+	t.lookupAccount(to)
+	t.lookupAccount(env.Context.Coinbase)
+
+	// The recipient balance includes the value transferred.
+	t.pre[to].Balance = new(big.Int).Sub(t.pre[to].Balance, value)
+
+	// The sender balance is after reducing: value and gasLimit.
+	// We need to re-add them to get the pre-tx balance.
+	fromBal := new(big.Int).Set(t.pre[from].Balance)
+	consumedGas := new(big.Int).Mul(env.TxContext.GasPrice, new(big.Int).SetUint64(t.gasLimit))
+	fromBal.Add(fromBal, new(big.Int).Add(value, consumedGas))
+	t.pre[from].Balance = fromBal
+	t.pre[from].Nonce--
+
+	// A created contract already has its nonce bumped, reset it to the
+	// empty account it was before the transaction.
+	if create {
+		t.pre[to].Nonce = 0
+		t.pre[to].Code = nil
+		t.created[to] = true
+	}
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *stateDiffTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	// Logs are not emitted when the call fails
+	if err != nil {
+		t.logs = [][]callLog{nil}
+	}
+}
+
+// CaptureState implements the EVMLogger interface to trace a single step of VM execution.
+func (t *stateDiffTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if err != nil {
+		return
+	}
+	// Skip if tracing was interrupted
+	if t.interrupt.Load() {
+		return
+	}
+	stackData := scope.Stack.Data()
+	stackLen := len(stackData)
+	caller := scope.Contract.Address()
+	switch {
+	case stackLen >= 1 && op == vm.SSTORE:
+		t.lookupAccount(caller)
+		t.lookupStorage(caller, common.Hash(stackData[stackLen-1].Bytes32()))
+	case stackLen >= 2 && op == vm.KECCAK256:
+		// Only single and double word preimages are needed to decode mapping
+		// and dynamic array slots, skip anything else.
+		offset, size := stackData[stackLen-1], stackData[stackLen-2]
+		if size.Uint64() != 32 && size.Uint64() != 64 {
+			return
+		}
+		data, err := tracers.GetMemoryCopyPadded(scope.Memory, int64(offset.Uint64()), int64(size.Uint64()))
+		if err != nil {
+			return
+		}
+		t.preimages[crypto.Keccak256Hash(data)] = data
+	case stackLen >= 1 && (op == vm.BALANCE || op == vm.SELFDESTRUCT):
+		t.lookupAccount(common.Address(stackData[stackLen-1].Bytes20()))
+		if op == vm.SELFDESTRUCT {
+			t.lookupAccount(caller)
+			t.deleted[caller] = true
+		}
+	case stackLen >= 5 && (op == vm.DELEGATECALL || op == vm.CALL || op == vm.STATICCALL || op == vm.CALLCODE):
+		t.lookupAccount(common.Address(stackData[stackLen-2].Bytes20()))
+	case op == vm.CREATE:
+		addr := crypto.CreateAddress(caller, t.env.StateDB.GetNonce(caller))
+		t.lookupAccount(addr)
+		t.created[addr] = true
+	case stackLen >= 4 && op == vm.CREATE2:
+		offset, size := stackData[stackLen-2], stackData[stackLen-3]
+		init, err := tracers.GetMemoryCopyPadded(scope.Memory, int64(offset.Uint64()), int64(size.Uint64()))
+		if err != nil {
+			return
+		}
+		addr := crypto.CreateAddress2(caller, stackData[stackLen-4].Bytes32(), crypto.Keccak256(init))
+		t.lookupAccount(addr)
+		t.created[addr] = true
+	case op >= vm.LOG3 && op <= vm.LOG4:
+		t.captureTransfer(op, scope)
+	}
+}
+
+// captureTransfer records the ERC-20 or ERC-721 Transfer event about to be
+// emitted by a LOG3 or LOG4 opcode.
+func (t *stateDiffTracer) captureTransfer(op vm.OpCode, scope *vm.ScopeContext) {
+	var (
+		size      = int(op - vm.LOG0)
+		stackData = scope.Stack.Data()
+		stackLen  = len(stackData)
+	)
+	if stackLen < 2+size {
+		return
+	}
+	topics := make([]common.Hash, size)
+	for i := 0; i < size; i++ {
+		topics[i] = common.Hash(stackData[stackLen-2-(i+1)].Bytes32())
+	}
+	if topics[0] != transferEventTopic {
+		return
+	}
+	mStart, mSize := stackData[stackLen-1], stackData[stackLen-2]
+	data, err := tracers.GetMemoryCopyPadded(scope.Memory, int64(mStart.Uint64()), int64(mSize.Uint64()))
+	if err != nil {
+		return
+	}
+	frame := len(t.logs) - 1
+	t.logs[frame] = append(t.logs[frame], callLog{Address: scope.Contract.Address(), Topics: topics, Data: data})
+}
+
+// CaptureEnter is called when EVM enters a new scope (via call, create or selfdestruct).
+func (t *stateDiffTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	if t.interrupt.Load() {
+		return
+	}
+	t.logs = append(t.logs, nil)
+}
+
+// CaptureExit is called when EVM exits a scope, even if the scope didn't
+// execute any code.
+func (t *stateDiffTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	if t.interrupt.Load() || len(t.logs) <= 1 {
+		return
+	}
+	logs := t.logs[len(t.logs)-1]
+	t.logs = t.logs[:len(t.logs)-1]
+
+	// Logs of failed frames are discarded along with their state changes.
+	if err == nil {
+		t.logs[len(t.logs)-1] = append(t.logs[len(t.logs)-1], logs...)
+	}
+}
+
+func (t *stateDiffTracer) CaptureTxStart(gasLimit uint64) {
+	t.gasLimit = gasLimit
+}
+
+func (t *stateDiffTracer) CaptureTxEnd(restGas uint64) {
+	if t.env == nil {
+		return
+	}
+	for addr, prev := range t.pre {
+		diff := &accountDiff{Destroyed: t.deleted[addr]}
+		if t.created[addr] && prev.Nonce == 0 && len(prev.Code) == 0 {
+			diff.Created = t.env.StateDB.GetNonce(addr) > 0 || t.env.StateDB.GetCodeSize(addr) > 0
+		}
+		if bal := t.env.StateDB.GetBalance(addr); bal.Cmp(prev.Balance) != 0 {
+			diff.Balance = &valueDiff{From: prev.Balance.String(), To: bal.String()}
+		}
+		if nonce := t.env.StateDB.GetNonce(addr); nonce != prev.Nonce {
+			diff.Nonce = &valueDiff{From: strconv.FormatUint(prev.Nonce, 10), To: strconv.FormatUint(nonce, 10)}
+		}
+		if code := t.env.StateDB.GetCode(addr); !bytes.Equal(code, prev.Code) {
+			diff.Code = &valueDiff{From: hexutil.Encode(prev.Code), To: hexutil.Encode(code)}
+		}
+		for slot, val := range prev.Storage {
+			if newVal := t.env.StateDB.GetState(addr, slot); newVal != val {
+				if diff.Storage == nil {
+					diff.Storage = make(map[common.Hash]*storageDiff)
+				}
+				diff.Storage[slot] = &storageDiff{Location: t.decodeSlot(slot), From: val, To: newVal}
+			}
+		}
+		if diff.Created || diff.Destroyed || diff.Balance != nil || diff.Nonce != nil || diff.Code != nil || diff.Storage != nil {
+			t.result[addr] = diff
+		}
+	}
+	if len(t.logs) > 0 {
+		for _, log := range t.logs[0] {
+			t.applyTransfer(log)
+		}
+	}
+	for _, diff := range t.result {
+		for _, token := range diff.Tokens {
+			if token.change != nil {
+				token.Change = token.change.String()
+			}
+		}
+	}
+}
+
+// applyTransfer accounts a Transfer event in the token balance changes of the
+// sender and recipient. ERC-20 transfers carry the amount in the event data,
+// whereas ERC-721 transfers carry an indexed token id.
+func (t *stateDiffTracer) applyTransfer(log callLog) {
+	var (
+		from = common.BytesToAddress(log.Topics[1][:])
+		to   = common.BytesToAddress(log.Topics[2][:])
+	)
+	switch {
+	case len(log.Topics) == 3 && len(log.Data) == 32:
+		amount := new(big.Int).SetBytes(log.Data)
+		if from != (common.Address{}) {
+			diff := t.token(from, log.Address, "ERC20")
+			diff.change.Sub(diff.change, amount)
+		}
+		if to != (common.Address{}) {
+			diff := t.token(to, log.Address, "ERC20")
+			diff.change.Add(diff.change, amount)
+		}
+	case len(log.Topics) == 4 && len(log.Data) == 0:
+		id := new(big.Int).SetBytes(log.Topics[3][:]).String()
+		if from != (common.Address{}) {
+			diff := t.token(from, log.Address, "ERC721")
+			diff.Sent = append(diff.Sent, id)
+		}
+		if to != (common.Address{}) {
+			diff := t.token(to, log.Address, "ERC721")
+			diff.Received = append(diff.Received, id)
+		}
+	}
+}
+
+// token returns the token balance change of a holder, creating it if needed.
+func (t *stateDiffTracer) token(holder, token common.Address, standard string) *tokenDiff {
+	diff, ok := t.result[holder]
+	if !ok {
+		diff = new(accountDiff)
+		t.result[holder] = diff
+	}
+	if diff.Tokens == nil {
+		diff.Tokens = make(map[common.Address]*tokenDiff)
+	}
+	if _, ok := diff.Tokens[token]; !ok {
+		diff.Tokens[token] = &tokenDiff{Standard: standard}
+		if standard == "ERC20" {
+			diff.Tokens[token].change = new(big.Int)
+		}
+	}
+	return diff.Tokens[token]
+}
+
+// decodeSlot resolves the position of a storage slot in the Solidity storage
+// layout, using the KECCAK256 preimages recorded during execution. Mapping
+// values live at keccak256(key . slot), dynamic array elements and bytes data
+// at keccak256(slot) + index, and struct members at a small offset from the
+// start of the struct. Slots which cannot be resolved are left empty.
+func (t *stateDiffTracer) decodeSlot(slot common.Hash) string {
+	return t.decodeLocation(slot, 0)
+}
+
+func (t *stateDiffTracer) decodeLocation(slot common.Hash, depth int) string {
+	// Plain state variables occupy the first few slots of the layout.
+	pos := new(uint256.Int).SetBytes(slot[:])
+	if pos.Lt(maxSlotOffset) {
+		return strconv.FormatUint(pos.Uint64(), 10)
+	}
+	// Avoid runaway recursion on pathological preimage chains.
+	if depth > 16 {
+		return ""
+	}
+	for offset := uint64(0); offset < maxSlotOffset.Uint64(); offset++ {
+		base := common.Hash(new(uint256.Int).Sub(pos, uint256.NewInt(offset)).Bytes32())
+		preimage, ok := t.preimages[base]
+		if !ok {
+			continue
+		}
+		var loc string
+		switch len(preimage) {
+		case 64:
+			parent := t.decodeLocation(common.BytesToHash(preimage[32:]), depth+1)
+			if parent == "" {
+				return ""
+			}
+			loc = fmt.Sprintf("%s[%s]", parent, formatMappingKey(preimage[:32]))
+		case 32:
+			parent := t.decodeLocation(common.BytesToHash(preimage), depth+1)
+			if parent == "" {
+				return ""
+			}
+			// Offsets into dynamic arrays are element indices, so fold them in.
+			return fmt.Sprintf("%s.data[%d]", parent, offset)
+		}
+		if offset > 0 {
+			loc = fmt.Sprintf("%s+%d", loc, offset)
+		}
+		return loc
+	}
+	return ""
+}
+
+// formatMappingKey renders a mapping key in its most likely type: addresses
+// as hex addresses, small numbers in decimal and anything else as raw hex.
+func formatMappingKey(key []byte) string {
+	n := new(uint256.Int).SetBytes(key)
+	if n.IsUint64() {
+		return strconv.FormatUint(n.Uint64(), 10)
+	}
+	if bytes.Equal(key[:12], make([]byte, 12)) {
+		return common.BytesToAddress(key).Hex()
+	}
+	return hexutil.Encode(key)
+}
+
+// GetResult returns the json-encoded state diff, and any error arising from
+// the encoding or forceful termination (via `Stop`).
+func (t *stateDiffTracer) GetResult() (json.RawMessage, error) {
+	for _, diff := range t.result {
+		for _, token := range diff.Tokens {
+			sort.Strings(token.Received)
+			sort.Strings(token.Sent)
+		}
+	}
+	res, err := json.Marshal(t.result)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(res), t.reason
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *stateDiffTracer) Stop(err error) {
+	t.reason = err
+	t.interrupt.Store(true)
+}
+
+// lookupAccount fetches details of an account and adds it to the prestate
+// if it doesn't exist there.
+func (t *stateDiffTracer) lookupAccount(addr common.Address) {
+	if _, ok := t.pre[addr]; ok {
+		return
+	}
+	t.pre[addr] = &account{
+		Balance: t.env.StateDB.GetBalance(addr),
+		Nonce:   t.env.StateDB.GetNonce(addr),
+		Code:    t.env.StateDB.GetCode(addr),
+		Storage: make(map[common.Hash]common.Hash),
+	}
+}
+
+// lookupStorage fetches the requested storage slot and adds it to the
+// prestate of the given contract. It assumes `lookupAccount` has been
+// performed on the contract before.
+func (t *stateDiffTracer) lookupStorage(addr common.Address, key common.Hash) {
+	if _, ok := t.pre[addr].Storage[key]; ok {
+		return
+	}
+	t.pre[addr].Storage[key] = t.env.StateDB.GetState(addr, key)
+}
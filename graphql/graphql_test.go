@@ -39,6 +39,7 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/node"
 	"github.com/rethereum-blockchain/go-rethereum/params"
 
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -411,3 +412,93 @@ func newGQLService(t *testing.T, stack *node.Node, gspec *core.Genesis, genBlock
 	}
 	return handler, chain
 }
+
+func TestGraphQLSubscriptions(t *testing.T) {
+	config := *params.AllEthashProtocolChanges
+	config.RethereumForks = &params.RethereumForks{}
+
+	stack := createNode(t)
+	defer stack.Close()
+
+	ethBackend, err := eth.New(stack, &ethconfig.Config{
+		Genesis:        &core.Genesis{Config: &config, GasLimit: 11500000, Difficulty: big.NewInt(1048576)},
+		Ethash:         ethash.Config{PowMode: ethash.ModeFake},
+		NetworkId:      1337,
+		TrieCleanCache: 5,
+		TrieDirtyCache: 5,
+		TrieTimeout:    60 * time.Minute,
+		SnapshotCache:  5,
+	})
+	if err != nil {
+		t.Fatalf("could not create eth backend: %v", err)
+	}
+	filterSystem := filters.NewFilterSystem(ethBackend.APIBackend, filters.Config{})
+	if _, err := newHandler(stack, ethBackend.APIBackend, filterSystem, []string{}, []string{}); err != nil {
+		t.Fatalf("could not create graphql service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	url := "ws" + strings.TrimPrefix(stack.HTTPEndpoint(), "http") + "/graphql"
+	dialer := websocket.Dialer{Subprotocols: []string{wsProtocolTransport}}
+
+	// Upgrades are subject to the same virtual host checks as HTTP requests.
+	if _, resp, err := dialer.Dial(url, http.Header{"Host": {"evil.com"}}); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected websocket upgrade for unknown host to be rejected, have %v", err)
+	}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("could not dial graphql websocket: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	expect := func(want string) {
+		t.Helper()
+		_, have, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		if strings.TrimSpace(string(have)) != want {
+			t.Fatalf("message mismatch\nhave: %s\nwant: %s", have, want)
+		}
+	}
+	send := func(msg string) {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatalf("failed to write message: %v", err)
+		}
+	}
+	send(`{"type":"connection_init"}`)
+	expect(`{"type":"connection_ack"}`)
+
+	// Queries are answered with a single result.
+	send(`{"id":"1","type":"subscribe","payload":{"query":"{block{number}}"}}`)
+	expect(`{"id":"1","type":"next","payload":{"data":{"block":{"number":0}}}}`)
+	expect(`{"id":"1","type":"complete"}`)
+
+	send(`{"id":"logs","type":"subscribe","payload":{"query":"{logs(filter:{}){index}}"}}`)
+	expect(`{"id":"logs","type":"next","payload":{"data":{"logs":[]}}}`)
+	expect(`{"id":"logs","type":"complete"}`)
+
+	// Subscriptions stream results as the chain progresses.
+	send(`{"id":"2","type":"subscribe","payload":{"query":"subscription{newBlocks{number}}"}}`)
+	time.Sleep(100 * time.Millisecond) // Wait for the subscription to be installed
+
+	chain, _ := core.GenerateChain(&config, ethBackend.BlockChain().Genesis(), ethash.NewFaker(), ethBackend.ChainDb(), 2, nil)
+	if _, err := ethBackend.BlockChain().InsertChain(chain); err != nil {
+		t.Fatalf("could not import blocks: %v", err)
+	}
+	expect(`{"id":"2","type":"next","payload":{"data":{"newBlocks":{"number":1}}}}`)
+	expect(`{"id":"2","type":"next","payload":{"data":{"newBlocks":{"number":2}}}}`)
+
+	// Invalid operations are rejected, duplicate ids terminate the connection.
+	send(`{"id":"3","type":"subscribe","payload":{"query":"subscription{unknown}"}}`)
+	expect(`{"id":"3","type":"error","payload":[{"message":"Cannot query field \"unknown\" on type \"Subscription\".","locations":[{"line":1,"column":14}]}]}`)
+
+	send(`{"id":"2","type":"subscribe","payload":{"query":"subscription{newBlocks{number}}"}}`)
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, wsCloseDuplicateID) {
+		t.Fatalf("expected duplicate id close, got %v", err)
+	}
+}
@@ -16,7 +16,8 @@
 
 package graphql
 
-const schema string = `
+// schemaTypes declares the types shared by the query and subscription schemas.
+const schemaTypes string = `
     # Bytes32 is a 32 byte binary string, represented as 0x-prefixed hexadecimal.
     scalar Bytes32
     # Address is a 20 byte Ethereum address, represented as 0x-prefixed hexadecimal.
@@ -31,11 +32,6 @@ const schema string = `
     # Long is a 64 bit unsigned integer.
     scalar Long
 
-    schema {
-        query: Query
-        mutation: Mutation
-    }
-
     # Account is an Ethereum account at a particular block.
     type Account {
         # Address is the address owning the account.
@@ -328,8 +324,10 @@ const schema string = `
       # successful execution of a transaction for the pending state.
       estimateGas(data: CallData!): Long!
     }
+`
 
-    type Query {
+// queryFields are the fields of the query root available in both schemas.
+const queryFields string = `
         # Block fetches an Ethereum block by number or by hash. If neither is
         # supplied, the most recent known block is returned.
         block(number: Long, hash: Bytes32): Block
@@ -340,8 +338,6 @@ const schema string = `
         pending: Pending!
         # Transaction returns a transaction specified by its hash.
         transaction(hash: Bytes32!): Transaction
-        # Logs returns log entries matching the provided filter.
-        logs(filter: FilterCriteria!): [Log!]!
         # GasPrice returns the node's estimate of a gas price sufficient to
         # ensure a transaction is mined in a timely fashion.
         gasPrice: BigInt!
@@ -352,10 +348,50 @@ const schema string = `
         syncing: SyncState
         # ChainID returns the current chain ID for transaction replay protection.
         chainID: BigInt!
-    }
+`
 
+// mutationType declares the mutation root available in both schemas.
+const mutationType string = `
     type Mutation {
         # SendRawTransaction sends an RLP-encoded transaction to the network.
         sendRawTransaction(data: Bytes!): Bytes32!
     }
 `
+
+// schema is the schema used to serve queries and mutations over HTTP.
+const schema string = schemaTypes + mutationType + `
+    schema {
+        query: Query
+        mutation: Mutation
+    }
+
+    type Query {` + queryFields + `
+        # Logs returns log entries matching the provided filter.
+        logs(filter: FilterCriteria!): [Log!]!
+    }
+`
+
+// subscriptionSchema is the schema used to serve operations over websocket.
+// The resolver library dispatches all root operations to a single resolver, so
+// its query root leaves out the logs field in favour of the subscription of the
+// same name.
+const subscriptionSchema string = schemaTypes + mutationType + `
+    schema {
+        query: Query
+        mutation: Mutation
+        subscription: Subscription
+    }
+
+    type Query {` + queryFields + `    }
+
+    type Subscription {
+        # NewBlocks emits every block that becomes the new head of the canonical
+        # chain.
+        newBlocks: Block!
+        # PendingTransactions emits transactions as they enter the transaction pool.
+        pendingTransactions: Transaction!
+        # Logs emits log entries matching the provided filter from newly imported
+        # blocks. Logs removed by chain reorganisations are not reported.
+        logs(filter: BlockFilterCriteria!): Log!
+    }
+`
@@ -24,6 +24,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/graph-gophers/graphql-go"
 	gqlErrors "github.com/graph-gophers/graphql-go/errors"
 	"github.com/rethereum-blockchain/go-rethereum/eth/filters"
@@ -109,8 +110,9 @@ func New(stack *node.Node, backend ethapi.Backend, filterSystem *filters.FilterS
 	return err
 }
 
-// newHandler returns a new `http.Handler` that will answer GraphQL queries.
-// It additionally exports an interactive query browser on the / endpoint.
+// newHandler returns a new `http.Handler` that will answer GraphQL queries,
+// and subscriptions over websocket connections to the same endpoint. It
+// additionally exports an interactive query browser on the / endpoint.
 func newHandler(stack *node.Node, backend ethapi.Backend, filterSystem *filters.FilterSystem, cors, vhosts []string) (*handler, error) {
 	q := Resolver{backend, filterSystem}
 
@@ -119,8 +121,26 @@ func newHandler(stack *node.Node, backend ethapi.Backend, filterSystem *filters.
 		return nil, err
 	}
 	h := handler{Schema: s}
-	handler := node.NewHTTPHandlerStack(h, cors, vhosts, nil)
 
+	// Subscriptions are served over websocket from the same endpoint.
+	sq := newSubscriptionResolver(&q)
+	ss, err := graphql.ParseSchema(subscriptionSchema, sq)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		wsHandler   = node.NewVHostHandlerStack(newWSHandler(s, ss, cors), vhosts)
+		httpHandler = node.NewHTTPHandlerStack(h, cors, vhosts, nil)
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			wsHandler.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+
+	stack.RegisterLifecycle(sq)
 	stack.RegisterHandler("GraphQL UI", "/graphql/ui", GraphiQL{})
 	stack.RegisterHandler("GraphQL", "/graphql", handler)
 	stack.RegisterHandler("GraphQL", "/graphql/", handler)
@@ -0,0 +1,236 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/rethereum-blockchain/go-rethereum"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/eth/filters"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/rpc"
+)
+
+// subscriptionBuffer is the number of results buffered for a subscriber. Once
+// a subscriber falls that far behind, its subscription is terminated rather
+// than stalling the event system shared by all subscribers.
+const subscriptionBuffer = 128
+
+var errServiceStopped = errors.New("service stopped")
+
+// subscriptionResolver is the root resolver of the subscription schema. Query
+// and mutation fields are served by the embedded resolver.
+type subscriptionResolver struct {
+	*Resolver
+
+	lock   sync.Mutex
+	events *filters.EventSystem // Created on the first subscription
+	closed bool
+
+	quit chan struct{}  // Terminates the running subscriptions
+	wg   sync.WaitGroup // Tracks the running subscriptions
+}
+
+func newSubscriptionResolver(r *Resolver) *subscriptionResolver {
+	return &subscriptionResolver{
+		Resolver: r,
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start implements node.Lifecycle.
+func (r *subscriptionResolver) Start() error {
+	return nil
+}
+
+// Stop implements node.Lifecycle, terminating all running subscriptions and
+// the event system feeding them.
+func (r *subscriptionResolver) Stop() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.quit)
+	r.lock.Unlock()
+
+	r.wg.Wait()
+	if r.events != nil {
+		r.events.Stop()
+	}
+	return nil
+}
+
+// track returns the event system feeding subscriptions, starting it if it's
+// not yet running, and registers a new running subscription. The caller must
+// call wg.Done once the subscription terminates.
+func (r *subscriptionResolver) track() (*filters.EventSystem, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return nil, errServiceStopped
+	}
+	if r.events == nil {
+		r.events = filters.NewEventSystem(r.filterSystem, false)
+	}
+	r.wg.Add(1)
+	return r.events, nil
+}
+
+// NewBlocks streams the blocks which become the new head of the chain.
+func (r *subscriptionResolver) NewBlocks(ctx context.Context) (<-chan *Block, error) {
+	events, err := r.track()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		headers = make(chan *types.Header, subscriptionBuffer)
+		sub     = events.SubscribeNewHeads(headers)
+		out     = make(chan *Block, subscriptionBuffer)
+	)
+	go func() {
+		defer r.wg.Done()
+		defer sub.Unsubscribe()
+		defer close(out)
+
+		for {
+			select {
+			case header := <-headers:
+				numberOrHash := rpc.BlockNumberOrHashWithHash(header.Hash(), false)
+				block := &Block{
+					r:            r.Resolver,
+					numberOrHash: &numberOrHash,
+					hash:         header.Hash(),
+					header:       header,
+				}
+				select {
+				case out <- block:
+				default:
+					log.Debug("Dropping slow GraphQL subscriber", "subscription", "newBlocks")
+					return
+				}
+			case <-sub.Err():
+				return
+			case <-ctx.Done():
+				return
+			case <-r.quit:
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// PendingTransactions streams the transactions entering the transaction pool.
+func (r *subscriptionResolver) PendingTransactions(ctx context.Context) (<-chan *Transaction, error) {
+	events, err := r.track()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		txs = make(chan []*types.Transaction, subscriptionBuffer)
+		sub = events.SubscribePendingTxs(txs)
+		out = make(chan *Transaction, subscriptionBuffer)
+	)
+	go func() {
+		defer r.wg.Done()
+		defer sub.Unsubscribe()
+		defer close(out)
+
+		for {
+			select {
+			case batch := <-txs:
+				for _, tx := range batch {
+					select {
+					case out <- &Transaction{r: r.Resolver, hash: tx.Hash(), tx: tx}:
+					default:
+						log.Debug("Dropping slow GraphQL subscriber", "subscription", "pendingTransactions")
+						return
+					}
+				}
+			case <-sub.Err():
+				return
+			case <-ctx.Done():
+				return
+			case <-r.quit:
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Logs streams the logs of newly imported blocks matching the given filter.
+func (r *subscriptionResolver) Logs(ctx context.Context, args struct{ Filter BlockFilterCriteria }) (<-chan *Log, error) {
+	var crit ethereum.FilterQuery
+	if args.Filter.Addresses != nil {
+		crit.Addresses = *args.Filter.Addresses
+	}
+	if args.Filter.Topics != nil {
+		crit.Topics = *args.Filter.Topics
+	}
+	events, err := r.track()
+	if err != nil {
+		return nil, err
+	}
+	logs := make(chan []*types.Log, subscriptionBuffer)
+	sub, err := events.SubscribeLogs(crit, logs)
+	if err != nil {
+		r.wg.Done()
+		return nil, err
+	}
+	out := make(chan *Log, subscriptionBuffer)
+	go func() {
+		defer r.wg.Done()
+		defer sub.Unsubscribe()
+		defer close(out)
+
+		for {
+			select {
+			case batch := <-logs:
+				for _, l := range batch {
+					if l.Removed {
+						continue
+					}
+					item := &Log{
+						r:           r.Resolver,
+						transaction: &Transaction{r: r.Resolver, hash: l.TxHash},
+						log:         l,
+					}
+					select {
+					case out <- item:
+					default:
+						log.Debug("Dropping slow GraphQL subscriber", "subscription", "logs")
+						return
+					}
+				}
+			case <-sub.Err():
+				return
+			case <-ctx.Done():
+				return
+			case <-r.quit:
+				return
+			}
+		}
+	}()
+	return out, nil
+}
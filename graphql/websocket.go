@@ -0,0 +1,392 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+	gqlErrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+)
+
+const (
+	// wsProtocolTransport is the graphql-transport-ws protocol spoken by the
+	// graphql-ws client library.
+	wsProtocolTransport = "graphql-transport-ws"
+
+	// wsProtocolLegacy is the graphql-ws protocol of the deprecated
+	// subscriptions-transport-ws library, still used by many clients.
+	wsProtocolLegacy = "graphql-ws"
+
+	wsMessageSizeLimit = 1024 * 1024
+	wsWriteTimeout     = 10 * time.Second
+	wsInitTimeout      = 10 * time.Second
+	wsKeepAlive        = 30 * time.Second
+)
+
+// Close codes defined by the graphql-transport-ws protocol.
+const (
+	wsCloseBadRequest      = 4400
+	wsCloseUnauthorized    = 4401
+	wsCloseInitTimeout     = 4408
+	wsCloseDuplicateID     = 4409
+	wsCloseTooManyInitReqs = 4429
+)
+
+// wsMessage is a protocol message exchanged with websocket clients.
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsOperation is the payload of an operation request.
+type wsOperation struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// wsHandler serves GraphQL queries, mutations and subscriptions over websocket.
+type wsHandler struct {
+	schema    *graphql.Schema // Schema serving queries and mutations
+	subSchema *graphql.Schema // Schema serving subscriptions
+	upgrader  websocket.Upgrader
+}
+
+func newWSHandler(schema, subSchema *graphql.Schema, allowedOrigins []string) *wsHandler {
+	return &wsHandler{
+		schema:    schema,
+		subSchema: subSchema,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			Subprotocols:    []string{wsProtocolTransport, wsProtocolLegacy},
+			CheckOrigin:     wsOriginValidator(allowedOrigins),
+		},
+	}
+}
+
+// wsOriginValidator accepts requests without an Origin header, requests from
+// the serving host itself, and requests from any of the allowed origins.
+func wsOriginValidator(allowedOrigins []string) func(*http.Request) bool {
+	origins := make(map[string]bool)
+	for _, origin := range allowedOrigins {
+		origins[strings.ToLower(origin)] = true
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || origins["*"] || origins[strings.ToLower(origin)] {
+			return true
+		}
+		if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		log.Warn("Rejected GraphQL WebSocket connection", "origin", origin)
+		return false
+	}
+}
+
+func (h *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Debug("GraphQL WebSocket upgrade failed", "err", err)
+		return
+	}
+	protocol := conn.Subprotocol()
+	if protocol == "" {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseProtocolError, "unsupported subprotocol"), time.Now().Add(wsWriteTimeout))
+		conn.Close()
+		return
+	}
+	c := &wsConn{
+		h:        h,
+		conn:     conn,
+		protocol: protocol,
+		ops:      make(map[string]context.CancelFunc),
+	}
+	c.serve(r.Context())
+}
+
+// wsConn is a single websocket client connection.
+type wsConn struct {
+	h        *wsHandler
+	conn     *websocket.Conn
+	protocol string
+
+	writeMu sync.Mutex // Serialises writes to the connection
+
+	opsMu sync.Mutex
+	ops   map[string]context.CancelFunc // Running operations by client supplied id
+	acked bool                          // Whether connection_init was acknowledged
+}
+
+// serve runs the read loop of the connection until the client disconnects or
+// violates the protocol.
+func (c *wsConn) serve(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		c.conn.Close()
+	}()
+	c.conn.SetReadLimit(wsMessageSizeLimit)
+
+	// Clients must initialise the connection within a reasonable time
+	initTimer := time.AfterFunc(wsInitTimeout, func() {
+		c.opsMu.Lock()
+		acked := c.acked
+		c.opsMu.Unlock()
+		if !acked {
+			c.close(wsCloseInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer initTimer.Stop()
+
+	for {
+		var msg wsMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			if _, ok := err.(*websocket.CloseError); !ok && ctx.Err() == nil {
+				c.close(wsCloseBadRequest, "Invalid message received")
+			}
+			return
+		}
+		if !c.handle(ctx, &msg) {
+			return
+		}
+	}
+}
+
+// handle processes a single client message. It returns false if the connection
+// should be torn down.
+func (c *wsConn) handle(ctx context.Context, msg *wsMessage) bool {
+	switch msg.Type {
+	case "connection_init":
+		c.opsMu.Lock()
+		acked := c.acked
+		c.acked = true
+		c.opsMu.Unlock()
+
+		if acked {
+			if c.protocol == wsProtocolTransport {
+				c.close(wsCloseTooManyInitReqs, "Too many initialisation requests")
+				return false
+			}
+			return true
+		}
+		c.send(&wsMessage{Type: "connection_ack"})
+		if c.protocol == wsProtocolLegacy {
+			c.send(&wsMessage{Type: "ka"})
+			go c.keepAlive(ctx)
+		}
+		return true
+
+	case "ping":
+		if c.protocol == wsProtocolTransport {
+			c.send(&wsMessage{Type: "pong", Payload: msg.Payload})
+		}
+		return true
+
+	case "pong":
+		return true
+
+	case "subscribe", "start":
+		if (msg.Type == "subscribe") != (c.protocol == wsProtocolTransport) {
+			break
+		}
+		var op wsOperation
+		if msg.ID == "" || json.Unmarshal(msg.Payload, &op) != nil {
+			c.close(wsCloseBadRequest, "Invalid operation")
+			return false
+		}
+		c.opsMu.Lock()
+		if !c.acked {
+			c.opsMu.Unlock()
+			c.close(wsCloseUnauthorized, "Unauthorized")
+			return false
+		}
+		if _, exists := c.ops[msg.ID]; exists {
+			c.opsMu.Unlock()
+			c.close(wsCloseDuplicateID, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+			return false
+		}
+		opCtx, cancel := context.WithCancel(ctx)
+		c.ops[msg.ID] = cancel
+		c.opsMu.Unlock()
+
+		go c.run(opCtx, msg.ID, &op)
+		return true
+
+	case "complete", "stop":
+		if (msg.Type == "complete") != (c.protocol == wsProtocolTransport) {
+			break
+		}
+		c.finish(msg.ID)
+		return true
+
+	case "connection_terminate":
+		if c.protocol == wsProtocolLegacy {
+			return false
+		}
+	}
+	c.close(wsCloseBadRequest, fmt.Sprintf("Invalid message type %q", msg.Type))
+	return false
+}
+
+// run executes an operation, streaming its results to the client. Queries and
+// mutations produce a single result, subscriptions one per event.
+func (c *wsConn) run(ctx context.Context, id string, op *wsOperation) {
+	defer c.finish(id)
+
+	// Operations are served by the subscription schema, apart from queries
+	// of the logs field it leaves out, which are handed to the main schema. If
+	// that rejects the operation before execution too, the error reported
+	// by the subscription schema is the more helpful one.
+	errs := c.h.subSchema.ValidateWithVariables(op.Query, op.Variables)
+	if len(errs) > 0 {
+		if len(c.h.schema.ValidateWithVariables(op.Query, op.Variables)) == 0 {
+			if resp := c.h.schema.Exec(ctx, op.Query, op.OperationName, op.Variables); resp.Data != nil {
+				c.respond(ctx, id, resp)
+				return
+			}
+		}
+		c.sendErrors(id, errs)
+		return
+	}
+	responses, err := c.h.subSchema.Subscribe(ctx, op.Query, op.OperationName, op.Variables)
+	if err != nil {
+		c.sendErrors(id, []*gqlErrors.QueryError{{Message: err.Error()}})
+		return
+	}
+	for response := range responses {
+		resp := response.(*graphql.Response)
+		if resp.Data == nil && len(resp.Errors) > 0 {
+			c.sendErrors(id, resp.Errors)
+			return
+		}
+		if !c.sendResult(id, resp) {
+			return
+		}
+	}
+	c.complete(ctx, id)
+}
+
+// respond delivers the single result of a query or mutation.
+func (c *wsConn) respond(ctx context.Context, id string, resp *graphql.Response) {
+	if c.sendResult(id, resp) {
+		c.complete(ctx, id)
+	}
+}
+
+// sendResult delivers an execution result of an operation to the client.
+func (c *wsConn) sendResult(id string, resp *graphql.Response) bool {
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		c.sendErrors(id, []*gqlErrors.QueryError{{Message: err.Error()}})
+		return false
+	}
+	typ := "next"
+	if c.protocol == wsProtocolLegacy {
+		typ = "data"
+	}
+	return c.send(&wsMessage{ID: id, Type: typ, Payload: payload})
+}
+
+// complete reports the end of an operation, unless it was cancelled by the
+// client, in which case no further messages may be sent for it.
+func (c *wsConn) complete(ctx context.Context, id string) {
+	if ctx.Err() == nil {
+		c.send(&wsMessage{ID: id, Type: "complete"})
+	}
+}
+
+// finish cancels and forgets the operation with the given id.
+func (c *wsConn) finish(id string) {
+	c.opsMu.Lock()
+	defer c.opsMu.Unlock()
+
+	if cancel, ok := c.ops[id]; ok {
+		cancel()
+		delete(c.ops, id)
+	}
+}
+
+// sendErrors reports an operation failing before producing any results. Such
+// a failure terminates the operation without a complete message.
+func (c *wsConn) sendErrors(id string, errs []*gqlErrors.QueryError) {
+	var (
+		payload []byte
+		err     error
+	)
+	if c.protocol == wsProtocolLegacy {
+		payload, err = json.Marshal(errs[0])
+	} else {
+		payload, err = json.Marshal(errs)
+	}
+	if err != nil {
+		log.Warn("Failed to encode GraphQL errors", "err", err)
+		return
+	}
+	c.send(&wsMessage{ID: id, Type: "error", Payload: payload})
+}
+
+// keepAlive periodically sends keep-alive messages to legacy protocol clients.
+func (c *wsConn) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(wsKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !c.send(&wsMessage{Type: "ka"}) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// send writes a message to the client, returning whether it succeeded.
+func (c *wsConn) send(msg *wsMessage) bool {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := c.conn.WriteJSON(msg); err != nil {
+		log.Debug("Failed to write GraphQL WebSocket message", "err", err)
+		return false
+	}
+	return true
+}
+
+// close terminates the connection with the given close code and reason.
+func (c *wsConn) close(code int, reason string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteTimeout))
+	c.conn.Close()
+}
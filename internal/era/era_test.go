@@ -0,0 +1,150 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"io"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+)
+
+type testchain struct {
+	headers  []*types.Header
+	receipts []types.Receipts
+	tds      []*big.Int
+}
+
+func TestEra1Builder(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "era1-test")
+	if err != nil {
+		t.Fatalf("error creating temp file: %v", err)
+	}
+	defer f.Close()
+
+	var (
+		builder = NewBuilder(f)
+		chain   = testchain{}
+	)
+	for i := 0; i < 128; i++ {
+		header := &types.Header{Number: big.NewInt(int64(i)), Difficulty: big.NewInt(int64(i + 1)), Extra: []byte{byte(i)}}
+		block := types.NewBlockWithHeader(header)
+		receipts := types.Receipts{{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: uint64(i), Logs: []*types.Log{}}}
+		td := big.NewInt(int64((i + 1) * (i + 2) / 2))
+
+		if err := builder.Add(block, receipts, td); err != nil {
+			t.Fatalf("error adding entry: %v", err)
+		}
+		chain.headers = append(chain.headers, block.Header())
+		chain.receipts = append(chain.receipts, receipts)
+		chain.tds = append(chain.tds, td)
+	}
+	// Finalize Era1 file.
+	root, err := builder.Finalize()
+	if err != nil {
+		t.Fatalf("error finalizing era1: %v", err)
+	}
+	// Verify Era1 contents.
+	e, err := Open(f.Name())
+	if err != nil {
+		t.Fatalf("failed to open era: %v", err)
+	}
+	defer e.Close()
+
+	if e.Start() != 0 || e.Count() != 128 {
+		t.Fatalf("metadata mismatch: start %d, count %d", e.Start(), e.Count())
+	}
+	if have, err := e.Accumulator(); err != nil || have != root {
+		t.Fatalf("accumulator mismatch: have %x, want %x (%v)", have, root, err)
+	}
+	if td, err := e.InitialTD(); err != nil || td.Sign() != 0 {
+		t.Fatalf("initial td mismatch: have %v (%v)", td, err)
+	}
+	it := NewIterator(e)
+	for i := uint64(0); i < uint64(len(chain.headers)); i++ {
+		if !it.Next() {
+			t.Fatalf("iterator exhausted at %d: %v", i, it.Error())
+		}
+		if it.Number() != i {
+			t.Fatalf("number mismatch: have %d, want %d", it.Number(), i)
+		}
+		if have, want := it.Block().Hash(), chain.headers[i].Hash(); have != want {
+			t.Fatalf("block %d hash mismatch: have %x, want %x", i, have, want)
+		}
+		if have, want := it.Receipts()[0].CumulativeGasUsed, chain.receipts[i][0].CumulativeGasUsed; have != want {
+			t.Fatalf("receipt %d mismatch: have %d, want %d", i, have, want)
+		}
+		if have, want := it.TotalDifficulty(), chain.tds[i]; have.Cmp(want) != 0 {
+			t.Fatalf("td %d mismatch: have %v, want %v", i, have, want)
+		}
+	}
+	if it.Next() || it.Error() != nil {
+		t.Fatalf("iterator not exhausted: %v", it.Error())
+	}
+	if _, err := e.GetBlockByNumber(128); err == nil {
+		t.Fatalf("out-of-bounds block retrieved")
+	}
+}
+
+func TestEra1BuilderNonContiguous(t *testing.T) {
+	builder := NewBuilder(io.Discard)
+	add := func(n int64) error {
+		header := &types.Header{Number: big.NewInt(n), Difficulty: common.Big1}
+		return builder.Add(types.NewBlockWithHeader(header), nil, big.NewInt(n+1))
+	}
+	if err := add(5); err != nil {
+		t.Fatalf("error adding entry: %v", err)
+	}
+	if err := add(7); err == nil {
+		t.Fatalf("non-contiguous block accepted")
+	}
+}
+
+func TestAccumulator(t *testing.T) {
+	// An empty accumulator is the length-mixed root of the empty tree
+	empty, err := ComputeAccumulator(nil, nil)
+	if err != nil {
+		t.Fatalf("failed to compute empty accumulator: %v", err)
+	}
+	var length [32]byte
+	if want := common.Hash(hashPair(zeroHashes[accumulatorDepth], length)); empty != want {
+		t.Fatalf("empty accumulator mismatch: have %x, want %x", empty, want)
+	}
+	// A single record is hashed against the empty subtrees on every level
+	hash, td := common.Hash{0x01}, big.NewInt(0x0102)
+	have, err := ComputeAccumulator([]common.Hash{hash}, []*big.Int{td})
+	if err != nil {
+		t.Fatalf("failed to compute accumulator: %v", err)
+	}
+	var tdLE [32]byte
+	tdLE[0], tdLE[1] = 0x02, 0x01
+
+	node := hashPair(hash, tdLE)
+	for depth := 0; depth < accumulatorDepth; depth++ {
+		node = hashPair(node, zeroHashes[depth])
+	}
+	length[0] = 1
+	if want := common.Hash(hashPair(node, length)); have != want {
+		t.Fatalf("accumulator mismatch: have %x, want %x", have, want)
+	}
+	if _, err := ComputeAccumulator([]common.Hash{hash}, nil); err == nil {
+		t.Fatalf("mismatching record count accepted")
+	}
+}
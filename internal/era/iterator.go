@@ -0,0 +1,88 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"math/big"
+
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+)
+
+// Iterator walks over the blocks of an Era1 archive in ascending order,
+// decoding the blocks along with their receipts and total difficulties.
+type Iterator struct {
+	e    *Era
+	next uint64
+
+	block    *types.Block
+	receipts types.Receipts
+	td       *big.Int
+	err      error
+}
+
+// NewIterator returns a new Iterator instance. Next must be immediately
+// called on new iterators to load the first item.
+func NewIterator(e *Era) *Iterator {
+	return &Iterator{e: e, next: e.Start()}
+}
+
+// Next moves the iterator to the next block entry. It returns false when all
+// items have been read or an error has halted its progress. Block, Receipts
+// and TotalDifficulty can be used to read the current entry.
+func (it *Iterator) Next() bool {
+	if it.err != nil || it.next >= it.e.Start()+it.e.Count() {
+		return false
+	}
+	if it.block, it.err = it.e.GetBlockByNumber(it.next); it.err != nil {
+		return false
+	}
+	if it.receipts, it.err = it.e.GetReceiptsByNumber(it.next); it.err != nil {
+		return false
+	}
+	if it.td, it.err = it.e.GetTotalDifficultyByNumber(it.next); it.err != nil {
+		return false
+	}
+	it.next++
+	return true
+}
+
+// Number returns the current number block the iterator is at.
+func (it *Iterator) Number() uint64 {
+	return it.next - 1
+}
+
+// Error returns the error status of the iterator. It should be called before
+// reading from any of the iterator's values.
+func (it *Iterator) Error() error {
+	return it.err
+}
+
+// Block returns the block at the current iterator position.
+func (it *Iterator) Block() *types.Block {
+	return it.block
+}
+
+// Receipts returns the receipts of the block at the current iterator position.
+func (it *Iterator) Receipts() types.Receipts {
+	return it.receipts
+}
+
+// TotalDifficulty returns the total difficulty of the chain up to and
+// including the block at the current iterator position.
+func (it *Iterator) TotalDifficulty() *big.Int {
+	return new(big.Int).Set(it.td)
+}
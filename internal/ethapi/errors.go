@@ -0,0 +1,35 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import "fmt"
+
+// PrunedHistoryError is returned if the body or receipts of a block are
+// requested, which were expired from the local chain by history pruning.
+type PrunedHistoryError struct {
+	Tail uint64 // Number of the first block with history still available
+}
+
+// Error implements error, returning the reason of the missing history.
+func (e *PrunedHistoryError) Error() string {
+	return fmt.Sprintf("pruned history unavailable: blocks below #%d were expired", e.Tail)
+}
+
+// ErrorCode returns the JSON error code for missing pruned history.
+func (e *PrunedHistoryError) ErrorCode() int {
+	return 4444
+}
@@ -141,6 +141,27 @@ web3._extend({
 			call: 'admin_removeTrustedPeer',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'addPeerToGroup',
+			call: 'admin_addPeerToGroup',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'removePeerFromGroup',
+			call: 'admin_removePeerFromGroup',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'banPeer',
+			call: 'admin_banPeer',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+		new web3._extend.Method({
+			name: 'unbanPeer',
+			call: 'admin_unbanPeer',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'exportChain',
 			call: 'admin_exportChain',
@@ -203,6 +224,18 @@ web3._extend({
 			name: 'datadir',
 			getter: 'admin_datadir'
 		}),
+		new web3._extend.Property({
+			name: 'listBans',
+			getter: 'admin_listBans'
+		}),
+		new web3._extend.Property({
+			name: 'peerScores',
+			getter: 'admin_peerScores'
+		}),
+		new web3._extend.Property({
+			name: 'peerGroups',
+			getter: 'admin_peerGroups'
+		}),
 	]
 });
 `
@@ -430,6 +463,21 @@ web3._extend({
 			params: 2,
 			inputFormatter: [null, null]
 		}),
+		new web3._extend.Method({
+			name: 'traceTransactions',
+			call: 'debug_traceTransactions',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+		new web3._extend.Method({
+			name: 'traceTransactionsStream',
+			call: function(args) {
+				args.unshift('traceTransactionsStream');
+				return 'debug_subscribe';
+			},
+			params: 3,
+			inputFormatter: [null, null, null]
+		}),
 		new web3._extend.Method({
 			name: 'traceCall',
 			call: 'debug_traceCall',
@@ -495,6 +543,18 @@ web3._extend({
 			call: 'debug_setTrieFlushInterval',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'pruneState',
+			call: 'debug_pruneState',
+		}),
+		new web3._extend.Method({
+			name: 'pruneStatus',
+			call: 'debug_pruneStatus',
+		}),
+		new web3._extend.Method({
+			name: 'snapSyncStatus',
+			call: 'debug_snapSyncStatus',
+		}),
 	],
 	properties: []
 });
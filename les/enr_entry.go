@@ -23,6 +23,9 @@ import (
 	"github.com/rethereum-blockchain/go-rethereum/rlp"
 )
 
+// serverTopic is the discovery topic advertised by LES servers.
+const serverTopic = "les-server"
+
 // lesEntry is the "les" ENR entry. This is set for LES servers only.
 type lesEntry struct {
 	// Ignore additional fields (for forward compatibility).
@@ -180,11 +180,12 @@ func (s *LesServer) Protocols() []p2p.Protocol {
 		}
 		return nil
 	}, nil)
-	// Add "les" ENR entries.
+	// Add "les" ENR entries and advertise the server topic.
 	for i := range ps {
 		ps[i].Attributes = []enr.Entry{&lesEntry{
 			VfxVersion: 1,
 		}}
+		ps[i].Topics = []string{serverTopic}
 	}
 	return ps
 }
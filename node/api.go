@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/rethereum-blockchain/go-rethereum/common/hexutil"
 	"github.com/rethereum-blockchain/go-rethereum/crypto"
@@ -116,6 +117,110 @@ func (api *adminAPI) RemoveTrustedPeer(url string) (bool, error) {
 	return true, nil
 }
 
+// AddPeerToGroup adds a remote node to a peer group, allowing it to use the
+// connection slots reserved for the group.
+func (api *adminAPI) AddPeerToGroup(group string, url string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	node, err := enode.Parse(enode.ValidSchemes, url)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	if err := server.AddPeerToGroup(group, node); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RemovePeerFromGroup removes a remote node from a peer group, but it does not
+// disconnect it automatically.
+func (api *adminAPI) RemovePeerFromGroup(group string, url string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	node, err := enode.Parse(enode.ValidSchemes, url)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	if err := server.RemovePeerFromGroup(group, node); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PeerGroups retrieves the peer groups of the node, along with their members
+// and connected peers.
+func (api *adminAPI) PeerGroups() ([]*p2p.PeerGroupInfo, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.PeerGroupsInfo(), nil
+}
+
+// BanPeer bans a remote node from connecting for the given number of seconds
+// (or the default ban duration if omitted), disconnecting it if connected.
+func (api *adminAPI) BanPeer(url string, seconds *uint64) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	node, err := enode.Parse(enode.ValidSchemes, url)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	duration := p2p.DefaultBanDuration
+	if seconds != nil {
+		duration = time.Duration(*seconds) * time.Second
+	}
+	if err := server.BanPeer(node, duration); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UnbanPeer lifts the ban of a remote node, identified either by its enode URL
+// or its hex node ID. It reports whether the node was banned.
+func (api *adminAPI) UnbanPeer(id string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	var nodeID enode.ID
+	if node, err := enode.Parse(enode.ValidSchemes, id); err == nil {
+		nodeID = node.ID()
+	} else if nodeID, err = enode.ParseID(id); err != nil {
+		return false, fmt.Errorf("invalid enode or node ID: %v", err)
+	}
+	return server.UnbanPeer(nodeID)
+}
+
+// ListBans retrieves the remote nodes currently banned from connecting.
+func (api *adminAPI) ListBans() ([]*p2p.BanInfo, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.Bans()
+}
+
+// PeerScores retrieves the reputation of all the remote nodes tracked by the
+// node, starting with the worst behaving ones.
+func (api *adminAPI) PeerScores() ([]*p2p.PeerScore, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.PeerScores()
+}
+
 // PeerEvents creates an RPC subscription which receives peer events from the
 // node's p2p.Server
 func (api *adminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription, error) {
@@ -763,9 +763,11 @@ func (n *Node) ResolvePath(x string) string {
 	return n.config.ResolvePath(x)
 }
 
-// ResolveAncient returns the absolute path of the root ancient directory.
+// ResolveAncient returns the absolute path of the root ancient directory, or
+// the URL of a remote ancient store unchanged.
 func (n *Node) ResolveAncient(name string, ancient string) string {
 	switch {
+	case rawdb.IsRemoteAncient(ancient):
 	case ancient == "":
 		ancient = filepath.Join(n.ResolvePath(name), "ancient")
 	case !filepath.IsAbs(ancient):
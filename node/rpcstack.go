@@ -194,8 +194,13 @@ func (h *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if ws != nil && isWebsocket(r) {
 		if checkPath(r, h.wsConfig.prefix) {
 			ws.ServeHTTP(w, r)
+			return
+		}
+		// Websocket requests outside of the RPC prefix may still be
+		// meant for a handler registered in the mux (e.g. GraphQL).
+		if _, pattern := h.mux.Handler(r); pattern == "" {
+			return
 		}
-		return
 	}
 
 	// if http-rpc is enabled, try to serve request
@@ -396,6 +401,12 @@ func NewWSHandlerStack(srv http.Handler, jwtSecret []byte) http.Handler {
 	return srv
 }
 
+// NewVHostHandlerStack returns a handler validating the Host-header of incoming
+// requests against the given virtual hosts before passing them to srv.
+func NewVHostHandlerStack(srv http.Handler, vhosts []string) http.Handler {
+	return newVHostHandler(vhosts, srv)
+}
+
 func newCorsHandler(srv http.Handler, allowedOrigins []string) http.Handler {
 	// disable CORS support if user has not specified a custom CORS configuration
 	if len(allowedOrigins) == 0 {
@@ -79,6 +79,8 @@ var (
 	errRecentlyDialed   = errors.New("recently dialed")
 	errNetRestrict      = errors.New("not contained in netrestrict list")
 	errNoPort           = errors.New("node does not provide TCP port")
+	errBanned           = errors.New("is banned")
+	errGroupFull        = errors.New("peer group is full")
 )
 
 // dialer creates outbound connections and submits them into Server.
@@ -90,6 +92,9 @@ var (
 //   - dynamic dials are created from node discovery results. The dialer
 //     continuously reads candidate nodes from its input iterator and attempts
 //     to create peer connections to nodes arriving through the iterator.
+//
+// Members of peer groups are dialed like static nodes, but only to fill the dial
+// slots reserved for their group. These slots aren't available to other dials.
 type dialScheduler struct {
 	dialConfig
 	setupFunc   dialSetupFunc
@@ -102,11 +107,12 @@ type dialScheduler struct {
 	remStaticCh chan *enode.Node
 	addPeerCh   chan *conn
 	remPeerCh   chan *conn
+	groupsCh    chan struct{}
 
 	// Everything below here belongs to loop and
 	// should only be accessed by code on the loop goroutine.
 	dialing   map[enode.ID]*dialTask // active tasks
-	peers     map[enode.ID]struct{}  // all connected peers
+	peers     map[enode.ID]connFlag  // all connected peers
 	dialPeers int                    // current number of dialed peers
 
 	// The static map tracks all static dial tasks. The subset of usable static dial tasks
@@ -116,6 +122,9 @@ type dialScheduler struct {
 	static     map[enode.ID]*dialTask
 	staticPool []*dialTask
 
+	// Dial state of the peer groups, the membership is shared with the server.
+	groups map[string]*dialGroup
+
 	// The dial history keeps recently dialed nodes. Members of history are not dialed.
 	history      expHeap
 	historyTimer *mclock.Alarm
@@ -128,10 +137,12 @@ type dialScheduler struct {
 type dialSetupFunc func(net.Conn, connFlag, *enode.Node) error
 
 type dialConfig struct {
-	self           enode.ID         // our own ID
-	maxDialPeers   int              // maximum number of dialed peers
-	maxActiveDials int              // maximum number of active dials
-	netRestrict    *netutil.Netlist // IP netrestrict list, disabled if nil
+	self           enode.ID            // our own ID
+	maxDialPeers   int                 // maximum number of dialed peers
+	maxActiveDials int                 // maximum number of active dials
+	netRestrict    *netutil.Netlist    // IP netrestrict list, disabled if nil
+	banned         func(enode.ID) bool // reports banned nodes, disabled if nil
+	members        *groupMembership    // peer groups with reserved dial slots, disabled if nil
 	resolver       nodeResolver
 	dialer         NodeDialer
 	log            log.Logger
@@ -166,13 +177,21 @@ func newDialScheduler(config dialConfig, it enode.Iterator, setupFunc dialSetupF
 		setupFunc:    setupFunc,
 		dialing:      make(map[enode.ID]*dialTask),
 		static:       make(map[enode.ID]*dialTask),
-		peers:        make(map[enode.ID]struct{}),
+		peers:        make(map[enode.ID]connFlag),
+		groups:       make(map[string]*dialGroup),
 		doneCh:       make(chan *dialTask),
 		nodesIn:      make(chan *enode.Node),
 		addStaticCh:  make(chan *enode.Node),
 		remStaticCh:  make(chan *enode.Node),
 		addPeerCh:    make(chan *conn),
 		remPeerCh:    make(chan *conn),
+		groupsCh:     make(chan struct{}),
+	}
+	if d.members == nil {
+		d.members, _ = newGroupMembership(nil)
+	}
+	for name, cfg := range d.members.groups {
+		d.groups[name] = &dialGroup{name: name, slots: cfg.Outbound, maxPeers: cfg.MaxPeers}
 	}
 	d.lastStatsLog = d.clock.Now()
 	d.ctx, d.cancel = context.WithCancel(context.Background())
@@ -204,6 +223,15 @@ func (d *dialScheduler) removeStatic(n *enode.Node) {
 	}
 }
 
+// groupsUpdated notifies the dialer that members were added to peer groups, so
+// they can be dialed.
+func (d *dialScheduler) groupsUpdated() {
+	select {
+	case d.groupsCh <- struct{}{}:
+	case <-d.ctx.Done():
+	}
+}
+
 // peerAdded updates the peer set.
 func (d *dialScheduler) peerAdded(c *conn) {
 	select {
@@ -231,6 +259,7 @@ loop:
 		// Launch new dials if slots are available.
 		slots := d.freeDialSlots()
 		slots -= d.startStaticDials(slots)
+		d.startGroupDials()
 		if slots > 0 {
 			nodesCh = d.nodesIn
 		} else {
@@ -250,6 +279,9 @@ loop:
 		case task := <-d.doneCh:
 			id := task.dest.ID()
 			delete(d.dialing, id)
+			if task.group != nil {
+				task.group.dialing--
+			}
 			d.updateStaticPool(id)
 			d.doneSinceLastLog++
 
@@ -258,7 +290,7 @@ loop:
 				d.dialPeers++
 			}
 			id := c.node.ID()
-			d.peers[id] = struct{}{}
+			d.peers[id] = c.flags
 			// Remove from static pool because the node is now connected.
 			task := d.static[id]
 			if task != nil && task.staticPoolIndex >= 0 {
@@ -297,6 +329,9 @@ loop:
 				}
 			}
 
+		case <-d.groupsCh:
+			// New group members are dialed at the top of the loop.
+
 		case <-d.historyTimer.C():
 			d.expireHistory()
 
@@ -362,11 +397,21 @@ func (d *dialScheduler) expireHistory() {
 // freeDialSlots returns the number of free dial slots. The result can be negative
 // when peers are connected while their task is still running.
 func (d *dialScheduler) freeDialSlots() int {
-	slots := (d.maxDialPeers - d.dialPeers) * 2
+	// Members in reserved slots and group dials don't take up regular slots.
+	dialPeers, dialing := d.dialPeers, len(d.dialing)
+	for _, g := range d.groups {
+		if _, gdialPeers := d.groupPeers(g); gdialPeers < g.slots {
+			dialPeers -= gdialPeers
+		} else {
+			dialPeers -= g.slots
+		}
+		dialing -= g.dialing
+	}
+	slots := (d.maxDialPeers - d.members.outbound - dialPeers) * 2
 	if slots > d.maxActiveDials {
 		slots = d.maxActiveDials
 	}
-	free := slots - len(d.dialing)
+	free := slots - dialing
 	return free
 }
 
@@ -393,6 +438,17 @@ func (d *dialScheduler) checkDial(n *enode.Node) error {
 	if d.history.contains(string(n.ID().Bytes())) {
 		return errRecentlyDialed
 	}
+	if name, ok := d.members.group(n.ID()); ok {
+		g := d.groups[name]
+		if peers, _ := d.groupPeers(g); g.maxPeers > 0 && peers+g.dialing >= g.maxPeers {
+			return errGroupFull
+		}
+	}
+	// Static nodes are configured by the operator, never let a ban hold them off.
+	// Group members are only granted slots, they're banned like other peers.
+	if _, static := d.static[n.ID()]; !static && d.banned != nil && d.banned(n.ID()) {
+		return errBanned
+	}
 	return nil
 }
 
@@ -407,6 +463,44 @@ func (d *dialScheduler) startStaticDials(n int) (started int) {
 	return started
 }
 
+// startGroupDials starts dials to the members of peer groups with free reserved
+// dial slots.
+func (d *dialScheduler) startGroupDials() {
+	for _, g := range d.groups {
+		if g.slots == 0 {
+			continue
+		}
+		_, dialPeers := d.groupPeers(g)
+		free := g.slots - dialPeers - g.dialing
+		for _, n := range d.members.nodes(g.name) {
+			if free <= 0 {
+				break
+			}
+			if d.checkDial(n) == nil {
+				task := newDialTask(n, staticDialedConn)
+				task.group = g
+				d.startDial(task)
+				g.dialing++
+				free--
+			}
+		}
+	}
+}
+
+// groupPeers counts the connected members of the peer group, along with the ones
+// that were dialed.
+func (d *dialScheduler) groupPeers(g *dialGroup) (peers, dialPeers int) {
+	for id, flags := range d.peers {
+		if name, ok := d.members.group(id); ok && name == g.name {
+			peers++
+			if flags&(dynDialedConn|staticDialedConn) != 0 {
+				dialPeers++
+			}
+		}
+	}
+	return peers, dialPeers
+}
+
 // updateStaticPool attempts to move the given static dial back into staticPool.
 func (d *dialScheduler) updateStaticPool(id enode.ID) {
 	task, ok := d.static[id]
@@ -447,10 +541,19 @@ func (d *dialScheduler) startDial(task *dialTask) {
 	}()
 }
 
+// dialGroup tracks the dial state of a peer group.
+type dialGroup struct {
+	name     string
+	slots    int // reserved dial slots
+	maxPeers int // maximum connected members, zero means unlimited
+	dialing  int // running group dial tasks
+}
+
 // A dialTask generated for each node that is dialed.
 type dialTask struct {
 	staticPoolIndex int
 	flags           connFlag
+	group           *dialGroup // set for group dials
 	// These fields are private to the task and should not be
 	// accessed by dialScheduler while the task is running.
 	dest         *enode.Node
@@ -279,6 +279,90 @@ func TestDialSchedRemoveStatic(t *testing.T) {
 }
 
 // This test checks that static dials are selected at random.
+// This test checks that members of peer groups are dialed into the reserved slots
+// of their group, and that these slots aren't used by other dials.
+func TestDialSchedPeerGroups(t *testing.T) {
+	t.Parallel()
+
+	members, err := newGroupMembership([]PeerGroup{{
+		Name:     "miners",
+		Outbound: 2,
+		Nodes: []*enode.Node{
+			newNode(uintID(0x10), "127.0.0.10:30303"),
+			newNode(uintID(0x11), "127.0.0.11:30303"),
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := dialConfig{
+		maxActiveDials: 10,
+		maxDialPeers:   4,
+		members:        members,
+	}
+	runDialTest(t, config, []dialTestRound{
+		// Two of four dial slots are reserved and one peer is connected, so only two
+		// of the discovered nodes are dialed. The members are dialed as well.
+		{
+			peersAdded: []*conn{
+				{flags: dynDialedConn, node: newNode(uintID(0x01), "127.0.0.1:30303")},
+			},
+			discovered: []*enode.Node{
+				newNode(uintID(0x02), "127.0.0.2:30303"),
+				newNode(uintID(0x03), "127.0.0.3:30303"),
+				newNode(uintID(0x04), "127.0.0.4:30303"),
+				newNode(uintID(0x05), "127.0.0.5:30303"),
+			},
+			wantNewDials: []*enode.Node{
+				newNode(uintID(0x02), "127.0.0.2:30303"),
+				newNode(uintID(0x03), "127.0.0.3:30303"),
+				newNode(uintID(0x10), "127.0.0.10:30303"),
+				newNode(uintID(0x11), "127.0.0.11:30303"),
+			},
+		},
+		// A member and a regular dial succeed, filling all regular slots.
+		{
+			succeeded: []enode.ID{
+				uintID(0x02),
+				uintID(0x10),
+			},
+			failed: []enode.ID{
+				uintID(0x11),
+			},
+			wantResolves: map[enode.ID]*enode.Node{
+				uintID(0x11): nil,
+			},
+		},
+		// The failed member is replaced by a new one. Regular dials don't take over
+		// the free reserved slot.
+		{
+			update: func(d *dialScheduler) {
+				members.remove("miners", uintID(0x11))
+				members.add("miners", newNode(uintID(0x12), "127.0.0.12:30303"))
+				d.groupsUpdated()
+			},
+			failed: []enode.ID{
+				uintID(0x03),
+			},
+			wantNewDials: []*enode.Node{
+				newNode(uintID(0x12), "127.0.0.12:30303"),
+			},
+		},
+		// A connected member drops and is dialed again.
+		{
+			peersRemoved: []enode.ID{
+				uintID(0x10),
+			},
+			succeeded: []enode.ID{
+				uintID(0x12),
+			},
+			wantNewDials: []*enode.Node{
+				newNode(uintID(0x10), "127.0.0.10:30303"),
+			},
+		},
+	})
+}
+
 func TestDialSchedManyStaticNodes(t *testing.T) {
 	t.Parallel()
 
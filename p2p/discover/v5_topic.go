@@ -0,0 +1,346 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/common/mclock"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/discover/v5wire"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enr"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/netutil"
+)
+
+const (
+	topicAdLifetime       = 15 * time.Minute // how long an advertisement is kept by a registrar
+	topicRegisterInterval = 5 * time.Minute  // how often registrations are refreshed
+	maxAdsPerTopic        = 100              // ads stored for a single topic
+	maxAdsTotal           = 5000             // ads stored for all topics
+	topicRegistrars       = 8                // registrars an advertisement is placed at
+	topicQueryResultLimit = 16               // applies in TOPICQUERY handler
+)
+
+var errTopicAdInvalid = errors.New("invalid topic advertisement")
+
+// TopicID is the identifier of a discovery topic. Advertisements are placed at
+// the nodes closest to it in the DHT.
+type TopicID [32]byte
+
+// NewTopicID derives the identifier of a topic from its name.
+func NewTopicID(name string) TopicID {
+	return TopicID(crypto.Keccak256Hash([]byte(name)))
+}
+
+// topicAd is an advertisement stored by a registrar.
+type topicAd struct {
+	node    *enode.Node
+	expires mclock.AbsTime
+}
+
+// topicSystem keeps the advertisements placed at the local node by others, and
+// tracks the topics the local node advertises itself under.
+type topicSystem struct {
+	transport *UDPv5
+
+	mutex  sync.Mutex
+	ads    map[TopicID]map[enode.ID]*topicAd
+	total  int
+	topics map[TopicID]context.CancelFunc
+}
+
+func newTopicSystem(transport *UDPv5) *topicSystem {
+	return &topicSystem{
+		transport: transport,
+		ads:       make(map[TopicID]map[enode.ID]*topicAd),
+		topics:    make(map[TopicID]context.CancelFunc),
+	}
+}
+
+// register stores an advertisement for the given node. If there is no room for
+// it, the time until the next slot frees up is returned.
+func (t *topicSystem) register(topic TopicID, n *enode.Node) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.transport.clock.Now()
+	t.expire(now)
+
+	ads := t.ads[topic]
+	if ad, ok := ads[n.ID()]; ok {
+		ad.node, ad.expires = n, now.Add(topicAdLifetime)
+		return 0
+	}
+	if len(ads) >= maxAdsPerTopic {
+		return earliestExpiry(ads).Sub(now)
+	}
+	if t.total >= maxAdsTotal {
+		wait := mclock.AbsTime(0)
+		for _, ads := range t.ads {
+			if exp := earliestExpiry(ads); wait == 0 || exp < wait {
+				wait = exp
+			}
+		}
+		return wait.Sub(now)
+	}
+	if ads == nil {
+		ads = make(map[enode.ID]*topicAd)
+		t.ads[topic] = ads
+	}
+	ads[n.ID()] = &topicAd{node: n, expires: now.Add(topicAdLifetime)}
+	t.total++
+	return 0
+}
+
+// expire drops all advertisements that are past their lifetime.
+func (t *topicSystem) expire(now mclock.AbsTime) {
+	for topic, ads := range t.ads {
+		for id, ad := range ads {
+			if ad.expires <= now {
+				delete(ads, id)
+				t.total--
+			}
+		}
+		if len(ads) == 0 {
+			delete(t.ads, topic)
+		}
+	}
+}
+
+func earliestExpiry(ads map[enode.ID]*topicAd) mclock.AbsTime {
+	var exp mclock.AbsTime
+	for _, ad := range ads {
+		if exp == 0 || ad.expires < exp {
+			exp = ad.expires
+		}
+	}
+	return exp
+}
+
+// query returns the nodes advertised under the given topic, leaving out those
+// that can't be relayed to the requester.
+func (t *topicSystem) query(topic TopicID, rip net.IP, limit int) []*enode.Node {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.expire(t.transport.clock.Now())
+
+	var nodes []*enode.Node
+	for _, ad := range t.ads[topic] {
+		if rip != nil && netutil.CheckRelayIP(rip, ad.node.IP()) != nil {
+			continue
+		}
+		nodes = append(nodes, ad.node)
+		if len(nodes) >= limit {
+			break
+		}
+	}
+	return nodes
+}
+
+// handleRegtopic stores the advertisement of the requester.
+func (t *topicSystem) handleRegtopic(p *v5wire.Regtopic, fromID enode.ID, fromAddr *net.UDPAddr) {
+	resp := &v5wire.Regconfirmation{ReqID: p.ReqID, Topic: p.Topic}
+
+	n, err := t.verifyAd(p, fromID, fromAddr)
+	if err != nil {
+		t.transport.log.Debug("Invalid "+p.Name(), "id", fromID, "addr", fromAddr, "err", err)
+		return
+	}
+	if wait := t.register(p.Topic, n); wait > 0 {
+		resp.WaitTime = uint64((wait + time.Second - 1) / time.Second)
+	}
+	t.transport.sendResponse(fromID, fromAddr, resp)
+}
+
+// verifyAd checks that the record in a REGTOPIC request belongs to the sender.
+func (t *topicSystem) verifyAd(p *v5wire.Regtopic, fromID enode.ID, fromAddr *net.UDPAddr) (*enode.Node, error) {
+	if p.ENR == nil {
+		return nil, errTopicAdInvalid
+	}
+	n, err := enode.New(t.transport.validSchemes, p.ENR)
+	if err != nil {
+		return nil, err
+	}
+	if n.ID() != fromID || !n.IP().Equal(fromAddr.IP) || n.UDP() <= 1024 {
+		return nil, errTopicAdInvalid
+	}
+	return n, nil
+}
+
+// handleTopicQuery returns the nodes advertised under a topic to the requester.
+func (t *topicSystem) handleTopicQuery(p *v5wire.TopicQuery, fromID enode.ID, fromAddr *net.UDPAddr) {
+	nodes := t.query(p.Topic, fromAddr.IP, topicQueryResultLimit)
+	for _, resp := range packNodes(p.ReqID, nodes) {
+		t.transport.sendResponse(fromID, fromAddr, resp)
+	}
+}
+
+// start begins advertising the local node under a topic, returning false if it
+// is already advertised.
+func (t *topicSystem) start(topic TopicID) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if _, ok := t.topics[topic]; ok {
+		return false
+	}
+	ctx, cancel := context.WithCancel(t.transport.closeCtx)
+	t.topics[topic] = cancel
+
+	t.transport.wg.Add(1)
+	go t.registerLoop(ctx, topic)
+	return true
+}
+
+// stop ends advertising the local node under a topic.
+func (t *topicSystem) stop(topic TopicID) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if cancel, ok := t.topics[topic]; ok {
+		cancel()
+		delete(t.topics, topic)
+	}
+}
+
+// registerLoop periodically places advertisements for the local node at the
+// nodes closest to the topic.
+func (t *topicSystem) registerLoop(ctx context.Context, topic TopicID) {
+	defer t.transport.wg.Done()
+
+	timer := t.transport.clock.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			return
+		}
+		wait := topicRegisterInterval
+		if retry := t.registerRound(ctx, topic); retry > 0 && retry < wait {
+			wait = retry
+		}
+		timer.Reset(wait)
+	}
+}
+
+// registerRound sends REGTOPIC to the registrars of a topic. It returns the
+// shortest wait time requested by a registrar that had no room for the ad.
+func (t *topicSystem) registerRound(ctx context.Context, topic TopicID) time.Duration {
+	var (
+		registrars = t.transport.newLookup(ctx, enode.ID(topic)).run()
+		record     = t.transport.Self().Record()
+		retry      time.Duration
+		registered int
+	)
+	if len(registrars) > topicRegistrars {
+		registrars = registrars[:topicRegistrars]
+	}
+	for _, n := range registrars {
+		wait, err := t.transport.regtopic(n, topic, record)
+		switch {
+		case err != nil:
+			t.transport.log.Trace("Topic registration failed", "id", n.ID(), "err", err)
+		case wait > 0:
+			if retry == 0 || wait < retry {
+				retry = wait
+			}
+		default:
+			registered++
+		}
+	}
+	t.transport.log.Debug("Advertised topic", "topic", enode.ID(topic), "registrars", len(registrars), "registered", registered)
+	return retry
+}
+
+// RegisterTopic starts advertising the local node under the given topic. The
+// advertisement is placed at the nodes closest to the topic ID, and refreshed
+// until StopRegisterTopic is called or the transport is closed.
+func (t *UDPv5) RegisterTopic(topic string) {
+	t.topics.start(NewTopicID(topic))
+}
+
+// StopRegisterTopic stops refreshing the advertisements of the local node under
+// the given topic. Already placed advertisements expire on their own.
+func (t *UDPv5) StopRegisterTopic(topic string) {
+	t.topics.stop(NewTopicID(topic))
+}
+
+// TopicSearch looks up the nodes advertised under the given topic.
+func (t *UDPv5) TopicSearch(topic string) []*enode.Node {
+	var (
+		id       = NewTopicID(topic)
+		nodes    = t.topics.query(id, nil, maxAdsPerTopic)
+		seen     = make(map[enode.ID]struct{})
+		results  = make(chan []*enode.Node)
+		resolved []*enode.Node
+	)
+	if t.tab.len() == 0 {
+		// Bootstrap the table first, otherwise there is nobody to ask.
+		<-t.tab.refresh()
+	}
+	registrars := t.newLookup(t.closeCtx, enode.ID(id)).run()
+	for _, n := range registrars {
+		go func(n *enode.Node) {
+			found, err := t.topicQuery(n, id)
+			if err != nil {
+				t.log.Trace("Topic query failed", "id", n.ID(), "err", err)
+			}
+			results <- found
+		}(n)
+	}
+	for range registrars {
+		nodes = append(nodes, <-results...)
+	}
+	for _, n := range nodes {
+		if _, ok := seen[n.ID()]; !ok {
+			seen[n.ID()] = struct{}{}
+			resolved = append(resolved, n)
+		}
+	}
+	return resolved
+}
+
+// regtopic calls REGTOPIC on a node and waits for the confirmation.
+func (t *UDPv5) regtopic(n *enode.Node, topic TopicID, record *enr.Record) (time.Duration, error) {
+	req := &v5wire.Regtopic{Topic: topic, ENR: record}
+	resp := t.callToNode(n, v5wire.RegconfirmationMsg, req)
+	defer t.callDone(resp)
+	select {
+	case respMsg := <-resp.ch:
+		conf := respMsg.(*v5wire.Regconfirmation)
+		if conf.Topic != topic {
+			return 0, errors.New("wrong topic in confirmation")
+		}
+		return time.Duration(conf.WaitTime) * time.Second, nil
+	case err := <-resp.err:
+		return 0, err
+	}
+}
+
+// topicQuery calls TOPICQUERY on a node and waits for responses.
+func (t *UDPv5) topicQuery(n *enode.Node, topic TopicID) ([]*enode.Node, error) {
+	resp := t.callToNode(n, v5wire.NodesMsg, &v5wire.TopicQuery{Topic: topic})
+	return t.waitForNodes(resp, nil)
+}
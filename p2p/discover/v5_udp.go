@@ -76,6 +76,9 @@ type UDPv5 struct {
 	// talkreq handler registry
 	talk *talkSystem
 
+	// topic advertisements
+	topics *topicSystem
+
 	// channels into dispatch
 	packetInCh    chan ReadPacket
 	readNextCh    chan struct{}
@@ -174,6 +177,7 @@ func newUDPv5(conn UDPConn, ln *enode.LocalNode, cfg Config) (*UDPv5, error) {
 		cancelCloseCtx: cancelCloseCtx,
 	}
 	t.talk = newTalkSystem(t)
+	t.topics = newTopicSystem(t)
 	tab, err := newTable(t, t.db, cfg.Bootnodes, cfg.Log)
 	if err != nil {
 		return nil, err
@@ -774,6 +778,12 @@ func (t *UDPv5) handle(p v5wire.Packet, fromID enode.ID, fromAddr *net.UDPAddr)
 		t.talk.handleRequest(fromID, fromAddr, p)
 	case *v5wire.TalkResponse:
 		t.handleCallResponse(fromID, fromAddr, p)
+	case *v5wire.Regtopic:
+		t.topics.handleRegtopic(p, fromID, fromAddr)
+	case *v5wire.Regconfirmation:
+		t.handleCallResponse(fromID, fromAddr, p)
+	case *v5wire.TopicQuery:
+		t.topics.handleTopicQuery(p, fromID, fromAddr)
 	}
 }
 
@@ -538,6 +538,75 @@ func TestUDPv5_talkRequest(t *testing.T) {
 	}
 }
 
+// This test checks that REGTOPIC and TOPICQUERY are handled correctly.
+func TestUDPv5_topicHandling(t *testing.T) {
+	t.Parallel()
+	test := newUDPV5Test(t)
+	defer test.close()
+
+	var (
+		topic  = NewTopicID("archive")
+		remote = test.getNode(test.remotekey, test.remoteaddr).Node()
+	)
+	// Registration of the sender's own record should be confirmed.
+	test.packetIn(&v5wire.Regtopic{ReqID: []byte{1}, Topic: topic, ENR: remote.Record()})
+	test.waitPacketOut(func(p *v5wire.Regconfirmation, addr *net.UDPAddr, _ v5wire.Nonce) {
+		if !bytes.Equal(p.ReqID, []byte{1}) {
+			t.Error("wrong request ID in response:", p.ReqID)
+		}
+		if p.Topic != topic || p.WaitTime != 0 {
+			t.Errorf("wrong confirmation: topic %x, wait %d", p.Topic, p.WaitTime)
+		}
+	})
+
+	// Registration of somebody else's record should be ignored.
+	var (
+		otherkey  = newkey()
+		otheraddr = &net.UDPAddr{IP: net.IP{10, 0, 1, 100}, Port: 30303}
+	)
+	test.packetInFrom(otherkey, otheraddr, &v5wire.Regtopic{ReqID: []byte{2}, Topic: topic, ENR: remote.Record()})
+
+	// Queries should return the registered node only under its topic.
+	test.packetInFrom(otherkey, otheraddr, &v5wire.TopicQuery{ReqID: []byte{3}, Topic: topic})
+	test.expectNodes([]byte{3}, 1, []*enode.Node{remote})
+
+	test.packetIn(&v5wire.TopicQuery{ReqID: []byte{4}, Topic: NewTopicID("stratum")})
+	test.expectNodes([]byte{4}, 1, nil)
+}
+
+// This test checks that topic advertisements can be found by other nodes.
+func TestUDPv5_topicE2E(t *testing.T) {
+	t.Parallel()
+
+	const N = 5
+	var nodes []*UDPv5
+	for i := 0; i < N; i++ {
+		var cfg Config
+		if len(nodes) > 0 {
+			cfg.Bootnodes = []*enode.Node{nodes[0].Self()}
+		}
+		node := startLocalhostV5(t, cfg)
+		nodes = append(nodes, node)
+		defer node.Close()
+	}
+	nodes[1].RegisterTopic("snap-serving")
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		results := nodes[N-1].TopicSearch("snap-serving")
+		if len(results) == 1 && results[0].ID() == nodes[1].Self().ID() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("advertised node not found, results: %v", results)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if results := nodes[N-1].TopicSearch("les-server"); len(results) != 0 {
+		t.Fatalf("found nodes under unadvertised topic: %v", results)
+	}
+}
+
 // This test checks that lookupDistances works.
 func TestUDPv5_lookupDistances(t *testing.T) {
 	test := newUDPV5Test(t)
@@ -47,8 +47,9 @@ const (
 	NodesMsg
 	TalkRequestMsg
 	TalkResponseMsg
-	RequestTicketMsg
-	TicketMsg
+	RegtopicMsg
+	RegconfirmationMsg
+	TopicQueryMsg
 
 	UnknownPacket   = byte(255) // any non-decryptable packet
 	WhoareyouPacket = byte(254) // the WHOAREYOU packet
@@ -118,6 +119,27 @@ type (
 		ReqID   []byte
 		Message []byte
 	}
+
+	// REGTOPIC asks the recipient to advertise the sender under a topic.
+	Regtopic struct {
+		ReqID []byte
+		Topic [32]byte
+		ENR   *enr.Record
+	}
+
+	// REGCONFIRMATION is the reply to REGTOPIC.
+	Regconfirmation struct {
+		ReqID    []byte
+		Topic    [32]byte
+		WaitTime uint64 // seconds until a retry may succeed, zero if registered
+	}
+
+	// TOPICQUERY requests the nodes advertised under a topic. It is answered
+	// with NODES.
+	TopicQuery struct {
+		ReqID []byte
+		Topic [32]byte
+	}
 )
 
 // DecodeMessage decodes the message body of a packet.
@@ -136,6 +158,12 @@ func DecodeMessage(ptype byte, body []byte) (Packet, error) {
 		dec = new(TalkRequest)
 	case TalkResponseMsg:
 		dec = new(TalkResponse)
+	case RegtopicMsg:
+		dec = new(Regtopic)
+	case RegconfirmationMsg:
+		dec = new(Regconfirmation)
+	case TopicQueryMsg:
+		dec = new(TopicQuery)
 	default:
 		return nil, fmt.Errorf("unknown packet type %d", ptype)
 	}
@@ -227,3 +255,30 @@ func (p *TalkResponse) SetRequestID(id []byte) { p.ReqID = id }
 func (p *TalkResponse) AppendLogInfo(ctx []interface{}) []interface{} {
 	return append(ctx, "req", hexutil.Bytes(p.ReqID), "len", len(p.Message))
 }
+
+func (*Regtopic) Name() string             { return "REGTOPIC/v5" }
+func (*Regtopic) Kind() byte               { return RegtopicMsg }
+func (p *Regtopic) RequestID() []byte      { return p.ReqID }
+func (p *Regtopic) SetRequestID(id []byte) { p.ReqID = id }
+
+func (p *Regtopic) AppendLogInfo(ctx []interface{}) []interface{} {
+	return append(ctx, "req", hexutil.Bytes(p.ReqID), "topic", hexutil.Bytes(p.Topic[:]))
+}
+
+func (*Regconfirmation) Name() string             { return "REGCONFIRMATION/v5" }
+func (*Regconfirmation) Kind() byte               { return RegconfirmationMsg }
+func (p *Regconfirmation) RequestID() []byte      { return p.ReqID }
+func (p *Regconfirmation) SetRequestID(id []byte) { p.ReqID = id }
+
+func (p *Regconfirmation) AppendLogInfo(ctx []interface{}) []interface{} {
+	return append(ctx, "req", hexutil.Bytes(p.ReqID), "topic", hexutil.Bytes(p.Topic[:]), "wait", p.WaitTime)
+}
+
+func (*TopicQuery) Name() string             { return "TOPICQUERY/v5" }
+func (*TopicQuery) Kind() byte               { return TopicQueryMsg }
+func (p *TopicQuery) RequestID() []byte      { return p.ReqID }
+func (p *TopicQuery) SetRequestID(id []byte) { p.ReqID = id }
+
+func (p *TopicQuery) AppendLogInfo(ctx []interface{}) []interface{} {
+	return append(ctx, "req", hexutil.Bytes(p.ReqID), "topic", hexutil.Bytes(p.Topic[:]))
+}
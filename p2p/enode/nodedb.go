@@ -40,6 +40,7 @@ const (
 	dbVersionKey   = "version" // Version of the database to flush if changes
 	dbNodePrefix   = "n:"      // Identifier to prefix node entries with
 	dbLocalPrefix  = "local:"
+	dbRepPrefix    = "rep:"
 	dbDiscoverRoot = "v4"
 	dbDiscv5Root   = "v5"
 
@@ -53,6 +54,14 @@ const (
 	// Local information is keyed by ID only, the full key is "local:<ID>:seq".
 	// Use localItemKey to create those keys.
 	dbLocalSeq = "seq"
+
+	// Reputation information is keyed by ID only, the full key is "rep:<ID>:score".
+	// It's kept apart from the node entries to survive their expiration. Use
+	// repItemKey to create those keys.
+	dbRepScore   = "score"
+	dbRepUpdated = "updated"
+	dbRepBan     = "ban"
+	dbRepBanIP   = "banip"
 )
 
 const (
@@ -195,6 +204,24 @@ func localItemKey(id ID, field string) []byte {
 	return key
 }
 
+// repItemKey returns the key of a node reputation item.
+func repItemKey(id ID, field string) []byte {
+	key := append([]byte(dbRepPrefix), id[:]...)
+	key = append(key, ':')
+	key = append(key, field...)
+	return key
+}
+
+// splitRepItemKey returns the components of a key created by repItemKey.
+func splitRepItemKey(key []byte) (id ID, field string) {
+	if len(key) < len(dbRepPrefix)+len(id)+1 {
+		return ID{}, ""
+	}
+	item := key[len(dbRepPrefix):]
+	copy(id[:], item[:len(id)])
+	return id, string(item[len(id)+1:])
+}
+
 // fetchInt64 retrieves an integer associated with a particular key.
 func (db *DB) fetchInt64(key []byte) int64 {
 	blob, err := db.lvl.Get(key, nil)
@@ -315,6 +342,7 @@ func (db *DB) expirer() {
 		select {
 		case <-tick.C:
 			db.expireNodes()
+			db.expireReputations()
 		case <-db.quit:
 			return
 		}
@@ -360,6 +388,20 @@ func (db *DB) expireNodes() {
 	}
 }
 
+// expireReputations deletes the reputation of the nodes that are not banned and
+// haven't been scored for some time, by when any penalty has been recovered.
+func (db *DB) expireReputations() {
+	var (
+		now       = time.Now()
+		threshold = now.Add(-dbNodeExpiration)
+	)
+	for id, rep := range db.Reputations() {
+		if !rep.Banned.After(now) && rep.Updated.Before(threshold) {
+			db.DeleteReputation(id)
+		}
+	}
+}
+
 // LastPingReceived retrieves the time of the last ping packet received from
 // a remote node.
 func (db *DB) LastPingReceived(id ID, ip net.IP) time.Time {
@@ -442,6 +484,78 @@ func (db *DB) storeLocalSeq(id ID, n uint64) {
 	db.storeUint64(localItemKey(id, dbLocalSeq), n)
 }
 
+// Reputation is the standing of a remote node, tracked across connections and
+// restarts.
+type Reputation struct {
+	Score   int       // Reputation score, lowered by penalties
+	Updated time.Time // Time the score was last updated
+	BanIP   net.IP    // IP address the node was banned at, if known
+	Banned  time.Time // Expiry of the ban, zero if never banned
+}
+
+// Reputation retrieves the reputation of a node. The zero value is returned
+// for nodes never scored or banned.
+func (db *DB) Reputation(id ID) Reputation {
+	rep := Reputation{Score: int(db.fetchInt64(repItemKey(id, dbRepScore)))}
+	if updated := db.fetchInt64(repItemKey(id, dbRepUpdated)); updated > 0 {
+		rep.Updated = time.Unix(updated, 0)
+	}
+	if banned := db.fetchInt64(repItemKey(id, dbRepBan)); banned > 0 {
+		rep.Banned = time.Unix(banned, 0)
+	}
+	if ip, err := db.lvl.Get(repItemKey(id, dbRepBanIP), nil); err == nil && len(ip) > 0 {
+		rep.BanIP = ip
+	}
+	return rep
+}
+
+// UpdateReputation stores the reputation of a node.
+func (db *DB) UpdateReputation(id ID, rep Reputation) error {
+	batch := new(leveldb.Batch)
+	for field, val := range map[string]int64{
+		dbRepScore:   int64(rep.Score),
+		dbRepUpdated: unixOrZero(rep.Updated),
+		dbRepBan:     unixOrZero(rep.Banned),
+	} {
+		blob := make([]byte, binary.MaxVarintLen64)
+		batch.Put(repItemKey(id, field), blob[:binary.PutVarint(blob, val)])
+	}
+	if rep.BanIP != nil {
+		batch.Put(repItemKey(id, dbRepBanIP), rep.BanIP)
+	} else {
+		batch.Delete(repItemKey(id, dbRepBanIP))
+	}
+	return db.lvl.Write(batch, nil)
+}
+
+// DeleteReputation deletes the reputation of a node.
+func (db *DB) DeleteReputation(id ID) {
+	deleteRange(db.lvl, repItemKey(id, ""))
+}
+
+// Reputations retrieves the reputation of all tracked nodes.
+func (db *DB) Reputations() map[ID]Reputation {
+	it := db.lvl.NewIterator(util.BytesPrefix([]byte(dbRepPrefix)), nil)
+	defer it.Release()
+
+	reps := make(map[ID]Reputation)
+	for it.Next() {
+		id, field := splitRepItemKey(it.Key())
+		if field != dbRepScore {
+			continue
+		}
+		reps[id] = db.Reputation(id)
+	}
+	return reps
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
 // QuerySeeds retrieves random nodes to be used as potential seed nodes
 // for bootstrapping.
 func (db *DB) QuerySeeds(n int, maxAge time.Duration) []*Node {
@@ -459,6 +459,36 @@ func TestDBExpiration(t *testing.T) {
 
 // This test checks that expiration works when discovery v5 data is present
 // in the database.
+// This test checks that stale reputations are expired, unless the node is banned.
+func TestDBExpireReputations(t *testing.T) {
+	db, _ := OpenDB("")
+	defer db.Close()
+
+	var (
+		now   = time.Now()
+		stale = now.Add(-dbNodeExpiration - time.Hour)
+		fresh = ID{1}
+		old   = ID{2}
+		ban   = ID{3}
+	)
+	db.UpdateReputation(fresh, Reputation{Score: -10, Updated: now})
+	db.UpdateReputation(old, Reputation{Score: -10, Updated: stale})
+	db.UpdateReputation(ban, Reputation{Updated: stale, Banned: now.Add(time.Hour)})
+
+	db.expireReputations()
+
+	reps := db.Reputations()
+	if _, ok := reps[fresh]; !ok {
+		t.Error("fresh reputation expired")
+	}
+	if _, ok := reps[old]; ok {
+		t.Error("stale reputation not expired")
+	}
+	if _, ok := reps[ban]; !ok {
+		t.Error("banned reputation expired")
+	}
+}
+
 func TestDBExpireV5(t *testing.T) {
 	db, _ := OpenDB("")
 	defer db.Close()
@@ -0,0 +1,108 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"context"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/metrics"
+	"golang.org/x/time/rate"
+)
+
+// throttleTimer measures the time serving messages are held back by the limiters.
+var throttleTimer = metrics.NewRegisteredTimer("p2p/throttle", nil)
+
+// ServeLimiter is a token bucket limiting the bandwidth spent on serving data to
+// remote peers. A single limiter is meant to be shared by all the peers of a
+// protocol, capping the total upload of the node. A nil limiter is unlimited.
+type ServeLimiter struct {
+	limiter *rate.Limiter
+	burst   int
+}
+
+// NewServeLimiter creates a limiter allowing the given number of bytes served
+// per second, with bursts of up to a second's worth of data. It returns nil if
+// the limit is zero, meaning unlimited.
+func NewServeLimiter(bytesPerSec uint64) *ServeLimiter {
+	if bytesPerSec == 0 {
+		return nil
+	}
+	burst := int(bytesPerSec)
+	if uint64(burst) != bytesPerSec || burst < 0 {
+		burst = int(^uint(0) >> 1) // Overflow, practically unlimited
+	}
+	return &ServeLimiter{
+		limiter: rate.NewLimiter(rate.Limit(bytesPerSec), burst),
+		burst:   burst,
+	}
+}
+
+// Wait blocks until enough tokens are available to serve a message of the given
+// size, or until the context is cancelled. Messages larger than the burst consume
+// the entire bucket.
+func (l *ServeLimiter) Wait(ctx context.Context, size uint32) error {
+	if l == nil {
+		return nil
+	}
+	n := int(size)
+	if n > l.burst {
+		n = l.burst
+	}
+	if l.limiter.AllowN(time.Now(), n) {
+		return nil
+	}
+	defer throttleTimer.UpdateSince(time.Now())
+	return l.limiter.WaitN(ctx, n)
+}
+
+// Wrap returns a message writer throttling the messages with the given codes,
+// leaving all others untouched. Throttled writes are aborted when the peer
+// disconnects; if the peer is nil, they wait for as long as needed. If the
+// limiter is nil, the original writer is returned.
+func (l *ServeLimiter) Wrap(p *Peer, rw MsgReadWriter, codes ...uint64) MsgReadWriter {
+	if l == nil {
+		return rw
+	}
+	throttled := make(map[uint64]struct{}, len(codes))
+	for _, code := range codes {
+		throttled[code] = struct{}{}
+	}
+	ctx := context.Background()
+	if p != nil {
+		ctx = p.ctx
+	}
+	return &limitedRW{MsgReadWriter: rw, limiter: l, ctx: ctx, codes: throttled}
+}
+
+// limitedRW is a message writer throttling the messages of a set of codes.
+type limitedRW struct {
+	MsgReadWriter
+	limiter *ServeLimiter
+	ctx     context.Context // Lifetime of the peer, aborting throttled writes
+	codes   map[uint64]struct{}
+}
+
+// WriteMsg waits for the limiter if the message is throttled, then writes it.
+func (rw *limitedRW) WriteMsg(msg Msg) error {
+	if _, ok := rw.codes[msg.Code]; ok {
+		if err := rw.limiter.Wait(rw.ctx, msg.Size); err != nil {
+			return err
+		}
+	}
+	return rw.MsgReadWriter.WriteMsg(msg)
+}
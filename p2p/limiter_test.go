@@ -0,0 +1,85 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestServeLimiter(t *testing.T) {
+	if l := NewServeLimiter(0); l != nil {
+		t.Fatalf("zero limit should be unlimited, got %v", l)
+	}
+	rw1, rw2 := MsgPipe()
+	defer rw1.Close()
+
+	limiter := NewServeLimiter(10000)
+	rw := limiter.Wrap(nil, rw1, 1)
+
+	go func() {
+		for {
+			msg, err := rw2.ReadMsg()
+			if err != nil {
+				return
+			}
+			msg.Discard()
+		}
+	}()
+	// Unthrottled messages and the initial burst should go through immediately
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := rw.WriteMsg(Msg{Code: 0, Size: 10000, Payload: bytes.NewReader(nil)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rw.WriteMsg(Msg{Code: 1, Size: 20000, Payload: bytes.NewReader(nil)}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Fatalf("burst throttled: took %v", elapsed)
+	}
+	// Any further throttled message needs to wait for the bucket to refill
+	if err := rw.WriteMsg(Msg{Code: 1, Size: 5000, Payload: bytes.NewReader(nil)}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("message not throttled: took %v", elapsed)
+	}
+}
+
+func TestServeLimiterCancel(t *testing.T) {
+	limiter := NewServeLimiter(1000)
+	if err := limiter.Wait(context.Background(), 1000); err != nil {
+		t.Fatal(err)
+	}
+	// With the bucket drained, the next wait should be aborted by the context
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	if err := limiter.Wait(ctx, 1000); err == nil {
+		t.Fatal("wait not aborted")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("wait aborted too late: took %v", elapsed)
+	}
+}
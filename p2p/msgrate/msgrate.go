@@ -343,6 +343,30 @@ func (t *Trackers) meanCapacities() map[uint64]float64 {
 	return capacities
 }
 
+// TrackerStats is a snapshot of the measurements of a single tracker.
+type TrackerStats struct {
+	Capacity  map[uint64]float64 // Number of items retrievable per second, by message kind
+	RoundTrip time.Duration      // Latency the peer responds to data requests with
+}
+
+// Stats returns the current measurements of all the added trackers.
+func (t *Trackers) Stats() map[string]TrackerStats {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	stats := make(map[string]TrackerStats, len(t.trackers))
+	for id, tt := range t.trackers {
+		tt.lock.RLock()
+		capacity := make(map[uint64]float64, len(tt.capacity))
+		for kind, val := range tt.capacity {
+			capacity[kind] = val
+		}
+		stats[id] = TrackerStats{Capacity: capacity, RoundTrip: tt.roundtrip}
+		tt.lock.RUnlock()
+	}
+	return stats
+}
+
 // TargetRoundTrip returns the current target round trip time for a request to
 // complete in.The returned RTT is slightly under the estimated RTT. The reason
 // is that message rate estimation is a 2 dimensional problem which is solvable
@@ -17,6 +17,7 @@
 package p2p
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -112,12 +113,17 @@ type Peer struct {
 	wg       sync.WaitGroup
 	protoErr chan error
 	closed   chan struct{}
+	ctx      context.Context // cancelled together with closed, for blocking calls
+	cancel   context.CancelFunc
 	pingRecv chan struct{}
 	disc     chan DiscReason
 
 	// events receives message send / receive events if set
 	events   *event.Feed
 	testPipe *MsgPipeRW // for testing
+
+	reputation *reputation  // reputation tracker of the server, nil if unmanaged
+	traffic    *peerTraffic // per-protocol and per-message traffic accounting
 }
 
 // NewPeer returns a peer for testing purposes.
@@ -135,6 +141,7 @@ func NewPeer(id enode.ID, name string, caps []Cap) *Peer {
 	conn := &conn{fd: pipe, transport: nil, node: node, caps: caps, name: name}
 	peer := newPeer(log.Root(), conn, protos)
 	close(peer.closed) // ensures Disconnect doesn't block
+	peer.cancel()
 	return peer
 }
 
@@ -227,6 +234,7 @@ func (p *Peer) Inbound() bool {
 
 func newPeer(log log.Logger, conn *conn, protocols []Protocol) *Peer {
 	protomap := matchProtocols(protocols, conn.caps, conn)
+	ctx, cancel := context.WithCancel(context.Background())
 	p := &Peer{
 		rw:       conn,
 		running:  protomap,
@@ -234,8 +242,11 @@ func newPeer(log log.Logger, conn *conn, protocols []Protocol) *Peer {
 		disc:     make(chan DiscReason),
 		protoErr: make(chan error, len(protomap)+1), // protocols + pingLoop
 		closed:   make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
 		pingRecv: make(chan struct{}, 16),
 		log:      log.New("id", conn.node.ID(), "conn", conn.flags),
+		traffic:  newPeerTraffic(),
 	}
 	return p
 }
@@ -289,6 +300,7 @@ loop:
 	}
 
 	close(p.closed)
+	p.cancel()
 	p.rw.close(reason)
 	p.wg.Wait()
 	return remoteRequested, err
@@ -416,6 +428,7 @@ func (p *Peer) startProtocols(writeStart <-chan struct{}, writeErr chan<- error)
 		proto.closed = p.closed
 		proto.wstart = writeStart
 		proto.werr = writeErr
+		proto.traffic = p.traffic
 		var rw MsgReadWriter = proto
 		if p.events != nil {
 			rw = newMsgEventer(rw, p.events, p.ID(), proto.Name, p.Info().Network.RemoteAddress, p.Info().Network.LocalAddress)
@@ -454,6 +467,8 @@ type protoRW struct {
 	werr   chan<- error    // for write results
 	offset uint64
 	w      MsgWriter
+
+	traffic *peerTraffic // traffic accounting of the peer, nil if untracked
 }
 
 func (rw *protoRW) WriteMsg(msg Msg) (err error) {
@@ -468,6 +483,9 @@ func (rw *protoRW) WriteMsg(msg Msg) (err error) {
 	select {
 	case <-rw.wstart:
 		err = rw.w.WriteMsg(msg)
+		if err == nil {
+			rw.traffic.record(msg.meterCap, msg.meterCode, msg.Size, false)
+		}
 		// Report write status back to Peer.run. It will initiate
 		// shutdown if the error is non-nil and unblock the next write
 		// otherwise. The calling protocol code should exit for errors
@@ -483,6 +501,7 @@ func (rw *protoRW) ReadMsg() (Msg, error) {
 	select {
 	case msg := <-rw.in:
 		msg.Code -= rw.offset
+		rw.traffic.record(rw.cap(), msg.Code, msg.Size, true)
 		return msg, nil
 	case <-rw.closed:
 		return Msg{}, io.EOF
@@ -505,7 +524,8 @@ type PeerInfo struct {
 		Trusted       bool   `json:"trusted"`
 		Static        bool   `json:"static"`
 	} `json:"network"`
-	Protocols map[string]interface{} `json:"protocols"` // Sub-protocol specific metadata fields
+	Protocols map[string]interface{}      `json:"protocols"`         // Sub-protocol specific metadata fields
+	Traffic   map[string]*ProtocolTraffic `json:"traffic,omitempty"` // Data exchanged per sub-protocol and message
 }
 
 // Info gathers and returns a collection of metadata known about a peer.
@@ -544,5 +564,8 @@ func (p *Peer) Info() *PeerInfo {
 		}
 		info.Protocols[proto.Name] = protoInfo
 	}
+	if p.traffic != nil {
+		info.Traffic = p.traffic.snapshot()
+	}
 	return info
 }
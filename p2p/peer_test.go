@@ -168,6 +168,52 @@ func TestPeerProtoEncodeMsg(t *testing.T) {
 	}
 }
 
+func TestPeerTraffic(t *testing.T) {
+	done := make(chan struct{})
+	proto := Protocol{
+		Name:   "a",
+		Length: 5,
+		Run: func(peer *Peer, rw MsgReadWriter) error {
+			if err := ExpectMsg(rw, 2, []uint{1}); err != nil {
+				t.Error(err)
+			}
+			if err := ExpectMsg(rw, 2, []uint{2}); err != nil {
+				t.Error(err)
+			}
+			if err := SendItems(rw, 4, "foo"); err != nil {
+				t.Error(err)
+			}
+			close(done)
+			<-peer.closed
+			return nil
+		},
+	}
+	closer, rw, peer, _ := testPeer([]Protocol{proto})
+	defer closer()
+
+	Send(rw, baseProtocolLength+2, []uint{1})
+	Send(rw, baseProtocolLength+2, []uint{2})
+	if err := ExpectMsg(rw, baseProtocolLength+4, []string{"foo"}); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	traffic := peer.Info().Traffic["a/0"]
+	if traffic == nil {
+		t.Fatal("protocol traffic not accounted")
+	}
+	want := Traffic{IngressPackets: 2, IngressBytes: 4, EgressPackets: 1, EgressBytes: 5}
+	if traffic.Traffic != want {
+		t.Errorf("protocol traffic mismatch: have %+v, want %+v", traffic.Traffic, want)
+	}
+	if have := *traffic.Messages["0x02"]; have != (Traffic{IngressPackets: 2, IngressBytes: 4}) {
+		t.Errorf("ingress message traffic mismatch: have %+v", have)
+	}
+	if have := *traffic.Messages["0x04"]; have != (Traffic{EgressPackets: 1, EgressBytes: 5}) {
+		t.Errorf("egress message traffic mismatch: have %+v", have)
+	}
+}
+
 func TestPeerPing(t *testing.T) {
 	closer, rw, _, _ := testPeer(nil)
 	defer closer()
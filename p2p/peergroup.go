@@ -0,0 +1,331 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+)
+
+var errUnknownPeerGroup = errors.New("unknown peer group")
+
+// PeerGroup is a named set of nodes with connection slots reserved for them.
+//
+// The reserved slots are taken from MaxPeers, so other peers can only use the
+// slots that remain. Members connect through the reserved slots of their group
+// while there are free ones, and compete for the remaining slots afterwards. If
+// the group reserves outbound slots, its members are dialed until they're filled.
+type PeerGroup struct {
+	Name     string
+	Nodes    []*enode.Node
+	Inbound  int // slots reserved for inbound connections from members
+	Outbound int // slots reserved for connections dialed to members
+	MaxPeers int `toml:",omitempty"` // maximum number of connected members, zero means unlimited
+}
+
+// PeerGroupInfo represents the state of a peer group.
+type PeerGroupInfo struct {
+	Name     string   `json:"name"`
+	Nodes    []string `json:"nodes"`
+	Inbound  int      `json:"inbound"`
+	Outbound int      `json:"outbound"`
+	MaxPeers int      `json:"maxPeers"`
+	Peers    struct {
+		Inbound  int `json:"inbound"`  // connected inbound members
+		Outbound int `json:"outbound"` // connected outbound members
+	} `json:"peers"`
+}
+
+// groupMembership holds the configuration and the members of all peer groups. It
+// is shared by the run loop of the server and the dial scheduler, which track
+// the connected and dialed members on their own.
+type groupMembership struct {
+	groups   map[string]*PeerGroup // configuration of the groups, Nodes unused
+	inbound  int                   // total reserved inbound slots
+	outbound int                   // total reserved outbound slots
+
+	lock    sync.RWMutex
+	members map[string]map[enode.ID]*enode.Node // members of each group
+	groupOf map[enode.ID]string                 // group of each member
+}
+
+func newGroupMembership(config []PeerGroup) (*groupMembership, error) {
+	gm := &groupMembership{
+		groups:  make(map[string]*PeerGroup),
+		members: make(map[string]map[enode.ID]*enode.Node),
+		groupOf: make(map[enode.ID]string),
+	}
+	for _, cfg := range config {
+		switch {
+		case cfg.Name == "":
+			return nil, errors.New("peer group without name")
+		case gm.groups[cfg.Name] != nil:
+			return nil, fmt.Errorf("duplicate peer group %q", cfg.Name)
+		case cfg.Inbound < 0 || cfg.Outbound < 0 || cfg.MaxPeers < 0:
+			return nil, fmt.Errorf("negative slot count in peer group %q", cfg.Name)
+		}
+		g := cfg
+		g.Nodes = nil
+		gm.groups[cfg.Name] = &g
+		gm.members[cfg.Name] = make(map[enode.ID]*enode.Node)
+		gm.inbound += cfg.Inbound
+		gm.outbound += cfg.Outbound
+		for _, n := range cfg.Nodes {
+			if _, err := gm.add(cfg.Name, n); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return gm, nil
+}
+
+// add makes the node a member of the given group, reporting whether it wasn't a
+// member yet. Nodes can only be in one group.
+func (gm *groupMembership) add(name string, n *enode.Node) (bool, error) {
+	gm.lock.Lock()
+	defer gm.lock.Unlock()
+
+	members := gm.members[name]
+	if members == nil {
+		return false, errUnknownPeerGroup
+	}
+	if other, ok := gm.groupOf[n.ID()]; ok {
+		if other == name {
+			return false, nil
+		}
+		return false, fmt.Errorf("node is a member of peer group %q", other)
+	}
+	members[n.ID()] = n
+	gm.groupOf[n.ID()] = name
+	return true, nil
+}
+
+// remove ends the membership of the node in the given group, reporting whether
+// it was a member.
+func (gm *groupMembership) remove(name string, id enode.ID) (bool, error) {
+	gm.lock.Lock()
+	defer gm.lock.Unlock()
+
+	members := gm.members[name]
+	if members == nil {
+		return false, errUnknownPeerGroup
+	}
+	if _, ok := members[id]; !ok {
+		return false, nil
+	}
+	delete(members, id)
+	delete(gm.groupOf, id)
+	return true, nil
+}
+
+// group returns the name of the group the node is a member of, if any.
+func (gm *groupMembership) group(id enode.ID) (string, bool) {
+	gm.lock.RLock()
+	defer gm.lock.RUnlock()
+
+	name, ok := gm.groupOf[id]
+	return name, ok
+}
+
+// nodes returns the members of the given group.
+func (gm *groupMembership) nodes(name string) []*enode.Node {
+	gm.lock.RLock()
+	defer gm.lock.RUnlock()
+
+	nodes := make([]*enode.Node, 0, len(gm.members[name]))
+	for _, n := range gm.members[name] {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// peerGroup counts the connected members of a peer group.
+type peerGroup struct {
+	*PeerGroup
+	inbound, outbound int
+}
+
+// reserved returns the number of reserved slots used by connected members.
+func (g *peerGroup) reserved() (inbound, outbound int) {
+	inbound, outbound = g.inbound, g.outbound
+	if inbound > g.Inbound {
+		inbound = g.Inbound
+	}
+	if outbound > g.Outbound {
+		outbound = g.Outbound
+	}
+	return inbound, outbound
+}
+
+// peerGroups tracks the connected members of all peer groups. It belongs to the
+// run loop of the server.
+type peerGroups struct {
+	*groupMembership
+	counts map[string]*peerGroup
+}
+
+func newPeerGroups(gm *groupMembership) *peerGroups {
+	pg := &peerGroups{
+		groupMembership: gm,
+		counts:          make(map[string]*peerGroup, len(gm.groups)),
+	}
+	for name, cfg := range gm.groups {
+		pg.counts[name] = &peerGroup{PeerGroup: cfg}
+	}
+	return pg
+}
+
+// of returns the group of the node, nil if it's not a member of any.
+func (pg *peerGroups) of(id enode.ID) *peerGroup {
+	if name, ok := pg.group(id); ok {
+		return pg.counts[name]
+	}
+	return nil
+}
+
+// addMember makes the node a member of the given group, counting it if it's
+// already connected.
+func (pg *peerGroups) addMember(name string, n *enode.Node, peers map[enode.ID]*Peer) error {
+	added, err := pg.add(name, n)
+	if added {
+		if p := peers[n.ID()]; p != nil {
+			pg.count(pg.counts[name], p.rw, 1)
+		}
+	}
+	return err
+}
+
+// removeMember ends the membership of the node in the given group.
+func (pg *peerGroups) removeMember(name string, n *enode.Node, peers map[enode.ID]*Peer) error {
+	removed, err := pg.remove(name, n.ID())
+	if removed {
+		if p := peers[n.ID()]; p != nil {
+			pg.count(pg.counts[name], p.rw, -1)
+		}
+	}
+	return err
+}
+
+func (pg *peerGroups) count(g *peerGroup, c *conn, delta int) {
+	if c.is(inboundConn) {
+		g.inbound += delta
+	} else {
+		g.outbound += delta
+	}
+}
+
+// peerAdded and peerRemoved keep track of the connected members.
+func (pg *peerGroups) peerAdded(c *conn) {
+	if g := pg.of(c.node.ID()); g != nil {
+		pg.count(g, c, 1)
+	}
+}
+
+func (pg *peerGroups) peerRemoved(c *conn) {
+	if g := pg.of(c.node.ID()); g != nil {
+		pg.count(g, c, -1)
+	}
+}
+
+// reserved returns the number of reserved slots used by connected members of all
+// groups.
+func (pg *peerGroups) reserved() (inbound, outbound int) {
+	for _, g := range pg.counts {
+		in, out := g.reserved()
+		inbound += in
+		outbound += out
+	}
+	return inbound, outbound
+}
+
+// hasReservedSlot reports whether the connection can use a free reserved slot of
+// the group it belongs to.
+func (pg *peerGroups) hasReservedSlot(c *conn) bool {
+	g := pg.of(c.node.ID())
+	switch {
+	case g == nil:
+		return false
+	case c.is(inboundConn):
+		return g.inbound < g.Inbound
+	default:
+		return g.outbound < g.Outbound
+	}
+}
+
+// full reports whether the group of the connection has reached its peer limit.
+func (pg *peerGroups) full(c *conn) bool {
+	g := pg.of(c.node.ID())
+	return g != nil && g.MaxPeers > 0 && g.inbound+g.outbound >= g.MaxPeers
+}
+
+// info returns the state of all groups, sorted by name.
+func (pg *peerGroups) info() []*PeerGroupInfo {
+	infos := make([]*PeerGroupInfo, 0, len(pg.counts))
+	for _, g := range pg.counts {
+		info := &PeerGroupInfo{
+			Name:     g.Name,
+			Nodes:    []string{},
+			Inbound:  g.Inbound,
+			Outbound: g.Outbound,
+			MaxPeers: g.MaxPeers,
+		}
+		info.Peers.Inbound, info.Peers.Outbound = g.inbound, g.outbound
+		for _, n := range pg.nodes(g.Name) {
+			info.Nodes = append(info.Nodes, n.URLv4())
+		}
+		sort.Strings(info.Nodes)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// AddPeerToGroup makes the given node a member of a peer group, allowing it to
+// use the slots reserved for the group. Members of groups reserving outbound
+// slots are dialed by the server.
+func (srv *Server) AddPeerToGroup(group string, node *enode.Node) error {
+	err := errServerStopped
+	srv.doPeerOp(func(peers map[enode.ID]*Peer) {
+		if err = srv.groups.addMember(group, node, peers); err == nil {
+			srv.dialsched.groupsUpdated()
+		}
+	})
+	return err
+}
+
+// RemovePeerFromGroup ends the membership of the given node in a peer group. It
+// does not disconnect the node.
+func (srv *Server) RemovePeerFromGroup(group string, node *enode.Node) error {
+	err := errServerStopped
+	srv.doPeerOp(func(peers map[enode.ID]*Peer) {
+		err = srv.groups.removeMember(group, node, peers)
+	})
+	return err
+}
+
+// PeerGroupsInfo returns the state of all peer groups.
+func (srv *Server) PeerGroupsInfo() []*PeerGroupInfo {
+	var infos []*PeerGroupInfo
+	srv.doPeerOp(func(map[enode.ID]*Peer) {
+		infos = srv.groups.info()
+	})
+	return infos
+}
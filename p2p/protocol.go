@@ -61,6 +61,10 @@ type Protocol struct {
 
 	// Attributes contains protocol specific information for the node record.
 	Attributes []enr.Entry
+
+	// Topics are the V5 discovery topics the node is advertised under while the
+	// protocol is running, e.g. to announce the services it offers.
+	Topics []string
 }
 
 func (p Protocol) cap() Cap {
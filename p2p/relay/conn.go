@@ -0,0 +1,386 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package relay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/p2p"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/netutil"
+	"github.com/rethereum-blockchain/go-rethereum/rlp"
+)
+
+// Connections to the relay listener start with a request frame. A connect request
+// asks the relay to forward the connection to one of its clients, which then
+// sends an accept request on a new connection to complete the splice. Frames are
+// RLP encoded and prefixed by their length as a big endian uint16.
+const (
+	connectRequest = iota
+	acceptRequest
+)
+
+// Status codes of connect requests.
+const (
+	statusOK = iota
+	statusUnknownNode
+	statusFailed
+	statusThrottled
+)
+
+const (
+	maxFrameSize       = 1024
+	handshakeTimeout   = 5 * time.Second  // time limit for reading the request frame
+	acceptTimeout      = 10 * time.Second // time limit for the client to accept a connection
+	directDialTimeout  = 3 * time.Second  // time limit for direct dials of relayed nodes
+	defaultDialTimeout = 15 * time.Second
+
+	connectThrottle      = time.Second // minimum time between connect requests of an Internet host
+	maxConnectHistory    = 1024        // connect history size that triggers removal of expired entries
+	maxRelayedHandshakes = 16          // limit of relayed connections accepted at the same time
+)
+
+var (
+	errUnknownNode = errors.New("node is not relayed")
+	errRelayFailed = errors.New("relayed node did not accept connection")
+	errFrameSize   = errors.New("relay frame too large")
+	errThrottled   = errors.New("too many connect requests")
+)
+
+type request struct {
+	Kind   uint
+	Target enode.ID // node to connect to, for connect requests
+	Token  token    // token of the incoming message, for accept requests
+}
+
+type response struct {
+	Status uint
+}
+
+// session is a pair of spliced connections.
+type session struct {
+	a, b net.Conn
+}
+
+func (s *session) close() {
+	s.a.Close()
+	s.b.Close()
+}
+
+func writeFrame(conn net.Conn, val interface{}) error {
+	enc, err := rlp.EncodeToBytes(val)
+	if err != nil {
+		return err
+	}
+	if len(enc) > maxFrameSize {
+		return errFrameSize
+	}
+	frame := make([]byte, 2+len(enc))
+	binary.BigEndian.PutUint16(frame, uint16(len(enc)))
+	copy(frame[2:], enc)
+	_, err = conn.Write(frame)
+	return err
+}
+
+func readFrame(conn net.Conn, val interface{}) error {
+	var size [2]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint16(size[:])
+	if n > maxFrameSize {
+		return errFrameSize
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	return rlp.DecodeBytes(buf, val)
+}
+
+// acceptLoop accepts connections on the relay listener.
+func (r *Relay) acceptLoop(listener net.Listener) {
+	defer r.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if netutil.IsTemporaryError(err) {
+			time.Sleep(50 * time.Millisecond)
+			continue
+		} else if err != nil {
+			return
+		}
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.serveConn(conn)
+		}()
+	}
+}
+
+// serveConn handles a connection to the relay listener.
+func (r *Relay) serveConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	var req request
+	if err := readFrame(conn, &req); err != nil {
+		r.log.Trace("Invalid relay request", "addr", conn.RemoteAddr(), "err", err)
+		conn.Close()
+		return
+	}
+	switch req.Kind {
+	case connectRequest:
+		r.serveConnect(conn, req.Target)
+	case acceptRequest:
+		r.serveAccept(conn, req.Token)
+	default:
+		conn.Close()
+	}
+}
+
+// serveConnect asks the target node to accept the connection, and splices both
+// connections when it does.
+func (r *Relay) serveConnect(conn net.Conn, target enode.ID) {
+	ip := netutil.AddrIP(conn.RemoteAddr())
+	if !r.allowConnect(ip) {
+		r.log.Trace("Throttled relay connect request", "addr", conn.RemoteAddr())
+		writeFrame(conn, &response{Status: statusThrottled})
+		conn.Close()
+		return
+	}
+	var tok token
+	rand.Read(tok[:])
+	accepted := make(chan net.Conn, 1)
+
+	r.mu.Lock()
+	c := r.clients[target]
+	if c != nil {
+		r.pending[tok] = accepted
+	}
+	r.mu.Unlock()
+	if c == nil {
+		writeFrame(conn, &response{Status: statusUnknownNode})
+		conn.Close()
+		return
+	}
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, tok)
+		r.mu.Unlock()
+		// Close connections accepted after the request has timed out.
+		select {
+		case late := <-accepted:
+			late.Close()
+		default:
+		}
+	}()
+
+	var other net.Conn
+	if err := p2p.Send(c.rw, incomingMsg, &incomingPacket{Token: tok, IP: ip}); err == nil {
+		timeout := time.NewTimer(acceptTimeout)
+		defer timeout.Stop()
+		select {
+		case other = <-accepted:
+		case <-timeout.C:
+		case <-r.quit:
+		}
+	}
+	if other == nil {
+		writeFrame(conn, &response{Status: statusFailed})
+		conn.Close()
+		return
+	}
+	if err := writeFrame(conn, &response{Status: statusOK}); err != nil {
+		conn.Close()
+		other.Close()
+		return
+	}
+	r.log.Debug("Relaying connection", "id", target, "from", conn.RemoteAddr())
+	conn.SetDeadline(time.Time{})
+	other.SetDeadline(time.Time{})
+	r.splice(conn, other)
+}
+
+// allowConnect reports whether a connect request from the given address is
+// allowed. Internet hosts may send one request per connectThrottle.
+func (r *Relay) allowConnect(ip net.IP) bool {
+	if ip == nil || netutil.IsLAN(ip) {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	key := ip.String()
+	if last, ok := r.connects[key]; ok && now.Sub(last) < connectThrottle {
+		return false
+	}
+	if len(r.connects) >= maxConnectHistory {
+		for k, last := range r.connects {
+			if now.Sub(last) >= connectThrottle {
+				delete(r.connects, k)
+			}
+		}
+	}
+	r.connects[key] = now
+	return true
+}
+
+// serveAccept hands the connection to the pending connect request of the token.
+func (r *Relay) serveAccept(conn net.Conn, tok token) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	accepted := r.pending[tok]
+	if accepted == nil {
+		conn.Close()
+		return
+	}
+	delete(r.pending, tok)
+	accepted <- conn
+}
+
+// splice copies data between both connections until either of them is closed.
+func (r *Relay) splice(a, b net.Conn) {
+	s := &session{a, b}
+	r.mu.Lock()
+	select {
+	case <-r.quit:
+		r.mu.Unlock()
+		s.close()
+		return
+	default:
+		r.sessions[s] = struct{}{}
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(a, b); done <- struct{}{} }()
+	go func() { io.Copy(b, a); done <- struct{}{} }()
+	<-done
+	s.close()
+	<-done
+
+	r.mu.Lock()
+	delete(r.sessions, s)
+	r.mu.Unlock()
+}
+
+// acceptRelayed opens a connection to the relay for an incoming connection and
+// hands it to the server as an inbound connection. ip is the address of the
+// connecting node, as reported by the relay.
+func (r *Relay) acceptRelayed(relay Entry, tok token, ip net.IP) {
+	select {
+	case r.handshakes <- struct{}{}:
+		defer func() { <-r.handshakes }()
+	default:
+		r.log.Debug("Too many relayed handshakes", "relay", relay.IP)
+		return
+	}
+	addr := &net.TCPAddr{IP: relay.IP, Port: int(relay.TCP)}
+	conn, err := net.DialTimeout("tcp", addr.String(), handshakeTimeout)
+	if err != nil {
+		r.log.Debug("Failed to accept relayed connection", "relay", addr, "err", err)
+		return
+	}
+	if err := writeFrame(conn, &request{Kind: acceptRequest, Token: tok}); err != nil {
+		conn.Close()
+		return
+	}
+	r.srv.SetupInboundConn(conn, ip)
+}
+
+// NewDialer returns a p2p.NodeDialer for use in p2p.Config. Nodes advertising a
+// relay are dialed directly first, and through their relay if that fails. All
+// other nodes are dialed using base, which defaults to plain TCP.
+func NewDialer(base p2p.NodeDialer) p2p.NodeDialer {
+	if base == nil {
+		base = tcpDialer{&net.Dialer{Timeout: defaultDialTimeout}}
+	}
+	return &dialer{base: base}
+}
+
+type tcpDialer struct {
+	d *net.Dialer
+}
+
+func (t tcpDialer) Dial(ctx context.Context, dest *enode.Node) (net.Conn, error) {
+	addr := &net.TCPAddr{IP: dest.IP(), Port: dest.TCP()}
+	return t.d.DialContext(ctx, "tcp", addr.String())
+}
+
+type dialer struct {
+	base p2p.NodeDialer
+}
+
+func (d *dialer) Dial(ctx context.Context, dest *enode.Node) (net.Conn, error) {
+	var entry Entry
+	if err := dest.Load(&entry); err != nil {
+		return d.base.Dial(ctx, dest)
+	}
+	if dest.IP() != nil && dest.TCP() != 0 {
+		dctx, cancel := context.WithTimeout(ctx, directDialTimeout)
+		conn, err := d.base.Dial(dctx, dest)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return dialRelayed(ctx, &entry, dest.ID())
+}
+
+// dialRelayed connects to the given node through a relay.
+func dialRelayed(ctx context.Context, relay *Entry, target enode.ID) (net.Conn, error) {
+	var d net.Dialer
+	addr := &net.TCPAddr{IP: relay.IP, Port: int(relay.TCP)}
+	conn, err := d.DialContext(ctx, "tcp", addr.String())
+	if err != nil {
+		return nil, err
+	}
+	// The relay answers once the target has accepted the connection.
+	conn.SetDeadline(time.Now().Add(handshakeTimeout + acceptTimeout))
+	if err := writeFrame(conn, &request{Kind: connectRequest, Target: target}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var resp response
+	if err := readFrame(conn, &resp); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	switch resp.Status {
+	case statusOK:
+		conn.SetDeadline(time.Time{})
+		return conn, nil
+	case statusUnknownNode:
+		err = errUnknownNode
+	case statusFailed:
+		err = errRelayFailed
+	case statusThrottled:
+		err = errThrottled
+	default:
+		err = fmt.Errorf("invalid relay status %d", resp.Status)
+	}
+	conn.Close()
+	return nil, err
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package relay
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/p2p/discover"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+	"github.com/rethereum-blockchain/go-rethereum/rlp"
+)
+
+// UDP hole punching is coordinated over discv5 TALKREQ. Relayed nodes register
+// their discovery endpoint with the relay, which keeps their NAT mapping open.
+// A node wanting to reach a relayed node asks the relay to punch. The relay
+// responds with the endpoint of the relayed node and notifies it of the
+// requester, making it send a probe which opens its NAT for the requester.
+const (
+	talkRegister = iota
+	talkPunch
+	talkNotify
+	talkProbe
+)
+
+const punchAttempts = 3
+
+var (
+	errNoRelay     = errors.New("node does not advertise a relay")
+	errPunchDenied = errors.New("relay refused hole punch")
+)
+
+type talkRequest struct {
+	Kind uint
+	Node enode.ID // target of punch requests, requester in notifications
+	IP   net.IP   // requester endpoint in notifications
+	Port uint16
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+type talkResponse struct {
+	OK   bool
+	IP   net.IP // endpoint of the target, for punch requests
+	Port uint16
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// handleTalkRequest serves relay TALKREQ messages.
+func (r *Relay) handleTalkRequest(id enode.ID, addr *net.UDPAddr, msg []byte) []byte {
+	var req talkRequest
+	if err := rlp.DecodeBytes(msg, &req); err != nil {
+		return nil
+	}
+	var resp talkResponse
+	switch req.Kind {
+	case talkRegister:
+		r.mu.Lock()
+		if c := r.clients[id]; c != nil {
+			c.udp = addr
+			resp.OK = true
+		}
+		r.mu.Unlock()
+
+	case talkPunch:
+		r.mu.Lock()
+		c := r.clients[req.Node]
+		if c != nil && c.udp != nil {
+			resp = talkResponse{OK: true, IP: c.udp.IP, Port: uint16(c.udp.Port)}
+			go r.notify(req.Node, c.udp, id, addr)
+		}
+		r.mu.Unlock()
+
+	case talkNotify:
+		// Only the advertised relay may make us send packets to other nodes.
+		if active, _, ok := r.activeRelay(); ok && active == id {
+			target := &net.UDPAddr{IP: req.IP, Port: int(req.Port)}
+			go r.srv.DiscV5.TalkRequestToID(req.Node, target, protocolName, encodeTalk(&talkRequest{Kind: talkProbe}))
+			resp.OK = true
+		}
+
+	case talkProbe:
+		resp.OK = true
+	}
+	return encodeTalk(&resp)
+}
+
+// notify tells a relayed node about a punch request.
+func (r *Relay) notify(client enode.ID, clientAddr *net.UDPAddr, from enode.ID, fromAddr *net.UDPAddr) {
+	req := &talkRequest{Kind: talkNotify, Node: from, IP: fromAddr.IP, Port: uint16(fromAddr.Port)}
+	if _, err := r.srv.DiscV5.TalkRequestToID(client, clientAddr, protocolName, encodeTalk(req)); err != nil {
+		r.log.Debug("Failed to notify relayed node", "id", client, "err", err)
+	}
+}
+
+// keepaliveLoop registers the discovery endpoint of the local node with the
+// advertised relay whenever it changes, and periodically afterwards.
+func (r *Relay) keepaliveLoop() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.activated:
+		case <-r.quit:
+			return
+		}
+		id, entry, ok := r.activeRelay()
+		if !ok {
+			continue
+		}
+		relay, err := entry.Node()
+		if err != nil || entry.UDP == 0 {
+			continue
+		}
+		if _, err := r.srv.DiscV5.TalkRequest(relay, protocolName, encodeTalk(&talkRequest{Kind: talkRegister})); err != nil {
+			r.log.Debug("Failed to register with relay", "id", id, "err", err)
+		}
+	}
+}
+
+// HolePunch establishes a discovery session with a node behind NAT, with the
+// help of the relay advertised in its record. It returns the node with the
+// endpoint through which it is reachable.
+func HolePunch(disc *discover.UDPv5, n *enode.Node) (*enode.Node, error) {
+	var entry Entry
+	if err := n.Load(&entry); err != nil {
+		return nil, errNoRelay
+	}
+	relay, err := entry.Node()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := disc.TalkRequest(relay, protocolName, encodeTalk(&talkRequest{Kind: talkPunch, Node: n.ID()}))
+	if err != nil {
+		return nil, err
+	}
+	var resp talkResponse
+	if err := rlp.DecodeBytes(msg, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		return nil, errPunchDenied
+	}
+	// The first packets may be dropped by the NAT of the node until its probe has
+	// been sent, so retry a few times.
+	target := enode.NewV4(n.Pubkey(), resp.IP, n.TCP(), int(resp.Port))
+	for i := 0; i < punchAttempts; i++ {
+		if err = disc.Ping(target); err == nil {
+			return target, nil
+		}
+	}
+	return nil, err
+}
+
+func encodeTalk(val interface{}) []byte {
+	enc, _ := rlp.EncodeToBytes(val)
+	return enc
+}
@@ -0,0 +1,359 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package relay implements connection relaying for nodes which can't accept
+// inbound connections, e.g. because they're behind carrier-grade NAT.
+//
+// A node behind NAT keeps a devp2p connection to one or more relays. Once a relay
+// agrees to forward connections, the node advertises it in the "relay" entry of
+// its record. Nodes wanting to connect contact the relay, which asks the node to
+// open a connection back to it and splices both connections together. The RLPx
+// handshake then runs end-to-end through the relay.
+//
+// If discovery v5 is enabled, relays also coordinate UDP hole punching over
+// TALKREQ, allowing the discovery traffic to reach the node directly.
+package relay
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/p2p"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+	"github.com/rethereum-blockchain/go-rethereum/rlp"
+)
+
+const (
+	protocolName    = "relay"
+	protocolVersion = 1
+	protocolLength  = 3
+
+	registerMsg   = 0x00
+	registeredMsg = 0x01
+	incomingMsg   = 0x02
+
+	defaultMaxClients = 64
+	keepaliveInterval = 20 * time.Second // interval of UDP registrations, keeping the NAT mapping alive
+)
+
+// Entry is the "relay" ENR entry. It advertises a relay which forwards connections
+// to the node.
+type Entry struct {
+	Key  []byte         // compressed public key of the relay
+	IP   net.IP         // IP address of the relay
+	TCP  uint16         // port on which the relay forwards connections
+	UDP  uint16         // discovery port of the relay
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// ENRKey implements enr.Entry.
+func (Entry) ENRKey() string { return "relay" }
+
+// Node returns the relay advertised by the entry.
+func (e *Entry) Node() (*enode.Node, error) {
+	key, err := crypto.DecompressPubkey(e.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relay key: %v", err)
+	}
+	return enode.NewV4(key, e.IP, int(e.TCP), int(e.UDP)), nil
+}
+
+// Config holds the relay settings.
+type Config struct {
+	// ListenAddr is the TCP address on which connections to relayed nodes are
+	// accepted. If empty, the local node doesn't act as a relay for others.
+	ListenAddr string
+
+	// MaxClients limits the number of nodes relayed at the same time.
+	// Zero defaults to 64.
+	MaxClients int
+
+	// Relays are asked to forward connections to the local node. They are
+	// added as static peers.
+	Relays []*enode.Node
+
+	// Log is the destination of relay log messages (defaults to root logger).
+	Log log.Logger
+}
+
+// Relay runs the relay protocol, both forwarding connections to other nodes and
+// registering the local node with its configured relays.
+type Relay struct {
+	cfg  Config
+	srv  *p2p.Server
+	log  log.Logger
+	quit chan struct{}
+	wg   sync.WaitGroup
+
+	mu         sync.Mutex
+	listener   net.Listener
+	clients    map[enode.ID]*client    // nodes relayed by the local node
+	pending    map[token]chan net.Conn // relayed connections waiting for the client
+	registered map[enode.ID]Entry      // relays forwarding connections to the local node
+	active     enode.ID                // relay advertised in the local record
+	activated  chan struct{}           // signals a change of the active relay
+	relays     map[enode.ID]bool       // configured relays
+	sessions   map[*session]struct{}   // spliced connections
+	connects   map[string]time.Time    // last connect request per source address
+
+	handshakes chan struct{} // limits relayed connections being accepted
+}
+
+// client is a node relayed by the local node.
+type client struct {
+	rw  p2p.MsgReadWriter
+	udp *net.UDPAddr // discovery endpoint, as observed on registration
+}
+
+type token [16]byte
+
+type registeredPacket struct {
+	Port uint16 // relay listener port, zero if the registration was refused
+}
+
+type incomingPacket struct {
+	Token token
+	IP    net.IP `rlp:"optional"` // address of the connecting node
+}
+
+// New creates a relay for the given server. The protocols returned by Protocols
+// must be added to the server before it is started, and Start must be called
+// after the server is running.
+func New(srv *p2p.Server, cfg Config) *Relay {
+	if cfg.MaxClients == 0 {
+		cfg.MaxClients = defaultMaxClients
+	}
+	if cfg.Log == nil {
+		cfg.Log = log.Root()
+	}
+	r := &Relay{
+		cfg:        cfg,
+		srv:        srv,
+		log:        cfg.Log,
+		quit:       make(chan struct{}),
+		clients:    make(map[enode.ID]*client),
+		pending:    make(map[token]chan net.Conn),
+		registered: make(map[enode.ID]Entry),
+		activated:  make(chan struct{}, 1),
+		relays:     make(map[enode.ID]bool),
+		sessions:   make(map[*session]struct{}),
+		connects:   make(map[string]time.Time),
+		handshakes: make(chan struct{}, maxRelayedHandshakes),
+	}
+	for _, n := range cfg.Relays {
+		r.relays[n.ID()] = true
+	}
+	return r
+}
+
+// Protocols returns the devp2p protocol used to register with relays.
+func (r *Relay) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    protocolName,
+		Version: protocolVersion,
+		Length:  protocolLength,
+		Run:     r.runPeer,
+	}}
+}
+
+// Start starts accepting relayed connections and connects to the configured
+// relays. It implements node.Lifecycle.
+func (r *Relay) Start() error {
+	if r.cfg.ListenAddr != "" {
+		listener, err := net.Listen("tcp", r.cfg.ListenAddr)
+		if err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.listener = listener
+		r.mu.Unlock()
+
+		r.log.Info("Relay listener up", "addr", listener.Addr())
+		r.wg.Add(1)
+		go r.acceptLoop(listener)
+	}
+	if r.srv.DiscV5 != nil {
+		r.srv.DiscV5.RegisterTalkHandler(protocolName, r.handleTalkRequest)
+		if len(r.cfg.Relays) > 0 {
+			r.wg.Add(1)
+			go r.keepaliveLoop()
+		}
+	}
+	for _, n := range r.cfg.Relays {
+		r.srv.AddPeer(n)
+	}
+	return nil
+}
+
+// Stop closes the listener and all relayed connections. It implements
+// node.Lifecycle.
+func (r *Relay) Stop() error {
+	close(r.quit)
+	r.mu.Lock()
+	if r.listener != nil {
+		r.listener.Close()
+	}
+	for s := range r.sessions {
+		s.close()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return nil
+}
+
+// runPeer runs the relay protocol with a peer.
+func (r *Relay) runPeer(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	if r.isRelay(p.ID()) {
+		if err := p2p.Send(rw, registerMsg, []interface{}{}); err != nil {
+			return err
+		}
+	}
+	defer r.peerGone(p.ID())
+
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		err = r.handleMsg(p, rw, msg)
+		msg.Discard()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Relay) handleMsg(p *p2p.Peer, rw p2p.MsgReadWriter, msg p2p.Msg) error {
+	switch msg.Code {
+	case registerMsg:
+		// The peer asks us to forward connections to it.
+		return p2p.Send(rw, registeredMsg, &registeredPacket{Port: r.addClient(p.ID(), rw)})
+
+	case registeredMsg:
+		var res registeredPacket
+		if err := msg.Decode(&res); err != nil {
+			return fmt.Errorf("invalid %s message: %v", protocolName, err)
+		}
+		if !r.isRelay(p.ID()) {
+			return nil
+		}
+		if res.Port == 0 {
+			r.log.Debug("Relay refused registration", "id", p.ID())
+			return nil
+		}
+		addr, ok := p.RemoteAddr().(*net.TCPAddr)
+		if !ok {
+			return nil
+		}
+		r.addRelay(p.ID(), Entry{
+			Key: crypto.CompressPubkey(p.Node().Pubkey()),
+			IP:  addr.IP,
+			TCP: res.Port,
+			UDP: uint16(p.Node().UDP()),
+		})
+		return nil
+
+	case incomingMsg:
+		var req incomingPacket
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("invalid %s message: %v", protocolName, err)
+		}
+		r.mu.Lock()
+		entry, ok := r.registered[p.ID()]
+		r.mu.Unlock()
+		if ok {
+			go r.acceptRelayed(entry, req.Token, req.IP)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("invalid %s message code %d", protocolName, msg.Code)
+	}
+}
+
+func (r *Relay) isRelay(id enode.ID) bool {
+	return r.relays[id]
+}
+
+// addClient starts relaying connections to the given node, returning the port
+// of the relay listener. If the node can't be relayed, zero is returned.
+func (r *Relay) addClient(id enode.ID, rw p2p.MsgReadWriter) uint16 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.listener == nil || (r.clients[id] == nil && len(r.clients) >= r.cfg.MaxClients) {
+		return 0
+	}
+	r.clients[id] = &client{rw: rw}
+	r.log.Debug("Relaying connections to node", "id", id)
+	return uint16(r.listener.Addr().(*net.TCPAddr).Port)
+}
+
+// addRelay records a relay which agreed to forward connections to the local
+// node, advertising it if no other relay is.
+func (r *Relay) addRelay(id enode.ID, entry Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.registered[id] = entry
+	if r.active == (enode.ID{}) {
+		r.setActive(id)
+	}
+}
+
+// peerGone removes all state associated with a disconnected peer.
+func (r *Relay) peerGone(id enode.ID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.clients, id)
+	delete(r.registered, id)
+	if r.active == id {
+		r.active = enode.ID{}
+		for other := range r.registered {
+			r.setActive(other)
+			return
+		}
+		r.srv.LocalNode().Delete(Entry{})
+		r.log.Info("Stopped advertising relay", "id", id)
+	}
+}
+
+// setActive advertises the given relay in the local record. The lock must be held.
+func (r *Relay) setActive(id enode.ID) {
+	entry := r.registered[id]
+	r.active = id
+	r.srv.LocalNode().Set(entry)
+	r.log.Info("Advertising relay", "id", id, "ip", entry.IP, "port", entry.TCP)
+
+	select {
+	case r.activated <- struct{}{}:
+	default:
+	}
+}
+
+// activeRelay returns the relay advertised in the local record.
+func (r *Relay) activeRelay() (enode.ID, Entry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.registered[r.active]
+	return r.active, entry, ok
+}
@@ -0,0 +1,216 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package relay
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/internal/testlog"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/p2p"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enr"
+)
+
+func TestEntry(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	entry := Entry{
+		Key: crypto.CompressPubkey(&key.PublicKey),
+		IP:  net.IP{10, 0, 0, 1},
+		TCP: 30304,
+		UDP: 30303,
+	}
+	var r enr.Record
+	r.Set(entry)
+
+	var loaded Entry
+	if err := r.Load(&loaded); err != nil {
+		t.Fatal("can't load entry:", err)
+	}
+	if !bytes.Equal(loaded.Key, entry.Key) || !loaded.IP.Equal(entry.IP) || loaded.TCP != entry.TCP || loaded.UDP != entry.UDP {
+		t.Fatalf("wrong entry loaded: %+v", loaded)
+	}
+	relay, err := loaded.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := enode.PubkeyToIDV4(&key.PublicKey)
+	if relay.ID() != want || !relay.IP().Equal(entry.IP) || relay.TCP() != 30304 || relay.UDP() != 30303 {
+		t.Fatalf("wrong relay node %v", relay)
+	}
+}
+
+type testNode struct {
+	srv   *p2p.Server
+	relay *Relay
+}
+
+func startTestNode(t *testing.T, name string, v5 bool, cfg Config) *testNode {
+	t.Helper()
+
+	key, _ := crypto.GenerateKey()
+	cfg.Log = testlog.Logger(t, log.LvlTrace).New("node", name)
+	srv := &p2p.Server{Config: p2p.Config{
+		Name:        name,
+		PrivateKey:  key,
+		MaxPeers:    10,
+		ListenAddr:  "127.0.0.1:0",
+		NoDiscovery: true,
+		DiscoveryV5: v5,
+		Dialer:      NewDialer(nil),
+		Logger:      cfg.Log,
+	}}
+	n := &testNode{srv: srv, relay: New(srv, cfg)}
+	srv.Protocols = n.relay.Protocols()
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.relay.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		n.relay.Stop()
+		srv.Stop()
+	})
+	return n
+}
+
+// closedPort returns a local TCP port which isn't accepting connections.
+func closedPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for", what)
+}
+
+func waitForEntry(t *testing.T, n *testNode) Entry {
+	var entry Entry
+	waitFor(t, "relay entry", func() bool {
+		return n.srv.Self().Load(&entry) == nil
+	})
+	return entry
+}
+
+// This test checks that a node which can't be reached directly is connected to
+// through its relay.
+func TestRelayedConnection(t *testing.T) {
+	relay := startTestNode(t, "relay", false, Config{ListenAddr: "127.0.0.1:0"})
+	natted := startTestNode(t, "natted", false, Config{Relays: []*enode.Node{relay.srv.Self()}})
+	// Simulate NAT by advertising a port nobody listens on.
+	natted.srv.LocalNode().Set(enr.TCP(closedPort(t)))
+
+	entry := waitForEntry(t, natted)
+	if want := relay.relay.listener.Addr().(*net.TCPAddr).Port; int(entry.TCP) != want {
+		t.Fatalf("wrong relay port %d in entry, want %d", entry.TCP, want)
+	}
+
+	dialer := startTestNode(t, "dialer", false, Config{})
+	dialer.srv.AddPeer(natted.srv.Self())
+	var peer *p2p.Peer
+	waitFor(t, "relayed peer", func() bool {
+		for _, p := range dialer.srv.Peers() {
+			if p.ID() == natted.srv.Self().ID() {
+				peer = p
+				return true
+			}
+		}
+		return false
+	})
+	if port := peer.RemoteAddr().(*net.TCPAddr).Port; port != int(entry.TCP) {
+		t.Errorf("peer connected through port %d, want relay port %d", port, entry.TCP)
+	}
+
+	// Disconnecting from the relay removes it from the record.
+	natted.srv.RemovePeer(relay.srv.Self())
+	waitFor(t, "relay entry removal", func() bool {
+		return natted.srv.Self().Load(&Entry{}) != nil
+	})
+}
+
+// This test checks that dialing a relayed node fails if the relay doesn't know it.
+func TestRelayedConnectionUnknownNode(t *testing.T) {
+	relay := startTestNode(t, "relay", false, Config{ListenAddr: "127.0.0.1:0"})
+	entry := &Entry{IP: net.IP{127, 0, 0, 1}, TCP: uint16(relay.relay.listener.Addr().(*net.TCPAddr).Port)}
+
+	_, err := dialRelayed(context.Background(), entry, enode.ID{1})
+	if err != errUnknownNode {
+		t.Fatalf("wrong error %v, want %v", err, errUnknownNode)
+	}
+}
+
+// This test checks that connect requests of Internet hosts are throttled.
+func TestConnectThrottle(t *testing.T) {
+	r := New(nil, Config{})
+	if !r.allowConnect(net.IP{95, 33, 21, 2}) {
+		t.Fatal("first request not allowed")
+	}
+	if r.allowConnect(net.IP{95, 33, 21, 2}) {
+		t.Fatal("second request allowed")
+	}
+	if !r.allowConnect(net.IP{95, 33, 21, 3}) {
+		t.Fatal("request of other host not allowed")
+	}
+	if !r.allowConnect(net.IP{127, 0, 0, 1}) || !r.allowConnect(net.IP{127, 0, 0, 1}) {
+		t.Fatal("LAN requests throttled")
+	}
+}
+
+// This test checks that the relay coordinates a UDP hole punch.
+func TestHolePunch(t *testing.T) {
+	relay := startTestNode(t, "relay", true, Config{ListenAddr: "127.0.0.1:0"})
+	natted := startTestNode(t, "natted", true, Config{Relays: []*enode.Node{relay.srv.Self()}})
+	requester := startTestNode(t, "requester", true, Config{})
+	waitForEntry(t, natted)
+
+	var (
+		target *enode.Node
+		err    error
+	)
+	waitFor(t, "hole punch", func() bool {
+		// The punch is refused until the natted node has registered its endpoint.
+		target, err = HolePunch(requester.srv.DiscV5, natted.srv.Self())
+		return err == nil
+	})
+	if target.ID() != natted.srv.Self().ID() {
+		t.Errorf("wrong target ID %v", target.ID())
+	}
+	if target.UDP() != natted.srv.Self().UDP() {
+		t.Errorf("wrong target UDP port %d, want %d", target.UDP(), natted.srv.Self().UDP())
+	}
+
+	if _, err := HolePunch(requester.srv.DiscV5, relay.srv.Self()); err != errNoRelay {
+		t.Errorf("wrong error for node without relay: %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+)
+
+// Penalties reported by the protocols against misbehaving peers.
+const (
+	PenaltyUseless   = 5  // Useless, stale or unrequested responses
+	PenaltyInvalid   = 25 // Invalid data, e.g. bad blocks, headers or proofs
+	PenaltyViolation = 50 // Protocol violations, e.g. malformed messages
+)
+
+const (
+	// banThreshold is the reputation score at or below which a peer is banned.
+	banThreshold = -100
+
+	// DefaultBanDuration is the time a peer is banned for by default.
+	DefaultBanDuration = time.Hour
+
+	// scoreRecoveryInterval is the time it takes for a penalized peer to regain
+	// a single point of reputation.
+	scoreRecoveryInterval = time.Minute
+)
+
+// BanInfo describes a node banned from connecting.
+type BanInfo struct {
+	ID     enode.ID  `json:"id"`
+	IP     net.IP    `json:"ip,omitempty"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// PeerScore is the reputation of a node tracked by the server.
+type PeerScore struct {
+	ID     enode.ID   `json:"id"`
+	Score  int        `json:"score"`
+	Banned *time.Time `json:"banned,omitempty"` // Expiry of the ban, if any
+}
+
+// reputation tracks the score of remote nodes in the node database, banning
+// the ones whose score falls too low for a while.
+type reputation struct {
+	db   *enode.DB
+	now  func() time.Time
+	bans map[enode.ID]*BanInfo // Active bans, mirrored from the database
+	lock sync.Mutex
+}
+
+// newReputation creates a reputation tracker, loading the bans from the node
+// database.
+func newReputation(db *enode.DB) *reputation {
+	r := &reputation{
+		db:   db,
+		now:  time.Now,
+		bans: make(map[enode.ID]*BanInfo),
+	}
+	for id, rep := range db.Reputations() {
+		if !rep.Banned.IsZero() {
+			// Expired bans are dropped on the first access
+			r.bans[id] = &BanInfo{ID: id, IP: rep.BanIP, Expiry: rep.Banned}
+		}
+	}
+	return r
+}
+
+// recover applies the score recovery since the last update to a reputation.
+func (r *reputation) recover(rep *enode.Reputation, now time.Time) {
+	if rep.Score < 0 && !rep.Updated.IsZero() {
+		rep.Score += int(now.Sub(rep.Updated) / scoreRecoveryInterval)
+		if rep.Score > 0 {
+			rep.Score = 0
+		}
+	}
+	rep.Updated = now
+}
+
+// penalize lowers the score of a node, returning the resulting score.
+func (r *reputation) penalize(id enode.ID, penalty int) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.now()
+	rep := r.db.Reputation(id)
+	r.recover(&rep, now)
+	rep.Score -= penalty
+	if err := r.db.UpdateReputation(id, rep); err != nil {
+		return 0, err
+	}
+	return rep.Score, nil
+}
+
+// ban bans a node (and the IP it was seen at, if known) until the given time,
+// resetting its score. The ban is enforced even if it can't be persisted.
+func (r *reputation) ban(id enode.ID, ip net.IP, expiry time.Time) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	rep := r.db.Reputation(id)
+	rep.Score, rep.Updated, rep.BanIP, rep.Banned = 0, r.now(), ip, expiry
+	r.bans[id] = &BanInfo{ID: id, IP: ip, Expiry: expiry}
+	return r.db.UpdateReputation(id, rep)
+}
+
+// unban lifts the ban of a node, reporting whether it was banned.
+func (r *reputation) unban(id enode.ID) (bool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.bans[id]; !ok {
+		return false, nil
+	}
+	delete(r.bans, id)
+
+	rep := r.db.Reputation(id)
+	rep.BanIP, rep.Banned = nil, time.Time{}
+	if err := r.db.UpdateReputation(id, rep); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// expire drops the bans that have run out. The caller must hold the lock.
+func (r *reputation) expire(now time.Time) {
+	for id, ban := range r.bans {
+		if !ban.Expiry.After(now) {
+			delete(r.bans, id)
+		}
+	}
+}
+
+// banned reports whether the node with the given ID is banned.
+func (r *reputation) banned(id enode.ID) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.expire(r.now())
+	_, ok := r.bans[id]
+	return ok
+}
+
+// bannedIP reports whether any node banned was last seen at the given IP.
+func (r *reputation) bannedIP(ip net.IP) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.expire(r.now())
+	for _, ban := range r.bans {
+		if ban.IP != nil && ban.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns all the active bans, ordered by expiry.
+func (r *reputation) list() []*BanInfo {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.expire(r.now())
+	bans := make([]*BanInfo, 0, len(r.bans))
+	for _, ban := range r.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Expiry.Before(bans[j].Expiry)
+	})
+	return bans
+}
+
+// scores returns the current reputation of all the tracked nodes, ordered from
+// the lowest score.
+func (r *reputation) scores() []*PeerScore {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var (
+		now    = r.now()
+		scores []*PeerScore
+	)
+	for id, rep := range r.db.Reputations() {
+		r.recover(&rep, now)
+		score := &PeerScore{ID: id, Score: rep.Score}
+		if rep.Banned.After(now) {
+			banned := rep.Banned
+			score.Banned = &banned
+		}
+		scores = append(scores, score)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score < scores[j].Score
+		}
+		return scores[i].ID.String() < scores[j].ID.String()
+	})
+	return scores
+}
+
+// Penalize reports a misbehaviour of the remote peer, lowering its reputation.
+// Peers whose score falls too low are disconnected and banned for a while,
+// unless they are trusted or static peers.
+func (p *Peer) Penalize(penalty int, reason string) {
+	if p.reputation == nil {
+		return // Peer not managed by a server, e.g. in tests
+	}
+	score, err := p.reputation.penalize(p.ID(), penalty)
+	if err != nil {
+		p.log.Warn("Failed to store peer reputation", "err", err)
+		return
+	}
+	p.log.Debug("Penalized peer", "penalty", penalty, "score", score, "reason", reason)
+
+	if score <= banThreshold && !p.rw.is(trustedConn|staticDialedConn) {
+		p.log.Info("Banning misbehaving peer", "duration", DefaultBanDuration, "reason", reason)
+		if err := p.reputation.ban(p.ID(), p.Node().IP(), p.reputation.now().Add(DefaultBanDuration)); err != nil {
+			p.log.Warn("Failed to store peer ban", "err", err)
+		}
+		p.Disconnect(DiscUselessPeer)
+	}
+}
+
+// BanPeer bans the given node from connecting for the given duration, disconnecting
+// it if it's currently connected. The IP the node is known at is only rejected
+// too if Config.BanIPs is set.
+func (srv *Server) BanPeer(node *enode.Node, duration time.Duration) error {
+	if srv.reputation == nil {
+		return errServerStopped
+	}
+	var (
+		expiry = srv.reputation.now().Add(duration)
+		err    error
+	)
+	srv.doPeerOp(func(peers map[enode.ID]*Peer) {
+		peer := peers[node.ID()]
+		if peer == nil {
+			err = srv.reputation.ban(node.ID(), node.IP(), expiry)
+			return
+		}
+		err = srv.reputation.ban(node.ID(), peer.Node().IP(), expiry)
+		peer.Disconnect(DiscUselessPeer)
+	})
+	return err
+}
+
+// UnbanPeer lifts the ban of the given node, reporting whether it was banned.
+func (srv *Server) UnbanPeer(id enode.ID) (bool, error) {
+	if srv.reputation == nil {
+		return false, errServerStopped
+	}
+	return srv.reputation.unban(id)
+}
+
+// Bans returns the nodes currently banned from connecting.
+func (srv *Server) Bans() ([]*BanInfo, error) {
+	if srv.reputation == nil {
+		return nil, errServerStopped
+	}
+	return srv.reputation.list(), nil
+}
+
+// PeerScores returns the reputation of all the nodes tracked by the server.
+func (srv *Server) PeerScores() ([]*PeerScore, error) {
+	if srv.reputation == nil {
+		return nil, errServerStopped
+	}
+	return srv.reputation.scores(), nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rethereum-blockchain/go-rethereum/p2p/enode"
+)
+
+func TestReputationScore(t *testing.T) {
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+
+	var (
+		now = time.Unix(1000000, 0)
+		rep = newReputation(db)
+		id  = enode.ID{1}
+	)
+	rep.now = func() time.Time { return now }
+
+	if score, _ := rep.penalize(id, PenaltyViolation); score != -PenaltyViolation {
+		t.Fatalf("wrong score after penalty: have %d, want %d", score, -PenaltyViolation)
+	}
+	// Time passing should recover some of the reputation, but never above zero
+	now = now.Add(10 * scoreRecoveryInterval)
+	if score, _ := rep.penalize(id, PenaltyUseless); score != -PenaltyViolation+10-PenaltyUseless {
+		t.Fatalf("wrong score after recovery: have %d, want %d", score, -PenaltyViolation+10-PenaltyUseless)
+	}
+	now = now.Add(time.Hour)
+	scores := rep.scores()
+	if len(scores) != 1 || scores[0].ID != id || scores[0].Score != 0 || scores[0].Banned != nil {
+		t.Fatalf("wrong scores after full recovery: %+v", scores)
+	}
+}
+
+func TestReputationBans(t *testing.T) {
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+
+	var (
+		now = time.Unix(1000000, 0)
+		rep = newReputation(db)
+		id1 = enode.ID{1}
+		id2 = enode.ID{2}
+		ip  = net.IP{10, 0, 0, 1}
+	)
+	rep.now = func() time.Time { return now }
+
+	rep.penalize(id1, PenaltyInvalid)
+	rep.ban(id1, ip, now.Add(time.Minute))
+	rep.ban(id2, nil, now.Add(time.Hour))
+
+	if !rep.banned(id1) || !rep.banned(id2) || rep.banned(enode.ID{3}) {
+		t.Fatal("wrong ban status")
+	}
+	if !rep.bannedIP(ip) || rep.bannedIP(net.IP{10, 0, 0, 2}) {
+		t.Fatal("wrong IP ban status")
+	}
+	if bans := rep.list(); len(bans) != 2 || bans[0].ID != id1 || bans[1].ID != id2 {
+		t.Fatalf("wrong ban list: %+v", bans)
+	}
+	if score := db.Reputation(id1).Score; score != 0 {
+		t.Fatalf("score not reset by ban: %d", score)
+	}
+	// Bans should survive a restart
+	rep = newReputation(db)
+	rep.now = func() time.Time { return now }
+	if !rep.banned(id1) || !rep.banned(id2) {
+		t.Fatal("bans not loaded from database")
+	}
+	// Bans should expire
+	now = now.Add(2 * time.Minute)
+	if rep.banned(id1) || rep.bannedIP(ip) {
+		t.Fatal("ban not expired")
+	}
+	// Bans should be liftable
+	if ok, err := rep.unban(id2); !ok || err != nil {
+		t.Fatalf("failed to lift active ban: %v", err)
+	}
+	if ok, _ := rep.unban(id2); ok {
+		t.Fatal("lifted inactive ban")
+	}
+	if bans := rep.list(); len(bans) != 0 {
+		t.Fatalf("bans left over: %+v", bans)
+	}
+	if rep = newReputation(db); len(rep.list()) != 0 {
+		t.Fatal("lifted ban loaded from database")
+	}
+}
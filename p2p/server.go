@@ -64,7 +64,10 @@ const (
 	frameWriteTimeout = 20 * time.Second
 )
 
-var errServerStopped = errors.New("server stopped")
+var (
+	errServerStopped  = errors.New("server stopped")
+	errTooManyPending = errors.New("too many pending connections")
+)
 
 // Config holds Server options.
 type Config struct {
@@ -93,6 +96,10 @@ type Config struct {
 	// protocol should be started or not.
 	DiscoveryV5 bool `toml:",omitempty"`
 
+	// DiscoveryTopics are advertised via V5 discovery in addition to the topics
+	// of the running protocols, allowing operators to announce external services.
+	DiscoveryTopics []string `toml:",omitempty"`
+
 	// Name sets the node name of this server.
 	Name string `toml:"-"`
 
@@ -113,11 +120,20 @@ type Config struct {
 	// allowed to connect, even above the peer limit.
 	TrustedNodes []*enode.Node
 
+	// PeerGroups are named sets of nodes with connection slots reserved for
+	// them. Members can be added and removed at runtime via AddPeerToGroup.
+	PeerGroups []PeerGroup `toml:",omitempty"`
+
 	// Connectivity can be restricted to certain IP networks.
 	// If this option is set to a non-nil value, only hosts which match one of the
 	// IP networks contained in the list are considered.
 	NetRestrict *netutil.Netlist `toml:",omitempty"`
 
+	// BanIPs makes the server reject inbound connections from the IP addresses
+	// banned nodes were last seen at, in addition to the banned node IDs. It's
+	// off by default, since it also blocks every other node sharing the address.
+	BanIPs bool `toml:",omitempty"`
+
 	// NodeDatabase is the path to the database containing the previously seen
 	// live nodes in the network.
 	NodeDatabase string `toml:",omitempty"`
@@ -181,12 +197,14 @@ type Server struct {
 	peerFeed     event.Feed
 	log          log.Logger
 
-	nodedb    *enode.DB
-	localnode *enode.LocalNode
-	ntab      *discover.UDPv4
-	DiscV5    *discover.UDPv5
-	discmix   *enode.FairMix
-	dialsched *dialScheduler
+	nodedb     *enode.DB
+	localnode  *enode.LocalNode
+	reputation *reputation
+	groups     *peerGroups // owned by the run loop
+	ntab       *discover.UDPv4
+	DiscV5     *discover.UDPv5
+	discmix    *enode.FairMix
+	dialsched  *dialScheduler
 
 	// Channels into the run loop.
 	quit                    chan struct{}
@@ -198,7 +216,9 @@ type Server struct {
 	checkpointPostHandshake chan *conn
 	checkpointAddPeer       chan *conn
 
-	// State of run loop and listenLoop.
+	// State of listenLoop, shared with relayed inbound connections.
+	inboundSlots   chan struct{} // limits pending inbound connections
+	inboundLock    sync.Mutex
 	inboundHistory expHeap
 }
 
@@ -464,6 +484,17 @@ func (srv *Server) Start() (err error) {
 	if srv.listenFunc == nil {
 		srv.listenFunc = net.Listen
 	}
+	members, err := newGroupMembership(srv.PeerGroups)
+	if err != nil {
+		return err
+	}
+	if members.inbound+members.outbound > srv.MaxPeers {
+		return fmt.Errorf("peer groups reserve %d slots, more than MaxPeers (%d)", members.inbound+members.outbound, srv.MaxPeers)
+	}
+	if members.outbound > srv.maxDialedConns() {
+		return fmt.Errorf("peer groups reserve %d outbound slots, more than the %d dialed peers allowed", members.outbound, srv.maxDialedConns())
+	}
+	srv.groups = newPeerGroups(members)
 	srv.quit = make(chan struct{})
 	srv.delpeer = make(chan peerDrop)
 	srv.checkpointPostHandshake = make(chan *conn)
@@ -473,9 +504,20 @@ func (srv *Server) Start() (err error) {
 	srv.peerOp = make(chan peerOpFunc)
 	srv.peerOpDone = make(chan struct{})
 
+	// The slots channel limits pending inbound connections.
+	tokens := defaultMaxPendingPeers
+	if srv.MaxPendingPeers > 0 {
+		tokens = srv.MaxPendingPeers
+	}
+	srv.inboundSlots = make(chan struct{}, tokens)
+	for i := 0; i < tokens; i++ {
+		srv.inboundSlots <- struct{}{}
+	}
+
 	if err := srv.setupLocalNode(); err != nil {
 		return err
 	}
+	srv.reputation = newReputation(srv.nodedb)
 	if srv.ListenAddr != "" {
 		if err := srv.setupListening(); err != nil {
 			return err
@@ -621,10 +663,37 @@ func (srv *Server) setupDiscovery() error {
 		if err != nil {
 			return err
 		}
+		for _, topic := range srv.discoveryTopics() {
+			srv.DiscV5.RegisterTopic(topic)
+		}
 	}
 	return nil
 }
 
+// discoveryTopics returns the topics the node is advertised under, gathered from
+// the running protocols and the configuration.
+func (srv *Server) discoveryTopics() []string {
+	var (
+		topics []string
+		seen   = make(map[string]bool)
+	)
+	add := func(topic string) {
+		if topic != "" && !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	for _, p := range srv.Protocols {
+		for _, topic := range p.Topics {
+			add(topic)
+		}
+	}
+	for _, topic := range srv.DiscoveryTopics {
+		add(topic)
+	}
+	return topics
+}
+
 func (srv *Server) setupDialScheduler() {
 	config := dialConfig{
 		self:           srv.localnode.ID(),
@@ -632,6 +701,8 @@ func (srv *Server) setupDialScheduler() {
 		maxActiveDials: srv.MaxPendingPeers,
 		log:            srv.Logger,
 		netRestrict:    srv.NetRestrict,
+		banned:         srv.reputation.banned,
+		members:        srv.groups.groupMembership,
 		dialer:         srv.Dialer,
 		clock:          srv.clock,
 	}
@@ -770,6 +841,7 @@ running:
 				peers[c.node.ID()] = p
 				srv.log.Debug("Adding p2p peer", "peercount", len(peers), "id", p.ID(), "conn", c.flags, "addr", p.RemoteAddr(), "name", p.Name())
 				srv.dialsched.peerAdded(c)
+				srv.groups.peerAdded(c)
 				if p.Inbound() {
 					inboundCount++
 				}
@@ -782,6 +854,7 @@ running:
 			delete(peers, pd.ID())
 			srv.log.Debug("Removing p2p peer", "peercount", len(peers), "id", pd.ID(), "duration", d, "req", pd.requested, "err", pd.err)
 			srv.dialsched.peerRemoved(pd.rw)
+			srv.groups.peerRemoved(pd.rw)
 			if pd.Inbound() {
 				inboundCount--
 			}
@@ -812,15 +885,25 @@ running:
 }
 
 func (srv *Server) postHandshakeChecks(peers map[enode.ID]*Peer, inboundCount int, c *conn) error {
+	// Slots reserved for peer groups are not available to other peers, members
+	// in reserved slots are thus not counted against the remaining ones.
+	var (
+		limited         = !c.is(trustedConn) && !srv.groups.hasReservedSlot(c)
+		usedIn, usedOut = srv.groups.reserved()
+	)
 	switch {
-	case !c.is(trustedConn) && len(peers) >= srv.MaxPeers:
+	case !c.is(trustedConn) && srv.groups.full(c):
+		return DiscTooManyPeers
+	case limited && len(peers)-usedIn-usedOut >= srv.MaxPeers-srv.groups.inbound-srv.groups.outbound:
 		return DiscTooManyPeers
-	case !c.is(trustedConn) && c.is(inboundConn) && inboundCount >= srv.maxInboundConns():
+	case limited && c.is(inboundConn) && inboundCount-usedIn >= srv.maxInboundConns()-srv.groups.inbound:
 		return DiscTooManyPeers
 	case peers[c.node.ID()] != nil:
 		return DiscAlreadyConnected
 	case c.node.ID() == srv.localnode.ID():
 		return DiscSelf
+	case !c.is(trustedConn|staticDialedConn) && srv.reputation != nil && srv.reputation.banned(c.node.ID()):
+		return DiscUselessPeer
 	default:
 		return nil
 	}
@@ -842,14 +925,7 @@ func (srv *Server) listenLoop() {
 	srv.log.Debug("TCP listener up", "addr", srv.listener.Addr())
 
 	// The slots channel limits accepts of new connections.
-	tokens := defaultMaxPendingPeers
-	if srv.MaxPendingPeers > 0 {
-		tokens = srv.MaxPendingPeers
-	}
-	slots := make(chan struct{}, tokens)
-	for i := 0; i < tokens; i++ {
-		slots <- struct{}{}
-	}
+	slots := srv.inboundSlots
 
 	// Wait for slots to be returned on exit. This ensures all connection goroutines
 	// are down before listenLoop returns.
@@ -912,7 +988,13 @@ func (srv *Server) checkInboundConn(remoteIP net.IP) error {
 	if srv.NetRestrict != nil && !srv.NetRestrict.Contains(remoteIP) {
 		return fmt.Errorf("not in netrestrict list")
 	}
+	// Reject connections from the addresses of banned nodes, if requested.
+	if srv.BanIPs && srv.reputation != nil && srv.reputation.bannedIP(remoteIP) {
+		return fmt.Errorf("banned")
+	}
 	// Reject Internet peers that try too often.
+	srv.inboundLock.Lock()
+	defer srv.inboundLock.Unlock()
 	now := srv.clock.Now()
 	srv.inboundHistory.expire(now, nil)
 	if !netutil.IsLAN(remoteIP) && srv.inboundHistory.contains(remoteIP.String()) {
@@ -940,6 +1022,33 @@ func (srv *Server) SetupConn(fd net.Conn, flags connFlag, dialDest *enode.Node)
 	return err
 }
 
+// SetupInboundConn runs the handshakes on an inbound connection which wasn't
+// accepted by the listener, such as one forwarded by a relay, and attempts to
+// add it as a peer. The connection is subject to the same admission checks as
+// accepted ones and shares their pending slots. remoteIP is the address of the
+// remote end if it differs from the one of fd.
+func (srv *Server) SetupInboundConn(fd net.Conn, remoteIP net.IP) error {
+	select {
+	case <-srv.inboundSlots:
+		defer func() { srv.inboundSlots <- struct{}{} }()
+	default:
+		fd.Close()
+		return errTooManyPending
+	}
+	if remoteIP == nil {
+		remoteIP = netutil.AddrIP(fd.RemoteAddr())
+	}
+	if err := srv.checkInboundConn(remoteIP); err != nil {
+		srv.log.Debug("Rejected inbound connection", "addr", fd.RemoteAddr(), "ip", remoteIP, "err", err)
+		fd.Close()
+		return err
+	}
+	if remoteIP != nil {
+		fd = newMeteredConn(fd, true)
+	}
+	return srv.SetupConn(fd, inboundConn, nil)
+}
+
 func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *enode.Node) error {
 	// Prevent leftover pending conns from entering the handshake.
 	srv.lock.Lock()
@@ -1020,6 +1129,7 @@ func (srv *Server) checkpoint(c *conn, stage chan<- *conn) error {
 
 func (srv *Server) launchPeer(c *conn) *Peer {
 	p := newPeer(srv.log, c, srv.Protocols)
+	p.reputation = srv.reputation
 	if srv.EnableMsgEvents {
 		// If message events are enabled, pass the peerFeed
 		// to the peer.
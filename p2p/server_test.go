@@ -300,6 +300,93 @@ func TestServerAtCap(t *testing.T) {
 	}
 }
 
+func TestServerPeerGroups(t *testing.T) {
+	var (
+		remoteKey = newkey()
+		members   = []enode.ID{randomID(), randomID(), randomID(), randomID()}
+	)
+	srv := &Server{
+		Config: Config{
+			PrivateKey:  newkey(),
+			MaxPeers:    10,
+			NoDial:      true,
+			NoDiscovery: true,
+			PeerGroups: []PeerGroup{{
+				Name:     "miners",
+				Nodes:    []*enode.Node{newNode(members[0], ""), newNode(members[1], ""), newNode(members[2], "")},
+				Inbound:  2,
+				MaxPeers: 3,
+			}},
+			Logger: testlog.Logger(t, log.LvlTrace),
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	addconn := func(id enode.ID) error {
+		fd, _ := net.Pipe()
+		tx := newTestTransport(&remoteKey.PublicKey, fd, nil)
+		node := enode.SignNull(new(enr.Record), id)
+		c := &conn{fd: fd, transport: tx, flags: inboundConn, node: node, cont: make(chan error)}
+		return srv.checkpoint(c, srv.checkpointAddPeer)
+	}
+
+	// Two members connect through the reserved slots, the third takes a regular one.
+	for i, id := range members[:3] {
+		if err := addconn(id); err != nil {
+			t.Fatalf("could not add member %d: %v", i, err)
+		}
+	}
+	// The fourth member exceeds the limit of the group.
+	if err := srv.AddPeerToGroup("miners", newNode(members[3], "")); err != nil {
+		t.Fatal("could not add group member:", err)
+	}
+	if err := addconn(members[3]); err != DiscTooManyPeers {
+		t.Fatal("wrong error for member above group limit:", err)
+	}
+	// Only seven regular slots remain for other peers.
+	for i := 0; i < 7; i++ {
+		if err := addconn(randomID()); err != nil {
+			t.Fatalf("could not add conn %d: %v", i, err)
+		}
+	}
+	if err := addconn(randomID()); err != DiscTooManyPeers {
+		t.Fatal("wrong error for conn above peer limit:", err)
+	}
+
+	infos := srv.PeerGroupsInfo()
+	if len(infos) != 1 || len(infos[0].Nodes) != 4 || infos[0].Peers.Inbound != 3 {
+		t.Fatalf("wrong peer group info: %+v", infos)
+	}
+	if err := srv.AddPeerToGroup("unknown", newNode(randomID(), "")); err != errUnknownPeerGroup {
+		t.Fatal("wrong error for unknown group:", err)
+	}
+}
+
+func TestServerPeerGroupsTooLarge(t *testing.T) {
+	tests := []PeerGroup{
+		{Name: "inbound", Inbound: 8, Outbound: 3}, // above MaxPeers
+		{Name: "outbound", Outbound: 4},            // above the dialed peers
+	}
+	for _, group := range tests {
+		srv := &Server{
+			Config: Config{
+				PrivateKey:  newkey(),
+				MaxPeers:    10,
+				NoDiscovery: true,
+				PeerGroups:  []PeerGroup{group},
+				Logger:      testlog.Logger(t, log.LvlTrace),
+			},
+		}
+		if err := srv.Start(); err == nil {
+			srv.Stop()
+			t.Errorf("group %q: server started with too many reserved slots", group.Name)
+		}
+	}
+}
+
 func TestServerPeerLimits(t *testing.T) {
 	srvkey := newkey()
 	clientkey := newkey()
@@ -571,6 +658,56 @@ func TestServerInboundThrottle(t *testing.T) {
 	}
 }
 
+// This test checks that connections set up by SetupInboundConn go through the
+// admission checks of the listener.
+func TestServerSetupInboundConnAdmission(t *testing.T) {
+	newTransportCalled := make(chan struct{}, 1)
+	srv := &Server{
+		Config: Config{
+			PrivateKey:      newkey(),
+			MaxPeers:        10,
+			MaxPendingPeers: 1,
+			NoDial:          true,
+			NoDiscovery:     true,
+			Logger:          testlog.Logger(t, log.LvlTrace),
+		},
+		newTransport: func(fd net.Conn, dialDest *ecdsa.PublicKey) transport {
+			newTransportCalled <- struct{}{}
+			return newRLPX(fd, dialDest)
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal("can't start: ", err)
+	}
+	defer srv.Stop()
+
+	// The second connection of an Internet host is throttled.
+	ip := net.IP{95, 33, 21, 2}
+	for i, want := range []bool{true, false} {
+		fd, _ := net.Pipe()
+		fd.SetDeadline(time.Now().Add(10 * time.Millisecond))
+		srv.SetupInboundConn(fd, ip)
+		select {
+		case <-newTransportCalled:
+			if !want {
+				t.Errorf("connection %d: not throttled", i)
+			}
+		default:
+			if want {
+				t.Errorf("connection %d: throttled", i)
+			}
+		}
+	}
+
+	// Connections are rejected while all pending slots are taken.
+	<-srv.inboundSlots
+	fd, _ := net.Pipe()
+	if err := srv.SetupInboundConn(fd, net.IP{95, 33, 21, 3}); err != errTooManyPending {
+		t.Errorf("wrong error %v, want %v", err, errTooManyPending)
+	}
+	srv.inboundSlots <- struct{}{}
+}
+
 func listenFakeAddr(network, laddr string, remoteAddr net.Addr) (net.Listener, error) {
 	l, err := net.Listen(network, laddr)
 	if err == nil {
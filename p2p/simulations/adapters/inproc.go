@@ -38,6 +38,7 @@ import (
 // connects them using net.Pipe
 type SimAdapter struct {
 	pipe       func() (net.Conn, net.Conn, error)
+	links      LinkFunc
 	mtx        sync.RWMutex
 	nodes      map[enode.ID]*SimNode
 	lifecycles LifecycleConstructors
@@ -55,6 +56,18 @@ func NewSimAdapter(services LifecycleConstructors) *SimAdapter {
 	}
 }
 
+// LinkFunc creates the connection between a dialing node and the node it dials.
+// The first returned end belongs to the dialed node, the second to the dialer.
+type LinkFunc func(dialer, dest enode.ID) (net.Conn, net.Conn, error)
+
+// NewSimAdapterWithLinks creates a SimAdapter which connects the nodes using the
+// given link function, allowing to simulate per-link network conditions.
+func NewSimAdapterWithLinks(services LifecycleConstructors, links LinkFunc) *SimAdapter {
+	adapter := NewSimAdapter(services)
+	adapter.links = links
+	return adapter
+}
+
 // Name returns the name of the adapter for logging purposes
 func (s *SimAdapter) Name() string {
 	return "sim-adapter"
@@ -96,7 +109,7 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 			PrivateKey:      config.PrivateKey,
 			MaxPeers:        math.MaxInt32,
 			NoDiscovery:     true,
-			Dialer:          s,
+			Dialer:          &simDialer{adapter: s, id: id},
 			EnableMsgEvents: config.EnableMsgEvents,
 		},
 		ExternalSigner: config.ExternalSigner,
@@ -120,6 +133,12 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 // Dial implements the p2p.NodeDialer interface by connecting to the node using
 // an in-memory net.Pipe
 func (s *SimAdapter) Dial(ctx context.Context, dest *enode.Node) (conn net.Conn, err error) {
+	return s.dial(enode.ID{}, dest)
+}
+
+// dial connects the dialer to the destination node. The dialer is only used to
+// select the link, it may be empty.
+func (s *SimAdapter) dial(dialer enode.ID, dest *enode.Node) (net.Conn, error) {
 	node, ok := s.GetNode(dest.ID())
 	if !ok {
 		return nil, fmt.Errorf("unknown node: %s", dest.ID())
@@ -129,7 +148,11 @@ func (s *SimAdapter) Dial(ctx context.Context, dest *enode.Node) (conn net.Conn,
 		return nil, fmt.Errorf("node not running: %s", dest.ID())
 	}
 	// SimAdapter.pipe is net.Pipe (NewSimAdapter)
-	pipe1, pipe2, err := s.pipe()
+	pipe := s.pipe
+	if s.links != nil {
+		pipe = func() (net.Conn, net.Conn, error) { return s.links(dialer, dest.ID()) }
+	}
+	pipe1, pipe2, err := pipe()
 	if err != nil {
 		return nil, err
 	}
@@ -140,6 +163,17 @@ func (s *SimAdapter) Dial(ctx context.Context, dest *enode.Node) (conn net.Conn,
 	return pipe2, nil
 }
 
+// simDialer dials nodes on behalf of a simulation node.
+type simDialer struct {
+	adapter *SimAdapter
+	id      enode.ID
+}
+
+// Dial implements the p2p.NodeDialer interface.
+func (d *simDialer) Dial(ctx context.Context, dest *enode.Node) (net.Conn, error) {
+	return d.adapter.dial(d.id, dest)
+}
+
 // DialRPC implements the RPCDialer interface by creating an in-memory RPC
 // client of the given node
 func (s *SimAdapter) DialRPC(id enode.ID) (*rpc.Client, error) {
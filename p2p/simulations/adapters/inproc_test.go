@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/rethereum-blockchain/go-rethereum/p2p/simulations/pipes"
 )
@@ -200,3 +201,44 @@ func TestNetPipeBidirections(t *testing.T) {
 		}
 	}
 }
+
+func TestLinkPipe(t *testing.T) {
+	link := pipes.Link{Latency: 20 * time.Millisecond, Loss: 0.5, Retransmit: 30 * time.Millisecond}
+	c1, c2, err := pipes.LinkPipe(link, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	msgs := 50
+	size := 8
+	start := time.Now()
+
+	// Writes are buffered by the link, so they don't block.
+	for i := 0; i < msgs; i++ {
+		msg := make([]byte, size)
+		binary.PutUvarint(msg, uint64(i))
+		if _, err := c1.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < msgs; i++ {
+		msg := make([]byte, size)
+		binary.PutUvarint(msg, uint64(i))
+		out := make([]byte, size)
+		if _, err := c2.Read(out); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 && time.Since(start) < link.Latency {
+			t.Fatalf("message delivered before link latency: %v", time.Since(start))
+		}
+		if !bytes.Equal(msg, out) {
+			t.Fatalf("expected %#v, got %#v", msg, out)
+		}
+	}
+	// With half of the writes lost, some must have been retransmitted.
+	if elapsed := time.Since(start); elapsed < link.Latency+link.Retransmit {
+		t.Fatalf("no retransmission delay observed: %v", elapsed)
+	}
+}
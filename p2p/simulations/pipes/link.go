@@ -0,0 +1,145 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pipes
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// defaultRetransmit is the delay added to lost writes if the link doesn't
+// specify one. It mirrors the minimum TCP retransmission timeout.
+const defaultRetransmit = 200 * time.Millisecond
+
+// Link describes the quality of a simulated network link.
+//
+// The connections carry a reliable stream, so lost packets are not dropped but
+// delivered late, as if they had been retransmitted. Writes are never reordered.
+type Link struct {
+	Latency    time.Duration // one-way delay applied to every write
+	Loss       float64       // probability of a write being lost, between 0 and 1
+	Retransmit time.Duration // additional delay of lost writes (default 200ms)
+}
+
+// LinkPipe creates an in-process full duplex pipe with the given link quality
+// applied in both directions. The seed makes the packet loss reproducible.
+func LinkPipe(link Link, seed int64) (net.Conn, net.Conn, error) {
+	p1, p2 := net.Pipe()
+	return NewLinkConn(p1, link, seed), NewLinkConn(p2, link, seed+1), nil
+}
+
+// NewLinkConn wraps a connection, delaying and losing the data written to it
+// according to the link quality.
+func NewLinkConn(conn net.Conn, link Link, seed int64) net.Conn {
+	if link.Retransmit == 0 {
+		link.Retransmit = defaultRetransmit
+	}
+	c := &linkConn{
+		Conn:   conn,
+		link:   link,
+		rand:   rand.New(rand.NewSource(seed)),
+		queue:  make(chan delayedWrite, 1024),
+		closed: make(chan struct{}),
+	}
+	go c.loop()
+	return c
+}
+
+// delayedWrite is a chunk of data waiting to be delivered.
+type delayedWrite struct {
+	data []byte
+	due  time.Time
+}
+
+// linkConn is a connection delivering its writes late.
+type linkConn struct {
+	net.Conn
+	link Link
+
+	lock sync.Mutex
+	rand *rand.Rand
+	last time.Time // delivery time of the last queued write
+
+	queue     chan delayedWrite
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Write queues the data for delivery once the link delay has passed.
+func (c *linkConn) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	due := time.Now().Add(c.link.Latency)
+	if c.link.Loss > 0 && c.rand.Float64() < c.link.Loss {
+		due = due.Add(c.link.Retransmit)
+	}
+	// A stream can't overtake itself, later writes wait for earlier ones.
+	if due.Before(c.last) {
+		due = c.last
+	}
+	c.last = due
+
+	data := make([]byte, len(b))
+	copy(data, b)
+	select {
+	case c.queue <- delayedWrite{data: data, due: due}:
+		return len(b), nil
+	case <-c.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+// Close closes the connection, discarding any undelivered writes.
+func (c *linkConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// loop delivers the queued writes when they are due.
+func (c *linkConn) loop() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	for {
+		var w delayedWrite
+		select {
+		case w = <-c.queue:
+		case <-c.closed:
+			return
+		}
+		if wait := time.Until(w.due); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-c.closed:
+				return
+			}
+		}
+		if _, err := c.Conn.Write(w.data); err != nil {
+			c.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Traffic is the amount of data exchanged with a peer, measured in messages and
+// raw (uncompressed) payload bytes.
+type Traffic struct {
+	IngressPackets uint64 `json:"ingressPackets"`
+	IngressBytes   uint64 `json:"ingressBytes"`
+	EgressPackets  uint64 `json:"egressPackets"`
+	EgressBytes    uint64 `json:"egressBytes"`
+}
+
+// add accounts a single message of the given size.
+func (t *Traffic) add(size uint32, ingress bool) {
+	if ingress {
+		t.IngressPackets++
+		t.IngressBytes += uint64(size)
+	} else {
+		t.EgressPackets++
+		t.EgressBytes += uint64(size)
+	}
+}
+
+// ProtocolTraffic is the amount of data exchanged with a peer over a single
+// sub-protocol, in total and broken down by message code.
+type ProtocolTraffic struct {
+	Traffic
+	Messages map[string]*Traffic `json:"messages"` // Keyed by hex message code
+}
+
+// protoTraffic is the traffic of a single sub-protocol, keyed by the raw
+// message codes. Keys are only formatted when a snapshot is taken, keeping the
+// accounting of every message cheap.
+type protoTraffic struct {
+	Traffic
+	messages map[uint64]*Traffic
+}
+
+// peerTraffic accounts the messages exchanged with a peer over all of its
+// running sub-protocols.
+type peerTraffic struct {
+	protos map[Cap]*protoTraffic
+	lock   sync.Mutex
+}
+
+func newPeerTraffic() *peerTraffic {
+	return &peerTraffic{protos: make(map[Cap]*protoTraffic)}
+}
+
+// record accounts a message sent or received over a sub-protocol. The code is
+// relative to the protocol's own message space.
+func (t *peerTraffic) record(cap Cap, code uint64, size uint32, ingress bool) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	proto := t.protos[cap]
+	if proto == nil {
+		proto = &protoTraffic{messages: make(map[uint64]*Traffic)}
+		t.protos[cap] = proto
+	}
+	proto.add(size, ingress)
+
+	msg := proto.messages[code]
+	if msg == nil {
+		msg = new(Traffic)
+		proto.messages[code] = msg
+	}
+	msg.add(size, ingress)
+}
+
+// snapshot returns a deep copy of the traffic accounted so far, keyed by
+// protocol name and version, then by hex message code.
+func (t *peerTraffic) snapshot() map[string]*ProtocolTraffic {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	protos := make(map[string]*ProtocolTraffic, len(t.protos))
+	for cap, proto := range t.protos {
+		cpy := &ProtocolTraffic{Traffic: proto.Traffic, Messages: make(map[string]*Traffic, len(proto.messages))}
+		for code, msg := range proto.messages {
+			traffic := *msg
+			cpy.Messages[fmt.Sprintf("%#02x", code)] = &traffic
+		}
+		protos[cap.String()] = cpy
+	}
+	return protos
+}
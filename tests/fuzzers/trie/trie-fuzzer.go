@@ -22,6 +22,7 @@ import (
 	"fmt"
 
 	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
 	"github.com/rethereum-blockchain/go-rethereum/trie"
 )
 
@@ -163,7 +164,7 @@ func runRandTest(rt randTest) error {
 		case opCommit:
 			hash, nodes := tr.Commit(false)
 			if nodes != nil {
-				if err := triedb.Update(trie.NewWithNodeSet(nodes)); err != nil {
+				if err := triedb.Update(hash, types.EmptyRootHash, trie.NewWithNodeSet(nodes)); err != nil {
 					return err
 				}
 			}
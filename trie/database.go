@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/fastcache"
@@ -91,6 +92,9 @@ type Database struct {
 	dirtiesSize  common.StorageSize // Storage size of the dirty node cache (exc. metadata)
 	childrenSize common.StorageSize // Storage size of the external children tracking
 	preimages    *preimageStore     // The store for caching preimages
+	pathdb       *pathDB            // Path-based node store, nil in the hash-based scheme
+
+	writeHook atomic.Pointer[func(common.Hash)] // Callback notified of every node flushed to disk
 
 	lock sync.RWMutex
 }
@@ -125,6 +129,8 @@ type Config struct {
 	Cache     int    // Memory allowance (MB) to use for caching trie nodes in memory
 	Journal   string // Journal of clean cache to survive node restarts
 	Preimages bool   // Flag whether the preimage of trie key is recorded
+
+	PathDB *PathConfig // Settings of the path-based scheme, nil selects the hash-based one
 }
 
 // NewDatabase creates a new trie database to store ephemeral trie content before
@@ -140,7 +146,7 @@ func NewDatabase(diskdb ethdb.Database) *Database {
 func NewDatabaseWithConfig(diskdb ethdb.Database, config *Config) *Database {
 	var cleans *fastcache.Cache
 	if config != nil && config.Cache > 0 {
-		if config.Journal == "" {
+		if config.Journal == "" || config.PathDB != nil {
 			cleans = fastcache.New(config.Cache * 1024 * 1024)
 		} else {
 			cleans = fastcache.LoadFromFileOrNew(config.Journal, config.Cache*1024*1024)
@@ -150,6 +156,13 @@ func NewDatabaseWithConfig(diskdb ethdb.Database, config *Config) *Database {
 	if config != nil && config.Preimages {
 		preimage = newPreimageStore(diskdb)
 	}
+	if config != nil && config.PathDB != nil {
+		return &Database{
+			diskdb:    diskdb,
+			preimages: preimage,
+			pathdb:    newPathDB(diskdb, config.PathDB, cleans),
+		}
+	}
 	return &Database{
 		diskdb:    diskdb,
 		resolver:  mptResolver{},
@@ -193,6 +206,10 @@ func (db *Database) insert(hash common.Hash, node []byte) {
 // Node retrieves an encoded cached trie node from memory. If it cannot be found
 // cached, the method queries the persistent database for the content.
 func (db *Database) Node(hash common.Hash) ([]byte, error) {
+	// Nodes are not addressable by hash in the path-based scheme
+	if db.pathdb != nil {
+		return nil, errors.New("not supported")
+	}
 	// It doesn't make sense to retrieve the metaroot
 	if hash == (common.Hash{}) {
 		return nil, errors.New("not found")
@@ -234,6 +251,9 @@ func (db *Database) Node(hash common.Hash) ([]byte, error) {
 // This method is extremely expensive and should only be used to validate internal
 // states in test code.
 func (db *Database) Nodes() []common.Hash {
+	if db.pathdb != nil {
+		return nil
+	}
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 
@@ -249,6 +269,9 @@ func (db *Database) Nodes() []common.Hash {
 // and external node(e.g. storage trie root), all internal trie nodes
 // are referenced together by database itself.
 func (db *Database) Reference(child common.Hash, parent common.Hash) {
+	if db.pathdb != nil {
+		return
+	}
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -282,6 +305,10 @@ func (db *Database) reference(child common.Hash, parent common.Hash) {
 
 // Dereference removes an existing reference from a root node.
 func (db *Database) Dereference(root common.Hash) {
+	// Stale nodes are overwritten in place in the path-based scheme
+	if db.pathdb != nil {
+		return
+	}
 	// Sanity check to ensure that the meta-root is not removed
 	if root == (common.Hash{}) {
 		log.Error("Attempted to dereference the trie cache meta root")
@@ -356,6 +383,10 @@ func (db *Database) dereference(hash common.Hash) {
 // Note, this method is a non-synchronized mutator. It is unsafe to call this
 // concurrently with other mutators.
 func (db *Database) Cap(limit common.StorageSize) error {
+	// The path-based scheme flushes its write buffer on its own
+	if db.pathdb != nil {
+		return nil
+	}
 	// Create a database batch to flush persistent data out. It is important that
 	// outside code doesn't see an inconsistent state (referenced data removed from
 	// memory cache during commit but not yet in persistent storage). This is ensured
@@ -381,6 +412,7 @@ func (db *Database) Cap(limit common.StorageSize) error {
 	for size > limit && oldest != (common.Hash{}) {
 		// Fetch the oldest referenced node and push into the batch
 		node := db.dirties[oldest]
+		db.notifyWrite(oldest)
 		rawdb.WriteLegacyTrieNode(batch, oldest, node.node)
 
 		// If we exceeded the ideal batch size, commit and reset
@@ -436,6 +468,29 @@ func (db *Database) Cap(limit common.StorageSize) error {
 	return nil
 }
 
+// SetWriteHook installs a callback which is invoked with the hash of every trie
+// node right before it's flushed from the dirty cache into the persistent store.
+// Passing nil removes the installed hook. The hook is only supported in the
+// hash-based scheme, since nodes are overwritten in place in the path-based one.
+func (db *Database) SetWriteHook(hook func(hash common.Hash)) error {
+	if db.pathdb != nil {
+		return errors.New("write hooks are not supported in path scheme")
+	}
+	if hook == nil {
+		db.writeHook.Store(nil)
+	} else {
+		db.writeHook.Store(&hook)
+	}
+	return nil
+}
+
+// notifyWrite invokes the installed write hook, if any, with the given node hash.
+func (db *Database) notifyWrite(hash common.Hash) {
+	if hook := db.writeHook.Load(); hook != nil {
+		(*hook)(hash)
+	}
+}
+
 // Commit iterates over all the children of a particular node, writes them out
 // to disk, forcefully tearing down all references in both directions. As a side
 // effect, all pre-images accumulated up to this point are also written.
@@ -443,6 +498,12 @@ func (db *Database) Cap(limit common.StorageSize) error {
 // Note, this method is a non-synchronized mutator. It is unsafe to call this
 // concurrently with other mutators.
 func (db *Database) Commit(node common.Hash, report bool) error {
+	if db.pathdb != nil {
+		if db.preimages != nil {
+			db.preimages.commit(true)
+		}
+		return db.pathdb.commit(node)
+	}
 	// Create a database batch to flush persistent data out. It is important that
 	// outside code doesn't see an inconsistent state (referenced data removed from
 	// memory cache during commit but not yet in persistent storage). This is ensured
@@ -513,6 +574,7 @@ func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleane
 		return err
 	}
 	// If we've reached an optimal batch size, commit and start over
+	db.notifyWrite(hash)
 	rawdb.WriteLegacyTrieNode(batch, hash, node.node)
 	if batch.ValueSize() >= ethdb.IdealBatchSize {
 		if err := batch.Write(); err != nil {
@@ -583,8 +645,13 @@ func (c *cleaner) Delete(key []byte) error {
 }
 
 // Update inserts the dirty nodes in provided nodeset into database and
-// link the account trie with multiple storage tries if necessary.
-func (db *Database) Update(nodes *MergedNodeSet) error {
+// link the account trie with multiple storage tries if necessary. The root
+// and parent are the state roots after and before the transition, which are
+// only used by the path-based scheme to track the state layers.
+func (db *Database) Update(root common.Hash, parent common.Hash, nodes *MergedNodeSet) error {
+	if db.pathdb != nil {
+		return db.pathdb.update(root, parent, nodes)
+	}
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -632,6 +699,13 @@ func (db *Database) Update(nodes *MergedNodeSet) error {
 // Size returns the current storage size of the memory cache in front of the
 // persistent database layer.
 func (db *Database) Size() (common.StorageSize, common.StorageSize) {
+	if db.pathdb != nil {
+		var preimageSize common.StorageSize
+		if db.preimages != nil {
+			preimageSize = db.preimages.size()
+		}
+		return db.pathdb.size(), preimageSize
+	}
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 
@@ -648,6 +722,9 @@ func (db *Database) Size() (common.StorageSize, common.StorageSize) {
 
 // GetReader retrieves a node reader belonging to the given state root.
 func (db *Database) GetReader(root common.Hash) Reader {
+	if db.pathdb != nil {
+		return db.pathdb.reader(root)
+	}
 	return newHashReader(db)
 }
 
@@ -730,5 +807,87 @@ func (db *Database) CommitPreimages() error {
 
 // Scheme returns the node scheme used in the database.
 func (db *Database) Scheme() string {
+	if db.pathdb != nil {
+		return rawdb.PathScheme
+	}
 	return rawdb.HashScheme
 }
+
+// Recoverable reports whether the state with the given root can be restored
+// by reverting the persistent state. It's only supported by the path-based
+// scheme, where historical states are not kept on disk.
+func (db *Database) Recoverable(root common.Hash) bool {
+	if db.pathdb == nil {
+		return false
+	}
+	db.pathdb.lock.RLock()
+	defer db.pathdb.lock.RUnlock()
+
+	return db.pathdb.recoverable(root)
+}
+
+// Recover rolls the persistent state back to the given root using the stored
+// state histories, dropping all the newer in-memory states.
+func (db *Database) Recover(root common.Hash) error {
+	if db.pathdb == nil {
+		return errors.New("not supported")
+	}
+	return db.pathdb.recover(root)
+}
+
+// Journal writes the in-memory states leading to the given root, along with
+// the buffered nodes not yet flushed, into the database so that they survive
+// a restart. It's only supported by the path-based scheme.
+func (db *Database) Journal(root common.Hash) error {
+	if db.pathdb == nil {
+		return errors.New("not supported")
+	}
+	return db.pathdb.journal(root)
+}
+
+// Reset wipes the persistent state and all the state histories, leaving an
+// empty state behind. It's used to recommit the genesis state in the
+// path-based scheme, as the trie nodes are overwritten in place.
+func (db *Database) Reset() error {
+	if db.pathdb == nil {
+		return errors.New("not supported")
+	}
+	return db.pathdb.reset()
+}
+
+// Disable drops all the in-memory states before the state is synced directly
+// into the persistent database. The database can't be used until re-enabled.
+func (db *Database) Disable() error {
+	if db.pathdb == nil {
+		return nil
+	}
+	db.pathdb.disable()
+	return nil
+}
+
+// Enable reinitializes the database on top of the synced state with the given
+// root, dropping the state histories which no longer apply.
+func (db *Database) Enable(root common.Hash) error {
+	if db.pathdb == nil {
+		return nil
+	}
+	return db.pathdb.enable(root)
+}
+
+// Initialized reports whether the genesis state has been committed into the
+// database.
+func (db *Database) Initialized(genesisRoot common.Hash) bool {
+	if db.pathdb != nil {
+		_, root := rawdb.ReadAccountTrieNode(db.diskdb, nil)
+		return root != (common.Hash{})
+	}
+	return rawdb.HasLegacyTrieNode(db.diskdb, genesisRoot)
+}
+
+// Close releases the resources held by the database.
+func (db *Database) Close() error {
+	if db.pathdb == nil {
+		return nil
+	}
+	return db.pathdb.close()
+}
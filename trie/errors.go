@@ -17,11 +17,26 @@
 package trie
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/rethereum-blockchain/go-rethereum/common"
 )
 
+var (
+	// errStaleLayer is returned when a path-based layer is accessed after it
+	// was merged or reverted into a newer disk layer.
+	errStaleLayer = errors.New("trie layer is stale")
+
+	// errStateUnrecoverable is returned if the requested state can't be
+	// reverted to, as the required state histories are not available.
+	errStateUnrecoverable = errors.New("state is unrecoverable")
+
+	// errPathDBDisabled is returned if the path-based database is accessed
+	// while the state is being synced.
+	errPathDBDisabled = errors.New("trie database is disabled during state sync")
+)
+
 // MissingNodeError is returned by the trie functions (Get, Update, Delete)
 // in the case where a trie node is not present in the local database. It contains
 // information necessary for retrieving the missing node.
@@ -44,3 +59,10 @@ func (err *MissingNodeError) Error() string {
 	}
 	return fmt.Sprintf("missing trie node %x (owner %x) (path %x) %v", err.NodeHash, err.Owner, err.Path, err.err)
 }
+
+// newUnexpectedNodeError constructs an error reporting a trie node whose hash
+// doesn't match the expected one in the path-based database, either because
+// the node was overwritten or is missing entirely.
+func newUnexpectedNodeError(loc string, expHash common.Hash, gotHash common.Hash, owner common.Hash, path []byte) error {
+	return fmt.Errorf("unexpected %s node, owner: %x, path: %x, want: %x, got: %x", loc, owner, path, expHash, gotHash)
+}
@@ -39,7 +39,6 @@ type memoryNode struct {
 var memoryNodeSize = int(reflect.TypeOf(memoryNode{}).Size())
 
 // memorySize returns the total memory size used by this node.
-// nolint:unused
 func (n *memoryNode) memorySize(pathlen int) int {
 	return len(n.node) + common.HashLength + pathlen
 }
@@ -64,21 +63,18 @@ func (n *memoryNode) isDeleted() bool {
 }
 
 // nodeWithPrev wraps the memoryNode with the previous node value.
-// nolint: unused
 type nodeWithPrev struct {
 	*memoryNode
 	prev []byte // RLP-encoded previous value, nil means it's non-existent
 }
 
 // unwrap returns the internal memoryNode object.
-// nolint:unused
 func (n *nodeWithPrev) unwrap() *memoryNode {
 	return n.memoryNode
 }
 
 // memorySize returns the total memory size used by this node. It overloads
 // the function in memoryNode by counting the size of previous value as well.
-// nolint: unused
 func (n *nodeWithPrev) memorySize(pathlen int) int {
 	return n.memoryNode.memorySize(pathlen) + len(n.prev)
 }
@@ -135,6 +131,17 @@ func (set *NodeSet) markDeleted(path []byte) {
 	set.deletes += 1
 }
 
+// MarkDeleted marks the node at the given path as deleted, recording its
+// original value. It's used to wipe the storage tries of destructed accounts
+// in the path-based scheme, where stale nodes are not garbage collected.
+func (set *NodeSet) MarkDeleted(path []byte, prev []byte) {
+	if set.accessList == nil {
+		set.accessList = make(map[string][]byte)
+	}
+	set.markDeleted(path)
+	set.accessList[string(path)] = prev
+}
+
 // addLeaf collects the provided leaf node into set.
 func (set *NodeSet) addLeaf(node *leaf) {
 	set.leaves = append(set.leaves, node)
@@ -200,12 +207,29 @@ func NewWithNodeSet(set *NodeSet) *MergedNodeSet {
 }
 
 // Merge merges the provided dirty nodes of a trie into the set. The assumption
-// is held that no duplicated set belonging to the same trie will be merged twice.
+// is held that no duplicated set belonging to the same trie will be merged twice,
+// except a set of deleted nodes followed by the set of the recreated trie.
 func (set *MergedNodeSet) Merge(other *NodeSet) error {
-	_, present := set.sets[other.owner]
-	if present {
+	present, ok := set.sets[other.owner]
+	if !ok {
+		set.sets[other.owner] = other
+		return nil
+	}
+	if present.updates != 0 {
 		return fmt.Errorf("duplicate trie for owner %#x", other.owner)
 	}
-	set.sets[other.owner] = other
+	// The trie was wiped and recreated, retain the original values of the
+	// overwritten nodes as recorded by the deletion.
+	for path, n := range other.nodes {
+		if _, ok := present.nodes[path]; ok {
+			present.deletes -= 1
+		} else if prev, ok := other.accessList[path]; ok {
+			present.accessList[path] = prev
+		}
+		present.nodes[path] = n
+	}
+	present.leaves = append(present.leaves, other.leaves...)
+	present.updates += other.updates
+	present.deletes += other.deletes
 	return nil
 }
@@ -0,0 +1,489 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+)
+
+const (
+	// maxDiffLayers is the maximum number of diff layers kept in memory on top
+	// of the disk layer, matching the number of recent states retained by the
+	// chain in the hash-based scheme.
+	maxDiffLayers = 128
+
+	// defaultDirtyCacheSize is the default memory allowance of the write buffer
+	// aggregating the transitions merged into the disk layer.
+	defaultDirtyCacheSize = 64 * 1024 * 1024
+)
+
+// PathConfig contains the settings of the path-based state scheme.
+type PathConfig struct {
+	StateHistory   uint64 // Number of recent states to keep reverse diffs for, 0 keeps all
+	DirtyCacheSize int    // Memory allowance (bytes) for buffering dirty nodes before flushing
+}
+
+// pathDB is the path-based trie node store. Nodes are keyed by their owner
+// and path on disk, so only a single version of the state is persisted. The
+// recent states are kept as a tree of in-memory diff layers on top of the disk
+// layer, and the persisted transitions can be rolled back via the reverse
+// diffs stored in the state freezer.
+type pathDB struct {
+	config    *PathConfig
+	diskdb    ethdb.Database
+	freezer   *rawdb.ResettableFreezer // State history store, nil if no ancient store is available
+	cleans    *fastcache.Cache         // Clean node cache shared by the disk layers
+	maxLayers int                      // Number of diff layers kept in memory
+
+	lock     sync.RWMutex
+	layers   map[common.Hash]layer // All live layers keyed by state root
+	disabled bool                  // Flag whether the state is being synced
+}
+
+// newPathDB opens the path-based trie node store on top of the given database.
+func newPathDB(diskdb ethdb.Database, config *PathConfig, cleans *fastcache.Cache) *pathDB {
+	if config == nil {
+		config = &PathConfig{}
+	}
+	if config.DirtyCacheSize == 0 {
+		config.DirtyCacheSize = defaultDirtyCacheSize
+	}
+	db := &pathDB{
+		config:    config,
+		diskdb:    diskdb,
+		cleans:    cleans,
+		maxLayers: maxDiffLayers,
+		layers:    make(map[common.Hash]layer),
+	}
+	if ancient, err := diskdb.AncientDatadir(); err == nil && ancient != "" {
+		freezer, err := rawdb.NewStateFreezer(ancient, false)
+		if err != nil {
+			log.Crit("Failed to open state history freezer", "err", err)
+		}
+		db.freezer = freezer
+	}
+	if err := db.loadJournal(); err != nil {
+		if err != errMissingJournal {
+			log.Info("Failed to load trie journal", "err", err)
+		}
+		dl := db.loadDiskLayer()
+		db.layers[dl.root] = dl
+	}
+	return db
+}
+
+// loadDiskLayer constructs the disk layer out of the persistent state, and
+// aligns the state histories with it.
+func (db *pathDB) loadDiskLayer() *diskLayer {
+	root := types.EmptyRootHash
+	if blob, hash := rawdb.ReadAccountTrieNode(db.diskdb, nil); len(blob) > 0 {
+		root = hash
+	}
+	id := rawdb.ReadPersistentStateID(db.diskdb)
+	if db.freezer != nil {
+		head, err := db.freezer.Ancients()
+		if err != nil {
+			log.Crit("Failed to retrieve state history head", "err", err)
+		}
+		switch {
+		case head > id:
+			// The histories of the transitions lost along with the write
+			// buffer (e.g. unclean shutdown) are dangling, drop them.
+			if err := db.freezer.TruncateHead(id); err != nil {
+				log.Crit("Failed to truncate state histories", "err", err)
+			}
+			log.Warn("Truncated dangling state histories", "number", head-id)
+
+		case head < id:
+			// The histories are missing (e.g. freezer was deleted), realign the
+			// state id so that new histories can be appended. The states older
+			// than the persistent one can't be reverted to anymore.
+			tail, err := db.freezer.Tail()
+			if err != nil {
+				log.Crit("Failed to retrieve state history tail", "err", err)
+			}
+			if tail != head {
+				if err := db.freezer.Reset(); err != nil {
+					log.Crit("Failed to reset state histories", "err", err)
+				}
+				head = 0
+			}
+			log.Warn("State histories are missing, realigning state id", "persistent", id, "history", head)
+			id = head
+			rawdb.WritePersistentStateID(db.diskdb, id)
+		}
+	}
+	return newDiskLayer(root, id, db, db.cleans, newNodeBuffer(db.config.DirtyCacheSize))
+}
+
+// diskLayer returns the bottom layer of the layer tree.
+func (db *pathDB) diskLayer() *diskLayer {
+	for _, l := range db.layers {
+		for l.parentLayer() != nil {
+			l = l.parentLayer()
+		}
+		return l.(*diskLayer)
+	}
+	return nil
+}
+
+// reader retrieves the reader of the given state, or nil if the state is not
+// available. The empty state is always available, even if there's no layer
+// representing it.
+func (db *pathDB) reader(root common.Hash) Reader {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if l := db.layers[root]; l != nil {
+		return l
+	}
+	if root == (common.Hash{}) || root == types.EmptyRootHash {
+		return emptyReader{}
+	}
+	return nil
+}
+
+// emptyReader is the reader of the empty state, which has no nodes to resolve.
+type emptyReader struct{}
+
+// Node implements the Reader interface, the empty state has no nodes.
+func (emptyReader) Node(owner common.Hash, path []byte, hash common.Hash) ([]byte, error) {
+	return nil, errors.New("empty state")
+}
+
+// update adds a new diff layer on top of the parent state.
+func (db *pathDB) update(root common.Hash, parent common.Hash, nodes *MergedNodeSet) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.disabled {
+		return errPathDBDisabled
+	}
+	// Skip the transition if the state is already known, e.g. the same block
+	// is re-executed or the transition is empty.
+	if _, ok := db.layers[root]; ok {
+		return nil
+	}
+	l := db.layers[parent]
+	if l == nil {
+		return fmt.Errorf("parent state %x is not available", parent)
+	}
+	db.layers[root] = newDiffLayer(l, root, l.stateID()+1, flattenNodes(nodes))
+	return db.cap(root, db.maxLayers)
+}
+
+// cap flattens the diff layers below the given state into the disk layer,
+// keeping at most the given number of diff layers in memory.
+func (db *pathDB) cap(root common.Hash, layers int) error {
+	diff, ok := db.layers[root].(*diffLayer)
+	if !ok {
+		return nil
+	}
+	for i := 0; i < layers-1; i++ {
+		parent, ok := diff.parentLayer().(*diffLayer)
+		if !ok {
+			return nil
+		}
+		diff = parent
+	}
+	bottom, ok := diff.parentLayer().(*diffLayer)
+	if !ok {
+		return nil
+	}
+	base, err := db.persist(bottom, false)
+	if err != nil {
+		return err
+	}
+	diff.setParent(base)
+	db.rebuild(base)
+	return nil
+}
+
+// persist merges the given diff layer along with all its ancestors into the
+// disk layer.
+func (db *pathDB) persist(bottom *diffLayer, force bool) (*diskLayer, error) {
+	parent := bottom.parentLayer()
+	if diff, ok := parent.(*diffLayer); ok {
+		base, err := db.persist(diff, false)
+		if err != nil {
+			return nil, err
+		}
+		bottom.setParent(base)
+		parent = base
+	}
+	return parent.(*diskLayer).commit(bottom, force)
+}
+
+// rebuild drops the layers which are no longer reachable from the given new
+// disk layer, e.g. the merged ones and the side branches of them.
+func (db *pathDB) rebuild(base *diskLayer) {
+	children := make(map[common.Hash][]common.Hash)
+	for root, l := range db.layers {
+		if diff, ok := l.(*diffLayer); ok {
+			parent := diff.parentLayer().rootHash()
+			children[parent] = append(children[parent], root)
+		}
+	}
+	layers := map[common.Hash]layer{base.root: base}
+
+	var keep func(root common.Hash)
+	keep = func(root common.Hash) {
+		for _, child := range children[root] {
+			if _, ok := layers[child]; ok {
+				continue
+			}
+			layers[child] = db.layers[child]
+			keep(child)
+		}
+	}
+	keep(base.root)
+
+	// The siblings built on the merged layer represent the same state as the
+	// new disk layer, relink them.
+	for _, child := range children[base.root] {
+		layers[child].(*diffLayer).setParent(base)
+	}
+	db.layers = layers
+}
+
+// commit flattens all the layers below the given state into the disk layer and
+// flushes the write buffer.
+func (db *pathDB) commit(root common.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.disabled {
+		return errPathDBDisabled
+	}
+	l := db.layers[root]
+	if l == nil {
+		return fmt.Errorf("state %x is not available", root)
+	}
+	switch l := l.(type) {
+	case *diskLayer:
+		return l.buffer.flush(db.diskdb, db.freezer, l.cleans, l.id, true)
+	case *diffLayer:
+		base, err := db.persist(l, true)
+		if err != nil {
+			return err
+		}
+		db.rebuild(base)
+	}
+	return nil
+}
+
+// recoverable reports whether the persistent state can be reverted to the
+// given state using the stored state histories.
+func (db *pathDB) recoverable(root common.Hash) bool {
+	if db.disabled || db.freezer == nil {
+		return false
+	}
+	id := rawdb.ReadStateID(db.diskdb, root)
+	if id == nil {
+		return false
+	}
+	dl := db.diskLayer()
+	if *id >= dl.id {
+		return false
+	}
+	// The histories in range [id+1, disk id] must all be present, and the
+	// first one must lead from the requested state.
+	tail, err := db.freezer.Tail()
+	if err != nil || *id < tail {
+		return false
+	}
+	h, err := readHistory(db.freezer, *id+1)
+	if err != nil {
+		return false
+	}
+	return h.meta.Parent == root
+}
+
+// recover reverts the persistent state to the given one, dropping all the
+// layers on top.
+func (db *pathDB) recover(root common.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.disabled {
+		return errPathDBDisabled
+	}
+	if !db.recoverable(root) {
+		return errStateUnrecoverable
+	}
+	dl := db.diskLayer()
+	for dl.root != root {
+		h, err := readHistory(db.freezer, dl.id)
+		if err != nil {
+			return err
+		}
+		if dl, err = dl.revert(h); err != nil {
+			return err
+		}
+		if err := db.freezer.TruncateHead(dl.id); err != nil {
+			return err
+		}
+	}
+	db.layers = map[common.Hash]layer{dl.root: dl}
+	log.Info("Reverted persistent state", "root", root, "id", dl.id)
+	return nil
+}
+
+// reset drops all the layers and wipes the persistent state along with the
+// state histories.
+func (db *pathDB) reset() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if dl := db.diskLayer(); dl != nil {
+		dl.markStale()
+	}
+	batch := db.diskdb.NewBatch()
+	it := db.diskdb.NewIterator(nil, nil)
+	for it.Next() {
+		if rawdb.IsAccountTrieNode(it.Key()) || rawdb.IsStorageTrieNode(it.Key()) {
+			batch.Delete(it.Key())
+		}
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				it.Release()
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	rawdb.WritePersistentStateID(batch, 0)
+	rawdb.DeleteTrieJournal(batch)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	if db.freezer != nil {
+		if err := db.freezer.Reset(); err != nil {
+			return err
+		}
+	}
+	if db.cleans != nil {
+		db.cleans.Reset()
+	}
+	dl := newDiskLayer(types.EmptyRootHash, 0, db, db.cleans, newNodeBuffer(db.config.DirtyCacheSize))
+	db.layers = map[common.Hash]layer{dl.root: dl}
+	db.disabled = false
+	return nil
+}
+
+// disable drops all the layers without persisting them, as the state is about
+// to be synced directly into the disk.
+func (db *pathDB) disable() {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if dl := db.diskLayer(); dl != nil {
+		dl.markStale()
+	}
+	db.layers = make(map[common.Hash]layer)
+	db.disabled = true
+}
+
+// enable reinitializes the disk layer on top of the synced state, dropping all
+// the state histories which no longer apply.
+func (db *pathDB) enable(root common.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	stored := types.EmptyRootHash
+	if blob, hash := rawdb.ReadAccountTrieNode(db.diskdb, nil); len(blob) > 0 {
+		stored = hash
+	}
+	if stored != root {
+		return fmt.Errorf("state root mismatch: stored %x, synced %x", stored, root)
+	}
+	rawdb.WritePersistentStateID(db.diskdb, 0)
+	rawdb.DeleteTrieJournal(db.diskdb)
+	if db.freezer != nil {
+		if err := db.freezer.Reset(); err != nil {
+			return err
+		}
+	}
+	if db.cleans != nil {
+		db.cleans.Reset()
+	}
+	dl := newDiskLayer(root, 0, db, db.cleans, newNodeBuffer(db.config.DirtyCacheSize))
+	db.layers = map[common.Hash]layer{dl.root: dl}
+	db.disabled = false
+	log.Info("Enabled trie database", "root", root)
+	return nil
+}
+
+// size returns the memory used by the diff layers and the write buffer.
+func (db *pathDB) size() common.StorageSize {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var size uint64
+	for _, l := range db.layers {
+		switch l := l.(type) {
+		case *diffLayer:
+			size += l.memory
+		case *diskLayer:
+			size += l.size()
+		}
+	}
+	return common.StorageSize(size)
+}
+
+// close releases the state freezer. The layers held in memory are discarded,
+// the caller is expected to journal or commit the wanted state beforehand.
+func (db *pathDB) close() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.freezer == nil {
+		return nil
+	}
+	return db.freezer.Close()
+}
+
+// flattenNodes converts the dirty nodes collected during commit into the
+// owner and path keyed form held by the diff layers, along with the original
+// value of each node.
+func flattenNodes(set *MergedNodeSet) map[common.Hash]map[string]*nodeWithPrev {
+	nodes := make(map[common.Hash]map[string]*nodeWithPrev)
+	if set == nil {
+		return nodes
+	}
+	for owner, subset := range set.sets {
+		flat := make(map[string]*nodeWithPrev, len(subset.nodes))
+		for path, n := range subset.nodes {
+			flat[path] = &nodeWithPrev{memoryNode: n, prev: subset.accessList[path]}
+		}
+		nodes[owner] = flat
+	}
+	return nodes
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/rlp"
+)
+
+// State history is the reverse diff of a state transition, recording the
+// original values of all the trie nodes mutated by it. It's the only way to
+// roll back the persistent state in the path-based scheme, as the stale nodes
+// are overwritten in place.
+//
+// Each state history is stored in the state freezer, indexed by the id of the
+// state it was created for. History n reverts state n back into state n-1.
+
+// historyMeta links a state history to the transition it reverts.
+type historyMeta struct {
+	Parent common.Hash // State root before the transition
+	Root   common.Hash // State root after the transition
+}
+
+// historyNode is the original value of a single mutated trie node. An empty
+// value means the node didn't exist before the transition.
+type historyNode struct {
+	Owner common.Hash
+	Path  []byte
+	Prev  []byte
+}
+
+// history is the reverse diff of a single state transition.
+type history struct {
+	meta  historyMeta
+	nodes []historyNode
+}
+
+// newHistory constructs the state history of the transition from parent to
+// root, out of the mutated nodes and their original values.
+func newHistory(root common.Hash, parent common.Hash, nodes map[common.Hash]map[string]*nodeWithPrev) *history {
+	h := &history{meta: historyMeta{Parent: parent, Root: root}}
+	for owner, subset := range nodes {
+		for path, n := range subset {
+			h.nodes = append(h.nodes, historyNode{Owner: owner, Path: []byte(path), Prev: n.prev})
+		}
+	}
+	// Sort the nodes so that the encoding is deterministic
+	sort.Slice(h.nodes, func(i, j int) bool {
+		if h.nodes[i].Owner != h.nodes[j].Owner {
+			return bytes.Compare(h.nodes[i].Owner[:], h.nodes[j].Owner[:]) < 0
+		}
+		return bytes.Compare(h.nodes[i].Path, h.nodes[j].Path) < 0
+	})
+	return h
+}
+
+// encode serializes the state history into the metadata and node blobs.
+func (h *history) encode() ([]byte, []byte, error) {
+	meta, err := rlp.EncodeToBytes(&h.meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := rlp.EncodeToBytes(h.nodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return meta, nodes, nil
+}
+
+// decode deserializes the state history from the metadata and node blobs.
+func (h *history) decode(meta []byte, nodes []byte) error {
+	if err := rlp.DecodeBytes(meta, &h.meta); err != nil {
+		return fmt.Errorf("invalid history metadata: %v", err)
+	}
+	if err := rlp.DecodeBytes(nodes, &h.nodes); err != nil {
+		return fmt.Errorf("invalid history nodes: %v", err)
+	}
+	return nil
+}
+
+// readHistory reads and decodes the state history with the given id.
+func readHistory(freezer *rawdb.ResettableFreezer, id uint64) (*history, error) {
+	meta, nodes, err := rawdb.ReadStateHistory(freezer, id)
+	if err != nil {
+		return nil, err
+	}
+	h := new(history)
+	if err := h.decode(meta, nodes); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// writeHistory stores the state history with the given id.
+func writeHistory(freezer *rawdb.ResettableFreezer, id uint64, h *history) error {
+	meta, nodes, err := h.encode()
+	if err != nil {
+		return err
+	}
+	if err := rawdb.WriteStateHistory(freezer, id, meta, nodes); err != nil {
+		return err
+	}
+	log.Debug("Stored state history", "id", id, "root", h.meta.Root, "nodes", len(h.nodes), "size", common.StorageSize(len(meta)+len(nodes)))
+	return nil
+}
+
+// truncateHistoryTail removes the histories older than the given limit, with
+// the head being the id of the newest history.
+func truncateHistoryTail(freezer *rawdb.ResettableFreezer, head uint64, limit uint64) error {
+	if limit == 0 || head <= limit {
+		return nil
+	}
+	tail, err := freezer.Tail()
+	if err != nil {
+		return err
+	}
+	if tail >= head-limit {
+		return nil
+	}
+	return freezer.TruncateTail(head - limit)
+}
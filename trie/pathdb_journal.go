@@ -0,0 +1,208 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+	"github.com/rethereum-blockchain/go-rethereum/rlp"
+)
+
+// journalVersion ensures that an incompatible journal is detected and discarded.
+const journalVersion uint64 = 0
+
+var (
+	// errMissingJournal is returned if the journal is not found.
+	errMissingJournal = errors.New("journal not found")
+
+	// errUnmatchedJournal is returned if the journal doesn't belong to the
+	// persistent state.
+	errUnmatchedJournal = errors.New("unmatched journal")
+)
+
+// journalNode is a single trie node in the journal. An empty blob denotes a
+// deleted node, the previous value is only tracked for the diff layers.
+type journalNode struct {
+	Path []byte
+	Blob []byte
+	Prev []byte
+}
+
+// journalNodes is the set of nodes of a single trie in the journal.
+type journalNodes struct {
+	Owner common.Hash
+	Nodes []journalNode
+}
+
+// journalDiff is a single diff layer in the journal.
+type journalDiff struct {
+	Root  common.Hash
+	ID    uint64
+	Nodes []journalNodes
+}
+
+// journal is the serialized form of the in-memory layers: the write buffer of
+// the disk layer and the diff layers on top of it, ordered from the bottom.
+type journal struct {
+	Version uint64
+	Base    common.Hash    // Root of the persistent state the layers are built on
+	Root    common.Hash    // Root of the disk layer
+	ID      uint64         // State id of the disk layer
+	Layers  uint64         // Number of state transitions in the write buffer
+	Buffer  []journalNodes // Nodes in the write buffer
+	Diffs   []journalDiff  // Diff layers on top of the disk layer
+}
+
+// persistentRoot returns the root of the state stored on disk.
+func (db *pathDB) persistentRoot() common.Hash {
+	if blob, hash := rawdb.ReadAccountTrieNode(db.diskdb, nil); len(blob) > 0 {
+		return hash
+	}
+	return types.EmptyRootHash
+}
+
+// journal writes the layers leading to the given state, along with the write
+// buffer of the disk layer, into the database, so that they survive a restart.
+// The layers of other branches are discarded.
+func (db *pathDB) journal(root common.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.disabled {
+		return errPathDBDisabled
+	}
+	l := db.layers[root]
+	if l == nil {
+		return fmt.Errorf("state %x is not available", root)
+	}
+	var diffs []*diffLayer
+	for {
+		diff, ok := l.(*diffLayer)
+		if !ok {
+			break
+		}
+		diffs = append(diffs, diff)
+		l = diff.parentLayer()
+	}
+	disk := l.(*diskLayer)
+	if disk.isStale() {
+		return errStaleLayer
+	}
+	j := &journal{
+		Version: journalVersion,
+		Base:    db.persistentRoot(),
+		Root:    disk.root,
+		ID:      disk.id,
+		Layers:  disk.buffer.layers,
+	}
+	for owner, subset := range disk.buffer.nodes {
+		entry := journalNodes{Owner: owner}
+		for path, n := range subset {
+			entry.Nodes = append(entry.Nodes, journalNode{Path: []byte(path), Blob: n.node})
+		}
+		j.Buffer = append(j.Buffer, entry)
+	}
+	for i := len(diffs) - 1; i >= 0; i-- {
+		diff := journalDiff{Root: diffs[i].root, ID: diffs[i].id}
+		for owner, subset := range diffs[i].nodes {
+			entry := journalNodes{Owner: owner}
+			for path, n := range subset {
+				entry.Nodes = append(entry.Nodes, journalNode{Path: []byte(path), Blob: n.node, Prev: n.prev})
+			}
+			diff.Nodes = append(diff.Nodes, entry)
+		}
+		j.Diffs = append(j.Diffs, diff)
+	}
+	blob, err := rlp.EncodeToBytes(j)
+	if err != nil {
+		return err
+	}
+	rawdb.WriteTrieJournal(db.diskdb, blob)
+	log.Info("Persisted trie journal", "disk", disk.root, "diffs", len(diffs), "size", common.StorageSize(len(blob)))
+	return nil
+}
+
+// loadJournal reconstructs the layers from the journal, if it's present and
+// belongs to the persistent state. The journal is only valid as long as the
+// write buffer it holds wasn't flushed since, which is verified against the
+// persistent state and the state histories.
+func (db *pathDB) loadJournal() error {
+	blob := rawdb.ReadTrieJournal(db.diskdb)
+	if len(blob) == 0 {
+		return errMissingJournal
+	}
+	var j journal
+	if err := rlp.DecodeBytes(blob, &j); err != nil {
+		return err
+	}
+	if j.Version != journalVersion {
+		return fmt.Errorf("unknown journal version %d", j.Version)
+	}
+	if j.Base != db.persistentRoot() || j.Layers > j.ID || rawdb.ReadPersistentStateID(db.diskdb) != j.ID-j.Layers {
+		return errUnmatchedJournal
+	}
+	if db.freezer != nil {
+		head, err := db.freezer.Ancients()
+		if err != nil {
+			return err
+		}
+		if head != j.ID {
+			return errUnmatchedJournal
+		}
+	}
+	buffer := newNodeBuffer(db.config.DirtyCacheSize)
+	for _, entry := range j.Buffer {
+		subset := make(map[string]*memoryNode, len(entry.Nodes))
+		for _, n := range entry.Nodes {
+			subset[string(n.Path)] = newJournalNode(n.Blob)
+			buffer.size += uint64(subset[string(n.Path)].memorySize(len(n.Path)))
+		}
+		buffer.nodes[entry.Owner] = subset
+	}
+	buffer.layers = j.Layers
+
+	var parent layer = newDiskLayer(j.Root, j.ID, db, db.cleans, buffer)
+	db.layers[j.Root] = parent
+	for _, diff := range j.Diffs {
+		nodes := make(map[common.Hash]map[string]*nodeWithPrev)
+		for _, entry := range diff.Nodes {
+			subset := make(map[string]*nodeWithPrev, len(entry.Nodes))
+			for _, n := range entry.Nodes {
+				subset[string(n.Path)] = &nodeWithPrev{memoryNode: newJournalNode(n.Blob), prev: n.Prev}
+			}
+			nodes[entry.Owner] = subset
+		}
+		parent = newDiffLayer(parent, diff.Root, diff.ID, nodes)
+		db.layers[diff.Root] = parent
+	}
+	log.Info("Loaded trie journal", "disk", j.Root, "diffs", len(j.Diffs))
+	return nil
+}
+
+// newJournalNode reconstructs a trie node from its journalled blob.
+func newJournalNode(blob []byte) *memoryNode {
+	if len(blob) == 0 {
+		return &memoryNode{}
+	}
+	return &memoryNode{hash: crypto.Keccak256Hash(blob), node: blob}
+}
@@ -0,0 +1,436 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/crypto"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/log"
+)
+
+// layer is a single state in the path-based layer tree, either an in-memory
+// diff layer or the persistent disk layer at the bottom.
+type layer interface {
+	Reader
+
+	// rootHash returns the state root the layer represents.
+	rootHash() common.Hash
+
+	// stateID returns the sequential id of the state the layer represents.
+	stateID() uint64
+
+	// parentLayer returns the layer this one was built on top of, or nil for
+	// the disk layer.
+	parentLayer() layer
+}
+
+// diffLayer is an in-memory state transition on top of a parent layer, holding
+// the mutated trie nodes along with their original values. The layer itself is
+// immutable, only the parent link is updated when the layers below are merged
+// into the disk layer.
+type diffLayer struct {
+	root   common.Hash                              // State root of the layer
+	id     uint64                                   // Sequential id of the state
+	nodes  map[common.Hash]map[string]*nodeWithPrev // Mutated nodes keyed by owner and path
+	memory uint64                                   // Approximate memory used by the nodes
+
+	lock   sync.RWMutex
+	parent layer // Parent layer, updated when the layers below are flattened
+}
+
+// newDiffLayer creates a new diff layer on top of the given parent.
+func newDiffLayer(parent layer, root common.Hash, id uint64, nodes map[common.Hash]map[string]*nodeWithPrev) *diffLayer {
+	dl := &diffLayer{
+		root:   root,
+		id:     id,
+		nodes:  nodes,
+		parent: parent,
+	}
+	for _, subset := range nodes {
+		for path, n := range subset {
+			dl.memory += uint64(n.memorySize(len(path)))
+		}
+	}
+	return dl
+}
+
+// rootHash implements the layer interface, returning the state root.
+func (dl *diffLayer) rootHash() common.Hash {
+	return dl.root
+}
+
+// stateID implements the layer interface, returning the state id.
+func (dl *diffLayer) stateID() uint64 {
+	return dl.id
+}
+
+// parentLayer implements the layer interface, returning the parent layer.
+func (dl *diffLayer) parentLayer() layer {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.parent
+}
+
+// setParent relinks the layer onto a new parent, used when the original one
+// is merged into the disk layer.
+func (dl *diffLayer) setParent(parent layer) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.parent = parent
+}
+
+// Node implements the Reader interface, retrieving the trie node with the given
+// path from this layer or falling back to the parents.
+func (dl *diffLayer) Node(owner common.Hash, path []byte, hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	if subset, ok := dl.nodes[owner]; ok {
+		if n, ok := subset[string(path)]; ok {
+			dl.lock.RUnlock()
+
+			if n.hash != hash {
+				return nil, newUnexpectedNodeError("diff", hash, n.hash, owner, path)
+			}
+			return n.node, nil
+		}
+	}
+	parent := dl.parent
+	dl.lock.RUnlock()
+
+	return parent.Node(owner, path, hash)
+}
+
+// nodeBuffer aggregates the nodes of multiple state transitions in memory on
+// top of the disk layer, flushing them to disk in batches once the memory
+// allowance is exceeded.
+type nodeBuffer struct {
+	nodes  map[common.Hash]map[string]*memoryNode // Aggregated nodes keyed by owner and path
+	layers uint64                                 // Number of state transitions merged in
+	size   uint64                                 // Approximate memory used by the nodes
+	limit  uint64                                 // Memory allowance before a flush is forced
+}
+
+// newNodeBuffer creates an empty node buffer with the given memory allowance.
+func newNodeBuffer(limit int) *nodeBuffer {
+	return &nodeBuffer{
+		nodes: make(map[common.Hash]map[string]*memoryNode),
+		limit: uint64(limit),
+	}
+}
+
+// node retrieves the trie node with the given path from the buffer.
+func (b *nodeBuffer) node(owner common.Hash, path []byte) (*memoryNode, bool) {
+	subset, ok := b.nodes[owner]
+	if !ok {
+		return nil, false
+	}
+	n, ok := subset[string(path)]
+	return n, ok
+}
+
+// commit merges the nodes of a state transition into the buffer, overwriting
+// the older versions of the same nodes.
+func (b *nodeBuffer) commit(nodes map[common.Hash]map[string]*nodeWithPrev) *nodeBuffer {
+	for owner, subset := range nodes {
+		current, ok := b.nodes[owner]
+		if !ok {
+			current = make(map[string]*memoryNode)
+			b.nodes[owner] = current
+		}
+		for path, n := range subset {
+			if orig, ok := current[path]; ok {
+				b.size -= uint64(orig.memorySize(len(path)))
+			}
+			current[path] = n.unwrap()
+			b.size += uint64(n.unwrap().memorySize(len(path)))
+		}
+	}
+	b.layers++
+	return b
+}
+
+// empty reports whether the buffer holds no pending state transitions.
+func (b *nodeBuffer) empty() bool {
+	return b.layers == 0
+}
+
+// reset discards all the buffered nodes.
+func (b *nodeBuffer) reset() {
+	b.nodes = make(map[common.Hash]map[string]*memoryNode)
+	b.layers = 0
+	b.size = 0
+}
+
+// flush persists the buffered nodes along with the id of the state they lead
+// to, if the memory allowance is exceeded or the flush is forced. The state
+// histories are synced beforehand, so that the persistent state can always be
+// reverted after a crash.
+func (b *nodeBuffer) flush(db ethdb.KeyValueStore, freezer *rawdb.ResettableFreezer, clean *fastcache.Cache, id uint64, force bool) error {
+	if b.size <= b.limit && !force {
+		return nil
+	}
+	if freezer != nil {
+		if err := freezer.Sync(); err != nil {
+			return err
+		}
+	}
+	var (
+		start = time.Now()
+		batch = db.NewBatchWithSize(int(b.size))
+		nodes int
+	)
+	for owner, subset := range b.nodes {
+		for path, n := range subset {
+			key := pathCacheKey(owner, []byte(path))
+			if n.isDeleted() {
+				if owner == (common.Hash{}) {
+					rawdb.DeleteAccountTrieNode(batch, []byte(path))
+				} else {
+					rawdb.DeleteStorageTrieNode(batch, owner, []byte(path))
+				}
+				if clean != nil {
+					clean.Del(key)
+				}
+			} else {
+				if owner == (common.Hash{}) {
+					rawdb.WriteAccountTrieNode(batch, []byte(path), n.node)
+				} else {
+					rawdb.WriteStorageTrieNode(batch, owner, []byte(path), n.node)
+				}
+				if clean != nil {
+					clean.Set(key, n.node)
+				}
+			}
+			nodes++
+		}
+	}
+	rawdb.WritePersistentStateID(batch, id)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Debug("Persisted trie nodes", "nodes", nodes, "layers", b.layers, "size", common.StorageSize(b.size), "id", id, "elapsed", common.PrettyDuration(time.Since(start)))
+	b.reset()
+	return nil
+}
+
+// diskLayer is the bottom layer of the path-based layer tree, representing the
+// persistent state along with the write buffer on top of it.
+type diskLayer struct {
+	root   common.Hash      // State root of the layer
+	id     uint64           // Sequential id of the state
+	db     *pathDB          // Database the layer belongs to
+	cleans *fastcache.Cache // Clean node cache keyed by owner and path
+	buffer *nodeBuffer      // Dirty nodes not yet flushed to disk
+
+	lock  sync.RWMutex
+	stale bool // Signals that the layer was replaced and is no longer usable
+}
+
+// newDiskLayer creates a new disk layer with the given state and write buffer.
+func newDiskLayer(root common.Hash, id uint64, db *pathDB, cleans *fastcache.Cache, buffer *nodeBuffer) *diskLayer {
+	return &diskLayer{
+		root:   root,
+		id:     id,
+		db:     db,
+		cleans: cleans,
+		buffer: buffer,
+	}
+}
+
+// rootHash implements the layer interface, returning the state root.
+func (dl *diskLayer) rootHash() common.Hash {
+	return dl.root
+}
+
+// stateID implements the layer interface, returning the state id.
+func (dl *diskLayer) stateID() uint64 {
+	return dl.id
+}
+
+// parentLayer implements the layer interface, the disk layer has no parent.
+func (dl *diskLayer) parentLayer() layer {
+	return nil
+}
+
+// isStale reports whether the layer was replaced by a newer disk layer.
+func (dl *diskLayer) isStale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// markStale flags the layer as replaced.
+func (dl *diskLayer) markStale() {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.stale = true
+}
+
+// Node implements the Reader interface, retrieving the trie node with the given
+// path from the write buffer, the clean cache or the persistent database. The
+// node hash is verified, as the stored nodes are overwritten in place.
+func (dl *diskLayer) Node(owner common.Hash, path []byte, hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, errStaleLayer
+	}
+	if n, ok := dl.buffer.node(owner, path); ok {
+		if n.hash != hash {
+			return nil, newUnexpectedNodeError("dirty", hash, n.hash, owner, path)
+		}
+		return n.node, nil
+	}
+	key := pathCacheKey(owner, path)
+	if dl.cleans != nil {
+		if blob := dl.cleans.Get(nil, key); len(blob) > 0 {
+			if got := crypto.Keccak256Hash(blob); got != hash {
+				return nil, newUnexpectedNodeError("clean", hash, got, owner, path)
+			}
+			memcacheCleanHitMeter.Mark(1)
+			memcacheCleanReadMeter.Mark(int64(len(blob)))
+			return blob, nil
+		}
+		memcacheCleanMissMeter.Mark(1)
+	}
+	var (
+		blob []byte
+		got  common.Hash
+	)
+	if owner == (common.Hash{}) {
+		blob, got = rawdb.ReadAccountTrieNode(dl.db.diskdb, path)
+	} else {
+		blob, got = rawdb.ReadStorageTrieNode(dl.db.diskdb, owner, path)
+	}
+	if got != hash {
+		return nil, newUnexpectedNodeError("disk", hash, got, owner, path)
+	}
+	if dl.cleans != nil && len(blob) > 0 {
+		dl.cleans.Set(key, blob)
+		memcacheCleanWriteMeter.Mark(int64(len(blob)))
+	}
+	return blob, nil
+}
+
+// commit merges the given diff layer, which must be the direct child of the
+// disk layer, into a new disk layer. The reverse diff of the transition is
+// stored in the state freezer first, so that the persistent state can be
+// reverted even if the node has crashed between the two steps.
+func (dl *diskLayer) commit(bottom *diffLayer, force bool) (*diskLayer, error) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	if dl.stale {
+		return nil, errStaleLayer
+	}
+	freezer := dl.db.freezer
+	if freezer != nil {
+		if err := writeHistory(freezer, bottom.id, newHistory(bottom.root, dl.root, bottom.nodes)); err != nil {
+			return nil, err
+		}
+	}
+	rawdb.WriteStateID(dl.db.diskdb, bottom.root, bottom.id)
+
+	ndl := newDiskLayer(bottom.root, bottom.id, dl.db, dl.cleans, dl.buffer.commit(bottom.nodes))
+	if err := ndl.buffer.flush(ndl.db.diskdb, freezer, ndl.cleans, ndl.id, force); err != nil {
+		return nil, err
+	}
+	dl.stale = true
+
+	// Drop the state histories beyond the retention limit
+	if freezer != nil {
+		if err := truncateHistoryTail(freezer, bottom.id, dl.db.config.StateHistory); err != nil {
+			return nil, err
+		}
+	}
+	return ndl, nil
+}
+
+// revert applies the given state history onto the disk layer, rolling the
+// persistent state back to its parent.
+func (dl *diskLayer) revert(h *history) (*diskLayer, error) {
+	if h.meta.Root != dl.rootHash() {
+		return nil, fmt.Errorf("history root mismatch: have %x, want %x", h.meta.Root, dl.rootHash())
+	}
+	if dl.id == 0 {
+		return nil, fmt.Errorf("state history not found for %x", dl.root)
+	}
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	if dl.stale {
+		return nil, errStaleLayer
+	}
+	// The history reverts the persistent state, make sure nothing is buffered
+	if !dl.buffer.empty() {
+		if err := dl.buffer.flush(dl.db.diskdb, dl.db.freezer, dl.cleans, dl.id, true); err != nil {
+			return nil, err
+		}
+	}
+	batch := dl.db.diskdb.NewBatch()
+	for _, n := range h.nodes {
+		if n.Owner == (common.Hash{}) {
+			if len(n.Prev) == 0 {
+				rawdb.DeleteAccountTrieNode(batch, n.Path)
+			} else {
+				rawdb.WriteAccountTrieNode(batch, n.Path, n.Prev)
+			}
+		} else {
+			if len(n.Prev) == 0 {
+				rawdb.DeleteStorageTrieNode(batch, n.Owner, n.Path)
+			} else {
+				rawdb.WriteStorageTrieNode(batch, n.Owner, n.Path, n.Prev)
+			}
+		}
+		if dl.cleans != nil {
+			dl.cleans.Del(pathCacheKey(n.Owner, n.Path))
+		}
+	}
+	rawdb.DeleteStateID(batch, dl.root)
+	rawdb.WritePersistentStateID(batch, dl.id-1)
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	dl.stale = true
+	return newDiskLayer(h.meta.Parent, dl.id-1, dl.db, dl.cleans, dl.buffer), nil
+}
+
+// size returns the memory used by the write buffer.
+func (dl *diskLayer) size() uint64 {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.buffer.size
+}
+
+// pathCacheKey constructs the clean cache key of a trie node, which is the
+// owner followed by the node path. The owner of the account trie is the zero
+// hash, so the keys of different tries never collide.
+func pathCacheKey(owner common.Hash, path []byte) []byte {
+	return append(owner.Bytes(), path...)
+}
@@ -0,0 +1,297 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/rethereum-blockchain/go-rethereum/common"
+	"github.com/rethereum-blockchain/go-rethereum/core/rawdb"
+	"github.com/rethereum-blockchain/go-rethereum/core/types"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb"
+	"github.com/rethereum-blockchain/go-rethereum/ethdb/memorydb"
+)
+
+// pathTester builds a sequence of states on top of a path-based database,
+// tracking the expected content of each.
+type pathTester struct {
+	diskdb ethdb.Database
+	db     *Database
+	roots  []common.Hash
+	states []map[string][]byte
+}
+
+func newPathTester(t *testing.T, freezer bool, history uint64) *pathTester {
+	var (
+		diskdb ethdb.Database = rawdb.NewMemoryDatabase()
+		err    error
+	)
+	if freezer {
+		diskdb, err = rawdb.NewDatabaseWithFreezer(memorydb.New(), t.TempDir(), "", false)
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+	}
+	return &pathTester{
+		diskdb: diskdb,
+		db:     NewDatabaseWithConfig(diskdb, &Config{PathDB: &PathConfig{StateHistory: history}}),
+		roots:  []common.Hash{types.EmptyRootHash},
+		states: []map[string][]byte{{}},
+	}
+}
+
+// generate applies the given number of random transitions on top of the last
+// state, mutating a few keys and deleting some of the existing ones.
+func (pt *pathTester) generate(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		parent := pt.roots[len(pt.roots)-1]
+		tr, err := New(TrieID(parent), pt.db)
+		if err != nil {
+			t.Fatalf("Failed to open trie %x: %v", parent, err)
+		}
+		state := make(map[string][]byte)
+		for k, v := range pt.states[len(pt.states)-1] {
+			state[k] = v
+		}
+		for j := 0; j < 16; j++ {
+			key, val := randBytes(32), randBytes(rand.Intn(32)+1)
+			tr.MustUpdate(key, val)
+			state[string(key)] = val
+		}
+		var deleted int
+		for k := range state {
+			if deleted == 4 {
+				break
+			}
+			tr.MustDelete([]byte(k))
+			delete(state, k)
+			deleted++
+		}
+		root, nodes := tr.Commit(false)
+		if err := pt.db.Update(root, parent, NewWithNodeSet(nodes)); err != nil {
+			t.Fatalf("Failed to update state %d: %v", len(pt.roots), err)
+		}
+		pt.roots = append(pt.roots, root)
+		pt.states = append(pt.states, state)
+	}
+}
+
+// verify checks that the state with the given index is available and matches
+// the expected content.
+func (pt *pathTester) verify(db *Database, index int) error {
+	tr, err := New(TrieID(pt.roots[index]), db)
+	if err != nil {
+		return err
+	}
+	for k, v := range pt.states[index] {
+		got, err := tr.Get([]byte(k))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, v) {
+			return fmt.Errorf("state %d key %x: value mismatch, have %x, want %x", index, k, got, v)
+		}
+	}
+	it := NewIterator(tr.NodeIterator(nil))
+	var count int
+	for it.Next() {
+		count++
+	}
+	if it.Err != nil {
+		return it.Err
+	}
+	if count != len(pt.states[index]) {
+		return fmt.Errorf("state %d: key count mismatch, have %d, want %d", index, count, len(pt.states[index]))
+	}
+	return nil
+}
+
+func TestPathDBLayers(t *testing.T) {
+	pt := newPathTester(t, false, 0)
+	pt.db.pathdb.maxLayers = 4
+	pt.generate(t, 10)
+
+	// The empty state is always available, skip it
+	for i := 1; i < len(pt.roots); i++ {
+		available := pt.db.GetReader(pt.roots[i]) != nil
+		if want := i >= len(pt.roots)-5; available != want {
+			t.Fatalf("state %d: availability mismatch, have %v, want %v", i, available, want)
+		}
+		if !available {
+			continue
+		}
+		if err := pt.verify(pt.db, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(pt.db.pathdb.layers); n != 5 {
+		t.Fatalf("layer count mismatch: have %d, want %d", n, 5)
+	}
+}
+
+func TestPathDBSideBranch(t *testing.T) {
+	pt := newPathTester(t, false, 0)
+	pt.db.pathdb.maxLayers = 2
+	pt.generate(t, 2)
+
+	// Build a side branch on top of the first state
+	tr, _ := New(TrieID(pt.roots[1]), pt.db)
+	tr.MustUpdate([]byte("side"), []byte("branch"))
+	side, nodes := tr.Commit(false)
+	if err := pt.db.Update(side, pt.roots[1], NewWithNodeSet(nodes)); err != nil {
+		t.Fatalf("Failed to update side branch: %v", err)
+	}
+	// Flatten the first state into the disk layer, the sibling branch must be
+	// relinked to it.
+	pt.generate(t, 1)
+	if root := pt.db.pathdb.diskLayer().root; root != pt.roots[1] {
+		t.Fatalf("disk layer mismatch: have %x, want %x", root, pt.roots[1])
+	}
+	tr, err := New(TrieID(side), pt.db)
+	if err != nil {
+		t.Fatalf("Side branch unavailable: %v", err)
+	}
+	if val, err := tr.Get([]byte("side")); err != nil || string(val) != "branch" {
+		t.Fatalf("Side branch content mismatch: %q %v", val, err)
+	}
+	// Flatten the next state too, the side branch is dropped
+	pt.generate(t, 1)
+	if pt.db.GetReader(side) != nil {
+		t.Fatal("stale side branch still available")
+	}
+}
+
+func TestPathDBCommitReopen(t *testing.T) {
+	pt := newPathTester(t, false, 0)
+	pt.generate(t, 8)
+
+	head := len(pt.roots) - 1
+	if err := pt.db.Commit(pt.roots[head], false); err != nil {
+		t.Fatalf("Failed to commit state: %v", err)
+	}
+	db := NewDatabaseWithConfig(pt.diskdb, &Config{PathDB: &PathConfig{}})
+	if err := pt.verify(db, head); err != nil {
+		t.Fatal(err)
+	}
+	if id := rawdb.ReadPersistentStateID(pt.diskdb); id != uint64(head) {
+		t.Fatalf("persistent state id mismatch: have %d, want %d", id, head)
+	}
+	if db.GetReader(pt.roots[head-1]) != nil {
+		t.Fatal("overwritten state available")
+	}
+}
+
+func TestPathDBRecover(t *testing.T) {
+	pt := newPathTester(t, true, 0)
+	pt.generate(t, 8)
+
+	head := len(pt.roots) - 1
+	if err := pt.db.Commit(pt.roots[head], false); err != nil {
+		t.Fatalf("Failed to commit state: %v", err)
+	}
+	if pt.db.Recoverable(pt.roots[head]) {
+		t.Fatal("persistent state reported recoverable")
+	}
+	if pt.db.Recoverable(common.Hash{0x1}) {
+		t.Fatal("unknown state reported recoverable")
+	}
+	for i := head - 1; i > 0; i -= 3 {
+		if !pt.db.Recoverable(pt.roots[i]) {
+			t.Fatalf("state %d not recoverable", i)
+		}
+		if err := pt.db.Recover(pt.roots[i]); err != nil {
+			t.Fatalf("Failed to recover state %d: %v", i, err)
+		}
+		if err := pt.verify(pt.db, i); err != nil {
+			t.Fatal(err)
+		}
+		if items, _ := pt.db.pathdb.freezer.Ancients(); items != uint64(i) {
+			t.Fatalf("state history count mismatch: have %d, want %d", items, i)
+		}
+		if pt.db.Recoverable(pt.roots[i+1]) {
+			t.Fatalf("reverted state %d reported recoverable", i+1)
+		}
+	}
+	pt.db.Close()
+}
+
+func TestPathDBHistoryLimit(t *testing.T) {
+	pt := newPathTester(t, true, 3)
+	pt.db.pathdb.maxLayers = 1
+	pt.generate(t, 8)
+	defer pt.db.Close()
+
+	disk := len(pt.roots) - 2
+	for i := 0; i < disk; i++ {
+		want := i >= disk-3
+		if have := pt.db.Recoverable(pt.roots[i]); have != want {
+			t.Fatalf("state %d: recoverable mismatch, have %v, want %v", i, have, want)
+		}
+	}
+	if err := pt.db.Recover(pt.roots[disk-4]); err == nil {
+		t.Fatal("recovered state beyond the history limit")
+	}
+	if err := pt.db.Recover(pt.roots[disk-3]); err != nil {
+		t.Fatalf("Failed to recover state: %v", err)
+	}
+	if err := pt.verify(pt.db, disk-3); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPathDBJournal(t *testing.T) {
+	pt := newPathTester(t, true, 0)
+	pt.generate(t, 8)
+
+	// Merge a few transitions into the write buffer, keeping the rest in memory
+	head := len(pt.roots) - 1
+	if err := pt.db.pathdb.cap(pt.roots[head], 4); err != nil {
+		t.Fatalf("Failed to cap layers: %v", err)
+	}
+	if err := pt.db.Journal(pt.roots[head]); err != nil {
+		t.Fatalf("Failed to journal layers: %v", err)
+	}
+	if err := pt.db.Close(); err != nil {
+		t.Fatalf("Failed to close database: %v", err)
+	}
+	db := NewDatabaseWithConfig(pt.diskdb, &Config{PathDB: &PathConfig{}})
+	for i := head - 4; i <= head; i++ {
+		if err := pt.verify(db, i); err != nil {
+			t.Fatalf("state %d: %v", i, err)
+		}
+	}
+	if db.GetReader(pt.roots[head-5]) != nil {
+		t.Fatal("merged state available")
+	}
+	// A journal not belonging to the persistent state must be discarded
+	if err := db.Commit(pt.roots[head-2], false); err != nil {
+		t.Fatalf("Failed to commit state: %v", err)
+	}
+	db.Close()
+
+	db = NewDatabaseWithConfig(pt.diskdb, &Config{PathDB: &PathConfig{}})
+	defer db.Close()
+	if db.GetReader(pt.roots[head]) != nil {
+		t.Fatal("stale journal loaded")
+	}
+	if err := pt.verify(db, head-2); err != nil {
+		t.Fatal(err)
+	}
+}